@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// lookupFlag returns the flag of the app called name, or nil
+func lookupFlag(app *cli.App, name string) cli.Flag {
+	for _, flag := range app.Flags {
+		for _, flagName := range flag.Names() {
+			if flagName == name {
+				return flag
+			}
+		}
+	}
+	return nil
+}
+
+// isCommand reports whether name is a command or command alias of the app
+func isCommand(app *cli.App, name string) bool {
+	for _, command := range app.Commands {
+		if command.HasName(name) {
+			return true
+		}
+	}
+	return name == "help" || name == "h"
+}
+
+// firstPositional returns the index of the first argument that isn't a global flag or
+// the value of one, or len(args) if there is none
+func firstPositional(app *cli.App, args []string) int {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") || arg == "-" {
+			return i
+		}
+		// Skip the value of a flag that takes one, unless given as --flag=value
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if flag := lookupFlag(app, name); flag != nil {
+			if _, isBool := flag.(*cli.BoolFlag); !isBool {
+				i++
+			}
+		}
+	}
+	return len(args)
+}
+
+// expandAlias replaces the first argument after the global flags with the arguments it
+// stands for if it is an alias, so `translate ja2en TEXT` runs as `translate -s ja -t en TEXT`.
+// The alias's flags go first, so flags given on the command line override them.
+func expandAlias(app *cli.App, args []string, aliases map[string][]string) []string {
+	if len(aliases) == 0 || len(args) < 2 {
+		return args
+	}
+	i := 1 + firstPositional(app, args[1:])
+	if i == len(args) || args[i] == "--" || isCommand(app, args[i]) {
+		return args
+	}
+	expansion, ok := aliases[args[i]]
+	if !ok {
+		return args
+	}
+	// An alias may end in a command, which has to stay after the global flags
+	j := firstPositional(app, expansion)
+	if j == len(expansion) && i == len(args)-1 {
+		// A lone word is text to translate, even if it is also an alias
+		return args
+	}
+	expanded := append([]string{args[0]}, expansion[:j]...)
+	expanded = append(expanded, args[1:i]...)
+	expanded = append(expanded, expansion[j:]...)
+	return append(expanded, args[i+1:]...)
+}
+
+// checkAliasName validates the name of a new alias
+func checkAliasName(app *cli.App, name string) error {
+	switch {
+	case name == "" || strings.HasPrefix(name, "-"):
+		return fmt.Errorf("invalid alias name %q", name)
+	case strings.ContainsAny(name, " \t\n"):
+		return fmt.Errorf("alias names can't contain spaces")
+	case isCommand(app, name):
+		return fmt.Errorf("%q is a command", name)
+	}
+	return nil
+}
+
+// quoteArgs joins arguments for display, quoting those with spaces
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			quoted[i] = strconv.Quote(arg)
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// runAliasAdd handles the alias add command
+func runAliasAdd(c *cli.Context) error {
+	args := c.Args().Slice()
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1], args[2:]...)
+	}
+	if len(args) < 2 {
+		return cli.Exit("Usage: translate alias add NAME [--] FLAGS... (e.g., alias add ja2en -- -s ja -t en)", ExitUsage)
+	}
+	name := args[0]
+	if err := checkAliasName(c.App, name); err != nil {
+		return cli.Exit(fmt.Sprintf("Alias error: %s", err), 1)
+	}
+
+	err := updateConfig(c.Context, func(config *Config) error {
+		if config.Aliases == nil {
+			config.Aliases = make(map[string][]string)
+		}
+		config.Aliases[name] = args[1:]
+		return nil
+	})
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Alias error: %s", err), 1)
+	}
+	fmt.Printf("Added alias %s: %s\n", name, quoteArgs(args[1:]))
+	return nil
+}
+
+// runAliasList handles the alias list command
+func runAliasList(c *cli.Context) error {
+	aliases := configFor(c.Context).Aliases
+	if len(aliases) == 0 {
+		fmt.Println("No aliases defined (add one with: translate alias add ja2en -- -s ja -t en)")
+		return nil
+	}
+	names := make([]string, 0, len(aliases))
+	for name := range aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s\t%s\n", name, quoteArgs(aliases[name]))
+	}
+	return nil
+}
+
+// runAliasRemove handles the alias remove command
+func runAliasRemove(c *cli.Context) error {
+	name := c.Args().First()
+	err := updateConfig(c.Context, func(config *Config) error {
+		if _, ok := config.Aliases[name]; !ok {
+			return fmt.Errorf("no alias named %q", name)
+		}
+		delete(config.Aliases, name)
+		return nil
+	})
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Alias error: %s", err), 1)
+	}
+	fmt.Printf("Removed alias %s\n", name)
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// parseTrailingFlags applies command flags that were given after positional arguments
+// (e.g. "translate xml file.xml --xpath ..."), which urfave/cli leaves unparsed,
+// and returns the remaining positional arguments.
+func parseTrailingFlags(c *cli.Context) ([]string, error) {
+	known := make(map[string]cli.Flag)
+	for _, flag := range c.Command.Flags {
+		for _, name := range flag.Names() {
+			known[name] = flag
+		}
+	}
+
+	var positional []string
+	args := c.Args().Slice()
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		flag, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("flag provided but not defined: %s", arg)
+		}
+
+		if _, isBool := flag.(*cli.BoolFlag); isBool {
+			if !hasValue {
+				value = "true"
+			}
+		} else if !hasValue {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			value = args[i]
+		}
+
+		if err := c.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	return positional, nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// How the token is sent to the server
+const (
+	// AuthBearer sends "Authorization: Bearer <token>", which DeepLX expects by default
+	AuthBearer = "bearer"
+	// AuthQuery sends ?token=<token>
+	AuthQuery = "query"
+	// AuthDLHeader sends "Authorization: DeepL-Auth-Key <token>" like the official DeepL API
+	AuthDLHeader = "dl-header"
+)
+
+// checkAuthStyle validates an --auth-style value
+func checkAuthStyle(style string) error {
+	switch style {
+	case AuthBearer, AuthQuery, AuthDLHeader:
+		return nil
+	}
+	return fmt.Errorf("unknown auth style %q (use bearer, query or dl-header)", style)
+}
+
+// setTokenAuth adds the token to a request to a DeepLX server the way authStyle says. With
+// basic auth in the URL the Authorization header is taken, so the token goes in the query.
+func setTokenAuth(req *http.Request, token, authStyle string) {
+	switch {
+	case token == "":
+	case authStyle == AuthQuery || req.URL.User != nil:
+		query := req.URL.Query()
+		query.Set("token", token)
+		req.URL.RawQuery = query.Encode()
+	case authStyle == AuthDLHeader:
+		req.Header.Set("Authorization", "DeepL-Auth-Key "+token)
+	default:
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// applyBasicAuth folds --basic-auth into the userinfo of the server URL, so every request
+// to the server, including the connection check, authenticates with it
+func applyBasicAuth(c *cli.Context) error {
+	serverURL := c.String("url")
+	credentials := c.String("basic-auth")
+	if credentials == "" && !strings.Contains(serverURL, "@") {
+		return nil
+	}
+
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return fmt.Errorf("invalid server URL: %v", err)
+	}
+	if credentials != "" {
+		user, password, ok := strings.Cut(credentials, ":")
+		if !ok || user == "" {
+			return fmt.Errorf("expected user:password")
+		}
+		u.User = url.UserPassword(user, password)
+	}
+	if u.User == nil {
+		return nil
+	}
+
+	password, _ := u.User.Password()
+	redactor.addSecrets(password)
+	return c.Set("url", u.String())
+}
+
+// splitUserinfo separates the basic auth credentials ("user:password") from a server URL
+func splitUserinfo(serverURL string) (string, string) {
+	u, err := url.Parse(serverURL)
+	if err != nil || u.User == nil {
+		return serverURL, ""
+	}
+	credentials := u.User.Username()
+	if password, ok := u.User.Password(); ok {
+		credentials += ":" + password
+	}
+	u.User = nil
+	return u.String(), credentials
+}
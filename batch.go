@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Fields of a batch item read by the batch command; any other field is metadata
+const (
+	batchText       = "text"
+	batchSourceLang = "source_lang"
+	batchTargetLang = "target_lang"
+)
+
+// Fields the batch command adds to each item
+const (
+	batchTranslation = "translation"
+	batchDetected    = "detected_source_lang"
+	batchError       = "error"
+	batchStats       = "stats"
+)
+
+// batchReport summarizes a batch run, echoing each item's metadata so the results can be
+// matched to the caller's own records
+type batchReport struct {
+	Schema     int               `json:"schema"`
+	Total      int               `json:"total"`
+	Translated int               `json:"translated"`
+	Failed     int               `json:"failed"`
+	Items      []batchReportItem `json:"items"`
+}
+
+// batchReportItem is the outcome of one batch item
+type batchReportItem struct {
+	Index      int                    `json:"index"`
+	Metadata   map[string]interface{} `json:"metadata,omitempty"`
+	SourceLang string                 `json:"source_lang,omitempty"`
+	TargetLang string                 `json:"target_lang"`
+	Cached     bool                   `json:"cached,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Stats      *textStats             `json:"stats,omitempty"`
+}
+
+// readBatchItems reads batch items as JSON Lines, or as a manifest holding a JSON array
+// of items, either on its own or under "items"
+func readBatchItems(in io.Reader) ([]map[string]interface{}, error) {
+	dec := json.NewDecoder(bufio.NewReader(in))
+	dec.UseNumber()
+
+	var values []interface{}
+	for n := 1; ; n++ {
+		var value interface{}
+		if err := dec.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid JSON in item %d: %v", n, err)
+		}
+		values = append(values, value)
+	}
+
+	if len(values) == 1 {
+		switch v := values[0].(type) {
+		case []interface{}:
+			values = v
+		case map[string]interface{}:
+			if list, ok := v["items"].([]interface{}); ok && v[batchText] == nil {
+				values = list
+			}
+		}
+	}
+
+	items := make([]map[string]interface{}, len(values))
+	for i, value := range values {
+		item, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("item %d is not a JSON object", i+1)
+		}
+		items[i] = item
+	}
+	return items, nil
+}
+
+// runBatch handles the batch command: it translates the text of each item, from and to
+// the item's own languages if it has them, and writes the items back with the translation
+// added. Other fields are passed through unchanged. Failed items get an error field and
+// don't stop the run.
+func runBatch(c *cli.Context) error {
+	in := io.Reader(os.Stdin)
+	if path := c.Args().First(); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+		}
+		defer file.Close()
+		in = file
+	}
+	items, err := readBatchItems(in)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+
+	out := io.Writer(os.Stdout)
+	if path := c.String("out"); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+		defer file.Close()
+		out = file
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+	width := 0
+	if c.String("out") == "" && isTerminal(os.Stdout) {
+		width = outputWidth()
+	}
+	formatter, err := newBatchFormatter(c.String("output-format"), w, width)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Option error: %s", err), ExitUsage)
+	}
+
+	config := configFor(c.Context)
+	client := sharedClient(c)
+	warnTokenExpiry(client.Token, time.Hour)
+	defaultSource := toDeepLCode(c.String("source"), true)
+	defaultTargets := splitLangList(c.String("target"))
+
+	// Items are written as they are translated, so progress is only shown when they don't
+	// go to the same terminal, or when the table is only written at the end
+	var progress *Progress
+	if c.String("out") != "" || !isTerminal(os.Stdout) || formatter.format == BatchTable {
+		progress = startProgress("Translating items", len(items), c.Bool("debug"))
+		defer progress.Stop()
+	}
+
+	// The last translation error decides the exit status when every item failed
+	var lastErr error
+	report := batchReport{Schema: SchemaVersion, Total: len(items), Items: make([]batchReportItem, len(items))}
+	for i, item := range items {
+		if err := c.Context.Err(); err != nil {
+			return cli.Exit(fmt.Sprintf("Translation error: %s", err), 1)
+		}
+
+		sourceLang := defaultSource
+		if lang, ok := item[batchSourceLang].(string); ok && lang != "" {
+			sourceLang = toDeepLCode(lang, true)
+		}
+		var targetLang string
+		if lang, ok := item[batchTargetLang].(string); ok && lang != "" {
+			targetLang = toDeepLCode(lang, false)
+		} else if len(defaultTargets) == 1 {
+			targetLang = toDeepLCode(defaultTargets[0], false)
+		}
+		targetLang = resolveTargetVariant(targetLang, config.VariantPreferences, false)
+
+		entry := batchReportItem{Index: i + 1, TargetLang: targetLang, Metadata: make(map[string]interface{})}
+		for key, value := range item {
+			if key != batchText && key != batchSourceLang && key != batchTargetLang {
+				entry.Metadata[key] = value
+			}
+		}
+
+		text, _ := item[batchText].(string)
+		switch {
+		case strings.TrimSpace(text) == "":
+			entry.Error = "no text to translate"
+		case targetLang == "":
+			entry.Error = "no target language (set target_lang or a single --target)"
+		default:
+			resp, cached, err := client.Translate(c.Context, text, sourceLang, targetLang)
+			if err != nil {
+				entry.Error = redactSecrets(strings.SplitN(err.Error(), "\n", 2)[0])
+				lastErr = err
+				break
+			}
+			item[batchTranslation] = resp.Data
+			if detected := toDeepLCode(resp.SourceLang, true); detected != "" {
+				item[batchDetected] = detected
+				entry.SourceLang = detected
+			}
+			entry.Cached = cached
+			if c.Bool("stats") {
+				entry.Stats = newTextStats(text, resp.Data)
+				if formatter.format == BatchJSON {
+					item[batchStats] = entry.Stats
+				} else {
+					fmt.Fprintf(os.Stderr, "Stats item %d: %s\n", i+1, entry.Stats)
+				}
+			}
+		}
+
+		if entry.Error != "" {
+			progress.Step(errors.New(entry.Error))
+			item[batchError] = entry.Error
+			report.Failed++
+			if c.Bool("debug") {
+				debugf("Item %d failed: %s\n", i+1, entry.Error)
+			}
+		} else {
+			progress.Step(nil)
+			report.Translated++
+		}
+		report.Items[i] = entry
+
+		if err := formatter.Write(item); err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+		// Flush per item so results can be followed while a long batch runs
+		if err := w.Flush(); err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+	}
+
+	progress.Stop()
+	if err := formatter.Close(); err != nil {
+		return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+	}
+
+	if path := c.String("report"); path != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Report error: %s", err), 1)
+		}
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return cli.Exit(fmt.Sprintf("Report error: %s", err), 1)
+		}
+	}
+
+	if report.Failed > 0 {
+		code := ExitPartial
+		if report.Translated == 0 {
+			code = ExitFailure
+			if lastErr != nil {
+				code = exitCodeFor(lastErr)
+			}
+		}
+		return cli.Exit(fmt.Sprintf("Translation error: %d of %d items failed", report.Failed, report.Total), code)
+	}
+	return nil
+}
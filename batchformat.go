@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats of the batch command's output
+const (
+	// BatchJSON writes the items back with the translation added (default)
+	BatchJSON = "json"
+	// BatchTable writes a two-column table of each text and its translation
+	BatchTable = "table"
+	// BatchTSV writes the text and translation of each item separated by a tab, with a
+	// header row, for importing into spreadsheets
+	BatchTSV = "tsv"
+	// BatchPlain writes only the translations, one item per line
+	BatchPlain = "plain"
+)
+
+// batchFormatter writes batch items in one of the batch formats
+type batchFormatter struct {
+	format string
+	w      io.Writer
+	enc    *json.Encoder
+	// rows are kept for the table, whose columns are sized to fit them all
+	rows [][2]string
+	// width is the width of the table, 0 for no limit
+	width int
+}
+
+// newBatchFormatter returns a formatter writing format to w
+func newBatchFormatter(format string, w io.Writer, width int) (*batchFormatter, error) {
+	f := &batchFormatter{format: format, w: w, width: width}
+	switch format {
+	case "", BatchJSON:
+		f.format = BatchJSON
+		f.enc = json.NewEncoder(w)
+		f.enc.SetEscapeHTML(false)
+	case BatchTSV:
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", batchText, batchTranslation); err != nil {
+			return nil, err
+		}
+	case BatchTable, BatchPlain:
+	default:
+		return nil, fmt.Errorf("unknown output format %q (use json, table, tsv or plain)", format)
+	}
+	return f, nil
+}
+
+// tsvField escapes the tabs, line breaks and backslashes of a TSV field
+func tsvField(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// Write writes an item; failed items have an empty translation
+func (f *batchFormatter) Write(item map[string]interface{}) error {
+	text, _ := item[batchText].(string)
+	translation, _ := item[batchTranslation].(string)
+	var err error
+	switch f.format {
+	case BatchJSON:
+		err = f.enc.Encode(item)
+	case BatchTSV:
+		_, err = fmt.Fprintf(f.w, "%s\t%s\n", tsvField(text), tsvField(translation))
+	case BatchPlain:
+		// Line breaks are kept out so each item stays on its own line
+		_, err = fmt.Fprintln(f.w, strings.ReplaceAll(translation, "\n", " "))
+	case BatchTable:
+		// Tabs would throw the columns out of line
+		f.rows = append(f.rows, [2]string{strings.ReplaceAll(text, "\t", " "), strings.ReplaceAll(translation, "\t", " ")})
+	}
+	return err
+}
+
+// Close writes what was held back until every item was seen: the table
+func (f *batchFormatter) Close() error {
+	if f.format != BatchTable || len(f.rows) == 0 {
+		return nil
+	}
+
+	left, right := displayWidth("Text"), displayWidth("Translation")
+	for _, row := range f.rows {
+		for _, line := range strings.Split(row[0], "\n") {
+			left = max(left, displayWidth(line))
+		}
+		for _, line := range strings.Split(row[1], "\n") {
+			right = max(right, displayWidth(line))
+		}
+	}
+	// Too wide for the terminal: both columns share the width, wrapping their text
+	if f.width > 0 && left+right+3 > f.width {
+		half := max((f.width-3)/2, 10)
+		left, right = min(left, half), max(f.width-3-min(left, half), 10)
+	}
+
+	pad := func(s string, width int) string {
+		return s + strings.Repeat(" ", max(width-displayWidth(s), 0))
+	}
+	var b strings.Builder
+	b.WriteString(pad("Text", left) + " │ Translation\n")
+	b.WriteString(strings.Repeat("─", left) + "─┼─" + strings.Repeat("─", right) + "\n")
+	for _, row := range f.rows {
+		texts := strings.Split(wrapText(row[0], left), "\n")
+		translations := strings.Split(wrapText(row[1], right), "\n")
+		for i := 0; i < max(len(texts), len(translations)); i++ {
+			var text, translation string
+			if i < len(texts) {
+				text = texts[i]
+			}
+			if i < len(translations) {
+				translation = translations[i]
+			}
+			b.WriteString(strings.TrimRight(pad(text, left)+" │ "+translation, " ") + "\n")
+		}
+	}
+	_, err := io.WriteString(f.w, b.String())
+	return err
+}
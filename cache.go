@@ -0,0 +1,103 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory LRU cache of translation responses with a per-entry time to live
+type Cache struct {
+	mu      sync.Mutex
+	maxSize int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+
+	hits   int64
+	misses int64
+}
+
+// cacheEntry is a single cached response
+type cacheEntry struct {
+	key     string
+	resp    TranslationResponse
+	expires time.Time
+}
+
+// NewCache creates a cache holding at most maxSize entries for ttl each (0 means no expiry)
+func NewCache(maxSize int, ttl time.Duration) *Cache {
+	return &Cache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// cacheKey builds the key identifying a translation request
+func cacheKey(text, sourceLang, targetLang string) string {
+	return sourceLang + "\x00" + targetLang + "\x00" + text
+}
+
+// Get returns a copy of the cached response for key, if present and not expired
+func (c *Cache) Get(key string) (*TranslationResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		c.misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	c.hits++
+	resp := entry.resp
+	return &resp, true
+}
+
+// Put stores a response, evicting the least recently used entry when full
+func (c *Cache) Put(key string, resp *TranslationResponse) {
+	if c.maxSize <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.ttl > 0 {
+		expires = time.Now().Add(c.ttl)
+	}
+
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*cacheEntry)
+		entry.resp = *resp
+		entry.expires = expires
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, resp: *resp, expires: expires})
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Stats returns the number of entries, hits and misses
+func (c *Cache) Stats() (size int, hits, misses int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.hits, c.misses
+}
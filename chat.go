@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// chatSide is one side of a conversation
+type chatSide struct {
+	// lang is the DeepL code of the language the side speaks
+	lang string
+	// label is the name its lines are shown with
+	label string
+}
+
+// chatSides resolves the languages of --pair (e.g. en:ja) and the labels of --speakers,
+// which default to the language tags
+func chatSides(c *cli.Context, config Config) ([2]chatSide, error) {
+	var sides [2]chatSide
+	first, second, ok := strings.Cut(c.String("pair"), ":")
+	first, second = strings.TrimSpace(first), strings.TrimSpace(second)
+	if !ok || first == "" || second == "" {
+		return sides, errors.New("--pair takes two languages, e.g. --pair en:ja")
+	}
+	for i, lang := range []string{first, second} {
+		code := resolveTargetVariant(toDeepLCode(lang, false), config.VariantPreferences, c.Bool("choose-variant"))
+		sides[i] = chatSide{lang: code, label: toBCP47(code)}
+	}
+	if baseLanguage(sides[0].lang) == baseLanguage(sides[1].lang) {
+		return sides, fmt.Errorf("--pair needs two different languages, not %s twice", baseLanguage(sides[0].lang))
+	}
+	if speakers := c.String("speakers"); speakers != "" {
+		labels := strings.Split(speakers, ",")
+		if len(labels) != 2 {
+			return sides, errors.New("--speakers takes two names, e.g. --speakers Anna,Kenji")
+		}
+		for i, label := range labels {
+			if label = strings.TrimSpace(label); label != "" {
+				sides[i].label = label
+			}
+		}
+	}
+	return sides, nil
+}
+
+// chatSpeaker returns which side said text, by its language detected offline, and false
+// when it can't be told, in which case the side other than last is guessed
+func chatSpeaker(text string, sides [2]chatSide, last int) (int, bool) {
+	lang := detectLanguage(text)
+	for i, side := range sides {
+		if lang != "" && lang == baseLanguage(side.lang) {
+			return i, true
+		}
+	}
+	return 1 - last, false
+}
+
+// runChat handles the chat command, for a face-to-face conversation between speakers of
+// the two languages of --pair: each line is translated into the language of the other
+// side, which one said it being detected
+func runChat(c *cli.Context) error {
+	config := configFor(c.Context)
+	sides, err := chatSides(c, config)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Chat error: %s", err), ExitUsage)
+	}
+	transcript := NewTranscript()
+	transcriptPath := c.String("transcript")
+
+	client := sharedClient(c)
+	client.Cache = NewCache(1000, 0)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	input := newREPLInput(c, interrupts)
+	if isTerminal(os.Stdin) {
+		hint("Type what either side says; it is translated into the other's language. Ctrl-C cancels a request, Ctrl-D or Ctrl-C at the prompt exits.\n")
+	}
+	prompt := strings.ToLower(toBCP47(sides[0].lang) + "|" + toBCP47(sides[1].lang) + "> ")
+
+	last := 1
+	for {
+		line, err := input.ReadLine(prompt)
+		if err == io.EOF || errors.Is(err, errInterrupted) {
+			return nil
+		}
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Input error: %s", err), 1)
+		}
+		text := strings.TrimSpace(line)
+		if text == "" {
+			continue
+		}
+		input.AddHistory(text)
+
+		speaker, known := chatSpeaker(text, sides, last)
+		sourceLang := ""
+		if known {
+			sourceLang = toDeepLCode(sides[speaker].lang, true)
+		}
+		output, err := translateCancellable(c, client, interrupts, text, sourceLang, []string{sides[1-speaker].lang})
+		// The engine may find the guessed speaker's text was in the other language
+		if err == nil && !known && baseLanguage(output.SourceLang) == baseLanguage(sides[1-speaker].lang) {
+			speaker = 1 - speaker
+			output, err = translateCancellable(c, client, interrupts, text, toDeepLCode(sides[speaker].lang, true), []string{sides[1-speaker].lang})
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Fprintln(os.Stderr, "Cancelled")
+			} else {
+				fmt.Fprintf(os.Stderr, "Translation error: %s\n", redactSecrets(strings.SplitN(err.Error(), "\n", 2)[0]))
+			}
+			continue
+		}
+		last = speaker
+
+		from, to := sides[speaker], sides[1-speaker]
+		fmt.Printf("%s → %s: %s\n", from.label, to.label, output.Translations[0].Text)
+
+		transcript.AddSpoken(from.label, text, output)
+		if transcriptPath != "" {
+			if err := transcript.Save(transcriptPath); err != nil {
+				return cli.Exit(fmt.Sprintf("Transcript error: %s", err), 1)
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Segmenter splits text into sentences; concatenating the segments gives back the text
+type Segmenter interface {
+	Segment(text string) []string
+}
+
+// segmenters holds the segmenters for languages whose sentences aren't delimited like
+// European ones, keyed by base DeepL code; add an entry to support another script
+var segmenters = map[string]Segmenter{
+	"ZH": cjkSegmenter,
+	"JA": cjkSegmenter,
+	"TH": thaiSegmenter{},
+}
+
+// defaultSegmenter ends sentences at . ! ? followed by whitespace
+var defaultSegmenter = &punctuationSegmenter{
+	terminators: ".!?",
+	closers:     `"')]’”»`,
+	needSpace:   true,
+}
+
+// cjkSegmenter ends sentences at full-width punctuation, which isn't followed by spaces
+var cjkSegmenter = &punctuationSegmenter{
+	terminators: "。．！？；!?…",
+	closers:     `」』）】〉》”’"')`,
+}
+
+// punctuationSegmenter ends sentences at terminator characters, keeping closing quotes
+// and brackets and the following whitespace with the sentence. Line breaks always end one.
+type punctuationSegmenter struct {
+	terminators string
+	closers     string
+	// needSpace only ends a sentence when whitespace follows, so "3.5" stays whole
+	needSpace bool
+}
+
+// Segment implements Segmenter
+func (s *punctuationSegmenter) Segment(text string) []string {
+	runes := []rune(text)
+	var segments []string
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		end := -1
+		switch {
+		case runes[i] == '\n':
+			end = i + 1
+		case strings.ContainsRune(s.terminators, runes[i]):
+			end = i + 1
+			for end < len(runes) && (strings.ContainsRune(s.terminators, runes[end]) || strings.ContainsRune(s.closers, runes[end])) {
+				end++
+			}
+			if s.needSpace && end < len(runes) && !unicode.IsSpace(runes[end]) {
+				i = end - 1
+				continue
+			}
+		default:
+			continue
+		}
+		for end < len(runes) && unicode.IsSpace(runes[end]) {
+			end++
+		}
+		segments = append(segments, string(runes[start:end]))
+		start = end
+		i = end - 1
+	}
+	if start < len(runes) {
+		segments = append(segments, string(runes[start:]))
+	}
+	return segments
+}
+
+// thaiSegmenter splits Thai, which has no sentence punctuation and separates sentences
+// and phrases with spaces
+type thaiSegmenter struct{}
+
+// Segment implements Segmenter
+func (thaiSegmenter) Segment(text string) []string {
+	runes := []rune(text)
+	var segments []string
+	start := 0
+	for i := 0; i < len(runes); i++ {
+		if !unicode.IsSpace(runes[i]) {
+			continue
+		}
+		end := i
+		for end < len(runes) && unicode.IsSpace(runes[end]) {
+			end++
+		}
+		segments = append(segments, string(runes[start:end]))
+		start = end
+		i = end - 1
+	}
+	if start < len(runes) {
+		segments = append(segments, string(runes[start:]))
+	}
+	return segments
+}
+
+// breakWords are words a sentence too long for one chunk may be split after or before,
+// for scripts without spaces between words
+type breakWords struct {
+	after  []string
+	before []string
+}
+
+// dictionaryBreaks lists the fallback break words per language
+var dictionaryBreaks = map[string]breakWords{
+	// Particles end a phrase
+	"JA": {after: []string{"から", "まで", "より", "ので", "けど", "ながら", "は", "が", "を", "に", "で", "へ", "も"}},
+	"ZH": {
+		after:  []string{"的", "了"},
+		before: []string{"但是", "因为", "所以", "而且", "并且", "或者", "如果", "虽然", "然后"},
+	},
+	// Conjunctions start a clause
+	"TH": {before: []string{"และ", "แต่", "หรือ", "ซึ่ง", "เพราะ", "ถ้า", "เมื่อ", "โดย"}},
+}
+
+// thaiLeadingVowels are written before the consonant they follow in speech
+const thaiLeadingVowels = "เแโใไ"
+
+// clausePunctuation ends a clause within a sentence
+const clausePunctuation = "、，,;；:："
+
+// textChunk is a piece of the input sent as one request, with the whitespace that
+// followed it in the input
+type textChunk struct {
+	Text string
+	Sep  string
+}
+
+// chunkText splits text longer than limit characters into chunks of at most limit characters,
+// at sentence boundaries where possible. It returns nil if the text doesn't need splitting.
+func chunkText(text, lang string, limit int) []textChunk {
+	if limit <= 0 || utf8.RuneCountInString(text) <= limit {
+		return nil
+	}
+
+	lang = segmentLanguage(lang, text)
+	segmenter, ok := segmenters[lang]
+	if !ok {
+		segmenter = defaultSegmenter
+	}
+
+	var pieces []string
+	for _, segment := range segmenter.Segment(text) {
+		pieces = append(pieces, splitLong(segment, limit, breakFuncs(lang))...)
+	}
+
+	// Pack whole sentences into as few chunks as fit
+	var packed []string
+	current, size := "", 0
+	for _, piece := range pieces {
+		n := utf8.RuneCountInString(strings.TrimRightFunc(piece, unicode.IsSpace))
+		if current != "" && size+n > limit {
+			packed = append(packed, current)
+			current, size = "", 0
+		}
+		current += piece
+		size += utf8.RuneCountInString(piece)
+	}
+	if current != "" {
+		packed = append(packed, current)
+	}
+
+	chunks := make([]textChunk, len(packed))
+	for i, chunk := range packed {
+		trimmed := strings.TrimRightFunc(chunk, unicode.IsSpace)
+		chunks[i] = textChunk{Text: trimmed, Sep: chunk[len(trimmed):]}
+	}
+	return chunks
+}
+
+// segmentLanguage returns the base language whose segmentation rules apply, detecting
+// the script when the source language is automatic
+func segmentLanguage(lang, text string) string {
+	if base := baseLanguage(lang); base != "" && base != "AUTO" {
+		return base
+	}
+	return detectLanguage(text)
+}
+
+// breakFunc reports whether a long sentence may be split before runes[i]
+type breakFunc func(runes []rune, i int) bool
+
+// breakFuncs returns the ways to split a sentence too long for one chunk, best first:
+// after clause punctuation, at dictionary words, then at whitespace
+func breakFuncs(lang string) []breakFunc {
+	funcs := []breakFunc{
+		func(runes []rune, i int) bool {
+			j := lastNonSpace(runes, i)
+			return j >= 0 && strings.ContainsRune(clausePunctuation, runes[j])
+		},
+	}
+	if words, ok := dictionaryBreaks[lang]; ok {
+		funcs = append(funcs, func(runes []rune, i int) bool {
+			head, tail := string(runes[:lastNonSpace(runes, i)+1]), string(runes[i:])
+			for _, word := range words.after {
+				if strings.HasSuffix(head, word) {
+					return true
+				}
+			}
+			// A Thai leading vowel belongs to the word that follows it
+			if strings.ContainsRune(thaiLeadingVowels, runes[i-1]) {
+				return false
+			}
+			for _, word := range words.before {
+				if strings.HasPrefix(tail, word) {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	funcs = append(funcs, func(runes []rune, i int) bool {
+		return unicode.IsSpace(runes[i-1])
+	})
+	return funcs
+}
+
+// lastNonSpace returns the index of the last non-space rune before i
+func lastNonSpace(runes []rune, i int) int {
+	j := i - 1
+	for j >= 0 && unicode.IsSpace(runes[j]) {
+		j--
+	}
+	return j
+}
+
+// splitLong splits a sentence longer than limit characters at the last allowed break
+// within the limit, trying each break function in turn and cutting hard as a last resort.
+// Whitespace stays with the piece before a break.
+func splitLong(text string, limit int, breaks []breakFunc) []string {
+	runes := []rune(text)
+	var pieces []string
+	for utf8.RuneCountInString(strings.TrimRightFunc(string(runes), unicode.IsSpace)) > limit {
+		// A hard cut mustn't separate a combining mark, such as a Thai tone mark, from its letter
+		cut := limit
+		for cut > 1 && unicode.Is(unicode.Mn, runes[cut]) {
+			cut--
+		}
+	search:
+		for _, isBreak := range breaks {
+			for i := limit; i > 0; i-- {
+				if !unicode.IsSpace(runes[i]) && isBreak(runes, i) {
+					cut = i
+					break search
+				}
+			}
+		}
+		pieces = append(pieces, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	if len(runes) > 0 {
+		pieces = append(pieces, string(runes))
+	}
+	return pieces
+}
+
+// noSpaceLanguages don't put spaces between sentences
+var noSpaceLanguages = map[string]bool{"ZH": true, "JA": true}
+
+// joinChunks joins translated chunks with the whitespace that separated them in the
+// input, adding a space between sentences where the source had none but the target needs one
+func joinChunks(translated []string, chunks []textChunk, targetLang string) string {
+	var b strings.Builder
+	for i, text := range translated {
+		b.WriteString(text)
+		sep := chunks[i].Sep
+		if sep == "" && i < len(translated)-1 && !noSpaceLanguages[baseLanguage(targetLang)] {
+			sep = " "
+		}
+		b.WriteString(sep)
+	}
+	return b.String()
+}
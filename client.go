@@ -0,0 +1,809 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Client sends translation requests to one or more servers of a provider,
+// adding caching, retries, failover between servers and rate limiting
+type Client struct {
+	// Provider is the engine the servers run; DeepLX if nil
+	Provider Provider
+	Servers  []string
+	Token    string
+	Timeout  time.Duration
+	Retries  int
+	Cache    *Cache
+	Limiter  *RateLimiter
+	Debug    bool
+
+	// NoVariantFallback disables retrying with the base language when a regional variant is rejected
+	NoVariantFallback bool
+	// HTTPClient is shared between requests to keep connections alive; a new one is used per request if nil
+	HTTPClient *http.Client
+	// SkipPreflight skips the reachability check normally made before every request
+	SkipPreflight bool
+	// skipped counts the texts passed through by SkipTranslated
+	skipped int64
+	// OnAttempt is called with the server about to be sent each request, e.g. to update a spinner
+	OnAttempt func(server string)
+	// Headers are added to every request, e.g. for gateways that require API keys
+	Headers http.Header
+	// AuthStyle is how the token is sent (AuthBearer, AuthQuery or AuthDLHeader)
+	AuthStyle string
+	// Mixed translates passages in different languages separately, each from the language
+	// detected for it, when the source language is automatic
+	Mixed bool
+	// KeepTargetRuns leaves passages already in the target language unchanged with Mixed
+	KeepTargetRuns bool
+	// SkipTranslated returns texts detected as already in the target language unchanged,
+	// without a request
+	SkipTranslated bool
+	// ChunkSize splits longer texts at sentence boundaries into requests of at most
+	// this many characters; 0 sends texts whole
+	ChunkSize int
+	// Session makes DeepLX requests go to the pro endpoint with this DeepL Pro session
+	Session *Session
+	// Failures remembers servers that are down or refused the token, to fail fast on them
+	Failures *FailureCache
+	// Tokens rotates requests over several tokens instead of always sending Token
+	Tokens *TokenPool
+	// Budget warns or stops when the characters sent would exceed a daily or monthly budget
+	Budget *Budget
+	// Metrics records the outcome, duration and retries of requests for export
+	Metrics *Metrics
+	// Glossary holds terms to translate as configured, whatever the provider
+	Glossary *GlossarySet
+	// History keeps the translations made, for history export and stats
+	History *History
+	// StrictPlaceholders fails translations that lose placeholders, tags or bracket pairs
+	// of their text, which are otherwise warned about
+	StrictPlaceholders bool
+	// PlaceholderRetries is how many times such translations are requested again first
+	PlaceholderRetries int
+	// DecodeEntities decodes the HTML entities of texts before they are sent, unless they
+	// are markup
+	DecodeEntities bool
+	// EncodeEntities encodes the characters special to HTML in translations, and those
+	// that were entities in the text as they were written there, unless they are markup
+	EncodeEntities bool
+	// Normalize is the Unicode normalization form texts are put in before they are sent
+	// (NormalizeNFC, NormalizeNFKC), or "" or NormalizeNone to send them as they are
+	Normalize string
+	// NormalizeOutput puts translations in the Normalize form too
+	NormalizeOutput bool
+	// PreTranslate is a shell command texts are passed through before they are sent
+	PreTranslate string
+	// PostTranslate is a shell command translations are passed through
+	PostTranslate string
+}
+
+// clientOverrides are the settings of a Client that a command takes from elsewhere than
+// the global flags. Zero fields leave the flags' settings.
+type clientOverrides struct {
+	// Provider replaces --provider, with Servers and Token as its server and token. The
+	// flags' token, tokens, session, headers and auth style belong to another server and
+	// aren't used.
+	Provider string
+	// Servers replaces --url
+	Servers []string
+	Token   string
+	// Retries, Cache and Limiter are for commands that serve many requests
+	Retries int
+	Cache   *Cache
+	Limiter *RateLimiter
+	// Headers are sent as well as those of --header, instead of any with the same name
+	Headers http.Header
+	// KeepAlive keeps connections to the servers alive between requests, which are
+	// checked by their own failures rather than a reachability check before each one
+	KeepAlive bool
+	// Relay forwards texts to a DeepLX server as they arrive, for the daemon: its clients
+	// process, count and record them themselves
+	Relay bool
+}
+
+// newClient builds a Client for a single server from the global command-line flags,
+// routed through the daemon when one is running for the same server
+func newClient(c *cli.Context) *Client {
+	// Invalid headers and providers are rejected before any command runs
+	client, _ := newClientWith(c, clientOverrides{})
+	return client
+}
+
+// newClientWith builds a Client from the global command-line flags with the settings of
+// overrides. Commands that don't override the servers go through the daemon when one
+// is running for the same server.
+func newClientWith(c *cli.Context, overrides clientOverrides) (*Client, error) {
+	providerName := c.String("provider")
+	if overrides.Provider != "" {
+		providerName = overrides.Provider
+	}
+	if overrides.Relay || providerName == "" {
+		providerName = ProviderDeepLX
+	}
+	provider, err := lookupProvider(providerName)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := customHeaders(c)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range overrides.Headers {
+		headers[name] = values
+	}
+	timeout := time.Duration(c.Int("timeout")) * time.Second
+
+	client := &Client{
+		Provider:          provider,
+		Servers:           []string{c.String("url")},
+		Token:             c.String("token"),
+		Timeout:           timeout,
+		Retries:           overrides.Retries,
+		Cache:             overrides.Cache,
+		Limiter:           overrides.Limiter,
+		Debug:             c.Bool("debug"),
+		NoVariantFallback: c.Bool("no-variant-fallback"),
+		Headers:           headers,
+		AuthStyle:         c.String("auth-style"),
+		Session:           sessionFromFlags(c),
+		Failures:          NewFailureCache(c.Duration("failure-ttl")),
+		Tokens:            tokenPoolFromFlags(c),
+		Metrics:           metricsFrom(c.Context),
+	}
+	if overrides.Servers != nil {
+		client.Servers = overrides.Servers
+	}
+	if overrides.Provider != "" {
+		client.Token = overrides.Token
+		client.Tokens, client.Session = nil, nil
+		client.Headers, client.AuthStyle = overrides.Headers, ""
+	}
+	if overrides.Relay {
+		// The daemon is never sent requests that need a session or token rotation
+		client.Tokens, client.Session = nil, nil
+	}
+	if client.Tokens != nil {
+		client.Token = client.Tokens.First()
+	}
+	if overrides.KeepAlive {
+		client.HTTPClient = &http.Client{Timeout: timeout}
+		client.SkipPreflight = true
+	}
+	if overrides.Relay {
+		return client, nil
+	}
+
+	client.ChunkSize = c.Int("chunk-size")
+	client.Mixed = c.Bool("mixed")
+	client.KeepTargetRuns = c.Bool("keep-target-runs")
+	client.SkipTranslated = c.Bool("skip-translated")
+	client.Glossary = glossaryFromFlags(c)
+	client.StrictPlaceholders = c.Bool("strict-placeholders")
+	client.PlaceholderRetries = c.Int("placeholder-retries")
+	client.DecodeEntities = c.Bool("decode-entities")
+	client.EncodeEntities = c.Bool("encode-entities")
+	client.Normalize = c.String("normalize")
+	client.NormalizeOutput = c.Bool("normalize-output")
+	client.PreTranslate = c.String("pre-translate")
+	client.PostTranslate = c.String("post-translate")
+	if providerName == ProviderPseudo {
+		// Pseudo-localization sends nothing, so there is no server, budget or history
+		client.Servers, client.SkipPreflight, client.Failures = []string{""}, true, nil
+		return client, nil
+	}
+	client.Budget = budgetFromFlags(c)
+	client.History = historyFromFlags(c)
+
+	// The daemon speaks DeepLX to its upstream. A HAR capture should show the traffic
+	// to the server, not to the daemon.
+	// The daemon doesn't forward sessions or rotate tokens
+	if providerName == ProviderDeepLX && overrides.Servers == nil && client.Session == nil && client.Tokens == nil &&
+		!c.Bool("no-daemon") && c.String("debug-har") == "" {
+		useDaemon(client)
+	}
+	return client, nil
+}
+
+// Translate translates text, trying each server in turn and retrying transient failures.
+// The returned bool reports whether the response came from the cache. Translations that
+// lose placeholders, tags or bracket pairs of text are requested again up to
+// PlaceholderRetries times, then warned about or, with StrictPlaceholders, failed. The
+// PreTranslate and PostTranslate hooks see the text and translation as given and returned.
+func (cl *Client) Translate(ctx context.Context, text, sourceLang, targetLang string) (*TranslationResponse, bool, error) {
+	if cl.PreTranslate != "" {
+		var err error
+		if text, err = runHook(ctx, "pre_translate", cl.PreTranslate, text, sourceLang, targetLang, cl.Debug); err != nil {
+			return nil, false, err
+		}
+	}
+	// Entities are part of markup, which the engine handles itself
+	markup := translateOptions(ctx).TagHandling != ""
+	var entities map[rune]string
+	if cl.DecodeEntities && !markup {
+		text, entities = decodeEntities(text)
+	}
+	text = normalizeText(text, cl.Normalize)
+
+	resp, cached, err := cl.translateOnce(ctx, text, sourceLang, targetLang)
+	for attempt := 0; err == nil; attempt++ {
+		problems := translationProblems(text, resp.Data)
+		if len(problems) == 0 {
+			break
+		}
+		placeholderErr := &PlaceholderError{Text: text, Problems: problems}
+		if attempt < cl.PlaceholderRetries {
+			if cl.Debug {
+				debugf("Retrying the %s\n", placeholderErr)
+			}
+			resp, cached, err = cl.translateOnce(withFresh(ctx), text, sourceLang, targetLang)
+			continue
+		}
+		if cl.StrictPlaceholders {
+			return nil, false, placeholderErr
+		}
+		warnf("%s", placeholderErr)
+		break
+	}
+	if err == nil && (cl.EncodeEntities && !markup || cl.NormalizeOutput) {
+		finish := func(translation string) string {
+			if cl.NormalizeOutput {
+				translation = normalizeText(translation, cl.Normalize)
+			}
+			if cl.EncodeEntities && !markup {
+				translation = encodeEntities(translation, entities)
+			}
+			return translation
+		}
+		// The response may be shared with the cache
+		finished := *resp
+		finished.Data = finish(resp.Data)
+		finished.Alternatives = nil
+		for _, alternative := range resp.Alternatives {
+			finished.Alternatives = append(finished.Alternatives, finish(alternative))
+		}
+		resp = &finished
+	}
+	if err == nil && cl.PostTranslate != "" {
+		translation, err := runHook(ctx, "post_translate", cl.PostTranslate, resp.Data, resp.SourceLang, targetLang, cl.Debug)
+		if err != nil {
+			return nil, false, err
+		}
+		finished := *resp
+		finished.Data = translation
+		resp = &finished
+	}
+	return resp, cached, err
+}
+
+// translateOnce implements Translate, making one translation of text
+func (cl *Client) translateOnce(ctx context.Context, text, sourceLang, targetLang string) (*TranslationResponse, bool, error) {
+	ctx, span := startSpan(ctx, "translate", spanKindInternal)
+	defer span.End()
+	span.SetAttr("translate.source_lang", sourceLang)
+	span.SetAttr("translate.target_lang", targetLang)
+	span.SetAttr("translate.text_length", len(text))
+
+	if cl.SkipTranslated && detectLanguage(text) == baseLanguage(targetLang) {
+		atomic.AddInt64(&cl.skipped, 1)
+		span.SetAttr("translate.skipped", true)
+		if cl.Debug {
+			debugf("Skipping text already in %s\n", baseLanguage(targetLang))
+		}
+		return &TranslationResponse{Code: 200, Data: text, SourceLang: baseLanguage(targetLang), TargetLang: targetLang}, false, nil
+	}
+
+	start, original := time.Now(), text
+	call := &historyCall{}
+	if cl.History != nil {
+		ctx = context.WithValue(ctx, historyCallContextKey{}, call)
+	}
+
+	text, masked := cl.Glossary.mask(text, targetLang)
+	if len(masked) > 0 {
+		span.SetAttr("translate.glossary_terms", len(masked))
+	}
+
+	var resp *TranslationResponse
+	var cached bool
+	var err error
+	// Markup can't be split into passages without separating tags from their ends
+	var runs []languageRun
+	if translateOptions(ctx).TagHandling == "" {
+		runs = cl.languageRuns(text, sourceLang)
+	}
+	if len(runs) > 1 {
+		span.SetAttr("translate.language_runs", len(runs))
+		resp, cached, err = cl.translateRuns(ctx, span, runs, targetLang)
+	} else {
+		resp, cached, err = cl.translateText(ctx, span, text, sourceLang, targetLang)
+	}
+	if err == nil && len(masked) > 0 {
+		// The response may be shared with the cache
+		restored := *resp
+		restored.Data = cl.Glossary.restore(resp.Data, masked, cl.Debug)
+		restored.Alternatives = nil
+		for _, alternative := range resp.Alternatives {
+			alternative, _ = unmask(alternative, masked)
+			restored.Alternatives = append(restored.Alternatives, alternative)
+		}
+		resp = &restored
+	}
+	if opts := translateOptions(ctx); err == nil && opts.Alternatives > 0 && len(resp.Alternatives) > opts.Alternatives {
+		limited := *resp
+		limited.Alternatives = opts.limitAlternatives(resp.Alternatives)
+		resp = &limited
+	}
+	if err == nil && cl.History != nil {
+		source := toDeepLCode(resp.SourceLang, true)
+		if source == "" {
+			source = sourceLang
+		}
+		cl.History.record(HistoryEntry{
+			Time:        start,
+			SourceLang:  source,
+			TargetLang:  targetLang,
+			Provider:    cl.providerName(),
+			Server:      call.server,
+			Text:        original,
+			Translation: resp.Data,
+			Characters:  utf8.RuneCountInString(original),
+			Cached:      cached,
+			DurationMS:  time.Since(start).Milliseconds(),
+			RequestID:   requestID(ctx),
+		})
+	}
+	span.SetAttr("translate.cache_hit", cached)
+	span.SetError(err)
+	return resp, cached, err
+}
+
+// Skipped returns how many texts SkipTranslated passed through without a request
+func (cl *Client) Skipped() int64 {
+	return atomic.LoadInt64(&cl.skipped)
+}
+
+// reportSkipped tells the user how many texts --skip-translated passed through
+func reportSkipped(client *Client, targetLang string) {
+	n := client.Skipped()
+	if n == 0 {
+		return
+	}
+	noun := "texts"
+	if n == 1 {
+		noun = "text"
+	}
+	hint("Skipped %d %s already in %s\n", n, noun, baseLanguage(targetLang))
+}
+
+// translateText translates text whole or, if it is longer than ChunkSize, in chunks.
+// Markup is always sent whole, since splitting it could separate tags from their ends.
+func (cl *Client) translateText(ctx context.Context, span *Span, text, sourceLang, targetLang string) (*TranslationResponse, bool, error) {
+	if translateOptions(ctx).TagHandling != "" {
+		return cl.translate(ctx, span, text, sourceLang, targetLang)
+	}
+	if chunks := chunkText(text, sourceLang, cl.ChunkSize); chunks != nil {
+		span.SetAttr("translate.chunks", len(chunks))
+		return cl.translateChunks(ctx, span, chunks, sourceLang, targetLang)
+	}
+	return cl.translate(ctx, span, text, sourceLang, targetLang)
+}
+
+// languageRuns splits text into passages by language when Mixed is set and the source
+// language is automatic
+func (cl *Client) languageRuns(text, sourceLang string) []languageRun {
+	if !cl.Mixed || !strings.EqualFold(sourceLang, "auto") {
+		return nil
+	}
+	runs := splitLanguageRuns(text)
+	if cl.Debug && len(runs) > 1 {
+		described := make([]string, len(runs))
+		for i, run := range runs {
+			lang := run.Lang
+			if lang == "" {
+				lang = "?"
+			}
+			described[i] = fmt.Sprintf("%s (%d characters)", lang, utf8.RuneCountInString(run.Text))
+		}
+		debugf("Language runs: %s\n", strings.Join(described, ", "))
+	}
+	return runs
+}
+
+// translateRuns translates each passage from its own language and joins the results.
+// The reported source language is that of the longest passage translated.
+func (cl *Client) translateRuns(ctx context.Context, span *Span, runs []languageRun, targetLang string) (*TranslationResponse, bool, error) {
+	targetBase := baseLanguage(targetLang)
+	result := &TranslationResponse{Code: 200, SourceLang: targetBase, TargetLang: targetLang}
+	allCached := true
+	longest := -1
+	translated := make([]string, len(runs))
+	chunks := make([]textChunk, len(runs))
+	for i, run := range runs {
+		chunks[i] = run.textChunk
+		if run.Text == "" || cl.KeepTargetRuns && run.Lang == targetBase {
+			translated[i] = run.Text
+			continue
+		}
+
+		sourceLang := run.Lang
+		if sourceLang == "" {
+			sourceLang = "AUTO"
+		}
+		resp, cached, err := cl.translateText(ctx, span, run.Text, sourceLang, targetLang)
+		if err != nil {
+			return nil, false, err
+		}
+		allCached = allCached && cached
+		translated[i] = resp.Data
+		if n := utf8.RuneCountInString(run.Text); n > longest {
+			longest = n
+			result.SourceLang = resp.SourceLang
+			result.Method = resp.Method
+			result.ID = resp.ID
+		}
+	}
+	result.Data = joinChunks(translated, chunks, targetLang)
+	return result, allCached, nil
+}
+
+// translateChunks translates the chunks of a long text one by one and joins the results.
+// Alternatives only exist for whole texts, so none are returned.
+func (cl *Client) translateChunks(ctx context.Context, span *Span, chunks []textChunk, sourceLang, targetLang string) (*TranslationResponse, bool, error) {
+	var result *TranslationResponse
+	allCached := true
+	translated := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		if chunk.Text == "" {
+			continue
+		}
+		if cl.Debug {
+			debugf("Translating chunk %d/%d (%d characters)\n", i+1, len(chunks), utf8.RuneCountInString(chunk.Text))
+		}
+		resp, cached, err := cl.translate(ctx, span, chunk.Text, sourceLang, targetLang)
+		if err != nil {
+			return nil, false, fmt.Errorf("chunk %d/%d: %v", i+1, len(chunks), err)
+		}
+		allCached = allCached && cached
+		translated[i] = resp.Data
+		if result == nil {
+			copied := *resp
+			result = &copied
+			// Keep the language detected in the first chunk for the rest
+			if strings.EqualFold(sourceLang, "auto") && resp.SourceLang != "" {
+				sourceLang = resp.SourceLang
+			}
+		}
+	}
+	if result == nil {
+		return nil, false, fmt.Errorf("nothing to translate")
+	}
+	result.Data = joinChunks(translated, chunks, targetLang)
+	result.Alternatives = nil
+	return result, allCached, nil
+}
+
+// translate implements Translate, recording retries and failovers on span and the outcome
+// of the request in the metrics
+func (cl *Client) translate(ctx context.Context, span *Span, text, sourceLang, targetLang string) (result *TranslationResponse, cached bool, err error) {
+	start := time.Now()
+	server, retries := "", 0
+	span.SetAttr("translate.provider", cl.providerName())
+	defer func() {
+		span.SetAttr("translate.retries", retries)
+		cl.Metrics.recordRequest(cl.providerName(), server, utf8.RuneCountInString(text), retries, time.Since(start), cached, err)
+		if call := historyCallFrom(ctx); call != nil && err == nil && server != "" {
+			call.server = server
+		}
+	}()
+
+	key := cacheKey(text, sourceLang, targetLang)
+	if opts := translateOptions(ctx).key(); opts != "" {
+		key += "\x00" + opts
+	}
+	if cl.Cache != nil && !isFresh(ctx) {
+		if resp, ok := cl.Cache.Get(key); ok {
+			return resp, true, nil
+		}
+	}
+
+	if len(cl.Servers) == 0 {
+		return nil, false, fmt.Errorf("no server configured")
+	}
+	if err := cl.Budget.Allow(utf8.RuneCountInString(text)); err != nil {
+		return nil, false, err
+	}
+
+	var lastErr error
+	for _, server = range cl.Servers {
+		if err := cl.Failures.Check(server, cl.Token); err != nil {
+			if cl.Debug {
+				debugf("Skipping %s, which failed recently\n", server)
+			}
+			lastErr = err
+			continue
+		}
+
+		for attempt := 0; attempt <= cl.Retries; attempt++ {
+			if attempt > 0 {
+				// Exponential backoff: 500ms, 1s, 2s, ...
+				backoff := time.Duration(500<<uint(attempt-1)) * time.Millisecond
+				if cl.Debug {
+					debugf("Retrying %s in %s (attempt %d/%d)\n", server, backoff, attempt, cl.Retries)
+				}
+				span.AddEvent("retry", map[string]interface{}{"server": server, "attempt": attempt, "backoff_ms": int(backoff.Milliseconds())})
+				retries++
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return nil, false, ctx.Err()
+				}
+			}
+
+			if cl.Limiter != nil {
+				if err := cl.Limiter.Wait(ctx); err != nil {
+					return nil, false, err
+				}
+			}
+
+			resp, err := cl.translateWithFallback(ctx, server, text, sourceLang, targetLang)
+			if err == nil {
+				cl.Failures.Clear(server)
+				// The daemon counts the requests it forwards itself
+				if server != daemonBaseURL && cl.providerName() != ProviderPseudo {
+					recordUsage(cl.providerName(), server, utf8.RuneCountInString(text))
+				}
+				if cl.Cache != nil {
+					cl.Cache.Put(key, resp)
+				}
+				return resp, false, nil
+			}
+
+			lastErr = err
+			if !isRetryable(err) {
+				cl.Failures.Record(server, cl.Token, err)
+				return nil, false, err
+			}
+		}
+		// A cancelled request says nothing about the server
+		if ctx.Err() == nil {
+			cl.Failures.Record(server, cl.Token, lastErr)
+		}
+
+		if len(cl.Servers) > 1 {
+			if cl.Debug {
+				debugf("Server %s failed, failing over: %s\n", server, strings.SplitN(lastErr.Error(), "\n", 2)[0])
+			}
+			span.AddEvent("failover", map[string]interface{}{"server": server, "error": strings.SplitN(lastErr.Error(), "\n", 2)[0]})
+		}
+	}
+
+	return nil, false, lastErr
+}
+
+// FetchAlternatives retries a translation against each of the given endpoint paths on every
+// server until one of them returns alternatives. Failures are only reported in debug mode.
+func (cl *Client) FetchAlternatives(ctx context.Context, text, sourceLang, targetLang string, endpoints []string) []string {
+	for _, server := range cl.Servers {
+		for _, endpoint := range endpoints {
+			if !strings.HasPrefix(endpoint, "/") {
+				endpoint = "/" + endpoint
+			}
+
+			resp, err := cl.send(ctx, server, endpoint, text, sourceLang, targetLang)
+			if err != nil {
+				if cl.Debug {
+					debugf("No alternatives from %s%s: %s\n", server, endpoint, strings.SplitN(err.Error(), "\n", 2)[0])
+				}
+				continue
+			}
+			if len(resp.Alternatives) > 0 {
+				return translateOptions(ctx).limitAlternatives(resp.Alternatives)
+			}
+		}
+	}
+	return nil
+}
+
+// Detect asks the provider for the language of text, trying each server in turn
+func (cl *Client) Detect(ctx context.Context, text string) (string, error) {
+	ctx, span := startSpan(ctx, "detect", spanKindInternal)
+	defer span.End()
+
+	err := fmt.Errorf("no server configured")
+	for _, server := range cl.Servers {
+		var conn ProviderConn
+		if conn, err = cl.conn(server, span); err != nil {
+			continue
+		}
+		var lang string
+		if lang, err = cl.provider().Detect(ctx, conn, text); err == nil {
+			span.SetAttr("translate.source_lang", lang)
+			return lang, nil
+		}
+	}
+	span.SetError(err)
+	return "", err
+}
+
+// Languages returns the target languages the provider supports on the first server that answers
+func (cl *Client) Languages(ctx context.Context) ([]string, error) {
+	err := fmt.Errorf("no server configured")
+	for _, server := range cl.Servers {
+		var conn ProviderConn
+		if conn, err = cl.conn(server, nil); err != nil {
+			continue
+		}
+		var langs []string
+		if langs, err = cl.provider().Languages(ctx, conn); err == nil {
+			return langs, nil
+		}
+	}
+	return nil, err
+}
+
+// provider returns the provider to send requests with
+func (cl *Client) provider() Provider {
+	if cl.Provider == nil {
+		return deepLXProvider{}
+	}
+	return cl.Provider
+}
+
+// conn returns how to reach a server, checking first that it is reachable unless
+// SkipPreflight is set or there is no server, as for most plugins. Requests are traced
+// on span if it isn't nil.
+func (cl *Client) conn(server string, span *Span) (ProviderConn, error) {
+	httpClient := cl.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: cl.Timeout}
+	}
+	httpClient = withHeaders(httpClient, cl.Headers)
+
+	if !cl.SkipPreflight && server != "" {
+		if err := pingServer(httpClient, server); err != nil {
+			return ProviderConn{}, err
+		}
+	}
+	return ProviderConn{
+		HTTPClient: tracedHTTPClient(httpClient, span),
+		Server:     server,
+		Token:      cl.Token,
+		AuthStyle:  cl.AuthStyle,
+		Debug:      cl.Debug,
+		Session:    cl.Session,
+	}, nil
+}
+
+// translateWithFallback sends one request, retrying with the base language if the server
+// rejects a regional variant such as EN-GB that it doesn't support
+func (cl *Client) translateWithFallback(ctx context.Context, server, text, sourceLang, targetLang string) (*TranslationResponse, error) {
+	resp, err := cl.send(ctx, server, "", text, sourceLang, targetLang)
+	if err == nil || cl.NoVariantFallback || !isVariantRejection(err) {
+		return resp, err
+	}
+
+	base := strings.SplitN(targetLang, "-", 2)[0]
+	if base == targetLang {
+		return nil, err
+	}
+
+	warnf("%s", redactSecrets(fmt.Sprintf("%s does not support target %s, falling back to %s", server, targetLang, base)))
+	return cl.send(ctx, server, "", text, sourceLang, base)
+}
+
+// send makes a single request to one endpoint of a server, or to the provider's
+// translation endpoint if endpoint is ""
+func (cl *Client) send(ctx context.Context, server, endpoint, text, sourceLang, targetLang string) (*TranslationResponse, error) {
+	name := endpoint
+	if name == "" {
+		name = "/translate"
+	}
+	_, span := startSpan(ctx, "POST "+name, spanKindClient)
+	defer span.End()
+	span.SetAttr("translate.target_lang", targetLang)
+
+	conn, err := cl.conn(server, span)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	if cl.OnAttempt != nil {
+		cl.OnAttempt(server)
+	}
+	for {
+		index := -1
+		if cl.Tokens != nil {
+			conn.Token, index = cl.Tokens.pick()
+		}
+		resp, err := cl.provider().Translate(ctx, conn, endpoint, text, sourceLang, targetLang)
+		if index < 0 || err == nil {
+			span.SetError(err)
+			return resp, err
+		}
+
+		// A rate limited or exhausted token rests while the others carry on
+		rest := tokenRestTime(err)
+		if rest == 0 || !cl.Tokens.rest(index, rest) {
+			span.SetError(err)
+			return resp, err
+		}
+		if cl.Debug {
+			debugf("Token %d refused (%s), rotating to the next\n", index+1, strings.SplitN(err.Error(), "\n", 2)[0])
+		}
+		span.AddEvent("token_rotation", map[string]interface{}{"token": index + 1, "error": strings.SplitN(err.Error(), "\n", 2)[0]})
+	}
+}
+
+// isVariantRejection reports whether an error looks like the server refusing the requested language
+func isVariantRejection(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusBadRequest || statusErr.StatusCode == http.StatusUnprocessableEntity
+	}
+	return strings.Contains(err.Error(), "translation failed with code 400")
+}
+
+// isRetryable reports whether a translation error is transient and worth retrying or failing over
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+
+	msg := err.Error()
+	return strings.Contains(msg, "cannot connect to DeepLX server") ||
+		strings.Contains(msg, "server not reachable") ||
+		strings.Contains(msg, "failed to send request") ||
+		strings.Contains(msg, "failed to read response")
+}
+
+// RateLimiter spaces out requests so that at most a fixed number are started per second
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter creates a limiter allowing perSecond requests per second (nil if perSecond <= 0)
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until the next request may be sent
+func (r *RateLimiter) Wait(ctx context.Context) error {
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		r.next = now
+	}
+	wait := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
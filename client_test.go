@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestNewClientWith(t *testing.T) {
+	useTempConfig(t)
+	flags := []string{
+		"--url", "http://flags", "--token", "flag-token", "--header", "X-Key: flag",
+		"--auth-style", AuthQuery, "--normalize", NormalizeNFC, "--pre-translate", "cat", "--no-daemon",
+	}
+
+	tests := []struct {
+		name      string
+		provider  string
+		overrides clientOverrides
+		wantErr   bool
+		check     func(t *testing.T, client *Client)
+	}{
+		{
+			name: "flags",
+			check: func(t *testing.T, client *Client) {
+				if client.Servers[0] != "http://flags" || client.Token != "flag-token" || client.AuthStyle != AuthQuery {
+					t.Errorf("server %v, token %q, auth style %q", client.Servers, client.Token, client.AuthStyle)
+				}
+				if client.Headers.Get("X-Key") != "flag" || client.Failures == nil || client.SkipPreflight {
+					t.Errorf("headers %v, failures %v, skip preflight %v", client.Headers, client.Failures, client.SkipPreflight)
+				}
+			},
+		},
+		{
+			name:      "serving",
+			overrides: clientOverrides{Servers: []string{"http://a", "http://b"}, Retries: 3, KeepAlive: true},
+			check: func(t *testing.T, client *Client) {
+				if len(client.Servers) != 2 || client.Retries != 3 || client.HTTPClient == nil || !client.SkipPreflight {
+					t.Errorf("servers %v, retries %d, HTTP client %v, skip preflight %v",
+						client.Servers, client.Retries, client.HTTPClient, client.SkipPreflight)
+				}
+				if client.Normalize != NormalizeNFC || client.PreTranslate != "cat" || client.Failures == nil {
+					t.Errorf("normalize %q, pre-translate %q, failures %v", client.Normalize, client.PreTranslate, client.Failures)
+				}
+			},
+		},
+		{
+			name:      "other provider",
+			overrides: clientOverrides{Provider: ProviderLibreTranslate, Servers: []string{"http://libre"}},
+			check: func(t *testing.T, client *Client) {
+				if client.providerName() != ProviderLibreTranslate || client.Servers[0] != "http://libre" {
+					t.Errorf("provider %q, servers %v", client.providerName(), client.Servers)
+				}
+				if client.Token != "" || client.Headers != nil || client.AuthStyle != "" {
+					t.Errorf("flag credentials sent to another provider: token %q, headers %v, auth style %q",
+						client.Token, client.Headers, client.AuthStyle)
+				}
+			},
+		},
+		{
+			name:      "relay",
+			provider:  ProviderLibreTranslate,
+			overrides: clientOverrides{Headers: map[string][]string{"X-Key": {"start"}}, Relay: true},
+			check: func(t *testing.T, client *Client) {
+				if client.providerName() != ProviderDeepLX || client.Headers.Get("X-Key") != "start" {
+					t.Errorf("provider %q, headers %v", client.providerName(), client.Headers)
+				}
+				if client.Normalize != "" || client.PreTranslate != "" || client.History != nil {
+					t.Errorf("relay processes texts: normalize %q, pre-translate %q, history %v",
+						client.Normalize, client.PreTranslate, client.History)
+				}
+			},
+		},
+		{
+			name:     "pseudo",
+			provider: ProviderPseudo,
+			check: func(t *testing.T, client *Client) {
+				if client.Servers[0] != "" || !client.SkipPreflight || client.History != nil || client.Normalize != NormalizeNFC {
+					t.Errorf("servers %v, skip preflight %v, history %v, normalize %q",
+						client.Servers, client.SkipPreflight, client.History, client.Normalize)
+				}
+			},
+		},
+		{
+			name:     "unknown provider",
+			provider: "nonesuch",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &cli.App{
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "provider", Value: ProviderDeepLX},
+					&cli.StringFlag{Name: "url"},
+					&cli.StringFlag{Name: "token"},
+					&cli.StringSliceFlag{Name: "header"},
+					&cli.StringFlag{Name: "auth-style"},
+					&cli.StringFlag{Name: "normalize"},
+					&cli.StringFlag{Name: "pre-translate"},
+					&cli.BoolFlag{Name: "no-daemon"},
+					&cli.IntFlag{Name: "timeout", Value: 5},
+				},
+				Action: func(c *cli.Context) error {
+					client, err := newClientWith(c, tt.overrides)
+					if (err != nil) != tt.wantErr {
+						t.Fatalf("error %v, want error %v", err, tt.wantErr)
+					}
+					if err == nil {
+						tt.check(t, client)
+					}
+					return nil
+				},
+			}
+			args := append([]string{AppName}, flags...)
+			if tt.provider != "" {
+				args = append(args, "--provider", tt.provider)
+			}
+			if err := app.RunContext(withInvocation(context.Background(), Config{}), args); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
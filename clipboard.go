@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands returns the commands that put their stdin on the clipboard, in the
+// order they are tried
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		// clip.exe garbles UTF-8, so the text goes through PowerShell
+		return [][]string{{"powershell", "-NoProfile", "-Command", "[Console]::InputEncoding = [Text.Encoding]::UTF8; Set-Clipboard -Value ([Console]::In.ReadToEnd())"}}
+	}
+	var commands [][]string
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		commands = append(commands, []string{"wl-copy"})
+	}
+	return append(commands,
+		[]string{"xclip", "-selection", "clipboard"},
+		[]string{"xsel", "--clipboard", "--input"},
+		[]string{"termux-clipboard-set"},
+	)
+}
+
+// copyToClipboard puts text on the system clipboard with the first clipboard tool found.
+// Without one, a terminal is asked to do it with an OSC 52 sequence, which also works
+// over SSH in the terminals supporting it.
+func copyToClipboard(text string) error {
+	for _, args := range clipboardCommands() {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	if isTerminal(os.Stderr) {
+		fmt.Fprintf(os.Stderr, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+		return nil
+	}
+	return fmt.Errorf("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+}
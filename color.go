@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Color modes of --color
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// ANSI color sequences
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+// colorMode is set by --color
+var colorMode = ColorAuto
+
+// checkColorMode validates a --color mode
+func checkColorMode(mode string) error {
+	switch mode {
+	case ColorAuto, ColorAlways, ColorNever:
+		return nil
+	}
+	return fmt.Errorf("unknown color mode %q (use auto, always or never)", mode)
+}
+
+// colorEnabled reports whether output to f should be colored. --color always and never
+// decide by themselves; otherwise f must be a terminal, so colors never end up in pipes
+// and files, and NO_COLOR (https://no-color.org) must be unset and TERM not "dumb".
+func colorEnabled(f *os.File) bool {
+	switch colorMode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f)
+}
+
+// paint wraps text in an ANSI color when color is on
+func paint(color bool, ansi, text string) string {
+	if !color || text == "" {
+		return text
+	}
+	return ansi + text + ansiReset
+}
+
+// warnf prints a warning on stderr, in yellow on a terminal
+func warnf(format string, args ...interface{}) {
+	fmt.Fprintln(os.Stderr, paint(colorEnabled(os.Stderr), ansiYellow, "Warning: "+fmt.Sprintf(format, args...)))
+}
+
+// colorizeJSON adds ANSI colors to JSON text: keys in blue, strings in green,
+// numbers in cyan, booleans in yellow and null in magenta
+func colorizeJSON(data []byte) []byte {
+	var out bytes.Buffer
+	for i := 0; i < len(data); {
+		c := data[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(data) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			end = min(end+1, len(data))
+
+			// A string followed by a colon is an object key
+			next := end
+			for next < len(data) && (data[next] == ' ' || data[next] == '\n' || data[next] == '\t' || data[next] == '\r') {
+				next++
+			}
+			color := ansiGreen
+			if next < len(data) && data[next] == ':' {
+				color = ansiBlue
+			}
+			out.WriteString(color)
+			out.Write(data[i:end])
+			out.WriteString(ansiReset)
+			i = end
+		case c == '-' || c >= '0' && c <= '9':
+			end := i + 1
+			for end < len(data) && bytes.IndexByte([]byte("0123456789.eE+-"), data[end]) >= 0 {
+				end++
+			}
+			out.WriteString(ansiCyan)
+			out.Write(data[i:end])
+			out.WriteString(ansiReset)
+			i = end
+		case bytes.HasPrefix(data[i:], []byte("true")) || bytes.HasPrefix(data[i:], []byte("false")):
+			end := i + 4
+			if c == 'f' {
+				end++
+			}
+			out.WriteString(ansiYellow)
+			out.Write(data[i:end])
+			out.WriteString(ansiReset)
+			i = end
+		case bytes.HasPrefix(data[i:], []byte("null")):
+			out.WriteString(ansiMagenta + "null" + ansiReset)
+			i += 4
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// compareResult is one provider's answer in the compare command
+type compareResult struct {
+	Provider   string `json:"provider"`
+	Text       string `json:"text,omitempty"`
+	SourceLang string `json:"source_lang,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+}
+
+// compareOutput is the JSON output of the compare command
+type compareOutput struct {
+	Schema  int             `json:"schema"`
+	Results []compareResult `json:"results"`
+}
+
+// languagesOutput is the JSON output of the languages command
+type languagesOutput struct {
+	Schema    int      `json:"schema"`
+	Languages []string `json:"languages"`
+}
+
+// providerClient builds a Client for the named provider. The selected provider uses the
+// global flags; others use their configured server and token.
+func providerClient(c *cli.Context, name string) (*Client, error) {
+	if _, err := lookupProvider(name); err != nil {
+		return nil, err
+	}
+	if name == c.String("provider") {
+		return sharedClient(c), nil
+	}
+
+	config := configFor(c.Context)
+	settings := config.Providers[name]
+	serverURL, token := settings.URL, settings.Token
+	if name == ProviderDeepLX {
+		if serverURL == "" {
+			serverURL = config.DefaultURL
+		}
+		if token == "" {
+			token = config.DefaultToken
+		}
+	}
+	if serverURL == "" {
+		serverURL = providerURL(name, token)
+	}
+	return newClientWith(c, clientOverrides{Provider: name, Servers: []string{serverURL}, Token: token})
+}
+
+// compareProviders returns the providers to compare: those given with --providers, or
+// the selected one and every provider with configured settings
+func compareProviders(c *cli.Context) []string {
+	if list := c.String("providers"); list != "" {
+		return splitLangList(list)
+	}
+	configured := configFor(c.Context).Providers
+	names := []string{c.String("provider")}
+	for _, name := range providerNames() {
+		if _, ok := configured[name]; ok && name != names[0] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// runCompare handles the compare command, translating the same text with several
+// providers side by side
+func runCompare(c *cli.Context) error {
+	args, err := parseTrailingFlags(c)
+	if err != nil {
+		return cli.Exit(err.Error(), ExitUsage)
+	}
+	text := strings.Join(args, " ")
+	if text == "" {
+		return cli.Exit("Usage: translate compare [--providers deeplx,deepl] TEXT", ExitUsage)
+	}
+	targets := splitLangList(c.String("target"))
+	if len(targets) != 1 {
+		return cli.Exit("Translation error: compare needs exactly one target language", ExitUsage)
+	}
+	sourceLang := toDeepLCode(c.String("source"), true)
+	targetLang := resolveTargetVariant(toDeepLCode(targets[0], false), configFor(c.Context).VariantPreferences, false)
+
+	names := compareProviders(c)
+	clients := make([]*Client, len(names))
+	for i, name := range names {
+		if clients[i], err = providerClient(c, name); err != nil {
+			return cli.Exit(fmt.Sprintf("Provider error: %s", err), 1)
+		}
+	}
+
+	results := make([]compareResult, len(names))
+	var wg sync.WaitGroup
+	for i := range names {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := time.Now()
+			resp, _, err := clients[i].Translate(c.Context, text, sourceLang, targetLang)
+			results[i] = compareResult{Provider: names[i], DurationMS: time.Since(start).Milliseconds()}
+			if err != nil {
+				results[i].Error = redactSecrets(strings.SplitN(err.Error(), "\n", 2)[0])
+				return
+			}
+			results[i].Text = resp.Data
+			results[i].SourceLang = toDeepLCode(resp.SourceLang, true)
+		}(i)
+	}
+	wg.Wait()
+
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(compareOutput{Schema: SchemaVersion, Results: results})
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, result := range results {
+		fmt.Printf("%s (%dms):\n", result.Provider, result.DurationMS)
+		if result.Error != "" {
+			fmt.Printf("  Error: %s\n", result.Error)
+			continue
+		}
+		fmt.Printf("  %s\n", result.Text)
+	}
+	return nil
+}
+
+// runLanguages handles the languages command, listing the target languages of the provider
+func runLanguages(c *cli.Context) error {
+	langs, err := sharedClient(c).Languages(c.Context)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Languages error: %s", err), 1)
+	}
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(languagesOutput{Schema: SchemaVersion, Languages: langs})
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, lang := range langs {
+		fmt.Printf("%s (%s)\n", lang, toBCP47(lang))
+	}
+	return nil
+}
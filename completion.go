@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// completeCommand is the hidden first argument the completion scripts call the program
+// with to get the candidates for the word being completed
+const completeCommand = "__complete"
+
+// completionScripts holds the completion script of each shell; %[1]s is the program name
+var completionScripts = map[string]string{
+	"bash": `# bash completion for %[1]s
+# Load with: source <(%[1]s completion bash)
+_%[1]s_complete() {
+    local IFS=$'\n'
+    COMPREPLY=($(%[1]s __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _%[1]s_complete %[1]s
+`,
+	"zsh": `#compdef %[1]s
+# zsh completion for %[1]s
+# Load with: source <(%[1]s completion zsh)
+_%[1]s() {
+    local -a candidates
+    candidates=("${(@f)$(%[1]s __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    candidates=(${candidates:#})
+    if (( ${#candidates} )); then
+        compadd -Q -- $candidates
+    else
+        _files
+    fi
+}
+compdef _%[1]s %[1]s
+`,
+	"fish": `# fish completion for %[1]s
+# Load with: %[1]s completion fish | source
+function __%[1]s_complete
+    set -l candidates (%[1]s __complete (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)
+    if test (count $candidates) -gt 0
+        printf '%%s\n' $candidates
+    else
+        __fish_complete_path (commandline -ct)
+    end
+end
+complete -c %[1]s -f -a '(__%[1]s_complete)'
+`,
+	"powershell": `# PowerShell completion for %[1]s
+# Load with: %[1]s completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName %[1]s -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') {
+        # Older PowerShell versions drop empty arguments to native commands
+        $words += '""'
+    }
+    & %[1]s __complete @words 2>$null | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+// completionShells returns the shells completion scripts are available for
+func completionShells() []string {
+	shells := make([]string, 0, len(completionScripts))
+	for shell := range completionScripts {
+		shells = append(shells, shell)
+	}
+	sort.Strings(shells)
+	return shells
+}
+
+// flagValueCandidates returns the values a flag can take, or nil to complete file names
+func flagValueCandidates(name string, config Config) []string {
+	switch name {
+	case "source", "s":
+		return append([]string{"auto"}, completionLanguages(false)...)
+	case "target", "t":
+		return completionLanguages(true)
+	case "provider", "providers":
+		return providerNames()
+	case "formality":
+		return []string{"more", "less", "default"}
+	case "budget-action":
+		return []string{BudgetWarn, BudgetStop}
+	case "color":
+		return []string{ColorAuto, ColorAlways, ColorNever}
+	case "glossary":
+		return glossaryNames(config)
+	}
+	return nil
+}
+
+// completionLanguages returns the language codes DeepL translates between in lower case,
+// with regional variants for targets
+func completionLanguages(target bool) []string {
+	var codes []string
+	for _, code := range deepLLanguages {
+		codes = append(codes, strings.ToLower(code))
+		if target {
+			for _, variant := range deepLVariants[code] {
+				codes = append(codes, strings.ToLower(variant))
+			}
+		}
+	}
+	return codes
+}
+
+// flagNames returns the flags as typed on the command line, e.g. "--target" and "-t"
+func flagNames(flags []cli.Flag) []string {
+	var names []string
+	for _, flag := range flags {
+		if visible, ok := flag.(cli.VisibleFlag); ok && !visible.IsVisible() {
+			continue
+		}
+		for _, name := range flag.Names() {
+			if len(name) == 1 {
+				names = append(names, "-"+name)
+			} else {
+				names = append(names, "--"+name)
+			}
+		}
+	}
+	return names
+}
+
+// findFlag returns the flag called name among flags, or nil
+func findFlag(flags []cli.Flag, name string) cli.Flag {
+	for _, flag := range flags {
+		for _, flagName := range flag.Names() {
+			if flagName == name {
+				return flag
+			}
+		}
+	}
+	return nil
+}
+
+// completeArgs returns the candidates for the last of args, the words typed after the
+// program name: flags, commands, aliases and @presets, or the values of flags such as
+// --target. Several languages separated by commas are completed one at a time.
+func completeArgs(app *cli.App, args []string, config Config) []string {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+	current := args[len(args)-1]
+	if current == `""` {
+		current = ""
+	}
+	words := args[:len(args)-1]
+	// bash splits --target=de into "--target", "=" and "de"
+	if current == "=" {
+		current = ""
+	} else if n := len(words); n > 0 && words[n-1] == "=" {
+		words = words[:n-1]
+	}
+
+	// Follow the commands typed so far, skipping flags and their values
+	flags := app.Flags
+	var command *cli.Command
+	var path []string
+	commands := app.Commands
+	valueOf := ""
+	positional := 0
+	for _, word := range words {
+		if valueOf != "" {
+			valueOf = ""
+			continue
+		}
+		if strings.HasPrefix(word, "-") && word != "-" && word != "--" {
+			name := strings.TrimLeft(word, "-")
+			if strings.Contains(name, "=") {
+				continue
+			}
+			if flag := findFlag(flags, name); flag != nil {
+				if _, isBool := flag.(*cli.BoolFlag); !isBool {
+					valueOf = name
+				}
+			}
+			continue
+		}
+		var sub *cli.Command
+		for _, candidate := range commands {
+			if candidate.HasName(word) {
+				sub = candidate
+				break
+			}
+		}
+		if sub == nil {
+			positional++
+			continue
+		}
+		command, commands, flags = sub, sub.Subcommands, sub.Flags
+		path = append(path, sub.Name)
+	}
+
+	// done is the part of the word kept as typed: "--target=" or the languages before a comma
+	done := ""
+	if strings.HasPrefix(current, "-") && valueOf == "" {
+		if i := strings.Index(current, "="); i >= 0 {
+			done, current = current[:i+1], current[i+1:]
+			valueOf = strings.TrimLeft(done[:i], "-")
+		}
+	}
+	if i := strings.LastIndex(current, ","); i >= 0 && (valueOf == "target" || valueOf == "t" || valueOf == "providers") {
+		done, current = done+current[:i+1], current[i+1:]
+	}
+
+	var candidates []string
+	switch {
+	case valueOf != "":
+		candidates = flagValueCandidates(valueOf, config)
+	case strings.HasPrefix(current, "-"):
+		candidates = flagNames(flags)
+	case positional > 0:
+		return nil
+	case command == nil:
+		for _, candidate := range commands {
+			if !candidate.Hidden {
+				candidates = append(candidates, candidate.Name)
+			}
+		}
+		for name := range config.Aliases {
+			candidates = append(candidates, name)
+		}
+		for name := range config.Presets {
+			candidates = append(candidates, presetPrefix+name)
+		}
+		sort.Strings(candidates)
+	case len(commands) > 0:
+		for _, candidate := range commands {
+			if !candidate.Hidden {
+				candidates = append(candidates, candidate.Name)
+			}
+		}
+	case strings.Join(path, " ") == "alias remove":
+		for name := range config.Aliases {
+			candidates = append(candidates, name)
+		}
+		sort.Strings(candidates)
+	case strings.Join(path, " ") == "preset remove":
+		for name := range config.Presets {
+			candidates = append(candidates, name)
+		}
+		sort.Strings(candidates)
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(strings.ToLower(candidate), strings.ToLower(current)) {
+			matches = append(matches, done+candidate)
+		}
+	}
+	return matches
+}
+
+// runComplete prints the candidates for completing the last of args, one per line
+func runComplete(app *cli.App, args []string, config Config) {
+	for _, candidate := range completeArgs(app, args, config) {
+		fmt.Println(candidate)
+	}
+}
+
+// runCompletion handles the completion command, printing the completion script of a shell
+func runCompletion(c *cli.Context) error {
+	shell := c.Args().First()
+	script, ok := completionScripts[shell]
+	if !ok {
+		return cli.Exit(fmt.Sprintf("Usage: %s completion %s", c.App.Name, strings.Join(completionShells(), "|")), 1)
+	}
+	fmt.Printf(script, c.App.Name)
+	return nil
+}
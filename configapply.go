@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// configApplyResult is the JSON output of config apply
+type configApplyResult struct {
+	Schema    int      `json:"schema"`
+	Changed   bool     `json:"changed"`
+	Check     bool     `json:"check"`
+	Changes   []string `json:"changes"`
+	Unchanged []string `json:"unchanged"`
+}
+
+// readDesiredConfig reads a desired-state file, in JSON or YAML, as top-level settings
+func readDesiredConfig(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var desired interface{}
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".json" || bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, &desired)
+	} else {
+		desired, err = parseYAML(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, err)
+	}
+	if desired == nil {
+		return map[string]interface{}{}, nil
+	}
+	settings, ok := desired.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s: expected a mapping of settings", path)
+	}
+	return settings, nil
+}
+
+// configAsMap returns the settings of config keyed by their JSON names; unset ones are left out
+func configAsMap(config Config) map[string]interface{} {
+	data, _ := json.Marshal(config)
+	var settings map[string]interface{}
+	json.Unmarshal(data, &settings)
+	return settings
+}
+
+// validateConfig checks the settings that have a fixed set of values
+func validateConfig(config Config) error {
+	if config.AuthStyle != "" {
+		if err := checkAuthStyle(config.AuthStyle); err != nil {
+			return err
+		}
+	}
+	if config.TokenRotation != "" {
+		if err := checkTokenRotation(config.TokenRotation); err != nil {
+			return err
+		}
+	}
+	if config.Budget != "" {
+		if _, _, err := parseBudget(config.Budget); err != nil {
+			return err
+		}
+	}
+	if config.BudgetAction != "" {
+		if err := checkBudgetAction(config.BudgetAction); err != nil {
+			return err
+		}
+	}
+	if err := checkGlossaries(config.Glossaries); err != nil {
+		return err
+	}
+	if config.UpdateCheck != "" {
+		if err := checkUpdateCheck(config.UpdateCheck); err != nil {
+			return err
+		}
+	}
+	if config.History != "" {
+		if err := checkHistory(config.History); err != nil {
+			return err
+		}
+	}
+	if config.Encryption != "" {
+		if err := checkEncryption(config.Encryption); err != nil {
+			return err
+		}
+	}
+	if err := checkMergeAnnotation(config.MergeAnnotation); err != nil {
+		return err
+	}
+	switch config.LanguageSort {
+	case "", LangSortInput, LangSortAlpha, LangSortConfig:
+	default:
+		return fmt.Errorf("unknown language sort %q (use input, alpha or config)", config.LanguageSort)
+	}
+	if config.Provider != "" {
+		if _, err := lookupProvider(config.Provider); err != nil {
+			return err
+		}
+	}
+	for name := range config.Providers {
+		if _, err := lookupProvider(name); err != nil {
+			return err
+		}
+	}
+	return checkPairs(config.Pairs)
+}
+
+// applyConfig converges the configuration to the settings in a desired-state file. Only
+// the settings in the file are managed: each replaces the current value, and null unsets
+// it. With check, the changes are reported but not saved, so running it is always safe.
+func applyConfig(c *cli.Context) error {
+	path := c.String("file")
+	desired, err := readDesiredConfig(path)
+	if err != nil {
+		return err
+	}
+
+	result := configApplyResult{Schema: SchemaVersion, Check: c.Bool("check"), Changes: []string{}, Unchanged: []string{}}
+	err = updateConfig(c.Context, func(config *Config) error {
+		current := configAsMap(*config)
+		merged := make(map[string]interface{}, len(current)+len(desired))
+		for key, value := range current {
+			merged[key] = value
+		}
+		for key, value := range desired {
+			if value == nil {
+				delete(merged, key)
+			} else {
+				merged[key] = value
+			}
+		}
+
+		// Decoding strictly rejects unknown settings and values of the wrong type
+		data, err := json.Marshal(merged)
+		if err != nil {
+			return err
+		}
+		var applied Config
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&applied); err != nil {
+			return fmt.Errorf("invalid %s: %v", path, strings.TrimPrefix(err.Error(), "json: "))
+		}
+		if err := validateConfig(applied); err != nil {
+			return fmt.Errorf("invalid %s: %v", path, err)
+		}
+
+		appliedMap := configAsMap(applied)
+		keys := make([]string, 0, len(desired))
+		for key := range desired {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if reflect.DeepEqual(appliedMap[key], current[key]) {
+				result.Unchanged = append(result.Unchanged, key)
+			} else {
+				result.Changes = append(result.Changes, key)
+			}
+		}
+		result.Changed = len(result.Changes) > 0
+
+		if !result.Changed || result.Check {
+			return errKeepConfig
+		}
+		*config = applied
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	verb := "changed"
+	if result.Check {
+		verb = "would change"
+	}
+	for _, key := range result.Changes {
+		fmt.Printf("%s: %s\n", verb, key)
+	}
+	for _, key := range result.Unchanged {
+		fmt.Printf("unchanged: %s\n", key)
+	}
+	fmt.Printf("%d %s, %d unchanged\n", len(result.Changes), verb, len(result.Unchanged))
+	return nil
+}
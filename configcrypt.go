@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"runtime"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Ways the tokens of the configuration are encrypted at rest
+const (
+	EncryptPassphrase = "passphrase"
+	EncryptMachine    = "machine"
+	// EncryptOff is given to config set --encrypt to store the tokens in plaintext again
+	EncryptOff = "off"
+)
+
+// encryptedPrefix marks an encrypted value: the salt, nonce and AES-256-GCM sealed
+// value follow in base64
+const encryptedPrefix = "enc:v1:"
+
+// passphraseEnv holds the passphrase of an encrypted configuration, so scripts and
+// services don't need a terminal
+const passphraseEnv = "TRANSLATE_PASSPHRASE"
+
+// kdfIterations is the PBKDF2-HMAC-SHA256 work factor deriving keys
+const kdfIterations = 200000
+
+var (
+	secretMu sync.Mutex
+	// secretPassphrase is the passphrase once asked for, so it's asked only once
+	secretPassphrase string
+	// secretPromptErr is why asking for the passphrase failed, so it isn't asked again
+	secretPromptErr error
+	// secretSalt is the salt of the values encrypted by this process, so a single key is
+	// derived for all of them
+	secretSalt []byte
+	// secretKeys caches the keys derived, by mode and salt
+	secretKeys = make(map[string][]byte)
+)
+
+// configSecretErr is why the tokens of the configuration couldn't be decrypted, reported
+// before any command runs
+var configSecretErr error
+
+// checkEncryption checks the name of an encryption mode
+func checkEncryption(mode string) error {
+	switch mode {
+	case EncryptPassphrase, EncryptMachine:
+		return nil
+	}
+	return fmt.Errorf("unknown encryption %q (use passphrase or machine)", mode)
+}
+
+// machineID returns an identifier of this machine that stays the same across reboots
+func machineID() (string, error) {
+	var id string
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice").Output()
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if strings.Contains(line, "IOPlatformUUID") {
+				if parts := strings.Split(line, "\""); len(parts) >= 4 {
+					id = parts[3]
+				}
+			}
+		}
+	case "windows":
+		out, err := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid").Output()
+		if err != nil {
+			return "", err
+		}
+		for _, line := range strings.Split(string(out), "\n") {
+			if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "MachineGuid" {
+				id = fields[2]
+			}
+		}
+	default:
+		for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id", "/etc/hostid"} {
+			if data, err := os.ReadFile(path); err == nil {
+				if id = strings.TrimSpace(string(data)); id != "" {
+					break
+				}
+			}
+		}
+	}
+	if id == "" {
+		return "", errors.New("no machine ID found on this system; use --encrypt passphrase")
+	}
+	return id, nil
+}
+
+// readPassphrase asks for a passphrase on the terminal without echoing it
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	defer restore()
+
+	var passphrase []byte
+	buf := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			return "", err
+		}
+		switch buf[0] {
+		case '\r', '\n':
+			return string(passphrase), nil
+		case 3, 4:
+			return "", errors.New("cancelled")
+		case 8, 127:
+			if len(passphrase) > 0 {
+				passphrase = passphrase[:len(passphrase)-1]
+			}
+		default:
+			passphrase = append(passphrase, buf[0])
+		}
+	}
+}
+
+// setPassphrase makes passphrase the one values are encrypted with from now on, as when
+// config set --encrypt passphrase asks for a new one
+func setPassphrase(passphrase string) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretPassphrase = passphrase
+	secretPromptErr = nil
+	secretSalt = nil
+	secretKeys = make(map[string][]byte)
+}
+
+// secretMaterial returns what the keys of mode are derived from, asking for the
+// passphrase if it isn't known yet. secretMu is held.
+func secretMaterial(mode string) ([]byte, error) {
+	switch mode {
+	case EncryptMachine:
+		id, err := machineID()
+		if err != nil {
+			return nil, err
+		}
+		name := ""
+		if u, err := user.Current(); err == nil {
+			name = u.Username
+		}
+		return []byte("deeplx-cli\x00" + id + "\x00" + name), nil
+	case EncryptPassphrase:
+		if secretPassphrase == "" {
+			secretPassphrase = os.Getenv(passphraseEnv)
+		}
+		if secretPromptErr != nil {
+			return nil, secretPromptErr
+		}
+		if secretPassphrase == "" && canPrompt() {
+			passphrase, err := readPassphrase("Configuration passphrase: ")
+			if err == nil && passphrase == "" {
+				err = errors.New("no passphrase given")
+			}
+			if err != nil {
+				secretPromptErr = err
+				return nil, err
+			}
+			secretPassphrase = passphrase
+		}
+		if secretPassphrase == "" {
+			return nil, fmt.Errorf("the tokens are encrypted with a passphrase; set %s", passphraseEnv)
+		}
+		return []byte(secretPassphrase), nil
+	}
+	return nil, checkEncryption(mode)
+}
+
+// secretKey returns the AES-256 key of mode for salt
+func secretKey(mode string, salt []byte) ([]byte, error) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	id := mode + "\x00" + string(salt)
+	if key, ok := secretKeys[id]; ok {
+		return key, nil
+	}
+	material, err := secretMaterial(mode)
+	if err != nil {
+		return nil, err
+	}
+	key := pbkdf2.Key(material, salt, kdfIterations, 32, sha256.New)
+	secretKeys[id] = key
+	return key, nil
+}
+
+// encryptSecret encrypts a value with the key of mode. Empty values and values already
+// encrypted are returned as they are.
+func encryptSecret(mode, value string) (string, error) {
+	if value == "" || strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	secretMu.Lock()
+	if secretSalt == nil {
+		secretSalt = make([]byte, 16)
+		if _, err := rand.Read(secretSalt); err != nil {
+			secretMu.Unlock()
+			return "", err
+		}
+	}
+	salt := secretSalt
+	secretMu.Unlock()
+
+	key, err := secretKey(mode, salt)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(append(append([]byte(nil), salt...), nonce...), nonce, []byte(value), nil)
+	return encryptedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret decrypts a value encrypted with the key of mode. Values that aren't
+// encrypted are returned as they are.
+func decryptSecret(mode, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(data) < 16+12 {
+		return "", errors.New("malformed encrypted value")
+	}
+	key, err := secretKey(mode, data[:16])
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := data[16 : 16+gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, data[16+gcm.NonceSize():], nil)
+	if err != nil {
+		if mode == EncryptMachine {
+			return "", errors.New("can't decrypt the tokens: they were encrypted on another machine or by another user")
+		}
+		return "", errors.New("can't decrypt the tokens: wrong passphrase")
+	}
+	return string(plain), nil
+}
+
+// transformUserinfo returns a server URL with f applied to its credentials (the
+// user:password@ of basic auth), which are kept as the user name when transformed
+func transformUserinfo(raw string, f func(string) (string, error)) (string, error) {
+	if !strings.Contains(raw, "@") {
+		return raw, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw, nil
+	}
+	userinfo := u.User.Username()
+	if password, ok := u.User.Password(); ok {
+		userinfo += ":" + password
+	}
+	if userinfo, err = f(userinfo); err != nil {
+		return raw, err
+	}
+	if user, password, ok := strings.Cut(userinfo, ":"); ok && !strings.HasPrefix(userinfo, encryptedPrefix) {
+		u.User = url.UserPassword(user, password)
+	} else {
+		u.User = url.User(userinfo)
+	}
+	return u.String(), nil
+}
+
+// transformSecrets returns config with f applied to each token, the session, the header
+// values and the credentials in server URLs. The slices and maps holding them are copied,
+// so config itself isn't changed.
+func transformSecrets(config Config, f func(string) (string, error)) (Config, error) {
+	var err error
+	if config.DefaultToken, err = f(config.DefaultToken); err != nil {
+		return config, err
+	}
+	if config.DefaultURL, err = transformUserinfo(config.DefaultURL, f); err != nil {
+		return config, err
+	}
+	if config.Headers != nil {
+		headers := make(map[string]string, len(config.Headers))
+		for name, value := range config.Headers {
+			if headers[name], err = f(value); err != nil {
+				return config, err
+			}
+		}
+		config.Headers = headers
+	}
+	if config.DLSession, err = f(config.DLSession); err != nil {
+		return config, err
+	}
+	if config.Tokens != nil {
+		tokens := make([]string, len(config.Tokens))
+		for i, token := range config.Tokens {
+			if tokens[i], err = f(token); err != nil {
+				return config, err
+			}
+		}
+		config.Tokens = tokens
+	}
+	if config.Providers != nil {
+		providers := make(map[string]ProviderSettings, len(config.Providers))
+		for name, settings := range config.Providers {
+			if settings.Token, err = f(settings.Token); err != nil {
+				return config, err
+			}
+			if settings.URL, err = transformUserinfo(settings.URL, f); err != nil {
+				return config, err
+			}
+			providers[name] = settings
+		}
+		config.Providers = providers
+	}
+	if config.Pairs != nil {
+		pairs := make(map[string]PairSettings, len(config.Pairs))
+		for pair, settings := range config.Pairs {
+			if settings.Token, err = f(settings.Token); err != nil {
+				return config, err
+			}
+			if settings.Server, err = transformUserinfo(settings.Server, f); err != nil {
+				return config, err
+			}
+			pairs[pair] = settings
+		}
+		config.Pairs = pairs
+	}
+	return config, nil
+}
+
+// decryptConfig decrypts the tokens of a configuration read from disk
+func decryptConfig(config Config) (Config, error) {
+	if config.Encryption == "" {
+		return config, nil
+	}
+	return transformSecrets(config, func(value string) (string, error) {
+		return decryptSecret(config.Encryption, value)
+	})
+}
+
+// encryptConfig encrypts the tokens of a configuration about to be written to disk
+func encryptConfig(config Config) (Config, error) {
+	if config.Encryption == "" {
+		return config, nil
+	}
+	return transformSecrets(config, func(value string) (string, error) {
+		return encryptSecret(config.Encryption, value)
+	})
+}
+
+// setEncryption handles config set --encrypt, asking for a new passphrase when one is
+// chosen and none is given in the environment
+func setEncryption(config *Config, mode string) error {
+	if mode == EncryptOff {
+		config.Encryption = ""
+		fmt.Println("Tokens will be stored in plaintext")
+		return nil
+	}
+	if err := checkEncryption(mode); err != nil {
+		return err
+	}
+	if mode == EncryptPassphrase {
+		passphrase := os.Getenv(passphraseEnv)
+		if passphrase == "" {
+			if !canPrompt() {
+				return fmt.Errorf("set %s to the passphrase", passphraseEnv)
+			}
+			first, err := readPassphrase("New passphrase: ")
+			if err != nil {
+				return err
+			}
+			second, err := readPassphrase("Repeat the passphrase: ")
+			if err != nil {
+				return err
+			}
+			if first == "" || first != second {
+				return errors.New("the passphrases are empty or don't match")
+			}
+			passphrase = first
+		}
+		setPassphrase(passphrase)
+	} else {
+		if _, err := machineID(); err != nil {
+			return err
+		}
+		// Keys derived from an earlier passphrase mustn't be reused
+		setPassphrase("")
+	}
+	config.Encryption = mode
+	fmt.Printf("Tokens will be encrypted with: %s\n", mode)
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Where an effective setting came from, from the most to the least specific
+const (
+	OriginFlag    = "flag"
+	OriginEnv     = "env"
+	OriginPair    = "pair"
+	OriginProject = "project"
+	OriginUser    = "user config"
+	OriginDefault = "default"
+)
+
+// traceableSetting is a setting config doctor explains: a global flag, and the key of the
+// configuration file or project file giving its default, if any
+type traceableSetting struct {
+	flag   string
+	key    string
+	secret bool
+}
+
+// traceableSettings are the settings config doctor explains, in the order shown
+var traceableSettings = []traceableSetting{
+	{flag: "url", key: "default_url"},
+	{flag: "token", key: "default_token", secret: true},
+	{flag: "tokens", key: "tokens", secret: true},
+	{flag: "token-rotation", key: "token_rotation"},
+	{flag: "dl-session", key: "dl_session", secret: true},
+	{flag: "session-refresh-command", key: "session_refresh_command"},
+	{flag: "pre-translate", key: "pre_translate"},
+	{flag: "post-translate", key: "post_translate"},
+	{flag: "basic-auth", secret: true},
+	{flag: "auth-style", key: "auth_style"},
+	{flag: "provider", key: "provider"},
+	{flag: "source", key: "source"},
+	{flag: "target", key: "target"},
+	{flag: "formality"},
+	{flag: "glossary", key: "glossary"},
+	{flag: "glossary-id"},
+	{flag: "budget", key: "budget"},
+	{flag: "budget-action", key: "budget_action"},
+	{flag: "sort-langs", key: "language_sort"},
+	{flag: "timeout"},
+	{flag: "failure-ttl"},
+	{flag: "output"},
+	{flag: "color"},
+}
+
+// settingOrigin is an effective setting, its value and where it came from
+type settingOrigin struct {
+	Setting string `json:"setting"`
+	Value   string `json:"value"`
+	Origin  string `json:"origin"`
+	// Detail names the variable, pair or file the value came from
+	Detail string `json:"detail,omitempty"`
+}
+
+// givenFlag is a global flag as the user gave it, before the language pair's settings,
+// the project's server or basic auth credentials set it
+type givenFlag struct {
+	set   bool
+	value string
+}
+
+// givenFlags are the traceable flags as the user gave them
+var givenFlags = make(map[string]givenFlag)
+
+// recordGivenFlags remembers the traceable flags before anything but the user sets them
+func recordGivenFlags(c *cli.Context) {
+	for _, setting := range traceableSettings {
+		givenFlags[setting.flag] = givenFlag{set: c.IsSet(setting.flag), value: fmt.Sprint(c.Value(setting.flag))}
+	}
+}
+
+// traceSetting finds where the effective value of a setting came from. Flags and their
+// variables come first, then the language pair's settings, the project file, the user
+// configuration and the built-in default.
+func traceSetting(c *cli.Context, setting traceableSetting, user map[string]interface{}, userPath string) settingOrigin {
+	origin := settingOrigin{Setting: setting.flag, Value: fmt.Sprint(c.Value(setting.flag))}
+	if origin.Value == "[]" {
+		origin.Value = ""
+	}
+	given, recorded := givenFlags[setting.flag]
+	if !recorded {
+		given = givenFlag{set: c.IsSet(setting.flag), value: origin.Value}
+	}
+
+	vars := flagEnvVars(c.App)
+	for _, name := range sortedKeys(vars) {
+		if vars[name] != "--"+setting.flag {
+			continue
+		}
+		if value, ok := os.LookupEnv(name); ok && value != "" && value == given.value {
+			origin.Origin, origin.Detail = OriginEnv, name
+			break
+		}
+	}
+	switch {
+	case origin.Origin != "":
+	case pairFlags[setting.flag] != "":
+		origin.Origin, origin.Detail = OriginPair, pairFlags[setting.flag]
+	case given.set:
+		origin.Origin = OriginFlag
+	case setting.flag == "url" && project != nil && project.Server != nil && serverWithoutUserinfo(origin.Value) == project.Server.URL:
+		origin.Origin, origin.Detail = OriginProject, project.Path
+	case project != nil && setting.key != "" && projectSets(setting.key):
+		origin.Origin, origin.Detail = OriginProject, project.Path
+	case setting.key != "" && user[setting.key] != nil:
+		origin.Origin, origin.Detail = OriginUser, userPath
+		if origin.Value == "" {
+			// Settings such as tokens are read from the configuration, not the flag's default
+			origin.Value = fmt.Sprint(user[setting.key])
+		}
+	default:
+		origin.Origin = OriginDefault
+	}
+
+	if setting.secret && origin.Value != "" {
+		origin.Value = "[configured]"
+	}
+	// Server URLs may hold basic auth credentials
+	origin.Value = redactSecrets(origin.Value)
+	return origin
+}
+
+// serverWithoutUserinfo returns a server URL without its basic auth credentials
+func serverWithoutUserinfo(serverURL string) string {
+	stripped, _ := splitUserinfo(serverURL)
+	return stripped
+}
+
+// projectSets reports whether the project file gives a setting
+func projectSets(key string) bool {
+	switch key {
+	case "source":
+		return project.Source != ""
+	case "target":
+		return project.Target != ""
+	case "glossary":
+		return project.Glossary != ""
+	}
+	_, ok := project.settings[key]
+	return ok
+}
+
+// configDoctorOutput is the JSON output of config doctor
+type configDoctorOutput struct {
+	Schema   int             `json:"schema"`
+	Config   string          `json:"config"`
+	Project  string          `json:"project,omitempty"`
+	Settings []settingOrigin `json:"settings"`
+}
+
+// runConfigDoctor handles the config doctor command, showing each effective setting and
+// where it came from
+func runConfigDoctor(c *cli.Context) error {
+	userPath, err := configFilePath()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Config error: %s", err), 1)
+	}
+	user := configAsMap(configFor(c.Context))
+
+	output := configDoctorOutput{Schema: SchemaVersion, Config: userPath}
+	if project != nil {
+		output.Project = project.Path
+	}
+	for _, setting := range traceableSettings {
+		output.Settings = append(output.Settings, traceSetting(c, setting, user, userPath))
+	}
+
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(output)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("User configuration: %s\n", output.Config)
+	if output.Project != "" {
+		fmt.Printf("Project configuration: %s\n", output.Project)
+	}
+	fmt.Println()
+	width := 0
+	for _, s := range output.Settings {
+		width = max(width, len(s.Setting))
+	}
+	for _, s := range output.Settings {
+		value := s.Value
+		if value == "" {
+			value = "(none)"
+		}
+		from := s.Origin
+		if s.Detail != "" {
+			from += " " + s.Detail
+		}
+		fmt.Printf("  %-*s  %s  ← %s\n", width, s.Setting, value, from)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// portableMarker next to the executable turns on portable mode, keeping the configuration
+// and the other files in portableDataDir beside it instead of the user's directory
+const (
+	portableMarker  = "translate.portable"
+	portableDataDir = "translate-data"
+)
+
+// portableDir is where files are kept in portable mode, or empty
+var portableDir string
+
+// appDir returns the directory the configuration, history, ledger and other files are
+// kept in: beside the executable in portable mode, else in the user's configuration
+// directory
+func appDir() (string, error) {
+	if portableDir != "" {
+		return portableDir, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "translate"), nil
+}
+
+// portableDirFromArgs returns the data directory beside the executable if portable mode is
+// on, by --portable, TRANSLATE_PORTABLE or the marker file, or empty
+func portableDirFromArgs(args []string) string {
+	on := false
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if arg == "--portable" || arg == "-portable" || arg == "--portable=true" {
+			on = true
+		}
+	}
+	if value := os.Getenv("TRANSLATE_PORTABLE"); value != "" && value != "0" && value != "false" {
+		on = true
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+	dir := filepath.Dir(exe)
+	if _, err := os.Stat(filepath.Join(dir, portableMarker)); err == nil {
+		on = true
+	}
+	if !on {
+		return ""
+	}
+	return filepath.Join(dir, portableDataDir)
+}
+
+// configPathOverride is the configuration file given with --config or TRANSLATE_CONFIG,
+// or empty for the one in the user's configuration directory
+var configPathOverride string
+
+// configFilePath returns the path of the configuration file
+func configFilePath() (string, error) {
+	if configPathOverride != "" {
+		return configPathOverride, nil
+	}
+	dir, err := appDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// configFlagFromArgs finds --config in the command line, which is needed before the flags
+// are parsed since the configuration provides their defaults. TRANSLATE_CONFIG is used
+// when it isn't given.
+func configFlagFromArgs(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		for _, prefix := range []string{"--config=", "-config="} {
+			if strings.HasPrefix(arg, prefix) {
+				return strings.TrimPrefix(arg, prefix)
+			}
+		}
+		if (arg == "--config" || arg == "-config") && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv("TRANSLATE_CONFIG")
+}
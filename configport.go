@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// mergeSettings merges overlay over base, both keyed by JSON name. A setting replaces
+// the one in base, except for mappings such as glossaries, pairs or providers, whose
+// entries are added to those in base.
+func mergeSettings(base, overlay map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(overlay))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		mine, ok1 := merged[key].(map[string]interface{})
+		theirs, ok2 := value.(map[string]interface{})
+		if !ok1 || !ok2 {
+			merged[key] = value
+			continue
+		}
+		combined := make(map[string]interface{}, len(mine)+len(theirs))
+		for k, v := range mine {
+			combined[k] = v
+		}
+		for k, v := range theirs {
+			combined[k] = v
+		}
+		merged[key] = combined
+	}
+	return merged
+}
+
+// decodeSettings turns settings keyed by JSON name into a Config, rejecting unknown
+// settings, values of the wrong type and invalid values
+func decodeSettings(settings map[string]interface{}) (Config, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return Config{}, err
+	}
+	var config Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return Config{}, fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "json: "))
+	}
+	if err := validateConfig(config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// stripSecrets removes the tokens, sessions and headers from a configuration, which
+// gateways often use for API keys, and the basic auth credentials from its server URLs
+func stripSecrets(config Config) Config {
+	config.DefaultToken = ""
+	config.DefaultURL, _ = splitUserinfo(config.DefaultURL)
+	config.Tokens = nil
+	config.DLSession = ""
+	config.Headers = nil
+	if config.Providers != nil {
+		providers := make(map[string]ProviderSettings, len(config.Providers))
+		for name, settings := range config.Providers {
+			settings.Token = ""
+			settings.URL, _ = splitUserinfo(settings.URL)
+			providers[name] = settings
+		}
+		config.Providers = providers
+	}
+	if config.Pairs != nil {
+		pairs := make(map[string]PairSettings, len(config.Pairs))
+		for pair, settings := range config.Pairs {
+			settings.Token = ""
+			settings.Server, _ = splitUserinfo(settings.Server)
+			pairs[pair] = settings
+		}
+		config.Pairs = pairs
+	}
+	return config
+}
+
+// exportConfig handles the config export command
+func exportConfig(c *cli.Context) error {
+	config := configFor(c.Context)
+	if c.Bool("no-secrets") {
+		config = stripSecrets(config)
+	}
+	// Pairs such as "ja>en" are kept readable
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(config); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+
+	out := c.String("out")
+	if out == "" || out == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	// Whatever secrets are left shouldn't be readable by others
+	if err := os.WriteFile(out, data, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Exported the configuration to %s\n", out)
+	return nil
+}
+
+// keepUserinfo puts back the basic auth credentials of the server URLs in mine that an
+// export without secrets stripped from the same URLs in imported
+func keepUserinfo(imported *Config, mine Config) {
+	keep := func(theirs *string, own string) {
+		if stripped, credentials := splitUserinfo(own); credentials != "" && *theirs == stripped {
+			*theirs = own
+		}
+	}
+	keep(&imported.DefaultURL, mine.DefaultURL)
+	for name, settings := range imported.Providers {
+		keep(&settings.URL, mine.Providers[name].URL)
+		imported.Providers[name] = settings
+	}
+	for pair, settings := range imported.Pairs {
+		keep(&settings.Server, mine.Pairs[pair].Server)
+		imported.Pairs[pair] = settings
+	}
+}
+
+// importConfig handles the config import command. The imported settings are merged over
+// the current ones, so secrets stripped from an export are kept; with replace they take
+// the place of the whole configuration.
+func importConfig(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("usage: translate config import [--replace] FILE")
+	}
+	path := c.Args().First()
+	imported, err := readDesiredConfig(path)
+	if err != nil {
+		return err
+	}
+
+	err = updateConfig(c.Context, func(config *Config) error {
+		settings := imported
+		if !c.Bool("replace") {
+			settings = mergeSettings(configAsMap(*config), imported)
+		}
+		result, err := decodeSettings(settings)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", path, err)
+		}
+		if !c.Bool("replace") {
+			keepUserinfo(&result, *config)
+		}
+		*config = result
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(imported))
+	for key := range imported {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Printf("Imported %d settings from %s: %s\n", len(keys), path, strings.Join(keys, ", "))
+	return nil
+}
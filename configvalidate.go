@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// configProblem is something wrong in the configuration file and how to fix it
+type configProblem struct {
+	// Key is the setting at fault, or empty when it's the file as a whole
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"`
+}
+
+// configKeys returns the names of the settings of the configuration file
+func configKeys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// closestKey returns the setting key most likely meant, or "" if none is close
+func closestKey(key string) string {
+	best, bestDistance := "", 4
+	for _, known := range configKeys() {
+		if d := editDistance(strings.ToLower(key), known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	return best
+}
+
+// lineColumn returns the line and column of the byte before offset in data, where the
+// decoder stopped
+func lineColumn(data []byte, offset int64) (int, int) {
+	if offset > 0 {
+		offset--
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	return line, len(before) - bytes.LastIndexByte(before, '\n')
+}
+
+// checkConfigURL reports a problem with a server URL of the configuration
+func checkConfigURL(key, value string) *configProblem {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return nil
+	}
+	return &configProblem{Key: key, Message: fmt.Sprintf("%q is not a valid server URL", value), Fix: "use a full http or https URL, e.g. http://localhost:1188"}
+}
+
+// checkConfigLanguage reports a problem with a language code of the configuration
+func checkConfigLanguage(key, code string, source bool) *configProblem {
+	if code == pairWildcard || knownLanguage(toDeepLCode(code, source)) {
+		return nil
+	}
+	return &configProblem{Key: key, Message: fmt.Sprintf("unknown language %q", code), Fix: "use a code such as DE, en-GB or pt-BR; translate languages lists them"}
+}
+
+// validateConfigData checks the contents of a configuration file: its syntax, the
+// settings it has, the types and values of each, and whether its tokens can be read
+func validateConfigData(data []byte) []configProblem {
+	var problems []configProblem
+	add := func(p *configProblem) {
+		if p != nil {
+			problems = append(problems, *p)
+		}
+	}
+
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line, column := lineColumn(data, syntax.Offset)
+			return []configProblem{{Message: fmt.Sprintf("line %d, column %d: %s", line, column, syntax.Error()), Fix: "fix the JSON syntax, or rewrite the file with config set"}}
+		}
+		return []configProblem{{Message: strings.TrimPrefix(err.Error(), "json: "), Fix: "the file must hold a JSON object of settings"}}
+	}
+
+	known := make(map[string]bool)
+	for _, key := range configKeys() {
+		known[key] = true
+	}
+	names := make([]string, 0, len(settings))
+	for key := range settings {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	for _, key := range names {
+		if known[key] {
+			continue
+		}
+		fix := "remove it; translate man lists the settings"
+		if closest := closestKey(key); closest != "" {
+			fix = fmt.Sprintf("did you mean %s?", closest)
+		}
+		problems = append(problems, configProblem{Key: key, Message: "unknown setting", Fix: fix})
+		delete(settings, key)
+	}
+
+	// Unknown settings are left out so the decoder reports the next kind of mistake
+	rest, _ := json.Marshal(settings)
+	var config Config
+	dec := json.NewDecoder(bytes.NewReader(rest))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return append(problems, configProblem{Key: typeErr.Field, Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value), Fix: "see translate man for the form of each setting"})
+		}
+		return append(problems, configProblem{Message: strings.TrimPrefix(err.Error(), "json: "), Fix: "see translate man for the form of each setting"})
+	}
+	if err := validateConfig(config); err != nil {
+		problems = append(problems, configProblem{Message: err.Error(), Fix: "set a value of those listed"})
+	}
+
+	add(checkConfigURL("default_url", config.DefaultURL))
+	for _, name := range sortedKeys(config.Providers) {
+		add(checkConfigURL("providers."+name+".url", config.Providers[name].URL))
+	}
+	for _, pair := range sortedKeys(config.Pairs) {
+		add(checkConfigURL("pairs."+pair+".server", config.Pairs[pair].Server))
+	}
+
+	// Other engines know languages of their own
+	if config.Provider == "" || config.Provider == ProviderDeepLX || config.Provider == ProviderDeepL {
+		for _, tag := range config.LanguageOrder {
+			add(checkConfigLanguage("language_order", tag, false))
+		}
+		for _, base := range sortedKeys(config.VariantPreferences) {
+			add(checkConfigLanguage("variant_preferences", config.VariantPreferences[base], false))
+		}
+		for _, lang := range sortedKeys(config.Voices) {
+			add(checkConfigLanguage("voices", lang, false))
+		}
+		for _, pair := range sortedKeys(config.Pairs) {
+			if source, target, err := parsePair(pair); err == nil {
+				add(checkConfigLanguage("pairs."+pair, source, true))
+				add(checkConfigLanguage("pairs."+pair, target, false))
+			}
+		}
+		for _, name := range sortedKeys(config.Glossaries) {
+			for _, lang := range sortedKeys(config.Glossaries[name]) {
+				add(checkConfigLanguage("glossaries."+name, lang, false))
+			}
+		}
+	}
+
+	if _, err := decryptConfig(config); err != nil {
+		problems = append(problems, configProblem{Key: "encryption", Message: err.Error(), Fix: fmt.Sprintf("set %s to the passphrase, or set the tokens again", passphraseEnv)})
+	}
+	return problems
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configFileProblems validates the configuration file, if there is one
+func configFileProblems() (string, []configProblem, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return path, nil, nil
+	}
+	if err != nil {
+		return path, []configProblem{{Message: err.Error(), Fix: "check the permissions of the file"}}, nil
+	}
+	return path, validateConfigData(data), nil
+}
+
+// formatConfigProblem returns a problem as a line of text
+func formatConfigProblem(p configProblem) string {
+	if p.Key == "" {
+		return p.Message
+	}
+	return p.Key + ": " + p.Message
+}
+
+// validateConfigOutput is the JSON output of config validate
+type validateConfigOutput struct {
+	Schema   int             `json:"schema"`
+	Path     string          `json:"path"`
+	Valid    bool            `json:"valid"`
+	Problems []configProblem `json:"problems"`
+}
+
+// runConfigValidate handles the config validate command
+func runConfigValidate(c *cli.Context) error {
+	path, problems, err := configFileProblems()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Config error: %s", err), 1)
+	}
+
+	if c.String("output") == OutputJSON {
+		output := validateConfigOutput{Schema: SchemaVersion, Path: path, Valid: len(problems) == 0, Problems: problems}
+		if output.Problems == nil {
+			output.Problems = []configProblem{}
+		}
+		data, err := json.Marshal(output)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+	} else if len(problems) == 0 {
+		fmt.Printf("%s is valid\n", path)
+	} else {
+		fmt.Printf("%s has %d problem(s):\n", path, len(problems))
+		for _, p := range problems {
+			fmt.Printf("  %s\n", formatConfigProblem(p))
+			if p.Fix != "" {
+				fmt.Printf("    Fix: %s\n", p.Fix)
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return cli.Exit("", 1)
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// daemonBaseURL is the placeholder host used for requests sent over the daemon socket
+const daemonBaseURL = "http://daemon"
+
+// daemonStatus is reported by the daemon's /status endpoint
+type daemonStatus struct {
+	PID                int       `json:"pid"`
+	Upstream           string    `json:"upstream"`
+	TokenFingerprint   string    `json:"token_fingerprint,omitempty"`
+	HeadersFingerprint string    `json:"headers_fingerprint,omitempty"`
+	AuthStyle          string    `json:"auth_style,omitempty"`
+	Started            time.Time `json:"started"`
+	CacheEntries       int       `json:"cache_entries"`
+	CacheHits          int64     `json:"cache_hits"`
+	CacheMisses        int64     `json:"cache_misses"`
+}
+
+// daemonSocketPath returns the path of the daemon's unix socket
+func daemonSocketPath() (string, error) {
+	dir, err := appDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "daemon.sock"), nil
+}
+
+// daemonHTTPClient returns an HTTP client whose connections go to the daemon socket
+func daemonHTTPClient(socket string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+}
+
+// tokenFingerprint identifies a token without revealing it
+func tokenFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:8])
+}
+
+// queryDaemon fetches the status of the running daemon
+func queryDaemon(socket string) (*daemonStatus, error) {
+	resp, err := daemonHTTPClient(socket, 500*time.Millisecond).Get(daemonBaseURL + "/status")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var status daemonStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("unexpected daemon response: %v", err)
+	}
+	return &status, nil
+}
+
+// useDaemon routes the requests of client through the daemon if one is running for the
+// same server and token, and reports whether it did; otherwise the client talks to the
+// server directly
+func useDaemon(client *Client) bool {
+	socket, err := daemonSocketPath()
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(socket); err != nil {
+		return false
+	}
+
+	status, err := queryDaemon(socket)
+	if err != nil || status.Upstream != client.Servers[0] || status.TokenFingerprint != tokenFingerprint(client.Token) ||
+		status.HeadersFingerprint != headersFingerprint(client.Headers) || status.AuthStyle != client.AuthStyle {
+		if client.Debug {
+			debugf("Not using daemon at %s\n", socket)
+		}
+		return false
+	}
+
+	if client.Debug {
+		debugf("Using daemon (pid %d) at %s\n", status.PID, socket)
+	}
+	// The daemon sends the token and headers, and remembers the failures of its upstream
+	client.Servers = []string{daemonBaseURL}
+	client.Token, client.Headers, client.AuthStyle = "", nil, ""
+	client.Failures = nil
+	client.HTTPClient = daemonHTTPClient(socket, client.Timeout)
+	client.SkipPreflight = true
+	// The daemon falls back itself; retrying through it would only duplicate the warning
+	client.NoVariantFallback = true
+	return true
+}
+
+// runDaemon handles the daemon run command, serving translations on the daemon socket in the foreground
+func runDaemon(c *cli.Context) error {
+	socket, err := daemonSocketPath()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+
+	if _, err := queryDaemon(socket); err == nil {
+		return cli.Exit("Daemon error: a daemon is already running", 1)
+	}
+	// Clear a socket left behind by a daemon that didn't shut down cleanly
+	os.Remove(socket)
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+	defer os.Remove(socket)
+
+	// Headers given to daemon start arrive through the environment
+	startHeaders := make(http.Header)
+	for _, header := range strings.Split(os.Getenv("TRANSLATE_DAEMON_HEADERS"), "\n") {
+		if name, value, err := parseHeader(header); err == nil {
+			startHeaders.Set(name, value)
+			redactor.addSecrets(value)
+		}
+	}
+	// Keep connections to the upstream warm between invocations
+	client, err := newClientWith(c, clientOverrides{
+		Retries:   1,
+		Cache:     NewCache(10000, 24*time.Hour),
+		Headers:   startHeaders,
+		KeepAlive: true,
+		Relay:     true,
+	})
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+	proxy := &proxyServer{client: client, debug: c.Bool("debug")}
+
+	started := time.Now()
+	server := &http.Server{ReadHeaderTimeout: 10 * time.Second}
+
+	// Shut down after a period without requests, so a forgotten daemon doesn't linger
+	idleTimeout := c.Duration("idle-timeout")
+	var idleMu sync.Mutex
+	var idleTimer *time.Timer
+	touch := func() {
+		if idleTimeout <= 0 {
+			return
+		}
+		idleMu.Lock()
+		defer idleMu.Unlock()
+		if idleTimer == nil {
+			idleTimer = time.AfterFunc(idleTimeout, func() { server.Close() })
+		} else {
+			idleTimer.Reset(idleTimeout)
+		}
+	}
+	touch()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/translate", func(w http.ResponseWriter, r *http.Request) {
+		touch()
+		proxy.handleTranslate(w, r)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		size, hits, misses := proxy.client.Cache.Stats()
+		writeJSON(w, http.StatusOK, &daemonStatus{
+			PID:                os.Getpid(),
+			Upstream:           client.Servers[0],
+			TokenFingerprint:   tokenFingerprint(client.Token),
+			HeadersFingerprint: headersFingerprint(client.Headers),
+			AuthStyle:          client.AuthStyle,
+			Started:            started,
+			CacheEntries:       size,
+			CacheHits:          hits,
+			CacheMisses:        misses,
+		})
+	})
+	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeProxyError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"message": "shutting down"})
+		go server.Close()
+	})
+	server.Handler = mux
+
+	// Stop cleanly on Ctrl-C, and survive the launching terminal going away
+	signal.Ignore(syscall.SIGHUP)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupt
+		server.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Daemon serving %s on %s\n", redactSecrets(client.Servers[0]), socket)
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+	return nil
+}
+
+// startDaemon handles the daemon start command, launching the daemon in the background
+func startDaemon(c *cli.Context) error {
+	socket, err := daemonSocketPath()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+	if status, err := queryDaemon(socket); err == nil {
+		fmt.Printf("Daemon already running (pid %d)\n", status.PID)
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(socket), 0755); err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+	logFile, err := os.OpenFile(filepath.Join(filepath.Dir(socket), "daemon.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+	defer logFile.Close()
+
+	// Like the token, basic auth credentials go through the environment
+	serverURL, credentials := splitUserinfo(c.String("url"))
+	args := []string{
+		"--url", serverURL,
+		"--timeout", fmt.Sprint(c.Int("timeout")),
+		"--auth-style", c.String("auth-style"),
+	}
+	if c.Bool("debug") {
+		args = append(args, "--debug")
+	}
+	if c.Bool("no-variant-fallback") {
+		args = append(args, "--no-variant-fallback")
+	}
+	args = append(args, "daemon", "run", "--idle-timeout", c.Duration("idle-timeout").String())
+
+	cmd := exec.Command(executable, args...)
+	// Pass the token through the environment so it doesn't show up in process listings
+	cmd.Env = append(os.Environ(), "TOKEN="+c.String("token"), "DEEPLX_TOKEN="+c.String("token"),
+		"TRANSLATE_DAEMON_HEADERS="+strings.Join(c.StringSlice("header"), "\n"), "DEEPLX_BASIC_AUTH="+credentials)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+	pid := cmd.Process.Pid
+	cmd.Process.Release()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := queryDaemon(socket); err == nil {
+			fmt.Printf("Daemon started (pid %d)\n", pid)
+			return nil
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return cli.Exit(fmt.Sprintf("Daemon error: daemon did not start, see %s", logFile.Name()), 1)
+}
+
+// stopDaemon handles the daemon stop command
+func stopDaemon(c *cli.Context) error {
+	socket, err := daemonSocketPath()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+
+	resp, err := daemonHTTPClient(socket, 2*time.Second).Post(daemonBaseURL+"/shutdown", "application/json", nil)
+	if err != nil {
+		fmt.Println("Daemon is not running")
+		return nil
+	}
+	resp.Body.Close()
+
+	fmt.Println("Daemon stopped")
+	return nil
+}
+
+// showDaemonStatus handles the daemon status command
+func showDaemonStatus(c *cli.Context) error {
+	socket, err := daemonSocketPath()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Daemon error: %s", err), 1)
+	}
+
+	status, err := queryDaemon(socket)
+	if err != nil {
+		fmt.Println("Daemon is not running")
+		return nil
+	}
+
+	fmt.Printf("Daemon running:\n")
+	fmt.Printf("  PID: %d\n", status.PID)
+	fmt.Printf("  Socket: %s\n", socket)
+	fmt.Printf("  Upstream: %s\n", redactSecrets(status.Upstream))
+	fmt.Printf("  Uptime: %s\n", time.Since(status.Started).Round(time.Second))
+	fmt.Printf("  Cache: %d entries, %d hits, %d misses\n", status.CacheEntries, status.CacheHits, status.CacheMisses)
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Layout of the dashboard
+const (
+	dashboardRows     = 8
+	dashboardErrors   = 3
+	dashboardBarWidth = 20
+	dashboardNameMax  = 40
+)
+
+// DashboardTask is a file or other unit of work shown on a dashboard
+type DashboardTask struct {
+	name     string
+	done     int
+	total    int
+	finished bool
+	err      error
+}
+
+// Dashboard shows the progress of several tasks running in parallel on stderr: a bar per
+// task, the totals and the latest errors, redrawn in place. When stderr isn't a terminal
+// it logs a line as each task finishes instead.
+type Dashboard struct {
+	w       io.Writer
+	live    bool
+	started time.Time
+
+	mu       sync.Mutex
+	tasks    []*DashboardTask
+	errors   []string
+	finished int
+	lines    int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startDashboard starts a dashboard on stderr, drawn live if stderr is a terminal and
+// debug output isn't interleaved with it. Running quietly only errors are logged.
+func startDashboard(debug bool) *Dashboard {
+	d := &Dashboard{
+		w:       os.Stderr,
+		live:    !debug && !quiet && isTerminal(os.Stderr),
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if d.live {
+		go d.run()
+	} else {
+		close(d.done)
+	}
+	return d
+}
+
+// Add adds a task of total steps
+func (d *Dashboard) Add(name string, total int) *DashboardTask {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	task := &DashboardTask{name: name, total: total}
+	d.tasks = append(d.tasks, task)
+	return task
+}
+
+// Step records a step of a task as done
+func (d *Dashboard) Step(task *DashboardTask) {
+	d.mu.Lock()
+	task.done++
+	d.mu.Unlock()
+}
+
+// Finish marks a task as done, or failed with err. Without a live display, message (or
+// the error) is logged.
+func (d *Dashboard) Finish(task *DashboardTask, err error, message string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	task.finished = true
+	task.err = err
+	d.finished++
+	if err != nil {
+		d.errors = append(d.errors, fmt.Sprintf("%s: %s", task.name, redactSecrets(strings.SplitN(err.Error(), "\n", 2)[0])))
+	}
+	if d.live {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(d.w, "%s: error: %s\n", task.name, redactSecrets(err.Error()))
+	} else if message != "" && !quiet {
+		fmt.Fprintln(d.w, message)
+	}
+}
+
+// Failed returns the number of failed tasks
+func (d *Dashboard) Failed() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.errors)
+}
+
+// Err returns the error of the first failed task, or nil
+func (d *Dashboard) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, task := range d.tasks {
+		if task.err != nil {
+			return task.err
+		}
+	}
+	return nil
+}
+
+// Stop draws the dashboard a last time and leaves it on screen
+func (d *Dashboard) Stop() {
+	select {
+	case <-d.stop:
+	default:
+		close(d.stop)
+	}
+	<-d.done
+}
+
+// run redraws the dashboard until stopped
+func (d *Dashboard) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		d.draw(frame)
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			d.draw(frame + 1)
+			return
+		}
+	}
+}
+
+// draw replaces the previous drawing with the current state
+func (d *Dashboard) draw(frame int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// Running tasks are shown first, then as many recently finished ones as fit
+	var running, finished []*DashboardTask
+	for _, task := range d.tasks {
+		if task.finished {
+			finished = append(finished, task)
+		} else {
+			running = append(running, task)
+		}
+	}
+	rows := running
+	for i := len(finished) - 1; i >= 0 && len(rows) < dashboardRows; i-- {
+		rows = append(rows, finished[i])
+	}
+	if len(rows) > dashboardRows {
+		rows = rows[:dashboardRows]
+	}
+
+	width := 0
+	for _, task := range rows {
+		if n := len([]rune(task.name)); n > width {
+			width = n
+		}
+	}
+	if width > dashboardNameMax {
+		width = dashboardNameMax
+	}
+
+	var lines []string
+	done, total := 0, 0
+	for _, task := range d.tasks {
+		done += task.done
+		total += task.total
+	}
+	for _, task := range rows {
+		name := []rune(task.name)
+		if len(name) > width {
+			name = append([]rune("…"), name[len(name)-width+1:]...)
+		}
+		icon := spinnerFrames[frame%len(spinnerFrames)]
+		switch {
+		case task.err != nil:
+			icon = "✗"
+		case task.finished:
+			icon = "✓"
+		}
+		line := fmt.Sprintf("%s %-*s %s %d/%d", icon, width, string(name), progressBar(task.done, task.total, dashboardBarWidth), task.done, task.total)
+		if task.err != nil {
+			line = fmt.Sprintf("%s %-*s failed", icon, width, string(name))
+		}
+		lines = append(lines, line)
+	}
+	if hidden := len(d.tasks) - len(rows); hidden > 0 {
+		lines = append(lines, fmt.Sprintf("  … and %d more", hidden))
+	}
+	summary := fmt.Sprintf("Total: %d/%d files, %d/%d texts", d.finished, len(d.tasks), done, total)
+	if len(d.errors) > 0 {
+		summary += fmt.Sprintf(", %d failed", len(d.errors))
+	}
+	elapsed := time.Since(d.started)
+	summary += fmt.Sprintf(" · %.1fs · %s", elapsed.Seconds(), throughput(done, elapsed))
+	if eta := progressETA(done, total, elapsed); eta != "" {
+		summary += " · ETA " + eta
+	}
+	lines = append(lines, summary)
+	errors := d.errors
+	if len(errors) > dashboardErrors {
+		errors = errors[len(errors)-dashboardErrors:]
+	}
+	for _, err := range errors {
+		lines = append(lines, "! "+err)
+	}
+
+	var b strings.Builder
+	if d.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", d.lines)
+	}
+	for _, line := range lines {
+		fmt.Fprintf(&b, "\r\x1b[K%s\n", line)
+	}
+	// Clear what is left of a longer previous drawing
+	b.WriteString("\x1b[J")
+	fmt.Fprint(d.w, b.String())
+	d.lines = len(lines)
+}
+
+// progressBar draws done out of total as a bar of width cells
+func progressBar(done, total, width int) string {
+	filled := width
+	if total > 0 {
+		filled = done * width / total
+	}
+	return strings.Repeat("█", filled) + strings.Repeat("░", width-filled)
+}
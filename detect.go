@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/urfave/cli/v2"
+)
+
+// stopwords are frequent function words that identify Latin- and Cyrillic-script languages
+var stopwords = map[string][]string{
+	"EN": {"the", "and", "is", "are", "was", "of", "to", "in", "that", "it", "for", "you", "with", "this", "have", "not", "be", "on", "we", "i", "my", "your", "can", "will", "please", "thanks"},
+	"DE": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "ich", "sie", "mit", "auf", "für", "den", "dem", "zu", "wir", "es", "sind", "auch", "bitte", "danke", "wie", "aber"},
+	"FR": {"le", "la", "les", "et", "est", "un", "une", "des", "je", "vous", "nous", "pas", "que", "qui", "pour", "dans", "avec", "sur", "ce", "il", "elle", "merci", "du", "au"},
+	"ES": {"el", "la", "los", "las", "y", "es", "un", "una", "que", "de", "en", "por", "para", "con", "no", "yo", "usted", "gracias", "pero", "muy", "está", "del", "se", "lo"},
+	"IT": {"il", "lo", "la", "gli", "le", "e", "è", "un", "una", "che", "di", "per", "con", "non", "sono", "io", "grazie", "ma", "anche", "della", "questo", "come", "ci", "mi"},
+	"PT": {"o", "a", "os", "as", "e", "é", "um", "uma", "que", "de", "em", "para", "com", "não", "eu", "você", "obrigado", "obrigada", "mas", "muito", "está", "do", "da", "se", "este", "quanto"},
+	"NL": {"de", "het", "een", "en", "is", "niet", "ik", "je", "we", "van", "op", "met", "voor", "dat", "zijn", "ook", "maar", "bedankt", "dank", "wij", "er", "te", "naar", "hoe"},
+	"PL": {"i", "w", "nie", "na", "się", "jest", "to", "że", "z", "do", "jak", "ale", "dziękuję", "proszę", "tak", "czy", "co", "mnie", "jestem", "dla", "od", "po", "już", "bardzo"},
+	"SV": {"och", "är", "att", "det", "en", "ett", "jag", "du", "vi", "inte", "med", "för", "på", "som", "har", "tack", "men", "av", "den", "till", "om", "kan", "var", "hej"},
+	"DA": {"og", "er", "at", "det", "en", "et", "jeg", "du", "vi", "ikke", "med", "for", "på", "som", "har", "tak", "men", "af", "den", "til", "hvad", "gerne", "have", "nogle"},
+	"NB": {"og", "er", "at", "det", "en", "et", "jeg", "du", "vi", "ikke", "med", "for", "på", "som", "har", "takk", "men", "av", "den", "til", "hva", "gjerne", "ha", "noen"},
+	"FI": {"ja", "on", "ei", "se", "että", "hän", "minä", "sinä", "me", "he", "kiitos", "mutta", "tai", "kun", "niin", "myös", "ovat", "oli", "tämä", "mitä"},
+	"CS": {"a", "je", "se", "to", "na", "v", "že", "s", "z", "ale", "jak", "jsem", "není", "děkuji", "prosím", "velmi", "také", "co", "už", "být", "venku"},
+	"SK": {"a", "je", "sa", "to", "na", "v", "že", "s", "z", "ale", "ako", "som", "nie", "ďakujem", "prosím", "veľmi", "tiež", "čo", "už", "byť", "vonku"},
+	"SL": {"in", "je", "se", "da", "na", "v", "ki", "z", "ne", "pa", "za", "so", "sem", "hvala", "prosim", "zelo", "tudi", "kaj", "že", "biti"},
+	"RO": {"și", "este", "în", "de", "la", "nu", "că", "cu", "pe", "un", "o", "sunt", "mulțumesc", "vă", "rog", "dar", "pentru", "care", "mai", "foarte"},
+	"HU": {"a", "az", "és", "hogy", "nem", "egy", "van", "is", "meg", "de", "köszönöm", "kérem", "vagy", "már", "még", "csak", "nagyon", "ez", "én", "mi"},
+	"TR": {"ve", "bir", "bu", "da", "de", "için", "ile", "ne", "çok", "ben", "sen", "biz", "değil", "var", "yok", "teşekkürler", "ama", "gibi", "daha", "mı", "mi", "evet", "hayır", "olarak"},
+	"ID": {"dan", "yang", "di", "ini", "itu", "dengan", "untuk", "tidak", "saya", "anda", "kami", "ada", "akan", "dari", "ke", "terima", "kasih", "juga", "sudah", "ingin"},
+	"ET": {"ja", "on", "ei", "see", "et", "ma", "sa", "me", "nad", "aitäh", "palun", "aga", "või", "kui", "ka", "oli", "väga", "mis", "täna", "ilm"},
+	"LV": {"un", "ir", "ar", "uz", "no", "par", "ka", "es", "tu", "mēs", "nav", "paldies", "lūdzu", "bet", "arī", "ļoti", "kas", "šodien", "vai", "tas"},
+	"LT": {"ir", "yra", "su", "į", "iš", "kad", "aš", "tu", "mes", "ne", "ačiū", "prašau", "bet", "taip", "pat", "labai", "kas", "šiandien", "ar", "tai"},
+	"RU": {"и", "в", "не", "на", "что", "я", "с", "он", "как", "это", "по", "но", "вы", "мы", "очень", "спасибо", "пожалуйста", "сегодня", "улице", "так"},
+	"UK": {"і", "й", "в", "не", "на", "що", "я", "з", "він", "як", "це", "по", "але", "ви", "ми", "дуже", "дякую", "будь", "сьогодні", "вулиці"},
+	"BG": {"и", "в", "не", "на", "че", "аз", "с", "той", "как", "това", "по", "но", "вие", "ние", "много", "благодаря", "моля", "днес", "навън", "е"},
+}
+
+// letterHints are letters that point to one Latin- or Cyrillic-script language
+var letterHints = map[rune]string{
+	'ß': "DE",
+	'ñ': "ES", '¿': "ES", '¡': "ES",
+	'ã': "PT",
+	'ł': "PL", 'ą': "PL", 'ę': "PL", 'ś': "PL", 'ź': "PL", 'ż': "PL",
+	'ğ': "TR", 'ı': "TR",
+	'œ': "FR",
+	'ř': "CS", 'ů': "CS", 'ě': "CS",
+	'ľ': "SK", 'ĺ': "SK", 'ŕ': "SK", 'ô': "SK",
+	'ș': "RO", 'ț': "RO", 'ă': "RO",
+	'ő': "HU", 'ű': "HU",
+	'ā': "LV", 'ē': "LV", 'ī': "LV", 'ļ': "LV", 'ņ': "LV", 'ģ': "LV", 'ķ': "LV",
+	'ė': "LT", 'į': "LT", 'ų': "LT",
+	'ы': "RU", 'э': "RU", 'ё': "RU",
+	'і': "UK", 'ї': "UK", 'є': "UK", 'ґ': "UK",
+}
+
+// detectLanguage guesses the base DeepL code of text offline, from its script and, for
+// Latin and Cyrillic script, character n-grams and function words. It returns "" when
+// there's too little to go on.
+func detectLanguage(text string) string {
+	scores := detectLanguageScores(text)
+	if len(scores) == 0 {
+		return ""
+	}
+	if len(scores) > 1 && scores[0].Score-scores[1].Score < minDetectMargin {
+		return ""
+	}
+	return scores[0].Lang
+}
+
+// languageScore is how well text matches a language; higher is better
+type languageScore struct {
+	Lang  string
+	Score float64
+}
+
+// minDetectMargin is how much better than the runner-up the best language must score
+const minDetectMargin = 0.1
+
+// detectLanguageScores ranks the languages text may be in, best first
+func detectLanguageScores(text string) []languageScore {
+	var latin, cyrillic int
+	scripts := make(map[string]int)
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			scripts["JA"] += 2
+		case unicode.Is(unicode.Han, r):
+			scripts["ZH"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["KO"]++
+		case unicode.Is(unicode.Thai, r):
+			scripts["TH"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["EL"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["AR"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["HE"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+
+	// Japanese mixes kanji with kana, so any kana makes Han text Japanese
+	if scripts["JA"] > 0 {
+		scripts["JA"] += scripts["ZH"]
+		delete(scripts, "ZH")
+	}
+	best, bestCount := "", 0
+	for lang, count := range scripts {
+		if count > bestCount || count == bestCount && lang < best {
+			best, bestCount = lang, count
+		}
+	}
+	if bestCount > latin && bestCount > cyrillic {
+		// Scripts used by a single language need no further analysis
+		return []languageScore{{Lang: best, Score: 1}}
+	}
+
+	switch {
+	case cyrillic > latin:
+		return scoreNgrams(text, "cyrillic")
+	case latin > 0:
+		return scoreNgrams(text, "latin")
+	}
+	return nil
+}
+
+//go:embed langdata/*.txt
+var langdata embed.FS
+
+// languageProfile holds the n-gram log probabilities of one language, learned from a
+// sample text in langdata/
+type languageProfile struct {
+	lang    string
+	script  string
+	logProb map[string]float64
+	// unseen is the log probability of an n-gram missing from the sample
+	unseen float64
+}
+
+var (
+	profilesOnce sync.Once
+	profiles     []*languageProfile
+)
+
+// languageProfiles builds the profiles from the embedded samples on first use
+func languageProfiles() []*languageProfile {
+	profilesOnce.Do(func() {
+		files, _ := langdata.ReadDir("langdata")
+		for _, file := range files {
+			sample, err := langdata.ReadFile("langdata/" + file.Name())
+			if err != nil {
+				continue
+			}
+			counts := make(map[string]int)
+			total := 0
+			for _, gram := range ngrams(string(sample)) {
+				counts[gram]++
+				total++
+			}
+
+			script := "latin"
+			for _, r := range string(sample) {
+				if unicode.Is(unicode.Cyrillic, r) {
+					script = "cyrillic"
+					break
+				}
+			}
+
+			// Additive smoothing, assuming a few thousand possible n-grams
+			const alpha, vocabulary = 0.5, 4000.0
+			denominator := float64(total) + alpha*vocabulary
+			profile := &languageProfile{
+				lang:    strings.ToUpper(strings.TrimSuffix(file.Name(), ".txt")),
+				script:  script,
+				logProb: make(map[string]float64, len(counts)),
+				unseen:  math.Log(alpha / denominator),
+			}
+			for gram, count := range counts {
+				profile.logProb[gram] = math.Log((float64(count) + alpha) / denominator)
+			}
+			profiles = append(profiles, profile)
+		}
+	})
+	return profiles
+}
+
+// ngrams returns the letter unigrams, bigrams and trigrams of text, lower-cased, with
+// words padded by spaces so word starts and ends count
+func ngrams(text string) []string {
+	var grams []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		runes := []rune(" " + word + " ")
+		for n := 1; n <= 3; n++ {
+			for i := 0; i+n <= len(runes); i++ {
+				if n == 1 && runes[i] == ' ' {
+					continue
+				}
+				grams = append(grams, string(runes[i:i+n]))
+			}
+		}
+	}
+	return grams
+}
+
+// scoreNgrams ranks the languages of a script by the average log probability of the n-grams
+// of text, plus a bonus for function words and distinctive letters
+func scoreNgrams(text, script string) []languageScore {
+	grams := ngrams(text)
+	if len(grams) < 6 {
+		return nil
+	}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	var scores []languageScore
+	for _, profile := range languageProfiles() {
+		if profile.script != script {
+			continue
+		}
+		sum := 0.0
+		for _, gram := range grams {
+			if p, ok := profile.logProb[gram]; ok {
+				sum += p
+			} else {
+				sum += profile.unseen
+			}
+		}
+		score := sum / float64(len(grams))
+
+		hits := 0
+		for _, word := range words {
+			for _, stopword := range stopwords[profile.lang] {
+				if word == stopword {
+					hits++
+					break
+				}
+			}
+		}
+		for _, r := range strings.ToLower(text) {
+			if letterHints[r] == profile.lang {
+				hits++
+			}
+		}
+		score += 0.5 * float64(hits) / float64(len(words)+1)
+
+		scores = append(scores, languageScore{Lang: profile.lang, Score: score})
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	return scores
+}
+
+// detectSource detects the language of text with the server, or with the offline detector
+// when offline is set or the server fails. The returned bool reports an offline result.
+func detectSource(ctx context.Context, client *Client, text string, offline bool) (string, bool, error) {
+	if !offline {
+		lang, err := client.Detect(ctx, text)
+		if err == nil {
+			return lang, false, nil
+		}
+		if client.Debug {
+			debugf("Server detection failed, using the offline detector: %s\n", strings.SplitN(err.Error(), "\n", 2)[0])
+		}
+	}
+
+	lang := detectLanguage(text)
+	if lang == "" {
+		return "", true, errors.New("could not detect the language offline; the text may be too short")
+	}
+	return lang, true, nil
+}
+
+// detectResult is the JSON output of the detect command
+type detectResult struct {
+	Schema     int    `json:"schema"`
+	SourceLang string `json:"source_lang"`
+	SourceTag  string `json:"source_tag"`
+	Offline    bool   `json:"offline"`
+}
+
+// runDetect handles the detect command, reading the text from the arguments or stdin
+func runDetect(c *cli.Context) error {
+	args, err := parseTrailingFlags(c)
+	if err != nil {
+		return cli.Exit(err.Error(), ExitUsage)
+	}
+	text := strings.Join(args, " ")
+	if text == "" && !isTerminal(os.Stdin) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+		}
+		text = string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		return cli.Exit("Usage: translate detect TEXT", ExitUsage)
+	}
+
+	// Skipping text already in English would report it without asking the server
+	client := sharedClient(c)
+	client.SkipTranslated = false
+	lang, offline, err := detectSource(c.Context, client, text, c.Bool("offline"))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Detection error: %s", err), 1)
+	}
+
+	result := detectResult{Schema: SchemaVersion, SourceLang: lang, SourceTag: toBCP47(lang), Offline: offline}
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	line := fmt.Sprintf("%s (%s)", paint(colorEnabled(os.Stdout), ansiGreen, result.SourceLang), result.SourceTag)
+	if offline {
+		line += " [offline]"
+	}
+	fmt.Println(line)
+	return nil
+}
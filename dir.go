@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+// translateIgnoreFile lists patterns of files dir leaves out, one per line, in the
+// directory translated
+const translateIgnoreFile = ".translateignore"
+
+// dirDefaultInclude are the files dir translates unless --include is given
+var dirDefaultInclude = []string{"*.md", "*.markdown", "*.txt", "*.html", "*.htm"}
+
+// dirPatterns matches paths relative to the directory translated against glob patterns.
+// A pattern without a slash matches a file or directory name anywhere in the tree; one
+// with a slash matches the path from the top, and a directory matched takes its files.
+type dirPatterns []string
+
+// match reports whether the slash-separated relative path rel matches a pattern
+func (p dirPatterns) match(rel string) bool {
+	for _, pattern := range p {
+		pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "/")
+		if pattern == "" {
+			continue
+		}
+		if !strings.Contains(pattern, "/") {
+			for _, name := range strings.Split(rel, "/") {
+				if ok, _ := path.Match(pattern, name); ok {
+					return true
+				}
+			}
+			continue
+		}
+		for prefix := rel; prefix != "."; prefix = path.Dir(prefix) {
+			if ok, _ := path.Match(pattern, prefix); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadTranslateIgnore reads the patterns of the .translateignore file in root, if any
+func loadTranslateIgnore(root string) (dirPatterns, error) {
+	f, err := os.Open(filepath.Join(root, translateIgnoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns dirPatterns
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+// dirPart is a piece of a file: text to translate, or text kept as it is
+type dirPart struct {
+	text      string
+	translate bool
+}
+
+// splitParagraphs splits a text file into paragraphs to translate and the blank lines
+// between them. In Markdown, front matter and fenced code blocks are kept as they are.
+func splitParagraphs(data string, markdown bool) []dirPart {
+	var parts []dirPart
+	var paragraph strings.Builder
+	flush := func() {
+		if paragraph.Len() == 0 {
+			return
+		}
+		text := paragraph.String()
+		trimmed := strings.TrimRight(text, "\r\n")
+		parts = append(parts, dirPart{text: trimmed, translate: true}, dirPart{text: text[len(trimmed):]})
+		paragraph.Reset()
+	}
+
+	lines := strings.SplitAfter(data, "\n")
+	fence := ""
+	for i, line := range lines {
+		bare := strings.TrimSpace(line)
+		switch {
+		case markdown && i == 0 && bare == "---":
+			// Front matter runs to the next --- line
+			fence = "---"
+			parts = append(parts, dirPart{text: line})
+		case fence != "":
+			parts = append(parts, dirPart{text: line})
+			if strings.HasPrefix(bare, fence) {
+				fence = ""
+			}
+		case markdown && (strings.HasPrefix(bare, "```") || strings.HasPrefix(bare, "~~~")):
+			flush()
+			fence = bare[:3]
+			parts = append(parts, dirPart{text: line})
+		case bare == "":
+			flush()
+			parts = append(parts, dirPart{text: line})
+		default:
+			paragraph.WriteString(line)
+		}
+	}
+	flush()
+	return parts
+}
+
+// dirJob is the translation of a file of the tree
+type dirJob struct {
+	path string
+	rel  string
+	out  string
+	// merge is how the translation is merged into an existing file at out
+	merge mergeMode
+}
+
+// translateDirFile translates a file of the tree as fits its format and writes it to the
+// mirrored path, showing its progress as a task of the dashboard
+func translateDirFile(ctx context.Context, client *Client, job dirJob, sourceLang, targetLang string, dashboard *Dashboard) {
+	name := fmt.Sprintf("%s → %s", job.rel, toBCP47(targetLang))
+	data, err := os.ReadFile(job.path)
+	if err != nil {
+		dashboard.Finish(dashboard.Add(name, 0), err, "")
+		return
+	}
+
+	text, layout := splitLayout(data)
+	ext := strings.ToLower(filepath.Ext(job.path))
+	switch ext {
+	case ".po", ".pot", ".yaml", ".yml", ".json", ".arb":
+		file, err := parseLocaleFile(job.path, text)
+		if err != nil {
+			dashboard.Finish(dashboard.Add(name, 0), err, "")
+			return
+		}
+		translations, todo := make(map[*localeEntry][]string), file.entries
+		if job.merge.enabled {
+			if translations, todo, err = mergeLocale(file, job.path, job.out, job.merge); err != nil {
+				dashboard.Finish(dashboard.Add(name, 0), err, "")
+				return
+			}
+		}
+		total := 0
+		for _, entry := range todo {
+			total += len(entry.Texts)
+		}
+		task := dashboard.Add(name, total)
+		for _, entry := range todo {
+			for _, text := range entry.Texts {
+				resp, _, err := client.Translate(ctx, text, sourceLang, targetLang)
+				if err != nil {
+					dashboard.Finish(task, fmt.Errorf("%q: %v", text, err), "")
+					return
+				}
+				translations[entry] = append(translations[entry], resp.Data)
+				dashboard.Step(task)
+			}
+		}
+		output := file.render(translations)
+		if ext == ".yaml" || ext == ".yml" {
+			output = renameYAMLRoot(output, targetLang)
+		}
+		err = writeDirFile(job.out, layout.restore(output))
+		dashboard.Finish(task, err, fmt.Sprintf("Translated %s", job.out))
+		return
+	case ".html", ".htm", ".xml", ".svg":
+		mode := TagHandlingHTML
+		if ext == ".xml" || ext == ".svg" {
+			mode = TagHandlingXML
+		}
+		if job.merge.enabled {
+			// Markup is translated as a whole, so there are no gaps to fill in a translation
+			if _, err := os.Stat(job.out); err == nil {
+				dashboard.Finish(dashboard.Add(name, 0), nil, fmt.Sprintf("Kept %s", job.out))
+				return
+			}
+		}
+		opts := translateOptions(ctx)
+		opts.TagHandling = mode
+		task := dashboard.Add(name, 1)
+		resp, _, err := client.Translate(withTranslateOptions(ctx, opts), text, sourceLang, targetLang)
+		if err != nil {
+			dashboard.Finish(task, err, "")
+			return
+		}
+		dashboard.Step(task)
+		err = writeDirFile(job.out, layout.restore(resp.Data))
+		dashboard.Finish(task, err, fmt.Sprintf("Translated %s", job.out))
+		return
+	}
+
+	markdown := ext == ".md" || ext == ".markdown"
+	parts := splitParagraphs(text, markdown)
+	segments := translatableSegments(parts)
+	kept := make([]*existingTranslation, len(segments))
+	if job.merge.enabled {
+		existing, _, err := readTarget(job.out)
+		if err == nil {
+			kept, err = mergeParagraphs(segments, existing, markdown, job.merge)
+		}
+		if err != nil {
+			dashboard.Finish(dashboard.Add(name, 0), err, "")
+			return
+		}
+	}
+	total := 0
+	for _, translation := range kept {
+		if translation == nil {
+			total++
+		}
+	}
+	task := dashboard.Add(name, total)
+	var b strings.Builder
+	segment := 0
+	for _, part := range parts {
+		if !part.translate {
+			b.WriteString(part.text)
+			continue
+		}
+		translation := kept[segment]
+		segment++
+		if translation == nil {
+			resp, _, err := client.Translate(ctx, part.text, sourceLang, targetLang)
+			if err != nil {
+				dashboard.Finish(task, err, "")
+				return
+			}
+			dashboard.Step(task)
+			translation = &existingTranslation{texts: []string{resp.Data}, annotated: job.merge.enabled}
+		}
+		// Only Markdown has comments to annotate paragraphs with
+		if translation.annotated && markdown && job.merge.annotation != "" {
+			b.WriteString(markdownAnnotation(job.merge.annotation))
+		}
+		b.WriteString(translation.texts[0])
+	}
+	err = writeDirFile(job.out, layout.restore(b.String()))
+	dashboard.Finish(task, err, fmt.Sprintf("Translated %s", job.out))
+}
+
+// writeDirFile writes a translated file, creating the directories of its path
+func writeDirFile(out, text string) error {
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(out, []byte(text), 0644)
+}
+
+// findDirJobs walks root for the files to translate, mirroring their paths under out.
+// The output directory is skipped should it be inside root.
+func findDirJobs(root, out string, include, exclude dirPatterns) ([]dirJob, error) {
+	absOut, _ := filepath.Abs(out)
+	var jobs []dirJob
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if abs, _ := filepath.Abs(p); abs == absOut {
+			return filepath.SkipDir
+		}
+		if exclude.match(rel) || d.Name() == translateIgnoreFile {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() || !include.match(rel) {
+			return nil
+		}
+		jobs = append(jobs, dirJob{path: p, rel: rel, out: filepath.Join(out, filepath.FromSlash(rel))})
+		return nil
+	})
+	return jobs, err
+}
+
+// runDir handles the dir command, translating the files of a directory tree into a
+// mirrored tree, several at a time
+func runDir(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return cli.Exit("Usage: translate -t LANG dir --out DIR [--include GLOB] [--exclude GLOB] DIR", ExitUsage)
+	}
+	root := c.Args().First()
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		return cli.Exit(fmt.Sprintf("Dir error: %s is not a directory", root), ExitUsage)
+	}
+	targets := splitLangList(c.String("target"))
+	out := c.String("out")
+	if out == "" {
+		return cli.Exit("Dir error: --out is required", ExitUsage)
+	}
+	if len(targets) != 1 && !strings.Contains(out, "{lang}") {
+		return cli.Exit("Dir error: translating into several languages needs {lang} in --out, e.g. docs.{lang}", ExitUsage)
+	}
+
+	include := dirPatterns(c.StringSlice("include"))
+	if len(include) == 0 {
+		include = dirDefaultInclude
+	}
+	exclude := dirPatterns(c.StringSlice("exclude"))
+	ignored, err := loadTranslateIgnore(root)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Dir error: %s", err), 1)
+	}
+	exclude = append(exclude, ignored...)
+	if project != nil {
+		exclude = append(exclude, project.Ignore...)
+	}
+
+	merge := mergeModeFor(c)
+	config := configFor(c.Context)
+	type target struct {
+		lang string
+		job  dirJob
+	}
+	var jobs []target
+	for _, t := range targets {
+		targetLang := resolveTargetVariant(toDeepLCode(t, false), config.VariantPreferences, false)
+		dirJobs, err := findDirJobs(root, strings.ReplaceAll(out, "{lang}", toBCP47(targetLang)), include, exclude)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Dir error: %s", err), 1)
+		}
+		for _, job := range dirJobs {
+			job.merge = merge
+			jobs = append(jobs, target{lang: targetLang, job: job})
+		}
+	}
+	if len(jobs) == 0 {
+		hint("No files in %s match %s\n", root, strings.Join(include, ", "))
+		return nil
+	}
+
+	client := sharedClient(c)
+	sourceLang := toDeepLCode(c.String("source"), true)
+	workers := c.Int("jobs")
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	dashboard := startDashboard(c.Bool("debug"))
+	queue := make(chan target)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				translateDirFile(c.Context, client, t.job, sourceLang, t.lang, dashboard)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+	dashboard.Stop()
+
+	if failed := dashboard.Failed(); failed > 0 {
+		code := ExitPartial
+		if failed == len(jobs) {
+			code = exitCodeFor(dashboard.Err())
+		}
+		return cli.Exit(fmt.Sprintf("Dir error: %d of %d files failed", failed, len(jobs)), code)
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// docHandle identifies a document uploaded to the official DeepL API
+type docHandle struct {
+	DocumentID  string `json:"document_id"`
+	DocumentKey string `json:"document_key"`
+}
+
+// docStatus is the translation status of an uploaded document
+type docStatus struct {
+	Status           string `json:"status"`
+	SecondsRemaining int    `json:"seconds_remaining"`
+	BilledCharacters int    `json:"billed_characters"`
+	ErrorMessage     string `json:"error_message"`
+}
+
+// docOutputPath names the translated copy of a document after its target language,
+// e.g. report.docx → report.de.docx
+func docOutputPath(path, targetLang string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + strings.ToLower(toBCP47(targetLang)) + ext
+}
+
+// uploadDocument starts the translation of a document
+func uploadDocument(ctx context.Context, conn ProviderConn, path, sourceLang, targetLang, formality string) (*docHandle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	fields := map[string]string{"target_lang": targetLang, "source_lang": sourceLang, "formality": formality}
+	for name, value := range fields {
+		if value != "" {
+			form.WriteField(name, value)
+		}
+	}
+	part, err := form.CreateFormFile("file", filepath.Base(path))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, err
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	target, err := url.JoinPath(conn.Server, "/v2/document")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	data, err := providerSend(conn, req, deepLProvider{}.authorize)
+	if err != nil {
+		return nil, err
+	}
+
+	var handle docHandle
+	if err := json.Unmarshal(data, &handle); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+	if handle.DocumentID == "" || handle.DocumentKey == "" {
+		return nil, fmt.Errorf("upload failed: no document ID in response")
+	}
+	return &handle, nil
+}
+
+// documentStatus asks how far the translation of a document is
+func documentStatus(ctx context.Context, conn ProviderConn, handle *docHandle) (*docStatus, error) {
+	var status docStatus
+	body := map[string]string{"document_key": handle.DocumentKey}
+	if err := providerRequest(ctx, conn, http.MethodPost, "/v2/document/"+url.PathEscape(handle.DocumentID), body, deepLProvider{}.authorize, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// downloadDocument fetches a translated document; the API allows this only once
+func downloadDocument(ctx context.Context, conn ProviderConn, handle *docHandle) ([]byte, error) {
+	target, err := url.JoinPath(conn.Server, "/v2/document", url.PathEscape(handle.DocumentID), "result")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	data, err := json.Marshal(map[string]string{"document_key": handle.DocumentKey})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return providerSend(conn, req, deepLProvider{}.authorize)
+}
+
+// waitForDocument polls the status of a document until it is translated, printing
+// progress on stderr whenever it changes
+func waitForDocument(ctx context.Context, conn ProviderConn, handle *docHandle, interval time.Duration) error {
+	var last string
+	for {
+		status, err := documentStatus(ctx, conn, handle)
+		if err != nil {
+			return err
+		}
+		line := status.Status
+		if status.Status == "translating" && status.SecondsRemaining > 0 {
+			line += fmt.Sprintf(" (about %ds remaining)", status.SecondsRemaining)
+		}
+		if line != last {
+			fmt.Fprintf(os.Stderr, "Status: %s\n", line)
+			last = line
+		}
+
+		switch status.Status {
+		case "done":
+			if status.BilledCharacters > 0 {
+				fmt.Fprintf(os.Stderr, "Billed characters: %d\n", status.BilledCharacters)
+			}
+			return nil
+		case "error":
+			if status.ErrorMessage == "" {
+				status.ErrorMessage = "unknown error"
+			}
+			return fmt.Errorf("translation failed: %s", status.ErrorMessage)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// runDoc handles the doc command: upload a document to the official DeepL API, wait for
+// its translation and save the translated file
+func runDoc(c *cli.Context) error {
+	if c.String("provider") != ProviderDeepL {
+		return cli.Exit("Document error: document translation needs the official DeepL API (--provider deepl)", 1)
+	}
+	path := c.Args().First()
+	if path == "" {
+		return cli.Exit("Document error: no document given", 1)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Document error: %s", err), 1)
+	}
+	targets := splitLangList(c.String("target"))
+	if len(targets) != 1 {
+		return cli.Exit("Document error: documents are translated into one target language at a time", 1)
+	}
+	targetLang := toDeepLCode(targets[0], false)
+	sourceLang := toDeepLCode(c.String("source"), true)
+	if strings.EqualFold(sourceLang, "auto") {
+		sourceLang = ""
+	}
+	sourceLang = baseLanguage(sourceLang)
+	out := c.String("out")
+	if out == "" {
+		out = docOutputPath(path, targetLang)
+	}
+
+	headers, _ := customHeaders(c)
+	conn := ProviderConn{
+		HTTPClient: withHeaders(&http.Client{Timeout: time.Duration(c.Int("timeout")) * time.Second}, headers),
+		Server:     c.String("url"),
+		Token:      c.String("token"),
+		Debug:      c.Bool("debug"),
+	}
+	ctx := c.Context
+
+	fmt.Fprintf(os.Stderr, "Uploading %s (%d KB)\n", filepath.Base(path), (info.Size()+1023)/1024)
+	handle, err := uploadDocument(ctx, conn, path, sourceLang, targetLang, translateOptions(ctx).Formality)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Document error: %s", err), 1)
+	}
+
+	if err := waitForDocument(ctx, conn, handle, c.Duration("poll-interval")); err != nil {
+		return cli.Exit(fmt.Sprintf("Document error: %s", err), 1)
+	}
+
+	data, err := downloadDocument(ctx, conn, handle)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Document error: %s", err), 1)
+	}
+	if err := os.WriteFile(out, data, 0644); err != nil {
+		return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+	}
+	fmt.Fprintf(os.Stderr, "Saved %s\n", out)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Docker settings used when setup starts a local DeepLX server
+const (
+	DockerImage         = "ghcr.io/owo-network/deeplx:latest"
+	DockerContainerName = "deeplx"
+	DockerPort          = "1188"
+)
+
+// dockerAvailable reports whether the docker CLI is installed and the daemon is reachable
+func dockerAvailable() bool {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return false
+	}
+	return exec.Command("docker", "info", "--format", "{{.ServerVersion}}").Run() == nil
+}
+
+// startDockerServer starts (or restarts) the DeepLX container and waits for it to answer on serverURL
+func startDockerServer(serverURL string, wait time.Duration) error {
+	// Reuse an existing container rather than failing on the name conflict
+	out, err := exec.Command("docker", "ps", "-a",
+		"--filter", "name=^"+DockerContainerName+"$",
+		"--format", "{{.Names}}").Output()
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	var cmd *exec.Cmd
+	if strings.TrimSpace(string(out)) == DockerContainerName {
+		cmd = exec.Command("docker", "start", DockerContainerName)
+	} else {
+		cmd = exec.Command("docker", "run", "-d",
+			"--name", DockerContainerName,
+			"--restart", "unless-stopped",
+			// DeepLX has no authentication here, so it is only reachable from this machine
+			"-p", "127.0.0.1:"+DockerPort+":"+DockerPort,
+			DockerImage)
+	}
+
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("docker failed: %v\n%s", err, strings.TrimSpace(string(output)))
+	}
+
+	// Wait for the server inside the container to come up
+	deadline := time.Now().Add(wait)
+	for {
+		err := checkServerConnection(serverURL, 2*time.Second)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("container started but server did not become ready within %s", wait)
+		}
+		time.Sleep(time.Second)
+	}
+}
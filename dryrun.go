@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Segments returns the texts Translate would send for text, split into language runs and
+// chunks the same way, without sending anything. Texts passed through as they are, such as
+// those --skip-translated skips, aren't among them.
+func (cl *Client) Segments(ctx context.Context, text, sourceLang, targetLang string) []string {
+	if cl.SkipTranslated && detectLanguage(text) == baseLanguage(targetLang) {
+		return nil
+	}
+	text, _ = cl.Glossary.mask(text, targetLang)
+
+	split := func(text, sourceLang string) []string {
+		if translateOptions(ctx).TagHandling == "" {
+			if chunks := chunkText(text, sourceLang, cl.ChunkSize); chunks != nil {
+				var segments []string
+				for _, chunk := range chunks {
+					if chunk.Text != "" {
+						segments = append(segments, chunk.Text)
+					}
+				}
+				return segments
+			}
+		}
+		return []string{text}
+	}
+
+	var runs []languageRun
+	if translateOptions(ctx).TagHandling == "" {
+		runs = cl.languageRuns(text, sourceLang)
+	}
+	if len(runs) <= 1 {
+		return split(text, sourceLang)
+	}
+	var segments []string
+	for _, run := range runs {
+		if run.Text == "" || cl.KeepTargetRuns && run.Lang == baseLanguage(targetLang) {
+			continue
+		}
+		lang := run.Lang
+		if lang == "" {
+			lang = "AUTO"
+		}
+		segments = append(segments, split(run.Text, lang)...)
+	}
+	return segments
+}
+
+// dryRunTarget is what a dry run would send for one target language
+type dryRunTarget struct {
+	TargetLang string `json:"target_lang"`
+	Tag        string `json:"tag"`
+	Segments   int    `json:"segments"`
+	Characters int    `json:"characters"`
+}
+
+// dryRunBudget is how the characters of a dry run compare with the budget
+type dryRunBudget struct {
+	Limit   int64  `json:"limit"`
+	Period  string `json:"period"`
+	Used    int64  `json:"used"`
+	Exceeds bool   `json:"exceeds"`
+}
+
+// dryRunOutput is the JSON output of --dry-run
+type dryRunOutput struct {
+	Schema   int            `json:"schema"`
+	Provider string         `json:"provider"`
+	Targets  []dryRunTarget `json:"targets"`
+	// Requests is the number of translation requests, not counting retries
+	Requests   int `json:"requests"`
+	Characters int `json:"characters"`
+	// QuotaCharacters is what the official DeepL API would take from the plan's quota
+	QuotaCharacters int           `json:"quota_characters,omitempty"`
+	Budget          *dryRunBudget `json:"budget,omitempty"`
+}
+
+// runDryRun reports what translating text into targetLangs would send, without sending it
+func runDryRun(c *cli.Context, client *Client, text, sourceLang string, targetLangs []string) error {
+	output := dryRunOutput{Schema: SchemaVersion, Provider: client.providerName(), Targets: []dryRunTarget{}}
+	for _, targetLang := range targetLangs {
+		target := dryRunTarget{TargetLang: targetLang, Tag: toBCP47(targetLang)}
+		for _, segment := range client.Segments(c.Context, text, sourceLang, targetLang) {
+			target.Segments++
+			target.Characters += utf8.RuneCountInString(segment)
+		}
+		output.Targets = append(output.Targets, target)
+		output.Requests += target.Segments
+		output.Characters += target.Characters
+	}
+	// The official API bills the characters of the source text per target language
+	if output.Provider == ProviderDeepL {
+		output.QuotaCharacters = output.Characters
+	}
+	if b := client.Budget; b != nil {
+		used := b.Used()
+		output.Budget = &dryRunBudget{Limit: b.Limit, Period: b.Period, Used: used, Exceeds: used+int64(output.Characters) > b.Limit}
+	}
+
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(output)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Println("Dry run, nothing was sent:")
+	for _, target := range output.Targets {
+		fmt.Printf("  %-8s %4d segments  %8d characters\n", target.Tag, target.Segments, target.Characters)
+	}
+	tags := make([]string, len(output.Targets))
+	for i, target := range output.Targets {
+		tags[i] = target.Tag
+	}
+	fmt.Printf("  Requests: %d to %s (%s), not counting retries\n", output.Requests, output.Provider, strings.Join(tags, ", "))
+	fmt.Printf("  Characters: %d\n", output.Characters)
+	if output.QuotaCharacters > 0 {
+		fmt.Printf("  Quota: %d characters of the plan's quota\n", output.QuotaCharacters)
+	}
+	if budget := output.Budget; budget != nil {
+		verdict := "within the budget"
+		if budget.Exceeds {
+			verdict = "would exceed the budget"
+		}
+		fmt.Printf("  Budget: %d used of %d per %s, %s\n", budget.Used, budget.Limit, budget.Period, verdict)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// entityPattern matches named, decimal and hexadecimal HTML character references
+var entityPattern = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z][a-zA-Z0-9]*);`)
+
+// decodeEntities decodes the HTML entities of text, so the engine sees the characters
+// they stand for. It returns how each character decoded was written, for encodeEntities.
+func decodeEntities(text string) (string, map[rune]string) {
+	written := make(map[rune]string)
+	decoded := entityPattern.ReplaceAllStringFunc(text, func(entity string) string {
+		s := html.UnescapeString(entity)
+		if r, size := utf8.DecodeRuneInString(s); s != entity && size == len(s) {
+			if _, ok := written[r]; !ok {
+				written[r] = entity
+			}
+		}
+		return s
+	})
+	return decoded, written
+}
+
+// encodeEntities encodes the characters special to HTML (&, < and >) of text, and those
+// written as entities in the input, the way they were written there
+func encodeEntities(text string, written map[rune]string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if entity, ok := written[r]; ok {
+			b.WriteString(entity)
+			continue
+		}
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
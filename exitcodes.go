@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Exit statuses, stable so scripts can branch on them rather than on error messages.
+// They are listed in the readme and the man page; new ones are only ever added.
+const (
+	ExitOK         = 0
+	ExitFailure    = 1 // Any failure not listed below
+	ExitUsage      = 2 // Invalid arguments or flags, or no text to translate
+	ExitConnection = 3 // The server couldn't be reached or timed out
+	ExitAuth       = 4 // The server refused the token or session
+	ExitRateLimit  = 5 // Rate limited, or the plan's quota or the character budget used up
+	ExitLanguage   = 6 // A language isn't supported
+	ExitPartial    = 7 // Some items of a batch or some files failed, the others were translated
+)
+
+// exitCodes describes the exit statuses for the man page and the readme
+var exitCodes = [][2]string{
+	{"0", "Success"},
+	{"1", "Any failure not listed below"},
+	{"2", "Invalid arguments or flags, or no text to translate"},
+	{"3", "The server couldn't be reached or timed out"},
+	{"4", "The server refused the token or session"},
+	{"5", "Rate limited, or the plan's quota or the character budget used up"},
+	{"6", "A language isn't supported"},
+	{"7", "Some items of a batch or some files failed, the others were translated"},
+}
+
+// BudgetError is returned when sending a text would exceed the character budget
+type BudgetError struct {
+	Message string
+}
+
+func (e *BudgetError) Error() string {
+	return e.Message
+}
+
+// LanguageError is returned for a language the provider doesn't support
+type LanguageError struct {
+	Message string
+}
+
+func (e *LanguageError) Error() string {
+	return e.Message
+}
+
+// exitCodeFor classifies a translation error into its exit status
+func exitCodeFor(err error) int {
+	var statusErr *StatusError
+	var budgetErr *BudgetError
+	var langErr *LanguageError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &budgetErr):
+		return ExitRateLimit
+	case errors.As(err, &langErr):
+		return ExitLanguage
+	case errors.As(err, &statusErr):
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode == 456:
+			return ExitRateLimit
+		case isAuthFailure(err):
+			return ExitAuth
+		case isVariantRejection(err):
+			return ExitLanguage
+		case isServerDown(err):
+			return ExitConnection
+		}
+		return ExitFailure
+	case errors.Is(err, context.DeadlineExceeded) || isServerDown(err):
+		return ExitConnection
+	case isSessionExpired(err):
+		return ExitAuth
+	case isVariantRejection(err):
+		return ExitLanguage
+	}
+	if msg := err.Error(); strings.Contains(msg, "Client.Timeout") || strings.Contains(msg, "i/o timeout") {
+		return ExitConnection
+	}
+	return ExitFailure
+}
+
+// translationExit returns the exit error of a failed translation, with the status of its class
+func translationExit(err error) error {
+	return cli.Exit(fmt.Sprintf("Translation error: %s", errorAdvice(err)), exitCodeFor(err))
+}
+
+// knownLanguage reports whether DeepL has the language of a DeepL code, or its base language
+func knownLanguage(code string) bool {
+	for _, lang := range deepLLanguages {
+		if baseLanguage(code) == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLanguages rejects source and target languages DeepL doesn't have, for the providers
+// speaking DeepL's languages; other engines know languages of their own
+func checkLanguages(provider, source string, targets []string) error {
+	if provider != ProviderDeepLX && provider != ProviderDeepL {
+		return nil
+	}
+	if code := toDeepLCode(source, true); code != "" && code != "AUTO" && !knownLanguage(code) {
+		return &LanguageError{fmt.Sprintf("unsupported source language %q", source)}
+	}
+	for _, target := range targets {
+		if !knownLanguage(toDeepLCode(target, false)) {
+			return &LanguageError{fmt.Sprintf("unsupported target language %q", target)}
+		}
+	}
+	return nil
+}
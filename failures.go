@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// failureEntry is a remembered failure of a server
+type failureEntry struct {
+	Error  string `json:"error"`
+	Status int    `json:"status,omitempty"`
+	// Token is the fingerprint of the token an authentication failure was for, or
+	// noTokenFingerprint when none was sent
+	Token string    `json:"token,omitempty"`
+	Until time.Time `json:"until"`
+}
+
+// noTokenFingerprint stands for the missing token of an authentication failure of a
+// request sent without one
+const noTokenFingerprint = "none"
+
+// failureFingerprint returns what an authentication failure with token is remembered by
+func failureFingerprint(token string) string {
+	if token == "" {
+		return noTokenFingerprint
+	}
+	return tokenFingerprint(token)
+}
+
+// failureKey returns what the failures of server are remembered under, its URL without
+// the basic auth credentials so they never reach the file, and what an authentication
+// failure with token is remembered for, which includes those credentials
+func failureKey(server, token string) (string, string) {
+	key, credentials := splitUserinfo(server)
+	if credentials != "" {
+		token += "\x00" + credentials
+	}
+	return key, failureFingerprint(token)
+}
+
+// FailureCache remembers for a short time that a server is down or refused the token,
+// across invocations, so editor integrations calling on every keystroke fail fast instead
+// of waiting for a timeout each time. A successful request forgets the failure at once.
+type FailureCache struct {
+	path string
+	ttl  time.Duration
+
+	once    sync.Once
+	mu      sync.Mutex
+	entries map[string]failureEntry
+}
+
+// failureCachePath returns the path of the file failures are remembered in
+func failureCachePath() (string, error) {
+	dir, err := appDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "failures.json"), nil
+}
+
+// NewFailureCache returns a cache remembering failures for ttl. With a ttl of 0 failures
+// are neither remembered nor checked, but successes still clear earlier ones.
+func NewFailureCache(ttl time.Duration) *FailureCache {
+	path, err := failureCachePath()
+	if err != nil {
+		return nil
+	}
+	return &FailureCache{path: path, ttl: ttl}
+}
+
+// isAuthFailure reports whether an error is the server refusing the credentials
+func isAuthFailure(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden)
+}
+
+// isServerDown reports whether an error means the server can't be reached at all, or a
+// gateway in front of it can't
+func isServerDown(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusBadGateway ||
+			statusErr.StatusCode == http.StatusServiceUnavailable ||
+			statusErr.StatusCode == http.StatusGatewayTimeout
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "cannot connect to DeepLX server") ||
+		strings.Contains(msg, "server not reachable") ||
+		strings.Contains(msg, "failed to send request")
+}
+
+// load reads the remembered failures once, dropping expired ones
+func (f *FailureCache) load() {
+	f.once.Do(func() {
+		f.entries = make(map[string]failureEntry)
+		data, err := os.ReadFile(f.path)
+		if err != nil {
+			return
+		}
+		var entries map[string]failureEntry
+		json.Unmarshal(data, &entries)
+		now := time.Now()
+		for server, entry := range entries {
+			if now.Before(entry.Until) {
+				f.entries[server] = entry
+			}
+		}
+	})
+}
+
+// save writes the remembered failures, replacing the file so a concurrent reader never
+// sees it half written
+func (f *FailureCache) save() {
+	data, err := json.MarshalIndent(f.entries, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return
+	}
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	os.Rename(tmp, f.path)
+}
+
+// Check returns the remembered failure of server as an error, or nil if there is none.
+// Authentication failures only count for the token they happened with.
+func (f *FailureCache) Check(server, token string) error {
+	if f == nil || f.ttl <= 0 {
+		return nil
+	}
+	f.load()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key, fingerprint := failureKey(server, token)
+	entry, ok := f.entries[key]
+	if !ok || !time.Now().Before(entry.Until) {
+		return nil
+	}
+	// Authentication failures only hold for the very token refused, or for sending none
+	if (entry.Token != "" || entry.Status == http.StatusUnauthorized || entry.Status == http.StatusForbidden) && entry.Token != fingerprint {
+		return nil
+	}
+	message := fmt.Sprintf("%s\n(remembered failure; retrying in %s, or now with --failure-ttl 0)", entry.Error, time.Until(entry.Until).Round(time.Second))
+	if entry.Status != 0 {
+		return &StatusError{entry.Status, message}
+	}
+	return errors.New(message)
+}
+
+// Record remembers err for server if it means the server is down or refused the token
+func (f *FailureCache) Record(server, token string, err error) {
+	if f == nil || f.ttl <= 0 || err == nil {
+		return
+	}
+	key, fingerprint := failureKey(server, token)
+	entry := failureEntry{Error: err.Error(), Until: time.Now().Add(f.ttl)}
+	switch {
+	case isAuthFailure(err):
+		entry.Token = fingerprint
+	case isServerDown(err):
+	default:
+		return
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		entry.Status = statusErr.StatusCode
+		entry.Error = statusErr.Message
+	}
+	// Messages may quote the server's URL
+	entry.Error = urlUserinfoPattern.ReplaceAllString(entry.Error, "${1}")
+
+	f.load()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries[key] = entry
+	f.save()
+}
+
+// Clear forgets the failure of server after a successful request
+func (f *FailureCache) Clear(server string) {
+	if f == nil {
+		return
+	}
+	f.load()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, _ := failureKey(server, "")
+	if _, ok := f.entries[key]; ok {
+		delete(f.entries, key)
+		f.save()
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// sqlLiteral is a string literal found in a selected column of an INSERT statement
+type sqlLiteral struct {
+	start, end int // byte range of the literal including its quotes
+	text       string
+	backslash  bool // literal used backslash escapes (MySQL style)
+}
+
+// sqlScanner walks SQL text while skipping strings and comments
+type sqlScanner struct {
+	data []byte
+	pos  int
+}
+
+// skipSpace skips whitespace and comments
+func (s *sqlScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch {
+		case s.data[s.pos] == ' ' || s.data[s.pos] == '\t' || s.data[s.pos] == '\n' || s.data[s.pos] == '\r':
+			s.pos++
+		case bytes.HasPrefix(s.data[s.pos:], []byte("--")) || s.data[s.pos] == '#':
+			for s.pos < len(s.data) && s.data[s.pos] != '\n' {
+				s.pos++
+			}
+		case bytes.HasPrefix(s.data[s.pos:], []byte("/*")):
+			end := bytes.Index(s.data[s.pos+2:], []byte("*/"))
+			if end < 0 {
+				s.pos = len(s.data)
+			} else {
+				s.pos += end + 4
+			}
+		default:
+			return
+		}
+	}
+}
+
+// keyword consumes a case-insensitive keyword if it's next
+func (s *sqlScanner) keyword(word string) bool {
+	end := s.pos + len(word)
+	if end > len(s.data) || !strings.EqualFold(string(s.data[s.pos:end]), word) {
+		return false
+	}
+	if end < len(s.data) && isSQLIdentByte(s.data[end]) {
+		return false
+	}
+	s.pos = end
+	return true
+}
+
+// identifier consumes a possibly quoted identifier, returning its unquoted name
+func (s *sqlScanner) identifier() (string, bool) {
+	if s.pos >= len(s.data) {
+		return "", false
+	}
+	switch quote := s.data[s.pos]; quote {
+	case '`', '"', '[':
+		closing := quote
+		if quote == '[' {
+			closing = ']'
+		}
+		end := bytes.IndexByte(s.data[s.pos+1:], closing)
+		if end < 0 {
+			return "", false
+		}
+		name := string(s.data[s.pos+1 : s.pos+1+end])
+		s.pos += end + 2
+		return name, true
+	}
+
+	start := s.pos
+	for s.pos < len(s.data) && isSQLIdentByte(s.data[s.pos]) {
+		s.pos++
+	}
+	return string(s.data[start:s.pos]), s.pos > start
+}
+
+// stringLiteral consumes a single-quoted literal, returning its decoded value
+func (s *sqlScanner) stringLiteral() (string, bool, bool) {
+	if s.pos >= len(s.data) || s.data[s.pos] != '\'' {
+		return "", false, false
+	}
+
+	var value strings.Builder
+	backslash := false
+	for i := s.pos + 1; i < len(s.data); i++ {
+		switch s.data[i] {
+		case '\\':
+			if i+1 < len(s.data) {
+				backslash = true
+				i++
+				switch s.data[i] {
+				case 'n':
+					value.WriteByte('\n')
+				case 't':
+					value.WriteByte('\t')
+				case 'r':
+					value.WriteByte('\r')
+				case '0':
+					value.WriteByte(0)
+				default:
+					value.WriteByte(s.data[i])
+				}
+			}
+		case '\'':
+			if i+1 < len(s.data) && s.data[i+1] == '\'' {
+				value.WriteByte('\'')
+				i++
+				continue
+			}
+			s.pos = i + 1
+			return value.String(), backslash, true
+		default:
+			value.WriteByte(s.data[i])
+		}
+	}
+	return "", false, false
+}
+
+// skipValue skips a non-string value such as a number, NULL or function call
+func (s *sqlScanner) skipValue() {
+	depth := 0
+	for s.pos < len(s.data) {
+		switch c := s.data[s.pos]; {
+		case c == '\'':
+			if _, _, ok := s.stringLiteral(); !ok {
+				s.pos = len(s.data)
+			}
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth == 0 {
+				return
+			}
+			depth--
+		case c == ',' && depth == 0:
+			return
+		}
+		s.pos++
+	}
+}
+
+// isSQLIdentByte reports whether c can appear in an unquoted identifier
+func isSQLIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// findSQLLiterals returns the string literals in the selected columns of every
+// INSERT INTO table (columns...) VALUES (...), ... statement
+func findSQLLiterals(data []byte, columns map[string]bool, table string) ([]sqlLiteral, error) {
+	var literals []sqlLiteral
+	s := &sqlScanner{data: data}
+
+	for s.pos < len(s.data) {
+		s.skipSpace()
+		if s.pos >= len(s.data) {
+			break
+		}
+
+		c := s.data[s.pos]
+		if c == '\'' {
+			if _, _, ok := s.stringLiteral(); !ok {
+				return nil, fmt.Errorf("unterminated string literal")
+			}
+			continue
+		}
+		if !s.keyword("INSERT") {
+			if isSQLIdentByte(c) {
+				s.identifier()
+			} else {
+				s.pos++
+			}
+			continue
+		}
+
+		s.skipSpace()
+		s.keyword("IGNORE")
+		s.skipSpace()
+		if !s.keyword("INTO") {
+			continue
+		}
+		s.skipSpace()
+		tableName, ok := s.identifier()
+		if !ok {
+			continue
+		}
+		s.skipSpace()
+
+		// Statements without a column list can't be matched by column name
+		if s.pos >= len(s.data) || s.data[s.pos] != '(' {
+			continue
+		}
+		s.pos++
+
+		var names []string
+		for {
+			s.skipSpace()
+			name, ok := s.identifier()
+			if !ok {
+				return nil, fmt.Errorf("invalid column list for %s", tableName)
+			}
+			names = append(names, name)
+			s.skipSpace()
+			if s.pos < len(s.data) && s.data[s.pos] == ',' {
+				s.pos++
+				continue
+			}
+			break
+		}
+		if s.pos >= len(s.data) || s.data[s.pos] != ')' {
+			return nil, fmt.Errorf("invalid column list for %s", tableName)
+		}
+		s.pos++
+
+		s.skipSpace()
+		if !s.keyword("VALUES") {
+			continue
+		}
+
+		// --table matches the table name with or without its schema
+		selected := table == "" || strings.EqualFold(tableName, table) ||
+			strings.EqualFold(tableName[strings.LastIndex(tableName, ".")+1:], table)
+
+		// Tuples: (v1, v2, ...), (v1, v2, ...)
+		for {
+			s.skipSpace()
+			if s.pos >= len(s.data) || s.data[s.pos] != '(' {
+				break
+			}
+			s.pos++
+
+			for index := 0; ; index++ {
+				s.skipSpace()
+				start := s.pos
+				// Allow N'...' and E'...' prefixed literals
+				if s.pos+1 < len(s.data) && (s.data[s.pos] == 'N' || s.data[s.pos] == 'E') && s.data[s.pos+1] == '\'' {
+					s.pos++
+				}
+
+				if s.pos < len(s.data) && s.data[s.pos] == '\'' {
+					literalStart := s.pos
+					text, backslash, ok := s.stringLiteral()
+					if !ok {
+						return nil, fmt.Errorf("unterminated string literal in %s", tableName)
+					}
+					if selected && index < len(names) && columns[strings.ToLower(names[index])] && strings.TrimSpace(text) != "" {
+						literals = append(literals, sqlLiteral{start: literalStart, end: s.pos, text: text, backslash: backslash})
+					}
+				} else {
+					s.pos = start
+					s.skipValue()
+				}
+
+				s.skipSpace()
+				if s.pos < len(s.data) && s.data[s.pos] == ',' {
+					s.pos++
+					continue
+				}
+				break
+			}
+
+			if s.pos < len(s.data) && s.data[s.pos] == ')' {
+				s.pos++
+			}
+			s.skipSpace()
+			if s.pos < len(s.data) && s.data[s.pos] == ',' {
+				s.pos++
+				continue
+			}
+			break
+		}
+	}
+	return literals, nil
+}
+
+// quoteSQLString renders text as a single-quoted SQL literal
+func quoteSQLString(text string, backslash bool) string {
+	if backslash {
+		text = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(text)
+	}
+	return "'" + strings.ReplaceAll(text, "'", "''") + "'"
+}
+
+// runFixture handles the fixture command
+func runFixture(c *cli.Context) error {
+	args, err := parseTrailingFlags(c)
+	if err != nil {
+		return cli.Exit(err.Error(), ExitUsage)
+	}
+	if len(args) != 1 || c.String("columns") == "" {
+		return cli.Exit("Usage: translate fixture FILE --columns NAME[,NAME...]", ExitUsage)
+	}
+	path := args[0]
+
+	columns := make(map[string]bool)
+	for _, column := range strings.Split(c.String("columns"), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns[strings.ToLower(column)] = true
+		}
+	}
+
+	targets := splitLangList(c.String("target"))
+	if len(targets) != 1 {
+		return cli.Exit("Translation error: fixture needs exactly one target language", ExitUsage)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+	// A BOM would stick to the first column's name
+	text, layout := splitLayout(raw)
+	data := []byte(text)
+
+	format := c.String("format")
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			format = "csv"
+		case ".tsv":
+			format = "tsv"
+		default:
+			format = "sql"
+		}
+	}
+
+	config := configFor(c.Context)
+	client := sharedClient(c)
+	client.Cache = NewCache(10000, 0)
+	sourceLang := toDeepLCode(c.String("source"), true)
+	targetLang := resolveTargetVariant(toDeepLCode(targets[0], false), config.VariantPreferences, false)
+
+	// The values are found while translating, so their number isn't known beforehand
+	progress := startProgress("Translating values", 0, c.Bool("debug"))
+	var translateErr error
+	translateText := func(text string) (string, error) {
+		resp, _, err := client.Translate(c.Context, text, sourceLang, targetLang)
+		progress.Step(err)
+		if err != nil {
+			translateErr = err
+			return "", err
+		}
+		return resp.Data, nil
+	}
+
+	var result []byte
+	switch format {
+	case "sql":
+		result, err = translateSQLFixture(data, columns, c.String("table"), translateText)
+	case "csv", "tsv":
+		result, err = translateCSVFixture(data, columns, format == "tsv", translateText)
+	default:
+		progress.Stop()
+		return cli.Exit(fmt.Sprintf("Unknown fixture format %q (use sql, csv or tsv)", format), 1)
+	}
+	progress.Stop()
+	if translateErr != nil {
+		return translationExit(translateErr)
+	}
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("%s: %s", path, err), 1)
+	}
+	reportSkipped(client, targetLang)
+	result = []byte(layout.restore(string(result)))
+
+	switch {
+	case c.Bool("in-place"):
+		info, err := os.Stat(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+		if err := os.WriteFile(path, result, info.Mode().Perm()); err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+	case c.String("out") != "":
+		if err := os.WriteFile(c.String("out"), result, 0644); err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+	default:
+		os.Stdout.Write(result)
+	}
+	return nil
+}
+
+// translateSQLFixture translates literals of the selected columns in an SQL dump
+func translateSQLFixture(data []byte, columns map[string]bool, table string, translateText func(string) (string, error)) ([]byte, error) {
+	literals, err := findSQLLiterals(data, columns, table)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	pos := 0
+	for _, literal := range literals {
+		translated, err := translateText(literal.text)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(data[pos:literal.start])
+		out.WriteString(quoteSQLString(translated, literal.backslash))
+		pos = literal.end
+	}
+	out.Write(data[pos:])
+	return out.Bytes(), nil
+}
+
+// translateCSVFixture translates the selected columns of a CSV/TSV file with a header row
+func translateCSVFixture(data []byte, columns map[string]bool, tabs bool, translateText func(string) (string, error)) ([]byte, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	if tabs {
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return data, nil
+	}
+
+	var selected []int
+	for i, name := range records[0] {
+		if columns[strings.ToLower(strings.TrimSpace(name))] {
+			selected = append(selected, i)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("none of the columns were found in the header")
+	}
+
+	for _, record := range records[1:] {
+		for _, i := range selected {
+			if i >= len(record) || strings.TrimSpace(record[i]) == "" {
+				continue
+			}
+			translated, err := translateText(record[i])
+			if err != nil {
+				return nil, err
+			}
+			record[i] = translated
+		}
+	}
+
+	var out bytes.Buffer
+	writer := csv.NewWriter(&out)
+	if tabs {
+		writer.Comma = '\t'
+	}
+	writer.UseCRLF = bytes.Contains(data, []byte("\r\n"))
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// fmtCheckContext is how many unchanged lines are shown around a difference
+const fmtCheckContext = 2
+
+// roundTripFormat passes a file through a format handler with every text "translated"
+// into itself, returning the re-serialized file and the number of texts. A lossless
+// handler returns the file unchanged.
+func roundTripFormat(c *cli.Context, path, format string, data []byte) ([]byte, int, error) {
+	count := 0
+	identity := func(text string) (string, error) {
+		count++
+		return text, nil
+	}
+
+	switch format {
+	case "po", "pot", "yaml", "yml", "json", "arb":
+		file, err := parseLocaleFile("file."+format, string(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		translations := make(map[*localeEntry][]string)
+		for _, entry := range file.entries {
+			translations[entry] = entry.Texts
+			if format == "po" || format == "pot" {
+				// The messages of a catalog to translate are those whose msgstr is empty
+				translations[entry] = make([]string, len(entry.Texts))
+			}
+			count += len(entry.Texts)
+		}
+		return []byte(file.render(translations)), count, nil
+	case "xml":
+		expr, err := compileXPath(c.String("xpath"))
+		if err != nil {
+			return nil, 0, err
+		}
+		edits, err := findXMLEdits(data, expr)
+		if err != nil {
+			return nil, 0, err
+		}
+		texts := make([]string, len(edits))
+		for i, edit := range edits {
+			texts[i] = edit.text
+		}
+		out, err := applyXMLEdits(data, edits, texts)
+		return out, len(edits), err
+	case "sql":
+		columns := fmtCheckColumns(c)
+		if len(columns) == 0 {
+			return nil, 0, fmt.Errorf("SQL needs --columns")
+		}
+		out, err := translateSQLFixture(data, columns, c.String("table"), identity)
+		return out, count, err
+	case "csv", "tsv":
+		columns := fmtCheckColumns(c)
+		if len(columns) == 0 {
+			// Every column goes through the handler
+			reader := csv.NewReader(bytes.NewReader(data))
+			if format == "tsv" {
+				reader.Comma = '\t'
+				reader.LazyQuotes = true
+			}
+			header, err := reader.Read()
+			if err != nil {
+				return nil, 0, err
+			}
+			columns = make(map[string]bool)
+			for _, name := range header {
+				columns[strings.ToLower(strings.TrimSpace(name))] = true
+			}
+		}
+		out, err := translateCSVFixture(data, columns, format == "tsv", identity)
+		return out, count, err
+	}
+	return nil, 0, fmt.Errorf("unknown format %q of %s (use po, yaml, json, xml, sql, csv or tsv)", format, filepath.Base(path))
+}
+
+// fmtCheckColumns returns the columns given with --columns
+func fmtCheckColumns(c *cli.Context) map[string]bool {
+	columns := make(map[string]bool)
+	for _, column := range strings.Split(c.String("columns"), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns[strings.ToLower(column)] = true
+		}
+	}
+	return columns
+}
+
+// lineDiff returns the lines that differ between two texts with a few lines of context,
+// removed lines in red and added ones in green if color is on. Lines are compared one to
+// one while both texts have as many; otherwise everything between their common beginning
+// and end is shown as changed.
+func lineDiff(before, after string, color bool) string {
+	a := strings.Split(strings.TrimSuffix(before, "\n"), "\n")
+	b := strings.Split(strings.TrimSuffix(after, "\n"), "\n")
+
+	// hunks holds the ranges [start, end) of a and b that differ
+	var hunks [][4]int
+	if len(a) == len(b) {
+		for i := 0; i < len(a); i++ {
+			if a[i] == b[i] {
+				continue
+			}
+			end := i
+			for end < len(a) && a[end] != b[end] {
+				end++
+			}
+			hunks = append(hunks, [4]int{i, end, i, end})
+			i = end
+		}
+	} else {
+		prefix := 0
+		for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+			prefix++
+		}
+		suffix := 0
+		for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+			suffix++
+		}
+		hunks = append(hunks, [4]int{prefix, len(a) - suffix, prefix, len(b) - suffix})
+	}
+
+	var out strings.Builder
+	line := func(marker, text string) {
+		// Show the line endings a change may be about
+		text = marker + strings.ReplaceAll(text, "\r", `\r`)
+		switch marker {
+		case "-":
+			text = paint(color, ansiRed, text)
+		case "+":
+			text = paint(color, ansiGreen, text)
+		}
+		fmt.Fprintln(&out, text)
+	}
+	for _, hunk := range hunks {
+		from, to := hunk[0]-fmtCheckContext, hunk[1]+fmtCheckContext
+		if from < 0 {
+			from = 0
+		}
+		if to > len(a) {
+			to = len(a)
+		}
+		fmt.Fprintln(&out, paint(color, ansiCyan, fmt.Sprintf("@@ line %d @@", hunk[0]+1)))
+		for _, text := range a[from:hunk[0]] {
+			line(" ", text)
+		}
+		for _, text := range a[hunk[0]:hunk[1]] {
+			line("-", text)
+		}
+		for _, text := range b[hunk[2]:hunk[3]] {
+			line("+", text)
+		}
+		for _, text := range a[hunk[1]:to] {
+			line(" ", text)
+		}
+	}
+	if strings.HasSuffix(before, "\n") != strings.HasSuffix(after, "\n") {
+		out.WriteString("(the newline at the end of the file differs)\n")
+	}
+	return out.String()
+}
+
+// runFmtCheck handles the fmt-check command, checking that a format handler writes a file
+// back unchanged when nothing is translated
+func runFmtCheck(c *cli.Context) error {
+	args, err := parseTrailingFlags(c)
+	if err != nil {
+		return cli.Exit(err.Error(), ExitUsage)
+	}
+	if len(args) != 1 {
+		return cli.Exit("Usage: translate fmt-check FILE [--format FORMAT]", ExitUsage)
+	}
+	path := args[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+
+	format := strings.ToLower(c.String("format"))
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	// As when translating, the handler sees the text without BOM and with LF line endings
+	text, layout := splitLayout(data)
+	out, count, err := roundTripFormat(c, path, format, []byte(text))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Format error: %s: %s", path, err), 1)
+	}
+	out = []byte(layout.restore(string(out)))
+
+	noun := "texts"
+	if count == 1 {
+		noun = "text"
+	}
+	if bytes.Equal(out, data) {
+		fmt.Printf("✓ %s: %d %s, written back unchanged\n", path, count, noun)
+		return nil
+	}
+	fmt.Print(lineDiff(string(data), string(out), colorEnabled(os.Stdout)))
+	return cli.Exit(fmt.Sprintf("✗ %s: the %s handler doesn't write the file back unchanged (%d %s)", path, format, count, noun), 1)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// scissorsPattern matches the line git commit --verbose puts above the diff, below which
+// git ignores the message
+var scissorsPattern = regexp.MustCompile(`^# -+ >8 -+$`)
+
+// trailerPattern matches a trailer line such as Signed-off-by: or Co-authored-by:
+var trailerPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*:\s`)
+
+// isTrailerBlock reports whether a paragraph is made of trailers, with indented
+// continuation lines
+func isTrailerBlock(paragraph string) bool {
+	lines := strings.Split(strings.TrimRight(paragraph, "\n"), "\n")
+	for i, line := range lines {
+		if trailerPattern.MatchString(line) || i > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// splitCommitMessage splits a commit message into paragraphs to translate and the parts
+// kept as they are: comment and blank lines, the trailer block ending the message, and
+// the diff below the scissors line of git commit --verbose
+func splitCommitMessage(message string) []dirPart {
+	var parts []dirPart
+	var paragraph strings.Builder
+	flush := func() {
+		if paragraph.Len() > 0 {
+			parts = append(parts, dirPart{text: paragraph.String(), translate: true})
+			paragraph.Reset()
+		}
+	}
+	lines := strings.SplitAfter(message, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, "\n")
+		if scissorsPattern.MatchString(trimmed) || strings.HasPrefix(trimmed, "diff --git ") {
+			flush()
+			parts = append(parts, dirPart{text: strings.Join(lines[i:], "")})
+			break
+		}
+		if strings.HasPrefix(trimmed, "#") || strings.TrimSpace(trimmed) == "" {
+			flush()
+			parts = append(parts, dirPart{text: line})
+			continue
+		}
+		paragraph.WriteString(line)
+	}
+	flush()
+
+	// Trailers end the message; the last paragraph is theirs if it is only trailers
+	for i := len(parts) - 1; i >= 0; i-- {
+		if parts[i].translate {
+			if i > 0 && isTrailerBlock(parts[i].text) {
+				parts[i].translate = false
+			}
+			break
+		}
+	}
+	return parts
+}
+
+// runGitMsg handles the git-msg command: a commit message, from a file such as the one a
+// prepare-commit-msg hook is given or from stdin, is translated paragraph by paragraph,
+// keeping its comments, trailers and diff as they are. A file is rewritten in place.
+func runGitMsg(c *cli.Context) error {
+	if c.NArg() > 1 {
+		return cli.Exit("Usage: translate -t LANG git-msg [FILE]", ExitUsage)
+	}
+	path := c.Args().First()
+	var data []byte
+	var err error
+	if path != "" && path != "-" {
+		data, err = os.ReadFile(path)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+
+	targets := splitLangList(c.String("target"))
+	if len(targets) != 1 {
+		return cli.Exit("Translation error: git-msg needs exactly one target language", ExitUsage)
+	}
+	config := configFor(c.Context)
+	targetLang := resolveTargetVariant(toDeepLCode(targets[0], false), config.VariantPreferences, false)
+	sourceLang := toDeepLCode(c.String("source"), true)
+
+	message, layout := splitLayout(data)
+	client := sharedClient(c)
+	var b strings.Builder
+	translated := 0
+	for _, part := range splitCommitMessage(message) {
+		if !part.translate {
+			b.WriteString(part.text)
+			continue
+		}
+		// The newline ending the paragraph stays out of the translation
+		text := strings.TrimRight(part.text, "\n")
+		resp, _, err := client.Translate(c.Context, text, sourceLang, targetLang)
+		if err != nil {
+			return translationExit(err)
+		}
+		b.WriteString(resp.Data + part.text[len(text):])
+		translated++
+	}
+	output := layout.restore(b.String())
+
+	if path != "" && path != "-" {
+		if translated == 0 {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+		if err := os.WriteFile(path, []byte(output), info.Mode().Perm()); err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+		return nil
+	}
+	fmt.Print(output)
+	return nil
+}
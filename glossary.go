@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v2"
+)
+
+// glossaryAnyTarget in a glossary holds terms used for every target language, such as
+// product names kept as they are
+const glossaryAnyTarget = "*"
+
+// Glossary maps the terms of a domain to their translations, per target language ("de",
+// "pt-BR") or for any target ("*"). An empty translation keeps the term as it was written.
+type Glossary map[string]map[string]string
+
+// glossaryEntry is a term of a selected glossary and its translation into one target
+type glossaryEntry struct {
+	glossary    string
+	term        string
+	translation string
+}
+
+// maskedTerm is a term found in a text and replaced by a placeholder: the entry it
+// matched and the text the placeholder is replaced with after translation
+type maskedTerm struct {
+	entry       glossaryEntry
+	replacement string
+}
+
+// glossaryPlaceholder matches the placeholders standing in for terms during translation,
+// allowing for spaces the engine may put inside them
+var glossaryPlaceholder = regexp.MustCompile(`⟦\s*(\d+)\s*⟧`)
+
+// GlossarySet is the glossaries selected with --glossary. The terms they have for the
+// target are swapped for placeholders the engine leaves alone, and the placeholders for
+// the translations of the terms afterwards, so any provider follows them. It counts how
+// often each entry was applied.
+type GlossarySet struct {
+	names      []string
+	glossaries map[string]Glossary
+
+	mu    sync.Mutex
+	fired map[glossaryEntry]int
+}
+
+// checkGlossaries validates the configured glossaries
+func checkGlossaries(glossaries map[string]Glossary) error {
+	for name, glossary := range glossaries {
+		if name == "" || strings.Contains(name, ",") {
+			return fmt.Errorf("invalid glossary name %q", name)
+		}
+		for target, terms := range glossary {
+			if target != glossaryAnyTarget && (strings.TrimSpace(target) == "" || strings.EqualFold(target, "auto")) {
+				return fmt.Errorf("glossary %s: invalid target language %q", name, target)
+			}
+			for term := range terms {
+				if strings.TrimSpace(term) == "" {
+					return fmt.Errorf("glossary %s: empty term for %s", name, target)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// glossaryNames returns the names of the configured glossaries in order
+func glossaryNames(config Config) []string {
+	names := make([]string, 0, len(config.Glossaries))
+	for name := range config.Glossaries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseGlossarySet selects the glossaries named in a comma-separated list; nil if it is empty
+func parseGlossarySet(list string, glossaries map[string]Glossary) (*GlossarySet, error) {
+	if err := checkGlossaries(glossaries); err != nil {
+		return nil, err
+	}
+	set := &GlossarySet{glossaries: make(map[string]Glossary), fired: make(map[glossaryEntry]int)}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		glossary, ok := glossaries[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown glossary %q (configured: %s)", name, strings.Join(glossaryNames(Config{Glossaries: glossaries}), ", "))
+		}
+		set.names = append(set.names, name)
+		set.glossaries[name] = glossary
+	}
+	if len(set.names) == 0 {
+		return nil, nil
+	}
+	return set, nil
+}
+
+// glossaryFromFlags returns the glossaries selected with --glossary, or nil. Unknown names
+// are rejected before any command runs.
+func glossaryFromFlags(c *cli.Context) *GlossarySet {
+	set, _ := parseGlossarySet(c.String("glossary"), configFor(c.Context).Glossaries)
+	return set
+}
+
+// entries returns the entries for targetLang, longest terms first so they win over the
+// terms inside them. Glossaries named later take precedence for the same term, and so do
+// terms for the target over terms for any target.
+func (g *GlossarySet) entries(targetLang string) []glossaryEntry {
+	byTerm := make(map[string]glossaryEntry)
+	for _, name := range g.names {
+		// Any target first, then the base language, then the exact variant
+		for level := 0; level < 3; level++ {
+			for target, terms := range g.glossaries[name] {
+				matched := false
+				switch level {
+				case 0:
+					matched = target == glossaryAnyTarget
+				case 1:
+					code := toDeepLCode(target, false)
+					matched = target != glossaryAnyTarget && code == baseLanguage(code) && code == baseLanguage(targetLang)
+				case 2:
+					code := toDeepLCode(target, false)
+					matched = target != glossaryAnyTarget && code != baseLanguage(code) && code == targetLang
+				}
+				if !matched {
+					continue
+				}
+				for term, translation := range terms {
+					byTerm[strings.ToLower(term)] = glossaryEntry{glossary: name, term: term, translation: translation}
+				}
+			}
+		}
+	}
+
+	entries := make([]glossaryEntry, 0, len(byTerm))
+	for _, entry := range byTerm {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if li, lj := utf8.RuneCountInString(entries[i].term), utf8.RuneCountInString(entries[j].term); li != lj {
+			return li > lj
+		}
+		return entries[i].term < entries[j].term
+	})
+	return entries
+}
+
+// glossaryWordRune reports whether r continues a word, so a term can't match inside it.
+// Scripts written without spaces have no word boundaries to respect.
+func glossaryWordRune(r rune) bool {
+	if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai) {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// mask replaces the terms of the entries for targetLang in text with placeholders,
+// matching whole words regardless of case. It returns the masked text and what each
+// placeholder stands for: the translation, or the text matched when there is none.
+func (g *GlossarySet) mask(text, targetLang string) (string, []maskedTerm) {
+	if g == nil {
+		return text, nil
+	}
+	var masked []maskedTerm
+	for _, entry := range g.entries(targetLang) {
+		re, err := regexp.Compile("(?i)" + regexp.QuoteMeta(entry.term))
+		if err != nil {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			before, _ := utf8.DecodeLastRuneInString(text[:loc[0]])
+			after, _ := utf8.DecodeRuneInString(text[loc[1]:])
+			first, _ := utf8.DecodeRuneInString(text[loc[0]:])
+			end, _ := utf8.DecodeLastRuneInString(text[:loc[1]])
+			if (glossaryWordRune(first) && glossaryWordRune(before)) || (glossaryWordRune(end) && glossaryWordRune(after)) {
+				continue
+			}
+			replacement := entry.translation
+			if replacement == "" {
+				replacement = text[loc[0]:loc[1]]
+			}
+			b.WriteString(text[last:loc[0]])
+			fmt.Fprintf(&b, "⟦%d⟧", len(masked))
+			masked = append(masked, maskedTerm{entry: entry, replacement: replacement})
+			last = loc[1]
+		}
+		if last > 0 {
+			b.WriteString(text[last:])
+			text = b.String()
+		}
+	}
+	return text, masked
+}
+
+// unmask replaces the placeholders in a translation with the translations of the terms,
+// reporting which placeholders were found
+func unmask(text string, masked []maskedTerm) (string, []bool) {
+	found := make([]bool, len(masked))
+	text = glossaryPlaceholder.ReplaceAllStringFunc(text, func(match string) string {
+		i, err := strconv.Atoi(glossaryPlaceholder.FindStringSubmatch(match)[1])
+		if err != nil || i >= len(masked) {
+			return match
+		}
+		found[i] = true
+		return masked[i].replacement
+	})
+	return text, found
+}
+
+// restore unmasks a translation, counting the entries applied. Placeholders the engine
+// dropped leave their entry unused.
+func (g *GlossarySet) restore(text string, masked []maskedTerm, debug bool) string {
+	if len(masked) == 0 {
+		return text
+	}
+	text, found := unmask(text, masked)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, term := range masked {
+		if found[i] {
+			g.fired[term.entry]++
+		} else if debug {
+			debugf("Glossary term %q was lost in translation\n", term.entry.term)
+		}
+	}
+	return text
+}
+
+// reportGlossary tells the user which glossary entries the translations of the
+// invocation in ctx used
+func reportGlossary(ctx context.Context) {
+	inv := invocationFrom(ctx)
+	if inv == nil || inv.client == nil || inv.client.Glossary == nil {
+		return
+	}
+	g := inv.client.Glossary
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if quiet {
+		return
+	}
+	if len(g.fired) == 0 {
+		fmt.Fprintf(os.Stderr, "Glossary %s: no entries used\n", strings.Join(g.names, ", "))
+		return
+	}
+	entries := make([]glossaryEntry, 0, len(g.fired))
+	for entry := range g.fired {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].glossary != entries[j].glossary {
+			return entries[i].glossary < entries[j].glossary
+		}
+		return strings.ToLower(entries[i].term) < strings.ToLower(entries[j].term)
+	})
+	fmt.Fprintln(os.Stderr, "Glossary entries used:")
+	for _, entry := range entries {
+		translation := entry.translation
+		if translation == "" {
+			translation = "(kept)"
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %s → %s (%d×)\n", entry.glossary, entry.term, translation, g.fired[entry])
+	}
+}
@@ -2,7 +2,12 @@ module github.com/juan-de-costa-rica/deeplx-cli
 
 go 1.21
 
-require github.com/urfave/cli/v2 v2.27.1
+require (
+	github.com/urfave/cli/v2 v2.27.1
+	golang.org/x/crypto v0.23.0
+	golang.org/x/net v0.25.0
+	golang.org/x/text v0.15.0
+)
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// The gRPC service described in proto/translate.proto, served over HTTP/2 with net/http.
+// Only uncompressed messages are supported.
+
+// gRPC method paths
+const (
+	grpcServicePrefix      = "/translate.v1.Translator/"
+	grpcMaxMessageSize     = 16 * 1024 * 1024
+	grpcContentType        = "application/grpc"
+	grpcHeaderStatus       = "Grpc-Status"
+	grpcHeaderMessage      = "Grpc-Message"
+	grpcHeaderTimeout      = "Grpc-Timeout"
+	grpcHeaderAcceptEncode = "Grpc-Accept-Encoding"
+)
+
+// gRPC status codes
+const (
+	grpcOK                = 0
+	grpcInvalidArgument   = 3
+	grpcDeadlineExceeded  = 4
+	grpcResourceExhausted = 8
+	grpcUnimplemented     = 12
+	grpcInternal          = 13
+	grpcUnavailable       = 14
+	grpcUnauthenticated   = 16
+)
+
+// grpcStatus is an error carrying a gRPC status code
+type grpcStatus struct {
+	code    int
+	message string
+}
+
+func (s *grpcStatus) Error() string {
+	return s.message
+}
+
+// grpcTranslateRequest mirrors translate.v1.TranslateRequest
+type grpcTranslateRequest struct {
+	Text       string
+	SourceLang string
+	TargetLang string
+	ID         string
+}
+
+// grpcTranslateResponse mirrors translate.v1.TranslateResponse
+type grpcTranslateResponse struct {
+	ID           string
+	Text         string
+	Alternatives []string
+	SourceLang   string
+	TargetLang   string
+	Cached       bool
+	Error        string
+}
+
+// serveGRPC runs the gRPC service on listen until it fails. gRPC needs HTTP/2, which
+// net/http only offers over TLS, so without a certificate an ephemeral self-signed one is
+// used. With plaintext it is served as cleartext HTTP/2 (h2c) instead, for clients that
+// can't trust a certificate or run behind a proxy terminating TLS.
+func (p *proxyServer) serveGRPC(listen, certFile, keyFile string, plaintext bool) error {
+	if plaintext {
+		if certFile != "" || keyFile != "" {
+			return errors.New("--grpc-plaintext can't be combined with --grpc-cert/--grpc-key")
+		}
+		server := &http.Server{
+			Addr:              listen,
+			Handler:           h2c.NewHandler(http.HandlerFunc(p.handleGRPC), &http2.Server{}),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		fmt.Fprintf(os.Stderr, "Serving gRPC on %s without TLS (h2c)\n", listen)
+		if p.authToken != "" {
+			fmt.Fprintln(os.Stderr, "The access token is sent in clear text; only use --grpc-plaintext on a trusted network")
+		}
+		return server.ListenAndServe()
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load gRPC certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else {
+		cert, err := selfSignedCertificate()
+		if err != nil {
+			return fmt.Errorf("failed to create gRPC certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		fmt.Fprintln(os.Stderr, "gRPC is using a self-signed certificate; pass --grpc-cert/--grpc-key to use your own")
+	}
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           http.HandlerFunc(p.handleGRPC),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	fmt.Fprintf(os.Stderr, "Serving gRPC on %s\n", listen)
+	return server.ListenAndServeTLS("", "")
+}
+
+// handleGRPC dispatches a gRPC call
+func (p *proxyServer) handleGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType) {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", grpcContentType)
+	w.Header().Set(grpcHeaderAcceptEncode, "identity")
+
+	ctx := r.Context()
+	if timeout, ok := parseGRPCTimeout(r.Header.Get(grpcHeaderTimeout)); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var err error
+	switch {
+	case !p.authorized(r):
+		err = &grpcStatus{grpcUnauthenticated, "invalid access token"}
+	case r.URL.Path == grpcServicePrefix+"Translate":
+		err = p.grpcTranslate(ctx, w, r.Body)
+	case r.URL.Path == grpcServicePrefix+"Detect":
+		err = p.grpcDetect(ctx, w, r.Body)
+	case r.URL.Path == grpcServicePrefix+"BatchTranslate":
+		err = p.grpcBatchTranslate(ctx, w, r.Body)
+	default:
+		err = &grpcStatus{grpcUnimplemented, fmt.Sprintf("unknown method %s", r.URL.Path)}
+	}
+
+	writeGRPCStatus(w, ctx, err)
+}
+
+// grpcTranslate handles the unary Translate call
+func (p *proxyServer) grpcTranslate(ctx context.Context, w http.ResponseWriter, body io.Reader) error {
+	msg, err := readGRPCMessage(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.grpcTranslateOne(ctx, decodeTranslateRequest(msg))
+	if err != nil {
+		return err
+	}
+	return writeGRPCMessage(w, encodeTranslateResponse(resp))
+}
+
+// grpcDetect handles the unary Detect call
+func (p *proxyServer) grpcDetect(ctx context.Context, w http.ResponseWriter, body io.Reader) error {
+	msg, err := readGRPCMessage(body)
+	if err != nil {
+		return err
+	}
+
+	var text string
+	walkProtoFields(msg, func(field int, value []byte) {
+		if field == 1 {
+			text = string(value)
+		}
+	})
+	if strings.TrimSpace(text) == "" {
+		return &grpcStatus{grpcInvalidArgument, "text is required"}
+	}
+
+	// Detection needs no translation: the server's detector is asked, or the offline one
+	language, offline, err := detectSource(ctx, p.client, text, false)
+	if err != nil {
+		if offline {
+			return &grpcStatus{grpcInvalidArgument, err.Error()}
+		}
+		return toGRPCStatus(err)
+	}
+
+	var out protoBuffer
+	out.appendString(1, language)
+	out.appendString(2, toBCP47(language))
+	return writeGRPCMessage(w, out)
+}
+
+// grpcBatchTranslate handles the bidirectional BatchTranslate stream, answering each request in order
+func (p *proxyServer) grpcBatchTranslate(ctx context.Context, w http.ResponseWriter, body io.Reader) error {
+	// Send headers right away so clients can start streaming
+	w.WriteHeader(http.StatusOK)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+
+	for {
+		msg, err := readGRPCMessage(body)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		req := decodeTranslateRequest(msg)
+		resp, err := p.grpcTranslateOne(ctx, req)
+		if err != nil {
+			var status *grpcStatus
+			if errors.As(err, &status) && status.code == grpcDeadlineExceeded {
+				return err
+			}
+			resp = &grpcTranslateResponse{ID: req.ID, Error: redactSecrets(err.Error())}
+		}
+
+		if err := writeGRPCMessage(w, encodeTranslateResponse(resp)); err != nil {
+			return err
+		}
+	}
+}
+
+// grpcTranslateOne translates a single request through the proxy's client
+func (p *proxyServer) grpcTranslateOne(ctx context.Context, req *grpcTranslateRequest) (*grpcTranslateResponse, error) {
+	if strings.TrimSpace(req.Text) == "" {
+		return nil, &grpcStatus{grpcInvalidArgument, "text is required"}
+	}
+
+	sourceLang := toDeepLCode(req.SourceLang, true)
+	if sourceLang == "" {
+		sourceLang = "AUTO"
+	}
+	targetLang := toDeepLCode(req.TargetLang, false)
+	if targetLang == "" {
+		return nil, &grpcStatus{grpcInvalidArgument, "target_lang is required"}
+	}
+
+	result, cached, err := p.client.Translate(ctx, req.Text, sourceLang, targetLang)
+	if err != nil {
+		return nil, toGRPCStatus(err)
+	}
+
+	return &grpcTranslateResponse{
+		ID:           req.ID,
+		Text:         result.Data,
+		Alternatives: result.Alternatives,
+		SourceLang:   toDeepLCode(result.SourceLang, true),
+		TargetLang:   targetLang,
+		Cached:       cached,
+	}, nil
+}
+
+// toGRPCStatus maps a translation error onto a gRPC status
+func toGRPCStatus(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &grpcStatus{grpcDeadlineExceeded, "deadline exceeded"}
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden:
+			return &grpcStatus{grpcUnauthenticated, err.Error()}
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return &grpcStatus{grpcResourceExhausted, err.Error()}
+		case statusErr.StatusCode == http.StatusBadRequest:
+			return &grpcStatus{grpcInvalidArgument, err.Error()}
+		}
+	}
+	if isRetryable(err) {
+		return &grpcStatus{grpcUnavailable, strings.SplitN(err.Error(), "\n", 2)[0]}
+	}
+	return &grpcStatus{grpcInternal, err.Error()}
+}
+
+// writeGRPCStatus sends the call's final status as trailers, without the upstream tokens
+// and other secrets its message may quote
+func writeGRPCStatus(w http.ResponseWriter, ctx context.Context, err error) {
+	code, message := grpcOK, ""
+	if err != nil {
+		var status *grpcStatus
+		if !errors.As(err, &status) {
+			status = &grpcStatus{grpcInternal, err.Error()}
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			status = &grpcStatus{grpcDeadlineExceeded, "deadline exceeded"}
+		}
+		code, message = status.code, redactSecrets(status.message)
+	}
+
+	w.Header().Set(http.TrailerPrefix+grpcHeaderStatus, strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+grpcHeaderMessage, url.PathEscape(message))
+	}
+}
+
+// readGRPCMessage reads one length-prefixed message, returning io.EOF at the end of the stream
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, &grpcStatus{grpcInternal, fmt.Sprintf("failed to read message: %v", err)}
+	}
+	if header[0] != 0 {
+		return nil, &grpcStatus{grpcUnimplemented, "compressed messages are not supported"}
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > grpcMaxMessageSize {
+		return nil, &grpcStatus{grpcResourceExhausted, fmt.Sprintf("message of %d bytes exceeds limit", size)}
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, &grpcStatus{grpcInternal, fmt.Sprintf("failed to read message: %v", err)}
+	}
+	return msg, nil
+}
+
+// writeGRPCMessage writes one length-prefixed message and flushes it to the client
+func writeGRPCMessage(w http.ResponseWriter, msg protoBuffer) error {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// parseGRPCTimeout parses a grpc-timeout header such as "500m" or "10S": at most 8 digits
+// and a unit. Timeouts too long for a Duration are capped.
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	digits := value[:len(value)-1]
+	if strings.Trim(digits, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	if n > math.MaxInt64/int64(unit) {
+		return math.MaxInt64, true
+	}
+	return time.Duration(n) * unit, true
+}
+
+// decodeTranslateRequest decodes a translate.v1.TranslateRequest
+func decodeTranslateRequest(msg []byte) *grpcTranslateRequest {
+	req := &grpcTranslateRequest{}
+	walkProtoFields(msg, func(field int, value []byte) {
+		switch field {
+		case 1:
+			req.Text = string(value)
+		case 2:
+			req.SourceLang = string(value)
+		case 3:
+			req.TargetLang = string(value)
+		case 4:
+			req.ID = string(value)
+		}
+	})
+	return req
+}
+
+// encodeTranslateResponse encodes a translate.v1.TranslateResponse
+func encodeTranslateResponse(resp *grpcTranslateResponse) protoBuffer {
+	var out protoBuffer
+	out.appendString(1, resp.ID)
+	out.appendString(2, resp.Text)
+	for _, alt := range resp.Alternatives {
+		out.appendBytes(3, []byte(alt))
+	}
+	out.appendString(4, resp.SourceLang)
+	out.appendString(5, resp.TargetLang)
+	out.appendBool(6, resp.Cached)
+	out.appendString(7, resp.Error)
+	return out
+}
+
+// protoBuffer is a protobuf-encoded message under construction
+type protoBuffer []byte
+
+// appendString appends a string field, omitting the proto3 default
+func (b *protoBuffer) appendString(field int, s string) {
+	if s != "" {
+		b.appendBytes(field, []byte(s))
+	}
+}
+
+// appendBytes appends a length-delimited field
+func (b *protoBuffer) appendBytes(field int, data []byte) {
+	*b = binary.AppendUvarint(*b, uint64(field)<<3|2)
+	*b = binary.AppendUvarint(*b, uint64(len(data)))
+	*b = append(*b, data...)
+}
+
+// appendBool appends a bool field, omitting the proto3 default
+func (b *protoBuffer) appendBool(field int, v bool) {
+	if v {
+		*b = binary.AppendUvarint(*b, uint64(field)<<3)
+		*b = append(*b, 1)
+	}
+}
+
+// walkProtoFields calls fn for every length-delimited field of a protobuf message, skipping the rest
+func walkProtoFields(msg []byte, fn func(field int, value []byte)) {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return
+		}
+		msg = msg[n:]
+
+		field, wireType := int(key>>3), key&7
+		switch wireType {
+		case 0: // varint
+			_, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return
+			}
+			msg = msg[n:]
+		case 1: // fixed64
+			if len(msg) < 8 {
+				return
+			}
+			msg = msg[8:]
+		case 2: // length-delimited
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || uint64(len(msg)-n) < size {
+				return
+			}
+			fn(field, msg[n:n+int(size)])
+			msg = msg[n+int(size):]
+		case 5: // fixed32
+			if len(msg) < 4 {
+				return
+			}
+			msg = msg[4:]
+		default:
+			return
+		}
+	}
+}
+
+// selfSignedCertificate creates a throwaway certificate for localhost
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: AppName + " serve"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
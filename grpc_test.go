@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseGRPCTimeout(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"1H", time.Hour, true},
+		{"2M", 2 * time.Minute, true},
+		{"10S", 10 * time.Second, true},
+		{"500m", 500 * time.Millisecond, true},
+		{"7u", 7 * time.Microsecond, true},
+		{"0n", 0, true},
+		{"99999999H", math.MaxInt64, true},
+		{"", 0, false},
+		{"S", 0, false},
+		{"10", 0, false},
+		{"10s", 0, false},
+		{"-1S", 0, false},
+		{"+1S", 0, false},
+		{"123456789S", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseGRPCTimeout(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseGRPCTimeout(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// grpcFrame frames msg as gRPC does, with the given compressed flag
+func grpcFrame(compressed byte, msg []byte) []byte {
+	frame := []byte{compressed, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func TestReadGRPCMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		stream   []byte
+		want     []byte
+		wantErr  error
+		wantCode int
+	}{
+		{"message", grpcFrame(0, []byte("hello")), []byte("hello"), nil, 0},
+		{"empty message", grpcFrame(0, nil), []byte{}, nil, 0},
+		{"end of stream", nil, nil, io.EOF, 0},
+		{"compressed", grpcFrame(1, []byte("x")), nil, nil, grpcUnimplemented},
+		{"too large", []byte{0, 0x01, 0x00, 0x00, 0x01}, nil, nil, grpcResourceExhausted},
+		{"truncated header", []byte{0, 0}, nil, nil, grpcInternal},
+		{"truncated message", grpcFrame(0, []byte("hello"))[:7], nil, nil, grpcInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readGRPCMessage(bytes.NewReader(tt.stream))
+			var status *grpcStatus
+			switch {
+			case tt.wantErr != nil:
+				if err != tt.wantErr {
+					t.Errorf("got error %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantCode != 0:
+				if !errors.As(err, &status) || status.code != tt.wantCode {
+					t.Errorf("got error %v, want status %d", err, tt.wantCode)
+				}
+			case err != nil:
+				t.Errorf("unexpected error %v", err)
+			case !bytes.Equal(got, tt.want) || got == nil:
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteGRPCMessage(t *testing.T) {
+	var msg protoBuffer
+	msg.appendString(1, "hi")
+	w := httptest.NewRecorder()
+	if err := writeGRPCMessage(w, msg); err != nil {
+		t.Fatal(err)
+	}
+	if want := grpcFrame(0, []byte{0x0a, 2, 'h', 'i'}); !bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("wrote %x, want %x", w.Body.Bytes(), want)
+	}
+
+	// What is written reads back
+	got, err := readGRPCMessage(w.Body)
+	if err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("read back %x, %v; want %x", got, err, []byte(msg))
+	}
+}
+
+func TestProtoBuffer(t *testing.T) {
+	long := string(bytes.Repeat([]byte("a"), 200))
+	tests := []struct {
+		name  string
+		build func(b *protoBuffer)
+		want  []byte
+	}{
+		{"string", func(b *protoBuffer) { b.appendString(2, "ab") }, []byte{0x12, 2, 'a', 'b'}},
+		{"empty string omitted", func(b *protoBuffer) { b.appendString(1, "") }, nil},
+		{"empty bytes kept", func(b *protoBuffer) { b.appendBytes(3, nil) }, []byte{0x1a, 0}},
+		{"true", func(b *protoBuffer) { b.appendBool(6, true) }, []byte{0x30, 1}},
+		{"false omitted", func(b *protoBuffer) { b.appendBool(6, false) }, nil},
+		{"large field number", func(b *protoBuffer) { b.appendString(16, "x") }, []byte{0x82, 0x01, 1, 'x'}},
+		{"long value", func(b *protoBuffer) { b.appendString(1, long) }, append([]byte{0x0a, 0xc8, 0x01}, long...)},
+	}
+	for _, tt := range tests {
+		var b protoBuffer
+		tt.build(&b)
+		if !bytes.Equal(b, tt.want) {
+			t.Errorf("%s: got %x, want %x", tt.name, []byte(b), tt.want)
+		}
+	}
+}
+
+func TestWalkProtoFields(t *testing.T) {
+	type field struct {
+		number int
+		value  string
+	}
+	tests := []struct {
+		name string
+		msg  []byte
+		want []field
+	}{
+		{"strings", []byte{0x0a, 1, 'a', 0x12, 2, 'b', 'c'}, []field{{1, "a"}, {2, "bc"}}},
+		{"other wire types skipped", []byte{
+			0x08, 0x96, 0x01, // varint
+			0x11, 1, 2, 3, 4, 5, 6, 7, 8, // fixed64
+			0x1d, 1, 2, 3, 4, // fixed32
+			0x22, 1, 'x',
+		}, []field{{4, "x"}}},
+		{"repeated", []byte{0x1a, 1, 'a', 0x1a, 1, 'b'}, []field{{3, "a"}, {3, "b"}}},
+		{"truncated value", []byte{0x0a, 1, 'a', 0x12, 5, 'b'}, []field{{1, "a"}}},
+		{"truncated varint", []byte{0x0a, 1, 'a', 0x08, 0x96}, []field{{1, "a"}}},
+		{"truncated fixed64", []byte{0x09, 1, 2}, nil},
+		{"group wire type stops", []byte{0x0b, 0x0a, 1, 'a'}, nil},
+		{"oversized length", []byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0x0f, 'a'}, nil},
+	}
+	for _, tt := range tests {
+		var got []field
+		walkProtoFields(tt.msg, func(number int, value []byte) {
+			got = append(got, field{number, string(value)})
+		})
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTranslateMessages(t *testing.T) {
+	var req protoBuffer
+	req.appendString(1, "Hello")
+	req.appendString(2, "EN")
+	req.appendString(3, "DE")
+	req.appendString(4, "id-1")
+	req.appendBool(5, true)
+	if got, want := decodeTranslateRequest(req), (&grpcTranslateRequest{Text: "Hello", SourceLang: "EN", TargetLang: "DE", ID: "id-1"}); *got != *want {
+		t.Errorf("decoded %+v, want %+v", got, want)
+	}
+
+	tests := []struct {
+		name string
+		resp grpcTranslateResponse
+		want []byte
+	}{
+		{"empty", grpcTranslateResponse{}, nil},
+		{"error", grpcTranslateResponse{ID: "7", Error: "failed"}, []byte{0x0a, 1, '7', 0x3a, 6, 'f', 'a', 'i', 'l', 'e', 'd'}},
+		{"translation", grpcTranslateResponse{Text: "Hallo", Alternatives: []string{"", "Hi"}, TargetLang: "DE", Cached: true},
+			[]byte{0x12, 5, 'H', 'a', 'l', 'l', 'o', 0x1a, 0, 0x1a, 2, 'H', 'i', 0x2a, 2, 'D', 'E', 0x30, 1}},
+	}
+	for _, tt := range tests {
+		got := encodeTranslateResponse(&tt.resp)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: encoded %x, want %x", tt.name, []byte(got), tt.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HARRecorder records HTTP traffic and writes it out as a HAR 1.2 archive
+type HARRecorder struct {
+	path string
+	base http.RoundTripper
+
+	mu      sync.Mutex
+	entries []harEntry
+	once    sync.Once
+}
+
+// harContextKey is the context key holding the HARRecorder
+type harContextKey struct{}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+	// Error is set when no response was received (a HAR extension field)
+	Error string `json:"_error,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+// NewHARRecorder creates a recorder writing to path (nil if path is empty)
+func NewHARRecorder(path string) *HARRecorder {
+	if path == "" {
+		return nil
+	}
+	return &HARRecorder{path: path}
+}
+
+// Install records all requests made through http.DefaultTransport and returns a context carrying the recorder
+func (r *HARRecorder) Install(ctx context.Context) context.Context {
+	r.base = http.DefaultTransport
+	http.DefaultTransport = r
+	return context.WithValue(ctx, harContextKey{}, r)
+}
+
+// RoundTrip implements http.RoundTripper, recording the exchange
+func (r *HARRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	started := time.Now()
+	resp, err := r.base.RoundTrip(req)
+	waited := time.Since(started)
+
+	entry := harEntry{
+		StartedDateTime: started.Format(time.RFC3339Nano),
+		Request:         r.harRequest(req, reqBody),
+	}
+
+	if err != nil {
+		entry.Time = ms(waited)
+		entry.Timings = harTimings{Wait: ms(waited)}
+		entry.Response = harResponse{Cookies: []harNameValue{}, Headers: []harNameValue{}, HeadersSize: -1, BodySize: -1, Error: redactSecrets(err.Error())}
+		r.add(entry)
+		return nil, err
+	}
+
+	respBody, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+	received := time.Since(started)
+
+	entry.Time = ms(received)
+	entry.Timings = harTimings{Wait: ms(waited), Receive: ms(received - waited)}
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     r.harHeaders(resp.Header),
+		Content: harContent{
+			Size:     len(respBody),
+			MimeType: resp.Header.Get("Content-Type"),
+			Text:     redactSecrets(string(respBody)),
+		},
+		HeadersSize: -1,
+		BodySize:    len(respBody),
+	}
+	if readErr != nil {
+		entry.Response.Error = readErr.Error()
+	}
+	r.add(entry)
+	return resp, readErr
+}
+
+// harRequest converts a request to its HAR form
+func (r *HARRecorder) harRequest(req *http.Request, body []byte) harRequest {
+	u := *req.URL
+	query := u.Query()
+	entry := harRequest{
+		Method:      req.Method,
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameValue{},
+		Headers:     r.harHeaders(req.Header),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(body),
+	}
+	for name, values := range query {
+		for i := range values {
+			if isSecretParam(name) && redactor.isEnabled() {
+				values[i] = redactedText
+			}
+			entry.QueryString = append(entry.QueryString, harNameValue{name, redactSecrets(values[i])})
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.User = nil
+	entry.URL = redactSecrets(u.String())
+
+	if len(body) > 0 {
+		entry.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: redactSecrets(string(body))}
+	}
+	return entry
+}
+
+// harHeaders converts headers to HAR form, hiding credentials
+func (r *HARRecorder) harHeaders(header http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range header {
+		for _, value := range values {
+			if redactor.isEnabled() {
+				switch strings.ToLower(name) {
+				case "authorization", "proxy-authorization":
+					// Keep the scheme so auth problems are still diagnosable
+					if scheme, _, ok := strings.Cut(value, " "); ok {
+						value = scheme + " " + redactedText
+					} else {
+						value = redactedText
+					}
+				case "cookie", "set-cookie", "x-api-key":
+					value = redactedText
+				}
+			}
+			headers = append(headers, harNameValue{name, redactSecrets(value)})
+		}
+	}
+	return headers
+}
+
+// isSecretParam reports whether a query parameter carries credentials
+func isSecretParam(name string) bool {
+	switch strings.ToLower(name) {
+	case "token", "auth_key", "key", "api_key", "access_token":
+		return true
+	}
+	return false
+}
+
+// add appends an entry
+func (r *HARRecorder) add(entry harEntry) {
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+}
+
+// Write saves the archive; later calls do nothing
+func (r *HARRecorder) Write() {
+	r.once.Do(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		entries := r.entries
+		if entries == nil {
+			entries = []harEntry{}
+		}
+		archive := map[string]interface{}{
+			"log": map[string]interface{}{
+				"version": "1.2",
+				"creator": map[string]string{"name": AppName, "version": AppVersion},
+				"entries": entries,
+			},
+		}
+		data, err := json.MarshalIndent(archive, "", "  ")
+		if err == nil {
+			err = os.WriteFile(r.path, data, 0600)
+		}
+		if err != nil {
+			warnf("failed to write HAR file %s: %v", r.path, err)
+		}
+	})
+}
+
+// writeHAR saves the archive of the recorder in ctx, if any
+func writeHAR(ctx context.Context) {
+	if rec, ok := ctx.Value(harContextKey{}).(*HARRecorder); ok {
+		rec.Write()
+	}
+}
+
+// ms converts a duration to fractional milliseconds
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
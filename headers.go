@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// parseHeader splits a "Name: value" header
+func parseHeader(header string) (string, string, error) {
+	name, value, ok := strings.Cut(header, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("invalid header %q (use 'Name: value')", header)
+	}
+	return http.CanonicalHeaderKey(name), strings.TrimSpace(value), nil
+}
+
+// customHeaders returns the extra headers to send with every request: the configured
+// headers, overridden by --header flags. Their values are redacted from output since
+// gateways usually use them for credentials.
+func customHeaders(c *cli.Context) (http.Header, error) {
+	headers := make(http.Header)
+	for name, value := range configFor(c.Context).Headers {
+		headers.Set(name, value)
+	}
+	for _, header := range c.StringSlice("header") {
+		name, value, err := parseHeader(header)
+		if err != nil {
+			return nil, err
+		}
+		headers.Set(name, value)
+	}
+
+	for _, values := range headers {
+		redactor.addSecrets(values...)
+	}
+	return headers, nil
+}
+
+// headersFingerprint identifies a set of headers without revealing their values
+func headersFingerprint(headers http.Header) string {
+	lines := make([]string, 0, len(headers))
+	for name, values := range headers {
+		lines = append(lines, name+": "+strings.Join(values, ","))
+	}
+	sort.Strings(lines)
+	return tokenFingerprint(strings.Join(lines, "\n"))
+}
+
+// headerTransport adds fixed headers to every request
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	return t.base.RoundTrip(req)
+}
+
+// withHeaders returns a copy of client that sends headers with every request
+func withHeaders(client *http.Client, headers http.Header) *http.Client {
+	if len(headers) == 0 {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	withHeaders := *client
+	withHeaders.Transport = &headerTransport{base: base, headers: headers}
+	return &withHeaders
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// History settings
+const (
+	HistoryOn  = "on"
+	HistoryOff = "off"
+)
+
+// historyMaxSize is the size past which the history file is moved aside to
+// history.jsonl.1, replacing the one moved aside before, and a new one started
+const historyMaxSize = 10 * 1024 * 1024
+
+// History export formats
+const (
+	HistoryCSV  = "csv"
+	HistoryJSON = "json"
+	HistoryTMX  = "tmx"
+)
+
+// HistoryEntry is a translation made on the command line, as kept in the history file
+type HistoryEntry struct {
+	Time        time.Time `json:"time"`
+	SourceLang  string    `json:"source_lang"`
+	TargetLang  string    `json:"target_lang"`
+	Provider    string    `json:"provider"`
+	Server      string    `json:"server,omitempty"`
+	Text        string    `json:"text"`
+	Translation string    `json:"translation"`
+	Characters  int       `json:"characters"`
+	Cached      bool      `json:"cached,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+	RequestID   string    `json:"request_id,omitempty"`
+}
+
+// History appends the translations of a client to the history file, one JSON object per line
+type History struct {
+	path  string
+	debug bool
+	mu    sync.Mutex
+}
+
+// historyPath returns the path of the history file
+func historyPath() (string, error) {
+	dir, err := appDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.jsonl"), nil
+}
+
+// checkHistory validates a history setting
+func checkHistory(setting string) error {
+	switch setting {
+	case HistoryOn, HistoryOff:
+		return nil
+	}
+	return fmt.Errorf("unknown history setting %q (use on or off)", setting)
+}
+
+// historyFromFlags returns the history translations are kept in, or nil when it is turned off
+func historyFromFlags(c *cli.Context) *History {
+	if configFor(c.Context).History == HistoryOff {
+		return nil
+	}
+	path, err := historyPath()
+	if err != nil {
+		return nil
+	}
+	return &History{path: path, debug: c.Bool("debug")}
+}
+
+// record appends an entry to the history file, rotating it when it gets too large. The
+// first entry ever kept says where they go and how to stop it. Failing to record is only
+// reported in debug mode, since the translation itself succeeded.
+func (h *History) record(entry HistoryEntry) {
+	if h == nil {
+		return
+	}
+	entry.Server, _ = splitUserinfo(entry.Server)
+	data, err := json.Marshal(entry)
+	if err == nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		err = h.rotate()
+	}
+	first := false
+	if err == nil {
+		first = !fileExists(h.path) && !fileExists(h.path+".1")
+		err = appendLine(h.path, data)
+	}
+	if err != nil && h.debug {
+		debugf("Could not save the translation to the history: %v\n", err)
+	}
+	if err == nil && first {
+		hint("Translations are kept in %s for history export and stats; turn this off with: %s config set --history off\n", h.path, AppName)
+	}
+}
+
+// rotate moves the history file aside once it reaches historyMaxSize
+func (h *History) rotate() error {
+	info, err := os.Stat(h.path)
+	if err != nil || info.Size() < historyMaxSize {
+		return nil
+	}
+	return os.Rename(h.path, h.path+".1")
+}
+
+// fileExists reports whether there is a file at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// appendLine appends a line to a file private to the user, creating it and its directory
+func appendLine(path string, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// historyCall collects what the requests of one translation report for its history entry
+type historyCall struct {
+	server string
+}
+
+// historyCallContextKey is the context key holding the historyCall
+type historyCallContextKey struct{}
+
+// historyCallFrom returns the historyCall in ctx, or nil
+func historyCallFrom(ctx context.Context) *historyCall {
+	call, _ := ctx.Value(historyCallContextKey{}).(*historyCall)
+	return call
+}
+
+// loadTranslationHistory reads the history file, after the one moved aside by the last
+// rotation, warning about lines it can't parse
+func loadTranslationHistory() ([]HistoryEntry, error) {
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	var entries []HistoryEntry
+	for _, file := range []string{path + ".1", path} {
+		read, skipped, err := readHistoryFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if skipped > 0 {
+			warnf("skipped %d unreadable line(s) of %s", skipped, file)
+		}
+		entries = append(entries, read...)
+	}
+	return entries, nil
+}
+
+// readHistoryFile reads the entries of a history file, counting the lines it can't parse.
+// A missing file has none.
+func readHistoryFile(path string) ([]HistoryEntry, int, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	skipped := 0
+	r := bufio.NewReader(f)
+	for {
+		// Lines are read whole, however long the text translated
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry HistoryEntry
+			if json.Unmarshal(line, &entry) == nil {
+				entries = append(entries, entry)
+			} else {
+				skipped++
+			}
+		}
+		if err == io.EOF {
+			return entries, skipped, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// historySince keeps the entries made on or after the day given (YYYY-MM-DD), all if empty
+func historySince(entries []HistoryEntry, since string) ([]HistoryEntry, error) {
+	if since == "" {
+		return entries, nil
+	}
+	day, err := time.ParseInLocation(ledgerDay, since, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q (use YYYY-MM-DD)", since)
+	}
+	var kept []HistoryEntry
+	for _, entry := range entries {
+		if !entry.Time.Before(day) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept, nil
+}
+
+// historyExport is the JSON export of the history
+type historyExport struct {
+	Schema  int            `json:"schema"`
+	Entries []HistoryEntry `json:"entries"`
+}
+
+// writeHistoryCSV writes the entries as CSV with a header row, for spreadsheets
+func writeHistoryCSV(w io.Writer, entries []HistoryEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"time", "source_lang", "target_lang", "provider", "server", "text", "translation", "characters", "cached", "duration_ms", "request_id"})
+	for _, entry := range entries {
+		cw.Write([]string{
+			entry.Time.Format(time.RFC3339),
+			entry.SourceLang,
+			entry.TargetLang,
+			entry.Provider,
+			entry.Server,
+			entry.Text,
+			entry.Translation,
+			strconv.Itoa(entry.Characters),
+			strconv.FormatBool(entry.Cached),
+			strconv.FormatInt(entry.DurationMS, 10),
+			entry.RequestID,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeHistoryTMX writes the entries as a TMX 1.4 translation memory for CAT tools. The
+// source language of each unit is its own, since the history mixes language pairs.
+func writeHistoryTMX(w io.Writer, entries []HistoryEntry) error {
+	escape := func(text string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(text))
+		return b.String()
+	}
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString("<tmx version=\"1.4\">\n")
+	fmt.Fprintf(&b, "  <header creationtool=\"%s\" creationtoolversion=\"%s\" datatype=\"plaintext\" segtype=\"block\" adminlang=\"en\" srclang=\"*all*\" o-tmf=\"%s\"/>\n", AppName, escape(AppVersion), AppName)
+	b.WriteString("  <body>\n")
+	for _, entry := range entries {
+		source := entry.SourceLang
+		if source == "" || strings.EqualFold(source, "auto") {
+			// Without a detected language the unit can't be placed in a memory
+			continue
+		}
+		fmt.Fprintf(&b, "    <tu creationdate=\"%s\" srclang=\"%s\">\n", entry.Time.UTC().Format("20060102T150405Z"), toBCP47(source))
+		fmt.Fprintf(&b, "      <prop type=\"x-provider\">%s</prop>\n", escape(entry.Provider))
+		if entry.Server != "" {
+			fmt.Fprintf(&b, "      <prop type=\"x-server\">%s</prop>\n", escape(entry.Server))
+		}
+		fmt.Fprintf(&b, "      <tuv xml:lang=\"%s\"><seg>%s</seg></tuv>\n", toBCP47(source), escape(entry.Text))
+		fmt.Fprintf(&b, "      <tuv xml:lang=\"%s\"><seg>%s</seg></tuv>\n", toBCP47(entry.TargetLang), escape(entry.Translation))
+		b.WriteString("    </tu>\n")
+	}
+	b.WriteString("  </body>\n</tmx>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// runHistoryExport handles the history export command
+func runHistoryExport(c *cli.Context) error {
+	entries, err := loadTranslationHistory()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("History error: %s", err), 1)
+	}
+	entries, err = historySince(entries, c.String("since"))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("History error: %s", err), ExitUsage)
+	}
+
+	var w io.Writer = os.Stdout
+	if out := c.String("out"); out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("History error: %s", err), 1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch format := strings.ToLower(c.String("format")); format {
+	case HistoryCSV:
+		err = writeHistoryCSV(w, entries)
+	case HistoryJSON:
+		if entries == nil {
+			entries = []HistoryEntry{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(historyExport{Schema: SchemaVersion, Entries: entries})
+	case HistoryTMX:
+		err = writeHistoryTMX(w, entries)
+	default:
+		return cli.Exit(fmt.Sprintf("History error: unknown format %q (use csv, json or tmx)", format), ExitUsage)
+	}
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("History error: %s", err), 1)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// runHook runs a pre_translate or post_translate hook: the shell command gets text on
+// stdin, with the languages in $TRANSLATE_SOURCE and $TRANSLATE_TARGET, and what it prints
+// takes its place. A hook printing nothing leaves text as it is, so one that only passes
+// it on to another tool needn't echo it back.
+func runHook(ctx context.Context, name, command, text, sourceLang, targetLang string, debug bool) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Env = append(os.Environ(), "TRANSLATE_SOURCE="+toBCP47(sourceLang), "TRANSLATE_TARGET="+toBCP47(targetLang))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if debug {
+		debugf("Running %s hook: %s\n", name, command)
+	}
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("%s hook failed: %s", name, message)
+	}
+	if stdout.Len() == 0 {
+		return text, nil
+	}
+	out := stdout.String()
+	// Commands end their output with a newline the text may not have had
+	if !strings.HasSuffix(text, "\n") {
+		out = strings.TrimSuffix(strings.TrimSuffix(out, "\n"), "\r")
+	}
+	return out, nil
+}
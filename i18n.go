@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/urfave/cli/v2"
+)
+
+// jsonNode is a JSON value that keeps the order of object keys, so a locale file can be
+// written back in the order its keys were written
+type jsonNode struct {
+	// object or array; for other values, scalar holds the value decoded with UseNumber
+	object bool
+	array  bool
+	keys   []string
+	fields map[string]*jsonNode
+	items  []*jsonNode
+	scalar interface{}
+}
+
+// str returns the string a node holds, and whether it holds one
+func (n *jsonNode) str() (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	s, ok := n.scalar.(string)
+	return s, ok
+}
+
+// set adds or replaces a field of an object node
+func (n *jsonNode) set(key string, value *jsonNode) {
+	if _, ok := n.fields[key]; !ok {
+		n.keys = append(n.keys, key)
+	}
+	n.fields[key] = value
+}
+
+// parseJSONNode decodes a JSON document into ordered nodes
+func parseJSONNode(data []byte) (*jsonNode, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeJSONNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the document")
+	}
+	return node, nil
+}
+
+// decodeJSONNode decodes the next value of dec
+func decodeJSONNode(dec *json.Decoder) (*jsonNode, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		node := &jsonNode{object: true, fields: make(map[string]*jsonNode)}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.set(key.(string), value)
+		}
+		_, err := dec.Token()
+		return node, err
+	case json.Delim('['):
+		node := &jsonNode{array: true}
+		for dec.More() {
+			value, err := decodeJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, value)
+		}
+		_, err := dec.Token()
+		return node, err
+	}
+	return &jsonNode{scalar: token}, nil
+}
+
+// writeJSONNode encodes a node, indenting nested values by indent
+func writeJSONNode(b *strings.Builder, n *jsonNode, indent string, depth int) {
+	inner := strings.Repeat(indent, depth+1)
+	switch {
+	case n.object:
+		if len(n.keys) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{\n")
+		for i, key := range n.keys {
+			b.WriteString(inner + jsonQuote(key) + ": ")
+			writeJSONNode(b, n.fields[key], indent, depth+1)
+			if i < len(n.keys)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(strings.Repeat(indent, depth) + "}")
+	case n.array:
+		if len(n.items) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[\n")
+		for i, item := range n.items {
+			b.WriteString(inner)
+			writeJSONNode(b, item, indent, depth+1)
+			if i < len(n.items)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(strings.Repeat(indent, depth) + "]")
+	default:
+		switch value := n.scalar.(type) {
+		case string:
+			b.WriteString(jsonQuote(value))
+		case json.Number:
+			b.WriteString(value.String())
+		case nil:
+			b.WriteString("null")
+		default:
+			fmt.Fprint(b, value)
+		}
+	}
+}
+
+// jsonIndent returns the indentation a JSON document uses, two spaces if it can't tell
+func jsonIndent(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+// localeFileLanguage returns the language a locale file is named after, as in de.json or
+// messages.pt_BR.json, or "" if it isn't
+func localeFileLanguage(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	if !isLanguageName(name) {
+		return ""
+	}
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// pendingMessage is a message of the source file missing from the target, to translate
+type pendingMessage struct {
+	node *jsonNode
+	text string
+	note string
+}
+
+// localeSync merges the messages of a source locale file into a target one
+type localeSync struct {
+	targetLang string
+	prune      bool
+	pending    []pendingMessage
+	kept       int
+	removed    int
+}
+
+// merge returns the target value for the source value src, keeping the translation
+// already in tgt (which may be nil) and queueing the messages missing from it
+func (s *localeSync) merge(src, tgt *jsonNode, note string) *jsonNode {
+	switch {
+	case src.object:
+		if tgt == nil || !tgt.object {
+			tgt = &jsonNode{object: true, fields: make(map[string]*jsonNode)}
+		}
+		result := &jsonNode{object: true, fields: make(map[string]*jsonNode)}
+		// In the Chrome extension format only "message" is translated, described by "description"
+		_, chrome := src.fields["message"]
+		for _, key := range src.keys {
+			value, existing := src.fields[key], tgt.fields[key]
+			switch {
+			case key == "@@locale" && existing == nil:
+				result.set(key, &jsonNode{scalar: strings.ReplaceAll(toBCP47(s.targetLang), "-", "_")})
+			case strings.HasPrefix(key, "@") || chrome && key != "message":
+				// Metadata, such as ARB descriptions, is copied rather than translated
+				if existing == nil {
+					existing = value
+				}
+				result.set(key, existing)
+			default:
+				note := ""
+				if description, ok := src.fields["@"+key].fieldString("description"); ok {
+					note = description
+				} else if chrome {
+					note, _ = src.fieldString("description")
+				}
+				result.set(key, s.merge(value, existing, note))
+			}
+		}
+		for _, key := range tgt.keys {
+			if _, ok := src.fields[key]; ok {
+				continue
+			}
+			if s.prune {
+				s.removed++
+				continue
+			}
+			result.set(key, tgt.fields[key])
+		}
+		return result
+	case src.array:
+		if tgt == nil || !tgt.array {
+			tgt = &jsonNode{array: true}
+		}
+		result := &jsonNode{array: true}
+		for i, item := range src.items {
+			var existing *jsonNode
+			if i < len(tgt.items) {
+				existing = tgt.items[i]
+			}
+			result.items = append(result.items, s.merge(item, existing, note))
+		}
+		if len(tgt.items) > len(src.items) {
+			if s.prune {
+				s.removed += len(tgt.items) - len(src.items)
+			} else {
+				result.items = append(result.items, tgt.items[len(src.items):]...)
+			}
+		}
+		return result
+	}
+
+	text, ok := src.str()
+	if !ok || text == "" {
+		if tgt != nil {
+			return tgt
+		}
+		return src
+	}
+	// An empty translation counts as missing
+	if translation, ok := tgt.str(); ok && translation != "" {
+		s.kept++
+		return tgt
+	}
+	node := &jsonNode{scalar: text}
+	s.pending = append(s.pending, pendingMessage{node: node, text: text, note: note})
+	return node
+}
+
+// fieldString returns the string field key of an object node
+func (n *jsonNode) fieldString(key string) (string, bool) {
+	if n == nil || !n.object {
+		return "", false
+	}
+	return n.fields[key].str()
+}
+
+// runI18nSync handles the i18n sync command: messages of the source file missing from the
+// target are translated and added, the target's own translations are left as they are,
+// and with --prune messages no longer in the source are removed
+func runI18nSync(c *cli.Context) error {
+	sourcePath, targetPath := c.String("source"), c.String("target")
+	if sourcePath == "" || targetPath == "" {
+		return cli.Exit("Usage: translate i18n sync --source en.json --target de.json [--prune]", ExitUsage)
+	}
+	for _, path := range []string{sourcePath, targetPath} {
+		if ext := strings.ToLower(filepath.Ext(path)); ext != ".json" && ext != ".arb" {
+			return cli.Exit(fmt.Sprintf("Sync error: %s isn't a JSON or ARB locale file", path), ExitUsage)
+		}
+	}
+
+	lang := c.String("lang")
+	if lang == "" {
+		lang = localeFileLanguage(targetPath)
+	}
+	if lang == "" {
+		return cli.Exit(fmt.Sprintf("Sync error: can't tell the language of %s from its name; give --lang", targetPath), ExitUsage)
+	}
+	config := configFor(c.Context)
+	targetLang := resolveTargetVariant(toDeepLCode(lang, false), config.VariantPreferences, false)
+	sourceLang := "AUTO"
+	if name := localeFileLanguage(sourcePath); name != "" {
+		sourceLang = toDeepLCode(name, true)
+	}
+
+	sourceData, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+	sourceText, layout := splitLayout(sourceData)
+	source, err := parseJSONNode([]byte(sourceText))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Sync error: %s: %s", sourcePath, err), 1)
+	}
+	var target *jsonNode
+	indent := jsonIndent(sourceData)
+	targetData, err := os.ReadFile(targetPath)
+	switch {
+	case err == nil:
+		// The target keeps its own layout; a new one takes the source's
+		var targetText string
+		targetText, layout = splitLayout(targetData)
+		if target, err = parseJSONNode([]byte(targetText)); err != nil {
+			return cli.Exit(fmt.Sprintf("Sync error: %s: %s", targetPath, err), 1)
+		}
+		indent = jsonIndent(targetData)
+	case !os.IsNotExist(err):
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+
+	sync := &localeSync{targetLang: targetLang, prune: c.Bool("prune")}
+	result := sync.merge(source, target, "")
+
+	client := sharedClient(c)
+	opts := translateOptions(c.Context)
+	progress := startProgress("Translating missing messages", len(sync.pending), c.Bool("debug"))
+	for _, message := range sync.pending {
+		messageOpts := opts
+		if message.note != "" {
+			messageOpts.Context = strings.TrimSpace(opts.Context + "\n" + message.note)
+		}
+		resp, _, err := client.Translate(withTranslateOptions(c.Context, messageOpts), message.text, sourceLang, targetLang)
+		progress.Step(err)
+		if err != nil {
+			progress.Stop()
+			return cli.Exit(fmt.Sprintf("Translation error: %q: %s", message.text, errorAdvice(err)), exitCodeFor(err))
+		}
+		message.node.scalar = resp.Data
+	}
+	progress.Stop()
+
+	var b strings.Builder
+	writeJSONNode(&b, result, indent, 0)
+	b.WriteByte('\n')
+	if err := os.WriteFile(targetPath, []byte(layout.restore(b.String())), 0644); err != nil {
+		return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+	}
+	summary := fmt.Sprintf("Added %d translations to %s, kept %d", len(sync.pending), targetPath, sync.kept)
+	if sync.prune {
+		summary += fmt.Sprintf(", removed %d", sync.removed)
+	}
+	fmt.Println(summary)
+	return nil
+}
+
+// flattenMessages collects the messages of a locale file by their dotted key, leaving out
+// metadata such as ARB's "@key" entries and Chrome's descriptions
+func flattenMessages(n *jsonNode, prefix string, keys *[]string, values map[string]string) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+	switch {
+	case n.object:
+		_, chrome := n.fields["message"]
+		for _, key := range n.keys {
+			if strings.HasPrefix(key, "@") || chrome && key != "message" {
+				continue
+			}
+			flattenMessages(n.fields[key], join(key), keys, values)
+		}
+	case n.array:
+		for i, item := range n.items {
+			flattenMessages(item, join(fmt.Sprint(i)), keys, values)
+		}
+	default:
+		if text, ok := n.str(); ok {
+			*keys = append(*keys, prefix)
+			values[prefix] = text
+		}
+	}
+}
+
+// Kinds of problems i18n lint reports
+const (
+	LintMissing      = "missing"
+	LintEmpty        = "empty"
+	LintUntranslated = "untranslated"
+	LintPlaceholders = "placeholders"
+)
+
+// lintIssue is a problem with a message of a locale file
+type lintIssue struct {
+	Key     string `json:"key"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// lintFile is the problems found in a locale file
+type lintFile struct {
+	Path   string      `json:"path"`
+	Issues []lintIssue `json:"issues"`
+}
+
+// lintOutput is the JSON output of i18n lint
+type lintOutput struct {
+	Schema int        `json:"schema"`
+	Source string     `json:"source"`
+	Files  []lintFile `json:"files"`
+	Issues int        `json:"issues"`
+}
+
+// lintLocale compares the messages of a translated locale file with the source's
+func lintLocale(sourceKeys []string, source, target map[string]string) []lintIssue {
+	issues := []lintIssue{}
+	for _, key := range sourceKeys {
+		text := source[key]
+		translation, ok := target[key]
+		switch {
+		case !ok:
+			issues = append(issues, lintIssue{Key: key, Kind: LintMissing, Message: "not translated"})
+		case translation == "" && text != "":
+			issues = append(issues, lintIssue{Key: key, Kind: LintEmpty, Message: "empty translation"})
+		case translation == text && strings.IndexFunc(text, unicode.IsLetter) >= 0:
+			issues = append(issues, lintIssue{Key: key, Kind: LintUntranslated, Message: "same as the source"})
+		default:
+			missing, extra := placeholderMismatch(text, translation)
+			var problems []string
+			if len(missing) > 0 {
+				problems = append(problems, "missing "+strings.Join(missing, " "))
+			}
+			if len(extra) > 0 {
+				problems = append(problems, "unexpected "+strings.Join(extra, " "))
+			}
+			if len(problems) > 0 {
+				issues = append(issues, lintIssue{Key: key, Kind: LintPlaceholders, Message: strings.Join(problems, "; ")})
+			}
+		}
+	}
+	return issues
+}
+
+// readMessages reads the messages of a JSON or ARB locale file
+func readMessages(path string) ([]string, map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	text, _ := splitLayout(data)
+	node, err := parseJSONNode([]byte(text))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var keys []string
+	values := make(map[string]string)
+	flattenMessages(node, "", &keys, values)
+	return keys, values, nil
+}
+
+// runI18nLint handles the i18n lint command, checking translated locale files against the
+// source: missing and empty messages, messages left as in the source, and placeholders
+// lost or added. It exits with status 1 when anything is found, for CI.
+func runI18nLint(c *cli.Context) error {
+	sourcePath := c.String("source")
+	if sourcePath == "" || c.NArg() == 0 {
+		return cli.Exit("Usage: translate i18n lint --source en.json FILE...", ExitUsage)
+	}
+	sourceKeys, source, err := readMessages(sourcePath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Lint error: %s", err), 1)
+	}
+
+	output := lintOutput{Schema: SchemaVersion, Source: sourcePath, Files: []lintFile{}}
+	for _, path := range c.Args().Slice() {
+		_, target, err := readMessages(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Lint error: %s", err), 1)
+		}
+		file := lintFile{Path: path, Issues: lintLocale(sourceKeys, source, target)}
+		output.Files = append(output.Files, file)
+		output.Issues += len(file.Issues)
+	}
+
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(output)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, file := range output.Files {
+			for _, issue := range file.Issues {
+				fmt.Printf("%s: %s: %s: %s\n", file.Path, issue.Key, issue.Kind, issue.Message)
+			}
+		}
+		if output.Issues > 0 {
+			fmt.Printf("%d issues in %d files\n", output.Issues, len(output.Files))
+		} else {
+			hint("No issues in %d files\n", len(output.Files))
+		}
+	}
+	if output.Issues > 0 {
+		return cli.Exit("", ExitFailure)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Invocation is what the goroutines of one run of the program share: the configuration,
+// read once at startup, and the client whose connections, failure cache, token pool and
+// budget all requests go through. The root Before puts it in the context, and commands
+// take it from there rather than reading the configuration file or building clients again.
+type Invocation struct {
+	mu     sync.Mutex
+	config Config
+
+	clientOnce sync.Once
+	client     *Client
+}
+
+type invocationContextKey struct{}
+
+// withInvocation returns a copy of ctx carrying an invocation using config
+func withInvocation(ctx context.Context, config Config) context.Context {
+	return context.WithValue(ctx, invocationContextKey{}, &Invocation{config: config})
+}
+
+// invocationFrom returns the invocation in ctx, or nil
+func invocationFrom(ctx context.Context) *Invocation {
+	if ctx == nil {
+		return nil
+	}
+	inv, _ := ctx.Value(invocationContextKey{}).(*Invocation)
+	return inv
+}
+
+// configFor returns the configuration of the invocation in ctx, or reads it when there is
+// none, with the project's settings merged in. Its maps and slices are shared, so changes go through updateConfig.
+func configFor(ctx context.Context) Config {
+	inv := invocationFrom(ctx)
+	if inv == nil {
+		return loadEffectiveConfig()
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	return inv.config
+}
+
+// errKeepConfig is returned by the change of updateConfig to leave the configuration as
+// it is, without an error
+var errKeepConfig = errors.New("configuration kept")
+
+// updateConfig changes the configuration and saves it. The file is read again first so a
+// change made meanwhile by another process isn't lost, and changes from goroutines of the
+// same invocation are made one at a time.
+func updateConfig(ctx context.Context, change func(*Config) error) error {
+	inv := invocationFrom(ctx)
+	if inv != nil {
+		inv.mu.Lock()
+		defer inv.mu.Unlock()
+	}
+	config := loadConfig()
+	if err := change(&config); err != nil {
+		if errors.Is(err, errKeepConfig) {
+			return nil
+		}
+		return err
+	}
+	if err := saveConfig(config); err != nil {
+		return err
+	}
+	if inv != nil {
+		if merged, err := project.apply(config); err == nil {
+			config = merged
+		}
+		inv.config = config
+	}
+	return nil
+}
+
+// sharedClient returns the client of the invocation, built from the flags on first use,
+// or a new client when there is no invocation
+func sharedClient(c *cli.Context) *Client {
+	inv := invocationFrom(c.Context)
+	if inv == nil {
+		return newClient(c)
+	}
+	inv.clientOnce.Do(func() {
+		inv.client = newClient(c)
+	})
+	return inv.client
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// useTempConfig points the configuration file at a fresh temporary one for a test
+func useTempConfig(t *testing.T) {
+	t.Helper()
+	old := configPathOverride
+	configPathOverride = filepath.Join(t.TempDir(), "config.json")
+	t.Cleanup(func() { configPathOverride = old })
+}
+
+// mockServer is a DeepLX server answering "LANG:text", counting its requests
+func mockServer(t *testing.T) (*httptest.Server, *int64) {
+	t.Helper()
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Text       string `json:"text"`
+			SourceLang string `json:"source_lang"`
+			TargetLang string `json:"target_lang"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt64(&requests, 1)
+		json.NewEncoder(w).Encode(TranslationResponse{
+			Code:       200,
+			Data:       req.TargetLang + ":" + req.Text,
+			SourceLang: "EN",
+			TargetLang: req.TargetLang,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// invocationWithClient returns a context whose invocation's client talks to server
+func invocationWithClient(t *testing.T, server string) context.Context {
+	t.Helper()
+	provider, err := lookupProvider(ProviderDeepLX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withInvocation(context.Background(), Config{})
+	inv := invocationFrom(ctx)
+	inv.clientOnce.Do(func() {
+		inv.client = &Client{Provider: provider, Servers: []string{server}, SkipPreflight: true, HTTPClient: &http.Client{}}
+	})
+	return ctx
+}
+
+// runCommand runs a command with the global --target, --source, --jobs and --debug flags
+func runCommand(ctx context.Context, command *cli.Command, args ...string) error {
+	app := &cli.App{
+		Name: AppName,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "target"},
+			&cli.StringFlag{Name: "source", Value: "auto"},
+			&cli.BoolFlag{Name: "debug"},
+		},
+		Commands:       []*cli.Command{command},
+		ExitErrHandler: func(*cli.Context, error) {},
+	}
+	return app.RunContext(ctx, append([]string{AppName}, args...))
+}
+
+func TestUpdateConfigConcurrent(t *testing.T) {
+	useTempConfig(t)
+	ctx := withInvocation(context.Background(), Config{})
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			err := updateConfig(ctx, func(config *Config) error {
+				if config.Aliases == nil {
+					config.Aliases = make(map[string][]string)
+				}
+				config.Aliases[fmt.Sprintf("a%d", i)] = []string{"-t", "de"}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = len(configFor(ctx).Aliases)
+		}()
+	}
+	wg.Wait()
+
+	if got := len(configFor(ctx).Aliases); got != writers {
+		t.Errorf("invocation has %d aliases, want %d", got, writers)
+	}
+	if got := len(loadConfig().Aliases); got != writers {
+		t.Errorf("file has %d aliases, want %d", got, writers)
+	}
+}
+
+func TestUpdateConfigKeep(t *testing.T) {
+	useTempConfig(t)
+	ctx := withInvocation(context.Background(), Config{})
+	err := updateConfig(ctx, func(config *Config) error {
+		config.LanguageSort = LangSortAlpha
+		return errKeepConfig
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(configPathOverride); !os.IsNotExist(err) {
+		t.Errorf("configuration saved although kept: %v", err)
+	}
+}
+
+func TestSharedClientConcurrent(t *testing.T) {
+	useTempConfig(t)
+	c := cli.NewContext(&cli.App{}, flag.NewFlagSet(AppName, flag.ContinueOnError), nil)
+	c.Context = withInvocation(context.Background(), Config{})
+
+	clients := make([]*Client, 32)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			clients[i] = sharedClient(c)
+		}(i)
+	}
+	wg.Wait()
+	for i, client := range clients {
+		if client == nil || client != clients[0] {
+			t.Fatalf("goroutine %d got client %p, want the shared %p", i, client, clients[0])
+		}
+	}
+}
+
+func TestLocaleParallel(t *testing.T) {
+	useTempConfig(t)
+	server, requests := mockServer(t)
+	ctx := invocationWithClient(t, server.URL)
+
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < 6; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("messages%d.json", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf(`{"greeting": "Hello %d", "farewell": "Bye %d"}`, i, i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	command := &cli.Command{
+		Name: "locale",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "out"},
+			&cli.IntFlag{Name: "jobs", Value: 4},
+			&cli.BoolFlag{Name: "merge"},
+			&cli.StringFlag{Name: "merge-annotation"},
+		},
+		Action: runLocale,
+	}
+	if err := runCommand(ctx, command, append([]string{"--target", "de,fr", "locale"}, paths...)...); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := atomic.LoadInt64(requests); got != 6*2*2 {
+		t.Errorf("server got %d requests, want %d", got, 6*2*2)
+	}
+	for i, path := range paths {
+		for _, lang := range []string{"DE", "FR"} {
+			data, err := os.ReadFile(localeOutputPath(path, lang))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := fmt.Sprintf(`"greeting": "%s:Hello %d"`, lang, i)
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s: got %s, want %s in it", localeOutputPath(path, lang), data, want)
+			}
+		}
+	}
+}
+
+func TestDirParallel(t *testing.T) {
+	useTempConfig(t)
+	server, _ := mockServer(t)
+	ctx := invocationWithClient(t, server.URL)
+
+	root := t.TempDir()
+	for i := 0; i < 8; i++ {
+		text := fmt.Sprintf("Paragraph one of %d.\n\nParagraph two of %d.\n", i, i)
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("doc%d.md", i)), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(t.TempDir(), "docs.{lang}")
+
+	command := &cli.Command{
+		Name: "dir",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "out"},
+			&cli.IntFlag{Name: "jobs", Value: 4},
+			&cli.StringSliceFlag{Name: "include"},
+			&cli.StringSliceFlag{Name: "exclude"},
+			&cli.BoolFlag{Name: "merge"},
+			&cli.StringFlag{Name: "merge-annotation"},
+		},
+		Action: runDir,
+	}
+	if err := runCommand(ctx, command, "--target", "de,ja", "dir", "--out", out, root); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		for _, lang := range []string{"de", "ja"} {
+			path := filepath.Join(strings.ReplaceAll(out, "{lang}", lang), fmt.Sprintf("doc%d.md", i))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := strings.ToUpper(lang)
+			want := fmt.Sprintf("%s:Paragraph one of %d.\n\n%s:Paragraph two of %d.\n", code, i, code, i)
+			if string(data) != want {
+				t.Errorf("%s: got %q, want %q", path, data, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// isTTY reports whether f is a terminal: only a terminal has terminal attributes, which
+// other character devices such as /dev/null don't
+func isTTY(f *os.File) bool {
+	var termios syscall.Termios
+	return termiosIoctl(f, ioctlGetTermios, &termios) == nil
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var procGetConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("GetConsoleMode")
+
+// isTTY reports whether f is a console: only a console has a console mode, which other
+// character devices such as NUL don't
+func isTTY(f *os.File) bool {
+	var mode uint32
+	ok, _, _ := procGetConsoleMode.Call(f.Fd(), uintptr(unsafe.Pointer(&mode)))
+	return ok != 0
+}
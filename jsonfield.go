@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// runJSONField translates one field of every JSON object read from stdin and writes the objects to stdout
+func runJSONField(c *cli.Context, field string) error {
+	targets := splitLangList(c.String("target"))
+	if len(targets) != 1 {
+		return cli.Exit("Translation error: --json-field needs exactly one target language", ExitUsage)
+	}
+
+	config := configFor(c.Context)
+	client := sharedClient(c)
+	sourceLang := toDeepLCode(c.String("source"), true)
+	targetLang := resolveTargetVariant(toDeepLCode(targets[0], false), config.VariantPreferences, false)
+
+	// Objects are written as they are translated, so progress is only shown when they
+	// don't go to the same terminal
+	var progress *Progress
+	if !isTerminal(os.Stdout) {
+		progress = startProgress("Translating objects", 0, c.Bool("debug"))
+	}
+	translateText := func(text string) (string, error) {
+		resp, _, err := client.Translate(c.Context, text, sourceLang, targetLang)
+		progress.Step(err)
+		if err != nil {
+			return "", err
+		}
+		return resp.Data, nil
+	}
+
+	err := translateJSONStream(c.Context, os.Stdin, os.Stdout, strings.Split(field, "."), translateText, c.Bool("debug"))
+	progress.Stop()
+	if err != nil {
+		return translationExit(err)
+	}
+	reportSkipped(client, targetLang)
+	return nil
+}
+
+// translateJSONStream decodes a stream of JSON values, translates the string at path in each
+// and writes them back one per line. Only the translated string is rewritten, so the keys
+// keep their order and the values their formatting. Values without a string at path are
+// passed through unchanged.
+func translateJSONStream(ctx context.Context, in io.Reader, out io.Writer, path []string, translateText func(string) (string, error), debug bool) error {
+	dec := json.NewDecoder(bufio.NewReader(in))
+
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	for n := 1; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid JSON in object %d: %v", n, err)
+		}
+
+		text, start, end, ok := jsonPathSpan(value, path)
+		if !ok {
+			if debug {
+				debugf("Object %d has no string at %s, passing through\n", n, strings.Join(path, "."))
+			}
+		} else if strings.TrimSpace(text) != "" {
+			translated, err := translateText(text)
+			if err != nil {
+				return fmt.Errorf("object %d: %v", n, err)
+			}
+			quoted, err := marshalJSONString(translated)
+			if err != nil {
+				return err
+			}
+			value = append(append(append(json.RawMessage{}, value[:start]...), quoted...), value[end:]...)
+		}
+
+		w.Write(value)
+		w.WriteByte('\n')
+		// Flush per object so downstream tools in a pipeline see results as they arrive
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// jsonPathSpan finds the string reached by walking path through the objects and arrays of
+// value, returning it and where its quoted form starts and ends in value
+func jsonPathSpan(value []byte, path []string) (string, int, int, bool) {
+	dec := json.NewDecoder(bytes.NewReader(value))
+	for _, segment := range path {
+		token, err := dec.Token()
+		if err != nil {
+			return "", 0, 0, false
+		}
+		switch token {
+		case json.Delim('{'):
+			found := false
+			for !found && dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return "", 0, 0, false
+				}
+				if found = key == segment; !found && skipJSONValue(dec) != nil {
+					return "", 0, 0, false
+				}
+			}
+			if !found {
+				return "", 0, 0, false
+			}
+		case json.Delim('['):
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 {
+				return "", 0, 0, false
+			}
+			for ; i > 0 && dec.More(); i-- {
+				if skipJSONValue(dec) != nil {
+					return "", 0, 0, false
+				}
+			}
+			if i > 0 || !dec.More() {
+				return "", 0, 0, false
+			}
+		default:
+			return "", 0, 0, false
+		}
+	}
+
+	// What comes before the string is whitespace and a separator, never a quote
+	start := int(dec.InputOffset())
+	token, err := dec.Token()
+	text, ok := token.(string)
+	if err != nil || !ok {
+		return "", 0, 0, false
+	}
+	end := int(dec.InputOffset())
+	return text, start + bytes.IndexByte(value[start:end], '"'), end, true
+}
+
+// skipJSONValue reads past the next value of dec
+func skipJSONValue(dec *json.Decoder) error {
+	var skipped json.RawMessage
+	return dec.Decode(&skipped)
+}
+
+// marshalJSONString quotes text as a JSON string, leaving <, > and & as they are
+func marshalJSONString(text string) ([]byte, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(text); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
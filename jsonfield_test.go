@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestTranslateJSONStreamKeepsLayout(t *testing.T) {
+	in := "{\"z\": 1, \"text\": \"Hello\", \"a\": {\"b\": [\"x\", {\"c\" : \"deep\"}]}}\n" +
+		"{\"id\": 2.50, \"text\": null}\n" +
+		"{\n  \"b\": \"keep\",\n  \"text\":   \"caf\\u00e9\"\n}\n"
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"text", "{\"z\": 1, \"text\": \"DE:Hello\", \"a\": {\"b\": [\"x\", {\"c\" : \"deep\"}]}}\n" +
+			"{\"id\": 2.50, \"text\": null}\n" +
+			"{\n  \"b\": \"keep\",\n  \"text\":   \"DE:café\"\n}\n"},
+		{"a.b.1.c", "{\"z\": 1, \"text\": \"Hello\", \"a\": {\"b\": [\"x\", {\"c\" : \"DE:deep\"}]}}\n" +
+			"{\"id\": 2.50, \"text\": null}\n" +
+			"{\n  \"b\": \"keep\",\n  \"text\":   \"caf\\u00e9\"\n}\n"},
+	}
+	translate := func(text string) (string, error) { return "DE:" + text, nil }
+	for _, test := range tests {
+		var out strings.Builder
+		if err := translateJSONStream(context.Background(), strings.NewReader(in), &out, strings.Split(test.path, "."), translate, false); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.path, out.String(), test.want)
+		}
+	}
+}
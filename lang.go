@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Language ordering modes for multi-target output
+const (
+	LangSortInput  = "input"
+	LangSortAlpha  = "alpha"
+	LangSortConfig = "config"
+)
+
+// splitLangList splits a comma-separated list of language codes, dropping empty entries
+func splitLangList(list string) []string {
+	var langs []string
+	for _, lang := range strings.Split(list, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang != "" {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// baseLanguage returns the upper-case base language of a code, e.g. "PT" for "pt-BR"
+func baseLanguage(code string) string {
+	return strings.ToUpper(strings.SplitN(code, "-", 2)[0])
+}
+
+// bcp47Tag normalizes a language code (e.g. "EN-US", "zh_hans") to BCP-47 casing ("en-US", "zh-Hans")
+func bcp47Tag(code string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(code), "_", "-"), "-")
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 4:
+			// Script subtag, e.g. Hans
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		case len(part) == 2 || (len(part) == 3 && part[0] >= '0' && part[0] <= '9'):
+			// Region subtag, e.g. US or 419
+			parts[i] = strings.ToUpper(part)
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// bcp47ToDeepL maps BCP-47 tags (lowercased) whose DeepL code isn't simply the uppercased tag
+var bcp47ToDeepL = map[string]string{
+	"zh":      "ZH",
+	"zh-hans": "ZH",
+	"zh-cn":   "ZH",
+	"zh-sg":   "ZH",
+	"zh-hant": "ZH-HANT",
+	"zh-tw":   "ZH-HANT",
+	"zh-hk":   "ZH-HANT",
+	"zh-mo":   "ZH-HANT",
+	"no":      "NB",
+	"nn":      "NB",
+	"nb-no":   "NB",
+	"en-au":   "EN-GB",
+	"en-nz":   "EN-GB",
+	"en-ie":   "EN-GB",
+	"en-ca":   "EN-US",
+	"pt-ao":   "PT-PT",
+	"pt-mz":   "PT-PT",
+	"es-mx":   "ES-419",
+	"es-ar":   "ES-419",
+	"es-co":   "ES-419",
+	"es-cl":   "ES-419",
+}
+
+// deepLToBCP47 maps DeepL codes whose BCP-47 form isn't simply the recased code
+var deepLToBCP47 = map[string]string{
+	"ZH":      "zh-Hans",
+	"ZH-HANS": "zh-Hans",
+	"ZH-HANT": "zh-Hant",
+}
+
+// deepLVariants lists the regional target variants DeepL supports, keyed by base language
+var deepLVariants = map[string][]string{
+	"EN": {"EN-GB", "EN-US"},
+	"PT": {"PT-BR", "PT-PT"},
+	"ES": {"ES-419"},
+	"ZH": {"ZH-HANS", "ZH-HANT"},
+}
+
+// deepLLanguages lists the base language codes DeepL translates between
+var deepLLanguages = []string{
+	"AR", "BG", "CS", "DA", "DE", "EL", "EN", "ES", "ET", "FI", "FR", "HE", "HU", "ID", "IT", "JA",
+	"KO", "LT", "LV", "NB", "NL", "PL", "PT", "RO", "RU", "SK", "SL", "SV", "TH", "TR", "UK", "VI", "ZH",
+}
+
+// ambiguousTargets lists base target languages for which the server silently picks a regional variant
+var ambiguousTargets = map[string]bool{
+	"EN": true,
+	"PT": true,
+}
+
+// toDeepLCode converts a language tag in BCP-47 or DeepL form to the code DeepLX expects.
+// Source languages only accept base codes, so any region or script is dropped for them.
+func toDeepLCode(tag string, source bool) string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || strings.EqualFold(tag, "auto") {
+		return strings.ToUpper(tag)
+	}
+
+	normalized := strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	code, ok := bcp47ToDeepL[normalized]
+	if !ok {
+		code = strings.ToUpper(normalized)
+		base := strings.SplitN(code, "-", 2)[0]
+		if code != base {
+			// Keep regional variants DeepL knows about, fall back to the base language otherwise
+			known := false
+			for _, variant := range deepLVariants[base] {
+				if variant == code {
+					known = true
+					break
+				}
+			}
+			if !known {
+				code = base
+			}
+		}
+	}
+
+	if source {
+		code = strings.SplitN(code, "-", 2)[0]
+	}
+	return code
+}
+
+// toBCP47 converts a DeepL language code (or a loosely-cased tag) to its BCP-47 form
+func toBCP47(code string) string {
+	if code == "" {
+		return ""
+	}
+	if tag, ok := deepLToBCP47[strings.ToUpper(strings.ReplaceAll(code, "_", "-"))]; ok {
+		return tag
+	}
+	return bcp47Tag(code)
+}
+
+// resolveTargetVariant picks a regional variant for an ambiguous target language (e.g. EN, PT),
+// using the configured preference or, if enabled and nothing is configured, an interactive prompt.
+// Without a terminal to ask on, or with --non-interactive, the server decides.
+func resolveTargetVariant(code string, preferences map[string]string, prompt bool) string {
+	if !ambiguousTargets[code] {
+		return code
+	}
+	if preferred, ok := preferences[code]; ok && preferred != "" {
+		return toDeepLCode(preferred, false)
+	}
+	if prompt && canPrompt() {
+		return promptVariant(code, deepLVariants[code])
+	}
+	return code
+}
+
+// promptVariant asks the user which regional variant of a language to translate into
+func promptVariant(code string, variants []string) string {
+	fmt.Fprintf(os.Stderr, "Target %s has regional variants:\n", code)
+	for i, variant := range variants {
+		fmt.Fprintf(os.Stderr, "%d. %s (%s)\n", i+1, variant, toBCP47(variant))
+	}
+	fmt.Fprintf(os.Stderr, "%d. Let the server decide\n", len(variants)+1)
+	fmt.Fprintf(os.Stderr, "Choice (1-%d): ", len(variants)+1)
+
+	var choice int
+	fmt.Scanln(&choice)
+	if choice >= 1 && choice <= len(variants) {
+		return variants[choice-1]
+	}
+	return code
+}
+
+// isTerminal reports whether f is an interactive terminal, not a file, pipe or another
+// character device such as /dev/null, as cron, CI and services often give
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return isTTY(f)
+}
+
+// sortTargetResults orders multi-target results according to the given mode
+func sortTargetResults(results []TargetResult, mode string, order []string) {
+	switch mode {
+	case LangSortAlpha:
+		sort.SliceStable(results, func(i, j int) bool {
+			return strings.ToLower(results[i].Tag) < strings.ToLower(results[j].Tag)
+		})
+	case LangSortConfig:
+		rank := make(map[string]int, len(order))
+		for i, lang := range order {
+			rank[strings.ToLower(toBCP47(toDeepLCode(lang, false)))] = i
+		}
+		position := func(tag string) int {
+			tag = strings.ToLower(tag)
+			if r, ok := rank[tag]; ok {
+				return r
+			}
+			// Fall back to the base language, so "pt" also places pt-BR and pt-PT
+			if r, ok := rank[strings.SplitN(tag, "-", 2)[0]]; ok {
+				return r
+			}
+			return len(order)
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			pi, pj := position(results[i].Tag), position(results[j].Tag)
+			if pi != pj {
+				return pi < pj
+			}
+			// Languages missing from the configured order go last, alphabetically
+			if pi == len(order) {
+				return strings.ToLower(results[i].Tag) < strings.ToLower(results[j].Tag)
+			}
+			return false
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// launcherItem is a translation or one of its alternatives listed by a launcher
+type launcherItem struct {
+	id       string
+	text     string
+	subtitle string
+	tag      string
+}
+
+// launcherItems lists the translations, each followed by its alternatives as items of
+// their own so any of them can be picked
+func launcherItems(out *TranslationOutput, showAlternatives bool) []launcherItem {
+	var items []launcherItem
+	for _, result := range out.Translations {
+		items = append(items, launcherItem{id: result.Tag, text: result.Text, subtitle: result.Tag, tag: result.Tag})
+		if !showAlternatives {
+			continue
+		}
+		for i, alt := range result.Alternatives {
+			items = append(items, launcherItem{
+				id:       fmt.Sprintf("%s-%d", result.Tag, i+1),
+				text:     alt,
+				subtitle: fmt.Sprintf("%s · alternative %d", result.Tag, i+1),
+				tag:      result.Tag,
+			})
+		}
+	}
+	return items
+}
+
+// alfredItem is an item of Alfred's script filter JSON
+type alfredItem struct {
+	UID      string            `json:"uid"`
+	Title    string            `json:"title"`
+	Subtitle string            `json:"subtitle"`
+	Arg      string            `json:"arg"`
+	Valid    bool              `json:"valid"`
+	Text     map[string]string `json:"text"`
+	Vars     map[string]string `json:"variables"`
+}
+
+// raycastAction is what an item of a Raycast list does when chosen
+type raycastAction struct {
+	Type    string `json:"type"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// raycastItem is an item of a Raycast list
+type raycastItem struct {
+	ID          string              `json:"id"`
+	Title       string              `json:"title"`
+	Subtitle    string              `json:"subtitle"`
+	Accessories []map[string]string `json:"accessories"`
+	Actions     []raycastAction     `json:"actions"`
+}
+
+// writeLauncher renders the translations for a launcher: Alfred's script filter JSON, or
+// a list whose items map onto Raycast's List.Item and its copy and paste actions
+func writeLauncher(w io.Writer, out *TranslationOutput, opts OutputOptions) error {
+	items := launcherItems(out, opts.ShowAlternatives)
+
+	var doc interface{}
+	switch opts.Format {
+	case OutputAlfred:
+		alfred := make([]alfredItem, len(items))
+		for i, item := range items {
+			alfred[i] = alfredItem{
+				UID:      item.id,
+				Title:    item.text,
+				Subtitle: item.subtitle + " · ↩ to copy",
+				Arg:      item.text,
+				Valid:    true,
+				Text:     map[string]string{"copy": item.text, "largetype": item.text},
+				Vars:     map[string]string{"target_lang": item.tag},
+			}
+		}
+		doc = map[string]interface{}{"items": alfred}
+	case OutputRaycast:
+		raycast := make([]raycastItem, len(items))
+		for i, item := range items {
+			raycast[i] = raycastItem{
+				ID:          item.id,
+				Title:       item.text,
+				Subtitle:    item.subtitle,
+				Accessories: []map[string]string{{"tag": item.tag}},
+				Actions: []raycastAction{
+					{Type: "copy", Title: "Copy Translation", Content: item.text},
+					{Type: "paste", Title: "Paste Translation", Content: item.text},
+				},
+			}
+		}
+		doc = map[string]interface{}{"schema": SchemaVersion, "items": raycast}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if opts.Terminal {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
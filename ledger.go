@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Date layouts of the ledger: entries are kept per day and summed per month
+const (
+	ledgerDay   = "2006-01-02"
+	ledgerMonth = "2006-01"
+)
+
+// ledgerSaveInterval is how often long-running commands write their counts to the ledger
+const ledgerSaveInterval = 30 * time.Second
+
+// Budget periods and what happens when a budget would be exceeded
+const (
+	BudgetDay   = "day"
+	BudgetMonth = "month"
+
+	BudgetWarn = "warn"
+	BudgetStop = "stop"
+)
+
+// usageCount is the characters translated on a server, as counted by the CLI
+type usageCount struct {
+	Characters int64 `json:"characters"`
+	Requests   int64 `json:"requests"`
+}
+
+// add returns the sum of two counts
+func (u usageCount) add(other usageCount) usageCount {
+	return usageCount{Characters: u.Characters + other.Characters, Requests: u.Requests + other.Requests}
+}
+
+// usageLedger holds the counts by day, provider and server
+type usageLedger map[string]map[string]map[string]usageCount
+
+// ledgerKey identifies the counts of a server of a provider
+type ledgerKey struct {
+	Provider string
+	Server   string
+}
+
+// pendingUsage counts what this process sent until it is written to the ledger
+var pendingUsage = struct {
+	sync.Mutex
+	counts map[ledgerKey]usageCount
+	saved  time.Time
+	// saves counts the times the counts were moved to the ledger
+	saves int
+}{counts: make(map[ledgerKey]usageCount), saved: time.Now()}
+
+// recordUsage counts the characters of a translation request sent to a server. Long-running
+// commands like serve and daemon write the counts to the ledger as they go.
+func recordUsage(provider, server string, characters int) {
+	pendingUsage.Lock()
+	key := ledgerKey{Provider: provider, Server: server}
+	pendingUsage.counts[key] = pendingUsage.counts[key].add(usageCount{Characters: int64(characters), Requests: 1})
+	due := time.Since(pendingUsage.saved) > ledgerSaveInterval
+	pendingUsage.Unlock()
+	if due {
+		saveLocalUsage()
+	}
+}
+
+// ledgerPath returns the path of the ledger file
+func ledgerPath() (string, error) {
+	dir, err := appDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "usage.json"), nil
+}
+
+// loadLedger reads the ledger
+func loadLedger() usageLedger {
+	ledger := make(usageLedger)
+	path, err := ledgerPath()
+	if err != nil {
+		return ledger
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ledger
+	}
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return make(usageLedger)
+	}
+	return ledger
+}
+
+// total sums the counts of the days starting with period (a day or a month), for one
+// provider and server or, where they are "", all of them
+func (l usageLedger) total(period, provider, server string) usageCount {
+	var total usageCount
+	for day, providers := range l {
+		if !strings.HasPrefix(day, period) {
+			continue
+		}
+		for name, servers := range providers {
+			if provider != "" && name != provider {
+				continue
+			}
+			for url, count := range servers {
+				if server == "" || url == server {
+					total = total.add(count)
+				}
+			}
+		}
+	}
+	return total
+}
+
+// saveLocalUsage adds what this process counted to today's entries of the ledger
+func saveLocalUsage() {
+	pendingUsage.Lock()
+	defer pendingUsage.Unlock()
+	pendingUsage.saved = time.Now()
+	if len(pendingUsage.counts) == 0 {
+		return
+	}
+	path, err := ledgerPath()
+	if err != nil {
+		return
+	}
+
+	ledger := loadLedger()
+	day := time.Now().Format(ledgerDay)
+	if ledger[day] == nil {
+		ledger[day] = make(map[string]map[string]usageCount)
+	}
+	for key, count := range pendingUsage.counts {
+		if ledger[day][key.Provider] == nil {
+			ledger[day][key.Provider] = make(map[string]usageCount)
+		}
+		ledger[day][key.Provider][key.Server] = ledger[day][key.Provider][key.Server].add(count)
+	}
+	pendingUsage.counts = make(map[ledgerKey]usageCount)
+	pendingUsage.saves++
+
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return
+	}
+	os.Rename(tmp, path)
+}
+
+// providerName returns the name the client's provider is registered under
+func (cl *Client) providerName() string {
+	p := cl.provider()
+	for name, registered := range providers {
+		if registered == p {
+			return name
+		}
+	}
+	return ""
+}
+
+// Budget limits the characters sent per day or month, over all providers and servers
+type Budget struct {
+	Limit  int64
+	Period string
+	// Stop fails requests that would exceed the budget instead of warning once
+	Stop bool
+
+	mu sync.Mutex
+	// used is what the ledger held for periodKey when it was last read, after saves
+	// writes of this process and with the file last changed at modified
+	used      int64
+	periodKey string
+	saves     int
+	modified  time.Time
+	warned    bool
+}
+
+// parseBudget reads a budget such as 50000, 50k/day or 2M/month; the period defaults to a day
+func parseBudget(budget string) (int64, string, error) {
+	amount, period, _ := strings.Cut(strings.ToLower(strings.TrimSpace(budget)), "/")
+	switch period {
+	case "", BudgetDay, "d", "daily":
+		period = BudgetDay
+	case BudgetMonth, "m", "monthly":
+		period = BudgetMonth
+	default:
+		return 0, "", fmt.Errorf("unknown budget period %q (use day or month)", period)
+	}
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(amount, "k"):
+		multiplier, amount = 1000, strings.TrimSuffix(amount, "k")
+	case strings.HasSuffix(amount, "m"):
+		multiplier, amount = 1000000, strings.TrimSuffix(amount, "m")
+	}
+	n, err := strconv.ParseFloat(amount, 64)
+	if err != nil || n <= 0 {
+		return 0, "", fmt.Errorf("invalid budget %q (e.g., 50000, 50k/day, 2M/month)", budget)
+	}
+	return int64(n * float64(multiplier)), period, nil
+}
+
+// checkBudgetAction validates a --budget-action value
+func checkBudgetAction(action string) error {
+	switch action {
+	case BudgetWarn, BudgetStop:
+		return nil
+	}
+	return fmt.Errorf("unknown budget action %q (use warn or stop)", action)
+}
+
+// budgetFromFlags returns the budget given on the command line or configured, or nil
+func budgetFromFlags(c *cli.Context) *Budget {
+	limit, period, err := parseBudget(c.String("budget"))
+	if c.String("budget") == "" || err != nil {
+		return nil
+	}
+	return &Budget{Limit: limit, Period: period, Stop: c.String("budget-action") == BudgetStop}
+}
+
+// budgetPeriodKey returns the ledger prefix of the period containing t
+func budgetPeriodKey(period string, t time.Time) string {
+	if period == BudgetMonth {
+		return t.Format(ledgerMonth)
+	}
+	return t.Format(ledgerDay)
+}
+
+// Used returns the characters sent in the current day or month of the budget, by any
+// process, including what this one hasn't written to the ledger yet
+func (b *Budget) Used() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.currentUse()
+}
+
+// currentUse is Used with b.mu held. The ledger is read again when a new period starts or
+// it was written since, by this process or another, so long-running commands such as
+// serve and daemon keep counting across their periodic saves.
+func (b *Budget) currentUse() int64 {
+	pendingUsage.Lock()
+	defer pendingUsage.Unlock()
+
+	key := budgetPeriodKey(b.Period, time.Now())
+	var modified time.Time
+	if path, err := ledgerPath(); err == nil {
+		if info, err := os.Stat(path); err == nil {
+			modified = info.ModTime()
+		}
+	}
+	if key != b.periodKey || pendingUsage.saves != b.saves || !modified.Equal(b.modified) {
+		b.used = loadLedger().total(key, "", "").Characters
+		b.periodKey, b.saves, b.modified = key, pendingUsage.saves, modified
+	}
+
+	used := b.used
+	for _, count := range pendingUsage.counts {
+		used += count.Characters
+	}
+	return used
+}
+
+// Allow checks that sending characters more stays within the budget. Over budget, it
+// warns once or, with Stop, returns an error so nothing is sent.
+func (b *Budget) Allow(characters int) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	used := b.currentUse()
+	if used+int64(characters) <= b.Limit {
+		return nil
+	}
+	message := fmt.Sprintf("the character budget of %d per %s would be exceeded (%d used, %d more to send)", b.Limit, b.Period, used, characters)
+	if b.Stop {
+		return &BudgetError{message + "; raise it with --budget or use --budget-action warn"}
+	}
+	if !b.warned {
+		warnf("%s", message)
+		b.warned = true
+	}
+	return nil
+}
+
+// statsUsageRow is the usage of one server of a provider in one period
+type statsUsageRow struct {
+	Period   string `json:"period"`
+	Provider string `json:"provider"`
+	Server   string `json:"server"`
+	usageCount
+}
+
+// statsUsageOutput is the JSON output of stats usage
+type statsUsageOutput struct {
+	Schema int             `json:"schema"`
+	Rows   []statsUsageRow `json:"rows"`
+	Total  usageCount      `json:"total"`
+}
+
+// runStatsUsage handles the stats usage command, listing the ledger by day or month
+func runStatsUsage(c *cli.Context) error {
+	saveLocalUsage()
+	by := c.String("by")
+	layout := ledgerDay
+	switch by {
+	case BudgetDay:
+	case BudgetMonth:
+		layout = ledgerMonth
+	default:
+		return cli.Exit(fmt.Sprintf("Stats error: unknown period %q (use day or month)", by), 1)
+	}
+	since := time.Now().AddDate(0, 0, -c.Int("days")+1).Format(ledgerDay)
+
+	counts := make(map[statsUsageRow]usageCount)
+	for day, providers := range loadLedger() {
+		if day < since {
+			continue
+		}
+		parsed, err := time.Parse(ledgerDay, day)
+		if err != nil {
+			continue
+		}
+		for provider, servers := range providers {
+			for server, count := range servers {
+				key := statsUsageRow{Period: parsed.Format(layout), Provider: provider, Server: server}
+				counts[key] = counts[key].add(count)
+			}
+		}
+	}
+
+	output := statsUsageOutput{Schema: SchemaVersion, Rows: []statsUsageRow{}}
+	for key, count := range counts {
+		key.usageCount = count
+		output.Rows = append(output.Rows, key)
+		output.Total = output.Total.add(count)
+	}
+	sort.Slice(output.Rows, func(i, j int) bool {
+		a, b := output.Rows[i], output.Rows[j]
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Server < b.Server
+	})
+
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(output)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(output.Rows) == 0 {
+		fmt.Printf("Nothing sent in the last %d days\n", c.Int("days"))
+	}
+	for _, row := range output.Rows {
+		fmt.Printf("%-10s  %-14s  %-36s  %10d characters  %6d requests\n", row.Period, row.Provider, redactSecrets(row.Server), row.Characters, row.Requests)
+	}
+	if len(output.Rows) > 1 {
+		fmt.Printf("%-10s  %-14s  %-36s  %10d characters  %6d requests\n", "Total", "", "", output.Total.Characters, output.Total.Requests)
+	}
+	if budget := budgetFromFlags(c); budget != nil {
+		when := "today"
+		if budget.Period == BudgetMonth {
+			when = "this month"
+		}
+		fmt.Printf("Budget: %d of %d characters used %s\n", budget.Used(), budget.Limit, when)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestBudgetUsedAcrossSaves(t *testing.T) {
+	old := portableDir
+	portableDir = t.TempDir()
+	t.Cleanup(func() { portableDir = old })
+	// Start from nothing sent, whatever other tests counted
+	pendingUsage.Lock()
+	pendingUsage.counts = make(map[ledgerKey]usageCount)
+	pendingUsage.Unlock()
+
+	budget := &Budget{Limit: 100, Period: BudgetDay}
+	steps := []struct {
+		characters int
+		save       bool
+		want       int64
+	}{
+		{10, false, 10},
+		{20, true, 30},
+		{5, false, 35},
+		{0, true, 35},
+		{40, true, 75},
+	}
+	for i, step := range steps {
+		if step.characters > 0 {
+			recordUsage(ProviderDeepLX, "http://server", step.characters)
+		}
+		if step.save {
+			saveLocalUsage()
+		}
+		if got := budget.Used(); got != step.want {
+			t.Errorf("step %d: Used = %d, want %d", i, got, step.want)
+		}
+	}
+	if err := (&Budget{Limit: 100, Period: BudgetDay, Stop: true}).Allow(30); err == nil {
+		t.Error("Allow let the budget be exceeded after the counts were saved")
+	}
+}
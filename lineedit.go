@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxHistory is the number of REPL lines kept in the history file
+const maxHistory = 1000
+
+// errInterrupted is returned by lineEditor.ReadLine when Ctrl-C is pressed
+var errInterrupted = errors.New("interrupted")
+
+// Keys other than plain runes, as returned by readKey
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyEscape
+	keyUnknown
+)
+
+// Control keys
+const (
+	ctrlA     = 0x01
+	ctrlB     = 0x02
+	ctrlC     = 0x03
+	ctrlD     = 0x04
+	ctrlE     = 0x05
+	ctrlF     = 0x06
+	ctrlG     = 0x07
+	ctrlH     = 0x08
+	keyTab    = 0x09
+	ctrlK     = 0x0b
+	ctrlL     = 0x0c
+	keyEnter  = 0x0d
+	ctrlN     = 0x0e
+	ctrlP     = 0x10
+	ctrlR     = 0x12
+	ctrlU     = 0x15
+	ctrlW     = 0x17
+	keyEsc    = 0x1b
+	backspace = 0x7f
+)
+
+// lineEditor reads lines from a terminal with history recall (up/down), reverse search
+// (Ctrl-R) and Tab completion
+type lineEditor struct {
+	in  *os.File
+	r   *bufio.Reader
+	out io.Writer
+
+	// history holds previous lines, oldest first
+	history []string
+	// historyPath is the file lines are appended to, or empty to keep history in memory
+	historyPath string
+	// complete returns the possible completions of line
+	complete func(line string) []string
+
+	// lastTab is set when the previous key was Tab, so a second Tab lists the candidates
+	lastTab bool
+}
+
+// newLineEditor returns an editor reading from the terminal in and loading its history
+// from historyPath, if set
+func newLineEditor(in *os.File, out io.Writer, historyPath string) *lineEditor {
+	return &lineEditor{
+		in:          in,
+		r:           bufio.NewReader(in),
+		out:         out,
+		history:     loadHistory(historyPath),
+		historyPath: historyPath,
+	}
+}
+
+// replHistoryPath returns the path of the REPL history file
+func replHistoryPath() (string, error) {
+	dir, err := appDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "repl_history"), nil
+}
+
+// loadHistory reads the history file, trimming it to the newest maxHistory lines
+func loadHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	history := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+		os.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0600)
+	}
+	return history
+}
+
+// AddHistory records line, skipping repeats of the previous line
+func (e *lineEditor) AddHistory(line string) {
+	if line == "" || strings.Contains(line, "\n") {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.historyPath == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.historyPath), 0755); err != nil {
+		return
+	}
+	// History contains translated text, so keep it private like shell history
+	f, err := os.OpenFile(e.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// ReadLine shows prompt and returns the line entered. It returns io.EOF on Ctrl-D at an
+// empty line and errInterrupted on Ctrl-C.
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var buf []rune
+	pos := 0
+	// historyIndex is len(history) while editing a new line
+	historyIndex := len(e.history)
+	var pending []rune
+
+	var searching bool
+	var query []rune
+	searchIndex := -1
+	var saved []rune
+
+	redraw := func() {
+		if searching {
+			match := ""
+			if searchIndex >= 0 {
+				match = e.history[searchIndex]
+			}
+			fmt.Fprintf(e.out, "\r\x1b[K(reverse-i-search)`%s': %s", string(query), match)
+			return
+		}
+		fmt.Fprintf(e.out, "\r\x1b[K%s%s", prompt, string(buf))
+		if back := displayWidth(string(buf[pos:])); back > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", back)
+		}
+	}
+	// search finds the newest history line at or before from that contains the query
+	search := func(from int) {
+		q := strings.ToLower(string(query))
+		for i := from; i >= 0; i-- {
+			if i < len(e.history) && strings.Contains(strings.ToLower(e.history[i]), q) {
+				searchIndex = i
+				return
+			}
+		}
+	}
+	// endSearch leaves search mode with the match, if any, in the buffer
+	endSearch := func() {
+		searching = false
+		if searchIndex >= 0 {
+			buf = []rune(e.history[searchIndex])
+			historyIndex = searchIndex
+		}
+		pos = len(buf)
+	}
+	setLine := func(line []rune) {
+		buf = append([]rune(nil), line...)
+		pos = len(buf)
+	}
+
+	redraw()
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			fmt.Fprint(e.out, "\r\n")
+			return "", err
+		}
+		repeatedTab := key == keyTab && e.lastTab
+		e.lastTab = key == keyTab
+
+		if searching {
+			switch key {
+			case ctrlR:
+				if searchIndex > 0 {
+					search(searchIndex - 1)
+				}
+			case backspace, ctrlH:
+				if len(query) > 0 {
+					query = query[:len(query)-1]
+					searchIndex = -1
+					search(len(e.history) - 1)
+				}
+			case ctrlG, keyEscape:
+				searching = false
+				setLine(saved)
+			case ctrlC:
+				fmt.Fprint(e.out, "\r\n")
+				return "", errInterrupted
+			default:
+				if key >= ' ' {
+					query = append(query, key)
+					from := searchIndex
+					if from < 0 {
+						from = len(e.history) - 1
+					}
+					search(from)
+					break
+				}
+				endSearch()
+				if key != keyEnter {
+					redraw()
+					continue
+				}
+				fmt.Fprintf(e.out, "\r\x1b[K%s%s\r\n", prompt, string(buf))
+				return string(buf), nil
+			}
+			redraw()
+			continue
+		}
+
+		switch key {
+		case keyEnter:
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case ctrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case ctrlD:
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case backspace, ctrlH:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case keyDelete:
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyLeft, ctrlB:
+			if pos > 0 {
+				pos--
+			}
+		case keyRight, ctrlF:
+			if pos < len(buf) {
+				pos++
+			}
+		case keyHome, ctrlA:
+			pos = 0
+		case keyEnd, ctrlE:
+			pos = len(buf)
+		case ctrlK:
+			buf = buf[:pos]
+		case ctrlU:
+			buf = buf[pos:]
+			pos = 0
+		case ctrlW:
+			start := pos
+			for start > 0 && unicode.IsSpace(buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(buf[start-1]) {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+		case ctrlL:
+			fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+		case keyUp, ctrlP:
+			if historyIndex > 0 {
+				if historyIndex == len(e.history) {
+					pending = append([]rune(nil), buf...)
+				}
+				historyIndex--
+				setLine([]rune(e.history[historyIndex]))
+			}
+		case keyDown, ctrlN:
+			if historyIndex < len(e.history) {
+				historyIndex++
+				if historyIndex == len(e.history) {
+					setLine(pending)
+				} else {
+					setLine([]rune(e.history[historyIndex]))
+				}
+			}
+		case ctrlR:
+			searching = true
+			saved = append([]rune(nil), buf...)
+			query = nil
+			searchIndex = -1
+		case keyTab:
+			e.completeLine(&buf, &pos, repeatedTab)
+		default:
+			if key >= ' ' {
+				buf = append(buf[:pos], append([]rune{key}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		redraw()
+	}
+}
+
+// completeLine completes the line at the end of buf: a single candidate replaces it, several
+// extend it to their common prefix, and a second Tab lists them
+func (e *lineEditor) completeLine(buf *[]rune, pos *int, list bool) {
+	if e.complete == nil || *pos != len(*buf) {
+		return
+	}
+	line := string(*buf)
+	candidates := e.complete(line)
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 || len(prefix) > len(line) {
+		*buf = []rune(prefix)
+		*pos = len(*buf)
+		return
+	}
+	if !list {
+		return
+	}
+
+	// List the candidates below the prompt, which redraw puts back afterwards
+	const maxListed = 20
+	fmt.Fprint(e.out, "\r\n")
+	for i, candidate := range candidates {
+		if i == maxListed {
+			fmt.Fprintf(e.out, "… %d more\r\n", len(candidates)-maxListed)
+			break
+		}
+		fmt.Fprintf(e.out, "%s\r\n", candidate)
+	}
+}
+
+// commonPrefix returns the longest prefix shared by all strings
+func commonPrefix(values []string) string {
+	prefix := []rune(values[0])
+	for _, value := range values[1:] {
+		runes := []rune(value)
+		n := 0
+		for n < len(prefix) && n < len(runes) && prefix[n] == runes[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	return string(prefix)
+}
+
+// readKey reads one key press, decoding the escape sequences of arrow and editing keys
+func (e *lineEditor) readKey() (rune, error) {
+	r, _, err := e.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != keyEsc {
+		return r, nil
+	}
+
+	// A lone Escape arrives by itself; sequences arrive in one read
+	if e.r.Buffered() == 0 {
+		return keyEscape, nil
+	}
+	next, _, err := e.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if next != '[' && next != 'O' {
+		return keyUnknown, nil
+	}
+
+	var params []rune
+	for {
+		c, _, err := e.r.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if c >= '0' && c <= '9' || c == ';' {
+			params = append(params, c)
+			continue
+		}
+		switch {
+		case c == 'A':
+			return keyUp, nil
+		case c == 'B':
+			return keyDown, nil
+		case c == 'C':
+			return keyRight, nil
+		case c == 'D':
+			return keyLeft, nil
+		case c == 'H':
+			return keyHome, nil
+		case c == 'F':
+			return keyEnd, nil
+		case c == '~' && (string(params) == "1" || string(params) == "7"):
+			return keyHome, nil
+		case c == '~' && (string(params) == "4" || string(params) == "8"):
+			return keyEnd, nil
+		case c == '~' && string(params) == "3":
+			return keyDelete, nil
+		}
+		return keyUnknown, nil
+	}
+}
+
+// replCompletions returns a completion function for the REPL: language codes after a
+// :to command, otherwise previously entered phrases, newest first
+func replCompletions(editor *lineEditor) func(line string) []string {
+	return func(line string) []string {
+		for _, command := range []string{":to ", ":set target ", ":set source "} {
+			rest, ok := strings.CutPrefix(line, command)
+			if !ok {
+				continue
+			}
+			done := ""
+			if i := strings.LastIndex(rest, ","); i >= 0 {
+				done, rest = rest[:i+1], rest[i+1:]
+			}
+			var candidates []string
+			for _, code := range languageCodes(editor.history) {
+				if strings.HasPrefix(code, strings.ToLower(rest)) {
+					candidates = append(candidates, command+done+code)
+				}
+			}
+			return candidates
+		}
+		if strings.HasPrefix(line, ":") {
+			// Complete the command a word at a time, as :set and then :set target
+			words := len(strings.Fields(line))
+			if strings.HasSuffix(line, " ") {
+				words++
+			}
+			seen := make(map[string]bool)
+			var candidates []string
+			for _, command := range replCommands {
+				// The words in capitals, brackets or with | are arguments
+				var fields []string
+				for _, field := range strings.Fields(command) {
+					if field != strings.ToLower(field) || strings.ContainsAny(field, "[|") {
+						break
+					}
+					fields = append(fields, field)
+				}
+				name := strings.Join(fields[:min(words, len(fields))], " ")
+				if strings.HasPrefix(name, line) && name != line && !seen[name] {
+					seen[name] = true
+					candidates = append(candidates, name)
+				}
+			}
+			return candidates
+		}
+		if strings.TrimSpace(line) == "" {
+			return nil
+		}
+
+		seen := make(map[string]bool)
+		var candidates []string
+		lower := strings.ToLower(line)
+		for i := len(editor.history) - 1; i >= 0; i-- {
+			phrase := editor.history[i]
+			if seen[phrase] || strings.HasPrefix(phrase, ":") || !strings.HasPrefix(strings.ToLower(phrase), lower) {
+				continue
+			}
+			seen[phrase] = true
+			// Keep what was typed so completion doesn't change its case
+			candidates = append(candidates, line+string([]rune(phrase)[len([]rune(line)):]))
+		}
+		return candidates
+	}
+}
+
+// languageCodes returns the DeepL languages and variants plus any other codes used with
+// :to or :set target in the history, in lower case
+func languageCodes(history []string) []string {
+	seen := make(map[string]bool)
+	var codes []string
+	add := func(code string) {
+		code = strings.ToLower(code)
+		if code != "" && !seen[code] {
+			seen[code] = true
+			codes = append(codes, code)
+		}
+	}
+	for _, code := range deepLLanguages {
+		add(code)
+	}
+	for _, variants := range deepLVariants {
+		for _, code := range variants {
+			add(code)
+		}
+	}
+	for _, line := range history {
+		langs, ok := strings.CutPrefix(line, ":to ")
+		if !ok {
+			langs, ok = strings.CutPrefix(line, ":set target ")
+		}
+		if ok {
+			for _, code := range splitLangList(langs) {
+				add(code)
+			}
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -0,0 +1,739 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+// localeEntry is a message of a locale file to translate
+type localeEntry struct {
+	// Texts are the strings to translate, e.g. the singular and plural of a PO message
+	Texts []string
+	// Note is the translator note describing where the message is used, if any
+	Note string
+	// Key identifies the message in the file and its translations, if the format allows
+	Key string
+	// Annotation is written as a comment before the entry, where the format has comments
+	Annotation string
+	// comment returns text as a comment of the format, nil if it has none
+	comment func(text string) string
+	// render returns the text replacing the entry in the file, given its translations
+	render func(translations []string) string
+}
+
+// localeSegment is a piece of a locale file: either text kept as it is or an entry
+type localeSegment struct {
+	text  string
+	entry *localeEntry
+}
+
+// localeFile is a locale file split into the parts kept as they are, comments included,
+// and the entries to translate
+type localeFile struct {
+	segments []localeSegment
+	entries  []*localeEntry
+}
+
+// keep appends text kept as it is
+func (f *localeFile) keep(text string) {
+	f.segments = append(f.segments, localeSegment{text: text})
+}
+
+// add appends an entry to translate
+func (f *localeFile) add(entry *localeEntry) {
+	f.segments = append(f.segments, localeSegment{entry: entry})
+	f.entries = append(f.entries, entry)
+}
+
+// render returns the file with each entry replaced by its translations
+func (f *localeFile) render(translations map[*localeEntry][]string) string {
+	var b strings.Builder
+	for _, segment := range f.segments {
+		if segment.entry == nil {
+			b.WriteString(segment.text)
+		} else {
+			if segment.entry.Annotation != "" && segment.entry.comment != nil {
+				b.WriteString(segment.entry.comment(segment.entry.Annotation))
+			}
+			b.WriteString(segment.entry.render(translations[segment.entry]))
+		}
+	}
+	return b.String()
+}
+
+// parseLocaleFile splits a locale file into its entries, by the format its extension names
+func parseLocaleFile(path, data string) (*localeFile, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".po", ".pot":
+		return parsePO(data), nil
+	case ".yml", ".yaml":
+		return parseYAMLLocale(data), nil
+	case ".json", ".arb":
+		return parseJSONLocale(data)
+	}
+	return nil, fmt.Errorf("unsupported locale file %s (use .po, .yaml or .json)", filepath.Base(path))
+}
+
+// localeOutputPath returns where the translation of a locale file goes: next to it, named
+// after the target language if the file is named after a language (en.yml → de.yml),
+// otherwise with the language before the extension (messages.po → messages.de.po)
+func localeOutputPath(path, targetLang string) string {
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(filepath.Base(path), ext)
+	if isLanguageName(name) {
+		return filepath.Join(filepath.Dir(path), toBCP47(targetLang)+ext)
+	}
+	return docOutputPath(path, targetLang)
+}
+
+// isLanguageName reports whether a file name or key is a language code, e.g. en or pt_BR
+func isLanguageName(name string) bool {
+	if len(name) > 7 {
+		return false
+	}
+	base := baseLanguage(strings.ReplaceAll(name, "_", "-"))
+	for _, lang := range deepLLanguages {
+		if base == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// renameYAMLRoot renames the top-level language key of a Rails-style locale file
+// ("en:" → "de:") when it is the file's only top-level key
+func renameYAMLRoot(output, targetLang string) string {
+	lines := strings.SplitAfter(output, "\n")
+	root := -1
+	for i, line := range lines {
+		if line == "" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" || strings.TrimSpace(line) == "---" {
+			continue
+		}
+		if root >= 0 {
+			return output
+		}
+		root = i
+	}
+	if root < 0 {
+		return output
+	}
+	key, rest, ok := strings.Cut(lines[root], ":")
+	if !ok || strings.TrimSpace(rest) != "" || !isLanguageName(key) {
+		return output
+	}
+	lines[root] = toBCP47(targetLang) + ":" + rest
+	return strings.Join(lines, "")
+}
+
+// isTranslatorNote reports whether a comment is a note for translators, returning its text:
+// "#. note" as gettext extracts them, or "# translators: note"
+func isTranslatorNote(comment string) (string, bool) {
+	if rest, ok := strings.CutPrefix(comment, "."); ok {
+		return strings.TrimSpace(rest), true
+	}
+	comment = strings.TrimSpace(comment)
+	lower := strings.ToLower(comment)
+	for _, prefix := range []string{"translators:", "translator:", "note:"} {
+		if strings.HasPrefix(lower, prefix) {
+			return strings.TrimSpace(comment[len(prefix):]), true
+		}
+	}
+	return "", false
+}
+
+// poUnquote decodes a PO string literal
+func poUnquote(literal string) string {
+	literal = strings.TrimSpace(literal)
+	literal = strings.TrimSuffix(strings.TrimPrefix(literal, `"`), `"`)
+	var b strings.Builder
+	for i := 0; i < len(literal); i++ {
+		if literal[i] != '\\' || i+1 == len(literal) {
+			b.WriteByte(literal[i])
+			continue
+		}
+		i++
+		switch literal[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(literal[i])
+		}
+	}
+	return b.String()
+}
+
+// poQuote encodes a PO string literal
+func poQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`).Replace(s) + `"`
+}
+
+// parsePO splits a gettext catalog into its messages. Messages already translated, the
+// header and obsolete messages are kept; msgctxt and "#." comments become the note.
+func parsePO(data string) *localeFile {
+	file := &localeFile{}
+	for _, message := range splitPOMessages(data) {
+		parsePOMessage(file, message)
+	}
+	return file
+}
+
+// splitPOMessages splits a catalog into the lines of each message, blank lines included
+func splitPOMessages(data string) [][]string {
+	var messages [][]string
+	lines := strings.SplitAfter(data, "\n")
+	for start := 0; start < len(lines); {
+		// Messages are separated by blank lines
+		end := start
+		for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+			end++
+		}
+		for end < len(lines) && strings.TrimSpace(lines[end]) == "" {
+			end++
+		}
+		messages = append(messages, lines[start:end])
+		start = end
+	}
+	return messages
+}
+
+// poKey identifies a message of a catalog by its context and msgid, as gettext does
+func poKey(ctxt, id string) string {
+	if ctxt == "" {
+		return id
+	}
+	return ctxt + "\x04" + id
+}
+
+// parsePOMessage adds a message of a catalog to file
+func parsePOMessage(file *localeFile, lines []string) {
+	var notes []string
+	fields := make(map[string]string)
+	var field string
+	strStart, strEnd := -1, -1
+	msgStart := -1
+	plurals := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if msgStart < 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			msgStart = i
+		}
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			if strings.HasPrefix(trimmed, "#.") {
+				notes = append(notes, strings.TrimSpace(trimmed[2:]))
+			}
+			continue
+		case strings.HasPrefix(trimmed, `"`):
+			fields[field] += poUnquote(trimmed)
+		case trimmed != "":
+			keyword, value, _ := strings.Cut(trimmed, " ")
+			field = keyword
+			fields[field] = poUnquote(value)
+			if strings.HasPrefix(keyword, "msgstr") {
+				if strStart < 0 {
+					strStart = i
+				}
+				if strings.HasPrefix(keyword, "msgstr[") {
+					plurals++
+				}
+			}
+		}
+		if strings.HasPrefix(field, "msgstr") && trimmed != "" {
+			strEnd = i + 1
+		}
+	}
+
+	id, hasID := fields["msgid"]
+	translated := false
+	for name, value := range fields {
+		if strings.HasPrefix(name, "msgstr") && value != "" {
+			translated = true
+		}
+	}
+	if !hasID || id == "" || strStart < 0 || translated {
+		file.keep(strings.Join(lines, ""))
+		return
+	}
+
+	ctxt := fields["msgctxt"]
+	if ctxt != "" {
+		notes = append(notes, ctxt)
+	}
+	entry := &localeEntry{Texts: []string{id}, Note: strings.Join(notes, " "), Key: poKey(ctxt, id)}
+	if plural, ok := fields["msgid_plural"]; ok {
+		entry.Texts = append(entry.Texts, plural)
+		if plurals < 2 {
+			plurals = 2
+		}
+	}
+	// The entry runs from the msgctxt or msgid, so that annotations go after the comments,
+	// and the msgstr lines are replaced, keeping their indentation
+	indent := lines[strStart][:len(lines[strStart])-len(strings.TrimLeft(lines[strStart], " \t"))]
+	message := strings.Join(lines[msgStart:strStart], "")
+	entry.comment = func(text string) string {
+		return indent + "# " + text + "\n"
+	}
+	entry.render = func(translations []string) string {
+		if len(translations) == 0 {
+			return message + strings.Join(lines[strStart:strEnd], "")
+		}
+		if len(translations) == 1 {
+			return message + indent + "msgstr " + poQuote(translations[0]) + "\n"
+		}
+		var b strings.Builder
+		b.WriteString(message)
+		for n := 0; n < plurals; n++ {
+			text := translations[1]
+			if n == 0 {
+				text = translations[0]
+			}
+			fmt.Fprintf(&b, "%smsgstr[%d] %s\n", indent, n, poQuote(text))
+		}
+		return b.String()
+	}
+	file.keep(strings.Join(lines[:msgStart], ""))
+	file.add(entry)
+	file.keep(strings.Join(lines[strEnd:], ""))
+}
+
+// parseYAMLLocale finds the string values of a YAML locale file, keeping the rest of each
+// line, comments included, as it is. Translator notes are the "#." or "# translators:"
+// comments right above a key. Block scalars (| and >) are left untranslated.
+func parseYAMLLocale(data string) *localeFile {
+	file := &localeFile{}
+	var notes []string
+	blockIndent := -1
+	for _, line := range strings.SplitAfter(data, "\n") {
+		body := strings.TrimRight(line, "\r\n")
+		trimmed := strings.TrimLeft(body, " ")
+		indent := len(body) - len(trimmed)
+		if blockIndent >= 0 && (trimmed == "" || indent > blockIndent) {
+			file.keep(line)
+			continue
+		}
+		blockIndent = -1
+
+		if strings.HasPrefix(trimmed, "#") {
+			if note, ok := isTranslatorNote(strings.TrimPrefix(trimmed, "#")); ok {
+				notes = append(notes, note)
+			}
+			file.keep(line)
+			continue
+		}
+		note := strings.Join(notes, " ")
+		notes = nil
+
+		// The value starts after "key: " or "- "
+		content := strings.TrimRight(stripYAMLComment(body), " ")
+		start := -1
+		if end := yamlKeyEnd(trimmed); end >= 0 {
+			start = indent + end + 1
+		} else if isYAMLSequenceItem(trimmed) {
+			start = indent + 1
+		}
+		if start < 0 || start >= len(content) {
+			file.keep(line)
+			continue
+		}
+		start += len(content[start:]) - len(strings.TrimLeft(content[start:], " "))
+		raw := content[start:]
+		if strings.HasPrefix(raw, "|") || strings.HasPrefix(raw, ">") {
+			blockIndent = indent
+			file.keep(line)
+			continue
+		}
+		if strings.ContainsAny(raw[:1], "[{&*!") {
+			file.keep(line)
+			continue
+		}
+		value, err := parseYAMLScalar(raw)
+		text, ok := value.(string)
+		if err != nil || !ok || text == "" {
+			file.keep(line)
+			continue
+		}
+
+		prefix, suffix := line[:start], line[len(content):]
+		quote := raw[0]
+		file.add(&localeEntry{
+			Texts: []string{text},
+			Note:  note,
+			render: func(translations []string) string {
+				if len(translations) == 0 {
+					return prefix + raw + suffix
+				}
+				return prefix + yamlQuote(translations[0], quote) + suffix
+			},
+		})
+	}
+	return file
+}
+
+// yamlQuote writes s as a YAML scalar, in the quotes the original used, or plain if it
+// was plain and stays a string that way
+func yamlQuote(s string, quote byte) string {
+	if s == "" {
+		return `""`
+	}
+	switch quote {
+	case '\'':
+		if !strings.ContainsAny(s, "\n\r\t") {
+			return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		}
+	case '"':
+	default:
+		value, err := parseYAMLScalar(s)
+		plain := err == nil && value == s && s == strings.TrimSpace(s) &&
+			!strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") &&
+			!strings.Contains(s, ": ") && !strings.Contains(s, " #") && !strings.ContainsAny(s, "\n\r\t")
+		if plain {
+			return s
+		}
+	}
+	return strconv.Quote(s)
+}
+
+// jsonString is a string value of a JSON document and where it is
+type jsonString struct {
+	path       []string
+	start, end int
+	value      string
+}
+
+// jsonLocaleScanner finds the string values of a JSON document, allowing the // and /* */
+// comments and trailing commas of JSONC
+type jsonLocaleScanner struct {
+	data    string
+	pos     int
+	strings []jsonString
+}
+
+// skip moves past whitespace and comments
+func (s *jsonLocaleScanner) skip() {
+	for s.pos < len(s.data) {
+		switch {
+		case strings.ContainsRune(" \t\r\n", rune(s.data[s.pos])):
+			s.pos++
+		case strings.HasPrefix(s.data[s.pos:], "//"):
+			if end := strings.IndexByte(s.data[s.pos:], '\n'); end >= 0 {
+				s.pos += end
+			} else {
+				s.pos = len(s.data)
+			}
+		case strings.HasPrefix(s.data[s.pos:], "/*"):
+			if end := strings.Index(s.data[s.pos+2:], "*/"); end >= 0 {
+				s.pos += end + 4
+			} else {
+				s.pos = len(s.data)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// str reads a string literal
+func (s *jsonLocaleScanner) str() (string, int, error) {
+	start := s.pos
+	for i := s.pos + 1; i < len(s.data); i++ {
+		switch s.data[i] {
+		case '\\':
+			i++
+		case '"':
+			s.pos = i + 1
+			var value string
+			if err := json.Unmarshal([]byte(s.data[start:s.pos]), &value); err != nil {
+				return "", 0, fmt.Errorf("invalid string at offset %d", start)
+			}
+			return value, start, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// value reads the value at path
+func (s *jsonLocaleScanner) value(path []string) error {
+	s.skip()
+	if s.pos >= len(s.data) {
+		return fmt.Errorf("unexpected end of document")
+	}
+	switch s.data[s.pos] {
+	case '{', '[':
+		object := s.data[s.pos] == '{'
+		closer := byte(']')
+		if object {
+			closer = '}'
+		}
+		s.pos++
+		for n := 0; ; n++ {
+			s.skip()
+			if s.pos < len(s.data) && s.data[s.pos] == closer {
+				s.pos++
+				return nil
+			}
+			key := strconv.Itoa(n)
+			if object {
+				if s.pos >= len(s.data) || s.data[s.pos] != '"' {
+					return fmt.Errorf("expected a key at offset %d", s.pos)
+				}
+				var err error
+				if key, _, err = s.str(); err != nil {
+					return err
+				}
+				s.skip()
+				if s.pos >= len(s.data) || s.data[s.pos] != ':' {
+					return fmt.Errorf("expected ':' at offset %d", s.pos)
+				}
+				s.pos++
+			}
+			if err := s.value(append(path[:len(path):len(path)], key)); err != nil {
+				return err
+			}
+			s.skip()
+			if s.pos < len(s.data) && s.data[s.pos] == ',' {
+				s.pos++
+			} else if s.pos >= len(s.data) || s.data[s.pos] != closer {
+				return fmt.Errorf("expected ',' or '%c' at offset %d", closer, s.pos)
+			}
+		}
+	case '"':
+		value, start, err := s.str()
+		if err != nil {
+			return err
+		}
+		s.strings = append(s.strings, jsonString{path: path, start: start, end: s.pos, value: value})
+	default:
+		for s.pos < len(s.data) && !strings.ContainsRune(",]} \t\r\n/", rune(s.data[s.pos])) {
+			s.pos++
+		}
+	}
+	return nil
+}
+
+// parseJSONLocale finds the messages of a JSON locale file, keeping everything else as it
+// is. Messages described ARB-style ("@key": {"description": ...}) or in the Chrome
+// extension format ({"message": ..., "description": ...}) get the description as note.
+func parseJSONLocale(data string) (*localeFile, error) {
+	scanner := &jsonLocaleScanner{data: data}
+	if err := scanner.value(nil); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, str := range scanner.strings {
+		values[strings.Join(str.path, "\x00")] = str.value
+	}
+	lookup := func(path ...string) (string, bool) {
+		value, ok := values[strings.Join(path, "\x00")]
+		return value, ok
+	}
+
+	file := &localeFile{}
+	pos := 0
+	for _, str := range scanner.strings {
+		metadata := false
+		for _, key := range str.path {
+			if strings.HasPrefix(key, "@") {
+				metadata = true
+			}
+		}
+		if metadata || str.value == "" || len(str.path) == 0 {
+			continue
+		}
+		parent, key := str.path[:len(str.path)-1], str.path[len(str.path)-1]
+		var note string
+		if _, chrome := lookup(append(parent[:len(parent):len(parent)], "message")...); chrome {
+			if key != "message" {
+				continue
+			}
+			note, _ = lookup(append(parent[:len(parent):len(parent)], "description")...)
+		} else {
+			note, _ = lookup(append(parent[:len(parent):len(parent)], "@"+key, "description")...)
+		}
+
+		raw := data[str.start:str.end]
+		file.keep(data[pos:str.start])
+		file.add(&localeEntry{
+			Texts: []string{str.value},
+			Note:  note,
+			Key:   strings.Join(str.path, "\x00"),
+			render: func(translations []string) string {
+				if len(translations) == 0 {
+					return raw
+				}
+				return jsonQuote(translations[0])
+			},
+		})
+		pos = str.end
+	}
+	file.keep(data[pos:])
+	return file, nil
+}
+
+// jsonQuote encodes a JSON string without escaping HTML characters
+func jsonQuote(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// localeJob is the translation of a locale file into one language
+type localeJob struct {
+	path       string
+	targetLang string
+	out        string
+	merge      mergeMode
+}
+
+// translateLocaleFile translates a locale file into one language and writes the result,
+// showing its progress as a task of the dashboard
+func translateLocaleFile(ctx context.Context, client *Client, job localeJob, sourceLang string, dashboard *Dashboard) {
+	name := fmt.Sprintf("%s → %s", job.path, toBCP47(job.targetLang))
+	data, err := os.ReadFile(job.path)
+	if err != nil {
+		dashboard.Finish(dashboard.Add(name, 0), err, "")
+		return
+	}
+	text, layout := splitLayout(data)
+	file, err := parseLocaleFile(job.path, text)
+	if err != nil {
+		dashboard.Finish(dashboard.Add(name, 0), err, "")
+		return
+	}
+	translations, todo := make(map[*localeEntry][]string), file.entries
+	if job.merge.enabled {
+		if translations, todo, err = mergeLocale(file, job.path, job.out, job.merge); err != nil {
+			dashboard.Finish(dashboard.Add(name, 0), err, "")
+			return
+		}
+	}
+	total := 0
+	for _, entry := range todo {
+		total += len(entry.Texts)
+	}
+	task := dashboard.Add(name, total)
+
+	opts := translateOptions(ctx)
+	for _, entry := range todo {
+		entryOpts := opts
+		if entry.Note != "" {
+			// The note adds to the context given on the command line
+			entryOpts.Context = strings.TrimSpace(opts.Context + "\n" + entry.Note)
+		}
+		entryCtx := withTranslateOptions(ctx, entryOpts)
+		for _, text := range entry.Texts {
+			resp, _, err := client.Translate(entryCtx, text, sourceLang, job.targetLang)
+			if err != nil {
+				dashboard.Finish(task, fmt.Errorf("%q: %v", text, err), "")
+				return
+			}
+			translations[entry] = append(translations[entry], resp.Data)
+			dashboard.Step(task)
+		}
+	}
+
+	output := file.render(translations)
+	if ext := strings.ToLower(filepath.Ext(job.path)); ext == ".yml" || ext == ".yaml" {
+		output = renameYAMLRoot(output, job.targetLang)
+	}
+	output = layout.restore(output)
+	if job.out == "-" {
+		fmt.Print(output)
+		dashboard.Finish(task, nil, "")
+		return
+	}
+	if err := os.WriteFile(job.out, []byte(output), 0644); err != nil {
+		dashboard.Finish(task, err, "")
+		return
+	}
+	if job.merge.enabled {
+		dashboard.Finish(task, nil, fmt.Sprintf("Translated %d of %d messages into %s, kept the others", len(todo), len(file.entries), job.out))
+		return
+	}
+	dashboard.Finish(task, nil, fmt.Sprintf("Translated %d messages into %s", len(file.entries), job.out))
+}
+
+// runLocale handles the locale command, translating PO, YAML or JSON locale files into a
+// file per target language, several at a time
+func runLocale(c *cli.Context) error {
+	paths := c.Args().Slice()
+	if len(paths) == 0 {
+		return cli.Exit("Locale error: no locale file given", 1)
+	}
+	targets := splitLangList(c.String("target"))
+	if c.String("out") != "" && (len(targets) != 1 || len(paths) != 1) {
+		return cli.Exit("Locale error: --out needs exactly one file and one target language", 1)
+	}
+	merge := mergeModeFor(c)
+	if merge.enabled && c.String("out") == "-" {
+		return cli.Exit("Locale error: --merge needs a target file to merge into, not stdout", ExitUsage)
+	}
+
+	config := configFor(c.Context)
+	var jobs []localeJob
+	for _, path := range paths {
+		for _, target := range targets {
+			targetLang := resolveTargetVariant(toDeepLCode(target, false), config.VariantPreferences, false)
+			out := c.String("out")
+			if out == "" {
+				out = localeOutputPath(path, targetLang)
+			}
+			jobs = append(jobs, localeJob{path: path, targetLang: targetLang, out: out, merge: merge})
+		}
+	}
+
+	client := sharedClient(c)
+	sourceLang := toDeepLCode(c.String("source"), true)
+	workers := c.Int("jobs")
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	dashboard := startDashboard(c.Bool("debug"))
+	queue := make(chan localeJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				translateLocaleFile(c.Context, client, job, sourceLang, dashboard)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+	dashboard.Stop()
+
+	if failed := dashboard.Failed(); failed > 0 {
+		code := ExitPartial
+		if failed == len(jobs) {
+			code = exitCodeFor(dashboard.Err())
+		}
+		if len(jobs) == 1 {
+			return cli.Exit("", code)
+		}
+		return cli.Exit(fmt.Sprintf("Locale error: %d of %d files failed", failed, len(jobs)), code)
+	}
+	return nil
+}
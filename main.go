@@ -2,28 +2,85 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/urfave/cli/v2"
 )
 
-// Version information
-const (
-	AppName    = "translate"
-	AppVersion = "0.1.0"
-)
+// Version information; release builds set AppVersion with -ldflags "-X main.AppVersion=v1.2.3"
+const AppName = "translate"
+
+var AppVersion = "0.1.0"
 
 // Config represents the configuration file structure
 type Config struct {
 	DefaultURL   string `json:"default_url,omitempty"`
 	DefaultToken string `json:"default_token,omitempty"`
+
+	// LanguageOrder is the preferred order of languages in multi-target output
+	LanguageOrder []string `json:"language_order,omitempty"`
+	// LanguageSort is the default ordering mode for multi-target output (input, alpha, config)
+	LanguageSort string `json:"language_sort,omitempty"`
+	// AlternativesEndpoints are tried in order when --alternatives gets none from /translate
+	AlternativesEndpoints []string `json:"alternatives_endpoints,omitempty"`
+	// VariantPreferences maps an ambiguous base language (EN, PT) to the regional variant to use
+	VariantPreferences map[string]string `json:"variant_preferences,omitempty"`
+	// Headers are sent with every request, e.g. for gateways that require API keys or tenant IDs
+	Headers map[string]string `json:"headers,omitempty"`
+	// AuthStyle is how the token is sent (bearer, query, dl-header)
+	AuthStyle string `json:"auth_style,omitempty"`
+	// Provider is the default translation engine (deeplx, deepl, libretranslate)
+	Provider string `json:"provider,omitempty"`
+	// Providers holds the server and credentials of each provider other than the default DeepLX server
+	Providers map[string]ProviderSettings `json:"providers,omitempty"`
+	// DLSession is the DeepL Pro session for DeepLX's pro endpoint (/v1/translate)
+	DLSession string `json:"dl_session,omitempty"`
+	// SessionRefreshCommand prints a new DLSession when the server reports it expired
+	SessionRefreshCommand string `json:"session_refresh_command,omitempty"`
+	// Tokens are rotated over for the default server instead of DefaultToken
+	Tokens []string `json:"tokens,omitempty"`
+	// TokenRotation is how Tokens are rotated (on-error, round-robin)
+	TokenRotation string `json:"token_rotation,omitempty"`
+	// Budget is the character budget per day or month (e.g., 50k/day, 2M/month)
+	Budget string `json:"budget,omitempty"`
+	// BudgetAction is what happens when the budget would be exceeded (warn, stop)
+	BudgetAction string `json:"budget_action,omitempty"`
+	// Pairs holds defaults for language pairs, e.g. "ja>en" or "*>de"
+	Pairs map[string]PairSettings `json:"pairs,omitempty"`
+	// Aliases maps shortcut names to the arguments they stand for, e.g. ja2en: [-s ja -t en]
+	Aliases map[string][]string `json:"aliases,omitempty"`
+	// Presets maps names used as @NAME to the arguments they stand for, e.g. docs-de: [-t de --glossary docs]
+	Presets map[string][]string `json:"presets,omitempty"`
+	// UpdateCheck turns the daily check for a newer release on (default) or off
+	UpdateCheck string `json:"update_check,omitempty"`
+	// Glossaries are named sets of terms and their translations, selected with --glossary
+	Glossaries map[string]Glossary `json:"glossaries,omitempty"`
+	// SpeakCommand reads the text on stdin aloud for --speak instead of say or espeak-ng
+	SpeakCommand string `json:"speak_command,omitempty"`
+	// Voices maps a target language to the voice --speak reads it with
+	Voices map[string]string `json:"voices,omitempty"`
+	// History turns keeping the translations made in history.jsonl on (default) or off
+	History string `json:"history,omitempty"`
+	// Encryption is how the tokens and session are encrypted at rest (passphrase, machine),
+	// or empty when they are stored in plaintext
+	Encryption string `json:"encryption,omitempty"`
+	// MergeAnnotation is the comment marking the segments --merge translated, none for no comment
+	MergeAnnotation string `json:"merge_annotation,omitempty"`
+	// PreTranslate is a shell command each text is passed through, on stdin, before it is sent
+	PreTranslate string `json:"pre_translate,omitempty"`
+	// PostTranslate is a shell command each translation is passed through, on stdin
+	PostTranslate string `json:"post_translate,omitempty"`
+	// TrustedServers are the servers of project files the user allowed their token to go to
+	TrustedServers []string `json:"trusted_servers,omitempty"`
 }
 
 // Response from DeepLX API
@@ -37,16 +94,56 @@ type TranslationResponse struct {
 	Method       string   `json:"method"`
 }
 
+// StatusError is returned when the DeepLX server answers with a non-200 HTTP status
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
 // Request to DeepLX API
 type TranslationRequest struct {
-	Text       string `json:"text"`
-	SourceLang string `json:"source_lang"`
-	TargetLang string `json:"target_lang"`
+	Text               string `json:"text"`
+	SourceLang         string `json:"source_lang"`
+	TargetLang         string `json:"target_lang"`
+	Formality          string `json:"formality,omitempty"`
+	TagHandling        string `json:"tag_handling,omitempty"`
+	SplitSentences     string `json:"split_sentences,omitempty"`
+	PreserveFormatting bool   `json:"preserve_formatting,omitempty"`
+	Context            string `json:"context,omitempty"`
+	GlossaryID         string `json:"glossary_id,omitempty"`
 }
 
 func main() {
-	// Load configuration
+	// Load configuration, with the settings of the project worked in merged over it
+	portableDir = portableDirFromArgs(os.Args[1:])
+	configPathOverride = configFlagFromArgs(os.Args[1:])
+	// Decrypting the configuration may ask for its passphrase
+	nonInteractive = nonInteractiveFromArgs(os.Args[1:])
 	config := loadConfig()
+	var projectErr error
+	if wd, err := os.Getwd(); err == nil {
+		project, projectErr = findProjectConfig(wd)
+	}
+	if merged, err := project.apply(config); err != nil {
+		projectErr = err
+	} else {
+		config = merged
+	}
+
+	defaultSource, defaultTarget, defaultGlossary := "auto", "en", ""
+	if project != nil {
+		if project.Source != "" {
+			defaultSource = project.Source
+		}
+		if project.Target != "" {
+			defaultTarget = project.Target
+		}
+		defaultGlossary = project.Glossary
+	}
 
 	// Set defaults from config
 	defaultURL := "http://localhost:1188"
@@ -59,6 +156,31 @@ func main() {
 		defaultToken = config.DefaultToken
 	}
 
+	defaultAuthStyle := AuthBearer
+	if config.AuthStyle != "" {
+		defaultAuthStyle = config.AuthStyle
+	}
+
+	defaultProvider := ProviderDeepLX
+	if config.Provider != "" {
+		defaultProvider = config.Provider
+	}
+
+	defaultTokenRotation := RotateOnError
+	if config.TokenRotation != "" {
+		defaultTokenRotation = config.TokenRotation
+	}
+
+	defaultBudgetAction := BudgetStop
+	if config.BudgetAction != "" {
+		defaultBudgetAction = config.BudgetAction
+	}
+
+	defaultLangSort := LangSortInput
+	if config.LanguageSort != "" {
+		defaultLangSort = config.LanguageSort
+	}
+
 	app := &cli.App{
 		Name:    AppName,
 		Version: AppVersion,
@@ -67,14 +189,14 @@ func main() {
 			&cli.StringFlag{
 				Name:    "source",
 				Aliases: []string{"s"},
-				Value:   "auto",
-				Usage:   "Source language code (e.g., en, fr, es, auto for automatic detection)",
+				Value:   defaultSource,
+				Usage:   "Source language as DeepL code or BCP-47 tag (e.g., en, fr, es, auto for automatic detection)",
 			},
 			&cli.StringFlag{
 				Name:    "target",
 				Aliases: []string{"t"},
-				Value:   "en",
-				Usage:   "Target language code (e.g., en, fr, es)",
+				Value:   defaultTarget,
+				Usage:   "Target language as DeepL code or BCP-47 tag (e.g., en-US, pt-BR, zh-Hans); separate several with commas (e.g., de,fr,ja)",
 			},
 			&cli.StringFlag{
 				Name:    "url",
@@ -90,12 +212,171 @@ func main() {
 				Usage:   "Authentication token for DeepLX server",
 				EnvVars: []string{"TOKEN", "DEEPLX_TOKEN"},
 			},
+			&cli.StringFlag{
+				Name:    "tokens",
+				Usage:   "Several tokens for the server, separated by commas, rotated when one is rate limited or out of quota",
+				EnvVars: []string{"DEEPLX_TOKENS"},
+			},
+			&cli.StringFlag{
+				Name:    "token-rotation",
+				Value:   defaultTokenRotation,
+				Usage:   "How --tokens are used: on-error (move on when one is refused) or round-robin (take turns)",
+				EnvVars: []string{"TRANSLATE_TOKEN_ROTATION"},
+			},
+			&cli.StringFlag{
+				Name:    "budget",
+				Value:   config.Budget,
+				Usage:   "Character budget per day or month across all servers (e.g., 50k/day, 2M/month), counted locally",
+				EnvVars: []string{"TRANSLATE_BUDGET"},
+			},
+			&cli.StringFlag{
+				Name:    "budget-action",
+				Value:   defaultBudgetAction,
+				Usage:   "What to do when a request would exceed --budget: warn (once) or stop (fail without sending)",
+				EnvVars: []string{"TRANSLATE_BUDGET_ACTION"},
+			},
+			&cli.DurationFlag{
+				Name:    "failure-ttl",
+				Value:   10 * time.Second,
+				Usage:   "Remember an unreachable server or rejected token this long, failing fast instead of waiting for a timeout on every call (0 disables)",
+				EnvVars: []string{"TRANSLATE_FAILURE_TTL"},
+			},
+			&cli.StringFlag{
+				Name:    "dl-session",
+				Value:   config.DLSession,
+				Usage:   "DeepL Pro session (the dl_session cookie) for DeepLX's pro endpoint; requests then go to /v1/translate",
+				EnvVars: []string{"DEEPLX_DL_SESSION"},
+			},
+			&cli.StringFlag{
+				Name:    "session-refresh-command",
+				Value:   config.SessionRefreshCommand,
+				Usage:   "Shell command printing a new dl_session when the server reports it expired; without one you are asked on the terminal",
+				EnvVars: []string{"TRANSLATE_SESSION_REFRESH_COMMAND"},
+			},
+			&cli.StringFlag{
+				Name:  "pre-translate",
+				Value: config.PreTranslate,
+				Usage: "Shell command each text is passed through before it is sent: it gets the text on stdin and prints the text to send ($TRANSLATE_SOURCE and $TRANSLATE_TARGET are set)",
+			},
+			&cli.StringFlag{
+				Name:  "post-translate",
+				Value: config.PostTranslate,
+				Usage: "Shell command each translation is passed through: it gets the translation on stdin and prints what to output, or nothing to keep it",
+			},
+			&cli.StringFlag{
+				Name:    "basic-auth",
+				Usage:   "HTTP basic auth credentials (user:password) for a server behind a reverse proxy; user:password@ in --url works too",
+				EnvVars: []string{"DEEPLX_BASIC_AUTH"},
+			},
+			&cli.StringFlag{
+				Name:  "auth-style",
+				Value: defaultAuthStyle,
+				Usage: "How to send the token: bearer (Authorization: Bearer), query (?token=) or dl-header (Authorization: DeepL-Auth-Key)",
+			},
+			&cli.StringFlag{
+				Name:    "provider",
+				Value:   defaultProvider,
+				Usage:   "Translation engine: deeplx, deepl (official API), libretranslate or a translate-provider-* plugin; its configured URL and token are used unless --url or --token are given",
+				EnvVars: []string{"TRANSLATE_PROVIDER"},
+			},
+			&cli.BoolFlag{
+				Name:  "strict-placeholders",
+				Usage: "Fail translations that lose placeholders ({name}, %s), HTML tags or bracket pairs of their text, instead of warning",
+			},
+			&cli.IntFlag{
+				Name:  "placeholder-retries",
+				Usage: "Request translations that lose placeholders, tags or bracket pairs again up to this many times",
+			},
+			&cli.BoolFlag{
+				Name:  "decode-entities",
+				Usage: "Decode HTML entities such as &amp; and &#8217; in the text before sending it, so the engine translates the characters they stand for",
+			},
+			&cli.BoolFlag{
+				Name:  "encode-entities",
+				Usage: "Encode &, < and > in the translation as HTML entities, and the characters that were entities in the text as they were written",
+			},
+			&cli.StringFlag{
+				Name:  "normalize",
+				Value: NormalizeNone,
+				Usage: "Unicode normalization of the text before it is sent: nfc composes decomposed characters (as in macOS file names), nfkc also replaces ligatures and full-width forms (as in OCR output), or none",
+			},
+			&cli.BoolFlag{
+				Name:  "normalize-output",
+				Usage: "Put the translation in the --normalize form too",
+			},
+			&cli.BoolFlag{
+				Name:  "stats",
+				Usage: "Count the characters and words of the text and translation, with their length ratio, to spot truncated or runaway translations: in JSON output, otherwise on stderr",
+			},
+			&cli.BoolFlag{
+				Name:  "pseudo",
+				Usage: "Pseudo-localize instead of translating, without a server: letters accented, text padded 30% and bracketed, placeholders and tags kept, to test i18n readiness",
+			},
+			&cli.StringFlag{
+				Name:  "formality",
+				Usage: "Register of the translation: more (formal), less (informal) or default; sent to engines that support it, e.g. for German or Japanese",
+			},
+			&cli.StringFlag{
+				Name:  "tag-handling",
+				Usage: "Have the server treat the text as html or xml markup and translate only its text, for servers that support it",
+			},
+			&cli.StringFlag{
+				Name:  "split-sentences",
+				Usage: "How the server splits text into sentences: 0 (not at all, e.g. for addresses and table cells), 1 (default) or nonewlines; for servers that support it",
+			},
+			&cli.BoolFlag{
+				Name:  "preserve-formatting",
+				Usage: "Keep the text's punctuation and capitalization as they are, for servers that support it",
+			},
+			&cli.StringFlag{
+				Name:  "context",
+				Usage: "Describe where the text is used (e.g., \"button label in a checkout form\") so ambiguous short texts translate right; not translated itself, for servers that support it",
+			},
+			&cli.StringFlag{
+				Name:    "glossary",
+				Value:   defaultGlossary,
+				Usage:   "Apply the configured glossaries with these names, merged with later ones taking precedence (e.g., product,legal)",
+				EnvVars: []string{"TRANSLATE_GLOSSARY"},
+			},
+			&cli.StringFlag{
+				Name:  "glossary-id",
+				Usage: "ID of a glossary stored on the server to translate with (official DeepL API, which also needs --source)",
+			},
 			&cli.BoolFlag{
 				Name:    "alternatives",
 				Aliases: []string{"a"},
 				Value:   false,
 				Usage:   "Show alternative translations",
 			},
+			&cli.IntFlag{
+				Name:  "alternatives-count",
+				Usage: "Number of alternatives to ask for where the engine supports it (LibreTranslate, plugins); others are cut down to it (default: the server's)",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Report the segments, characters and requests a translation would take without sending anything",
+			},
+			&cli.BoolFlag{
+				Name:  "queue",
+				Usage: "If the server can't be reached, queue the translation and succeed; send it later with queue flush",
+			},
+			&cli.IntFlag{
+				Name:  "pick",
+				Usage: "Output the Nth alternative (1 for the first) instead of the primary translation; fails when there are fewer",
+			},
+			&cli.BoolFlag{
+				Name:    "copy",
+				Aliases: []string{"c"},
+				Usage:   "Also copy the translation to the clipboard (translations into several targets are separated by a blank line)",
+			},
+			&cli.BoolFlag{
+				Name:  "speak",
+				Usage: "Also read the translation aloud (say, espeak-ng or the configured speak_command)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "alternatives-endpoint",
+				Usage: "Endpoint path to retry when --alternatives returns none (repeatable; default /v1/translate)",
+			},
 			&cli.IntFlag{
 				Name:    "timeout",
 				Value:   30,
@@ -106,6 +387,262 @@ func main() {
 				Value: false,
 				Usage: "Enable debug output",
 			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o", "format"},
+				Value:   OutputText,
+				Usage:   "Output format (text, json, pretty, or raycast and alfred for launchers)",
+			},
+			&cli.IntFlag{
+				Name:  "wrap",
+				Usage: "Reflow and wrap text output at N columns, as for commit messages or email, even when it doesn't go to a terminal (default: the terminal width when writing to one)",
+			},
+			&cli.BoolFlag{
+				Name:  "no-wrap",
+				Usage: "Never wrap output",
+			},
+			&cli.BoolFlag{
+				Name:  "no-pager",
+				Usage: "Don't pipe output that doesn't fit on the screen through $PAGER",
+			},
+			&cli.StringFlag{
+				Name:  "color",
+				Usage: "Color output: auto (on a terminal unless NO_COLOR is set), always or never",
+				Value: ColorAuto,
+			},
+			&cli.BoolFlag{
+				Name:  "pretty",
+				Usage: "Show the result in a bordered box with language labels (same as --output pretty)",
+			},
+			&cli.BoolFlag{
+				Name:    "non-interactive",
+				Aliases: []string{"yes"},
+				Usage:   "Never prompt: setup takes its answers from --url and --token, ambiguous targets are left to the server and an expired session fails",
+				EnvVars: []string{"TRANSLATE_NON_INTERACTIVE"},
+			},
+			&cli.BoolFlag{
+				Name:    "quiet",
+				Aliases: []string{"q"},
+				Usage:   "Print only translations and errors: no tips, welcome text, notices or progress, for scripts and editors",
+				EnvVars: []string{"TRANSLATE_QUIET"},
+			},
+			&cli.BoolFlag{
+				Name:    "null",
+				Aliases: []string{"0"},
+				Usage:   "Translate segments separated by NUL bytes on stdin (or each argument, as from xargs -0), writing the translations each followed by a NUL byte",
+			},
+			&cli.BoolFlag{
+				Name:  "multiline",
+				Usage: "Read the text from stdin up to a line holding only . (or EOF) and translate it as one, newlines included; in the REPL, each entry is read so",
+			},
+			&cli.BoolFlag{
+				Name:  "service",
+				Usage: "Translate the text on stdin and print only the translation, for macOS Services and Shortcuts (exit status 0 translated, 1 failed, 2 no text)",
+			},
+			&cli.BoolFlag{
+				Name:  "choose-variant",
+				Usage: "Prompt for the regional variant when the target is ambiguous (e.g., EN, PT) and no preference is configured",
+			},
+			&cli.StringFlag{
+				Name:  "json-field",
+				Usage: "Read JSON objects from stdin, translate the field at this dot-separated path (e.g., event.message) and re-emit them",
+			},
+			&cli.BoolFlag{
+				Name:  "no-daemon",
+				Usage: "Talk to the server directly even if a daemon is running",
+			},
+			&cli.BoolFlag{
+				Name:  "no-variant-fallback",
+				Usage: "Fail instead of falling back to the base language when the server rejects a regional variant",
+			},
+			&cli.StringFlag{
+				Name:  "sort-langs",
+				Value: defaultLangSort,
+				Usage: "Order of multi-target results: input (as given), alpha (by language tag), config (by configured language_order)",
+			},
+			&cli.BoolFlag{
+				Name:  "redact",
+				Value: true,
+				Usage: "Hide tokens and credentials in debug output, logs, traces and HAR files (--redact=false to show them)",
+			},
+			&cli.StringFlag{
+				Name:  "debug-har",
+				Usage: "Record HTTP requests and responses to this HAR file (tokens are redacted)",
+			},
+			&cli.BoolFlag{
+				Name:  "mixed",
+				Usage: "Translate passages in different languages separately, each from its own detected language",
+			},
+			&cli.BoolFlag{
+				Name:  "keep-target-runs",
+				Usage: "With --mixed, leave passages already in the target language unchanged",
+			},
+			&cli.BoolFlag{
+				Name:  "skip-translated",
+				Usage: "Pass through texts already in the target language (by local language detection) without a server call",
+			},
+			&cli.IntFlag{
+				Name:  "chunk-size",
+				Usage: "Split texts longer than this many characters at sentence boundaries (CJK and Thai aware) and translate the pieces separately; 0 disables",
+			},
+			&cli.StringSliceFlag{
+				Name:    "header",
+				Aliases: []string{"H"},
+				Usage:   "Extra request header, e.g. 'X-Api-Key: abc' (repeatable; adds to configured headers)",
+			},
+			&cli.StringFlag{
+				Name:    "otel-endpoint",
+				Usage:   "Export OpenTelemetry traces of translation requests to this OTLP/HTTP endpoint (e.g., http://localhost:4318)",
+				EnvVars: []string{"OTEL_EXPORTER_OTLP_ENDPOINT"},
+			},
+			&cli.BoolFlag{
+				Name:    "portable",
+				Usage:   "Keep the configuration, history and other files in translate-data beside the executable (also on when translate.portable is there)",
+				EnvVars: []string{"TRANSLATE_PORTABLE"},
+			},
+			&cli.StringFlag{
+				Name:    "config",
+				Usage:   "Configuration file to use instead of the one in the user's configuration directory",
+				EnvVars: []string{"TRANSLATE_CONFIG"},
+			},
+			&cli.StringFlag{
+				Name:    "metrics-endpoint",
+				Usage:   "Export request metrics to StatsD (statsd://HOST:PORT) or an OTLP/HTTP collector (e.g., http://localhost:4318)",
+				EnvVars: []string{"TRANSLATE_METRICS_ENDPOINT"},
+			},
+		},
+		Before: func(c *cli.Context) error {
+			c.Context = withRequestID(c.Context, "")
+			c.Context = withInvocation(c.Context, config)
+			if projectErr != nil {
+				return cli.Exit(fmt.Sprintf("Config error: %s", projectErr), 1)
+			}
+			if configSecretErr != nil {
+				return cli.Exit(fmt.Sprintf("Config error: %s", configSecretErr), 1)
+			}
+			if _, err := customHeaders(c); err != nil {
+				return cli.Exit(fmt.Sprintf("Header error: %s", err), 1)
+			}
+			redactor.setEnabled(c.Bool("redact"))
+			nonInteractive = c.Bool("non-interactive") || c.Bool("service")
+			quiet = c.Bool("quiet") || c.Bool("service")
+			if err := checkColorMode(c.String("color")); err != nil {
+				return cli.Exit(fmt.Sprintf("Option error: %s", err), 1)
+			}
+			colorMode = c.String("color")
+			if args := c.Args().Slice(); len(args) < 2 || args[0] != "config" || args[1] != "validate" {
+				if path, problems, err := configFileProblems(); err == nil && len(problems) > 0 {
+					warnf("%s: %s; run translate config validate for fixes", path, formatConfigProblem(problems[0]))
+				}
+			}
+			if !c.Bool("service") {
+				startUpdateCheck(config)
+			}
+			// Pairs, the project's server and basic auth set flags themselves
+			recordGivenFlags(c)
+			if err := applyPairSettings(c); err != nil {
+				return cli.Exit(fmt.Sprintf("Pair error: %s", err), 1)
+			}
+			if err := applyProjectServer(c); err != nil {
+				return cli.Exit(fmt.Sprintf("Config error: %s", err), 1)
+			}
+			if c.Bool("pseudo") {
+				if err := c.Set("provider", ProviderPseudo); err != nil {
+					return cli.Exit(fmt.Sprintf("Provider error: %s", err), 1)
+				}
+			}
+			if err := applyProvider(c); err != nil {
+				return cli.Exit(fmt.Sprintf("Provider error: %s", err), 1)
+			}
+			if err := checkLanguages(c.String("provider"), c.String("source"), splitLangList(c.String("target"))); err != nil {
+				return cli.Exit(fmt.Sprintf("Language error: %s", err), ExitLanguage)
+			}
+			redactor.addSecrets(c.String("token"), config.DefaultToken, c.String("dl-session"), config.DLSession)
+			redactor.addSecrets(strings.Split(c.String("tokens"), ",")...)
+			redactor.addSecrets(config.Tokens...)
+			for _, settings := range config.Providers {
+				redactor.addSecrets(settings.Token)
+			}
+			for _, settings := range config.Pairs {
+				redactor.addSecrets(settings.Token)
+			}
+			if err := applyBasicAuth(c); err != nil {
+				return cli.Exit(fmt.Sprintf("Basic auth error: %s", err), 1)
+			}
+			if err := checkAuthStyle(c.String("auth-style")); err != nil {
+				return cli.Exit(fmt.Sprintf("Auth style error: %s", err), 1)
+			}
+			if err := checkTokenRotation(c.String("token-rotation")); err != nil {
+				return cli.Exit(fmt.Sprintf("Token rotation error: %s", err), 1)
+			}
+			if budget := c.String("budget"); budget != "" {
+				if _, _, err := parseBudget(budget); err != nil {
+					return cli.Exit(fmt.Sprintf("Budget error: %s", err), 1)
+				}
+			}
+			if err := checkBudgetAction(c.String("budget-action")); err != nil {
+				return cli.Exit(fmt.Sprintf("Budget error: %s", err), 1)
+			}
+			if _, err := parseGlossarySet(c.String("glossary"), configFor(c.Context).Glossaries); err != nil {
+				return cli.Exit(fmt.Sprintf("Glossary error: %s", err), 1)
+			}
+			opts, err := optionsFromFlags(c)
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Option error: %s", err), 1)
+			}
+			c.Context = withTranslateOptions(c.Context, opts)
+			if err := checkNormalization(c.String("normalize")); err != nil {
+				return cli.Exit(fmt.Sprintf("Option error: %s", err), 1)
+			}
+
+			if rec := NewHARRecorder(c.String("debug-har")); rec != nil {
+				c.Context = rec.Install(c.Context)
+			}
+			if tracer := NewTracer(c.String("otel-endpoint"), c.Bool("debug")); tracer != nil {
+				name := AppName
+				if command := c.App.Command(c.Args().First()); command != nil {
+					name += " " + command.Name
+				}
+				c.Context = tracer.Start(c.Context, name)
+			}
+			metrics, err := NewMetrics(c.String("metrics-endpoint"), c.Bool("debug"))
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Metrics error: %s", err), 1)
+			}
+			if metrics != nil {
+				c.Context = metrics.Start(c.Context)
+			}
+			return nil
+		},
+		After: func(c *cli.Context) error {
+			writeHAR(c.Context)
+			shutdownTracer(c.Context)
+			shutdownMetrics(c.Context)
+			saveLocalUsage()
+			reportGlossary(c.Context)
+			if !c.Bool("service") {
+				notifyUpdate(configFor(c.Context))
+			}
+			return nil
+		},
+		// Errors from cli.Exit terminate the process before After runs, so flush traces first
+		ExitErrHandler: func(c *cli.Context, err error) {
+			writeHAR(c.Context)
+			shutdownTracer(c.Context)
+			shutdownMetrics(c.Context)
+			saveLocalUsage()
+			if exitErr, ok := err.(cli.ExitCoder); ok && exitErr.ExitCode() != 0 {
+				// Let failures be matched against server logs
+				message := redactSecrets(exitErr.Error())
+				if id := sentRequestID(c.Context); id != "" {
+					if message != "" {
+						message += "\n"
+					}
+					message += "Request ID: " + id
+				}
+				err = cli.Exit(message, exitErr.ExitCode())
+			}
+			cli.HandleExitCoder(err)
 		},
 		Commands: []*cli.Command{
 			{
@@ -124,6 +661,98 @@ func main() {
 								Name:  "token", 
 								Usage: "Set default authentication token",
 							},
+							&cli.StringFlag{
+								Name:  "language-order",
+								Usage: "Set preferred order of languages in multi-target output (e.g., en,de,fr)",
+							},
+							&cli.StringFlag{
+								Name:  "auth-style",
+								Usage: "Set how the token is sent (bearer, query, dl-header)",
+							},
+							&cli.StringFlag{
+								Name:  "language-sort",
+								Usage: "Set default ordering of multi-target output (input, alpha, config)",
+							},
+							&cli.StringFlag{
+								Name:  "alternatives-endpoints",
+								Usage: "Set endpoint paths to retry when --alternatives returns none (e.g., /v1/translate)",
+							},
+							&cli.StringFlag{
+								Name:  "variants",
+								Usage: "Set preferred regional variants for ambiguous targets (e.g., en-GB,pt-BR)",
+							},
+							&cli.StringSliceFlag{
+								Name:  "header",
+								Usage: "Set a header sent with every request, e.g. 'X-Api-Key: abc'; an empty value removes it (repeatable)",
+							},
+							&cli.StringFlag{
+								Name:  "provider",
+								Usage: "Set the default translation engine (deeplx, deepl, libretranslate)",
+							},
+							&cli.StringSliceFlag{
+								Name:  "provider-url",
+								Usage: "Set the server of a provider, e.g. libretranslate=http://localhost:5000 (repeatable)",
+							},
+							&cli.StringSliceFlag{
+								Name:  "provider-token",
+								Usage: "Set the token of a provider, e.g. deepl=YOUR_API_KEY (repeatable)",
+							},
+							&cli.StringFlag{
+								Name:  "tokens",
+								Usage: "Set several tokens for the default server, separated by commas, rotated when one is refused",
+							},
+							&cli.StringFlag{
+								Name:  "token-rotation",
+								Usage: "Set how the tokens are rotated (on-error, round-robin)",
+							},
+							&cli.StringFlag{
+								Name:  "budget",
+								Usage: "Set the character budget per day or month (e.g., 50k/day, 2M/month)",
+							},
+							&cli.StringFlag{
+								Name:  "budget-action",
+								Usage: "Set what happens when the budget would be exceeded (warn, stop)",
+							},
+							&cli.StringFlag{
+								Name:  "update-check",
+								Usage: "Turn the daily check for a newer release on or off",
+							},
+							&cli.StringFlag{
+								Name:  "history",
+								Usage: "Turn keeping the translations made in the history on or off",
+							},
+							&cli.StringFlag{
+								Name:  "dl-session",
+								Usage: "Set the DeepL Pro session for DeepLX's pro endpoint",
+							},
+							&cli.StringFlag{
+								Name:  "encrypt",
+								Usage: "Encrypt the stored tokens with a passphrase ($TRANSLATE_PASSPHRASE or asked for) or a key of this machine, or off",
+							},
+							&cli.StringFlag{
+								Name:  "session-refresh-command",
+								Usage: "Set the shell command printing a new session when it expires",
+							},
+							&cli.StringFlag{
+								Name:  "merge-annotation",
+								Usage: "Set the comment marking the segments --merge translated, none for no comment",
+							},
+							&cli.StringFlag{
+								Name:  "pre-translate",
+								Usage: "Set the shell command each text is passed through before it is sent, none to remove it",
+							},
+							&cli.StringFlag{
+								Name:  "post-translate",
+								Usage: "Set the shell command each translation is passed through, none to remove it",
+							},
+							&cli.StringFlag{
+								Name:  "speak-command",
+								Usage: "Set the shell command reading the text on stdin aloud for --speak ($TRANSLATE_VOICE and $TRANSLATE_LANG are set)",
+							},
+							&cli.StringSliceFlag{
+								Name:  "voice",
+								Usage: "Set the voice --speak uses for a language, e.g. de=Anna; an empty voice removes it (repeatable)",
+							},
 						},
 						Action: func(c *cli.Context) error {
 							return setConfig(c)
@@ -136,55 +765,120 @@ func main() {
 							return showConfig()
 						},
 					},
-				},
-			},
-			{
-				Name:  "setup",
-				Usage: "Interactive setup for DeepLX CLI",
-				Action: func(c *cli.Context) error {
-					fmt.Println("🚀 DeepLX CLI Setup")
-					fmt.Println("==================")
-					fmt.Println()
-					
-					// Check if DeepLX is running locally
-					fmt.Print("Checking for local DeepLX server... ")
-					localURL := "http://localhost:1188"
-					if err := checkServerConnection(localURL, 5*time.Second); err == nil {
-						fmt.Println("✓ Found!")
-						
-						// Test if it requires authentication
-						_, err := translate(localURL, "test", "AUTO", "EN", "", 5*time.Second, false)
-						if err != nil && strings.Contains(err.Error(), "authentication") {
-							fmt.Println("\n⚠️  Server requires authentication")
-							fmt.Print("Enter your token (or press Enter to skip): ")
-							var token string
-							fmt.Scanln(&token)
-							
-							if token != "" {
-								// Test with token
-								_, err = translate(localURL, "test", "AUTO", "EN", token, 5*time.Second, false)
-								if err == nil {
-									// Save configuration
-									config := Config{
-										DefaultURL:   localURL,
-										DefaultToken: token,
-									}
-									if err := saveConfig(config); err == nil {
-										fmt.Println("\n✓ Configuration saved!")
-										fmt.Println("\nYou're all set! Try:")
-										fmt.Println(`  translate "Hello world"`)
-										return nil
-									}
+					{
+						Name:  "apply",
+						Usage: "Converge the configuration to the settings in a YAML or JSON file, reporting what changed",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "file",
+								Aliases:  []string{"f"},
+								Usage:    "Desired settings; keys not in the file are left alone, null removes a setting",
+								Required: true,
+							},
+							&cli.BoolFlag{
+								Name:  "check",
+								Usage: "Only report what would change",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return applyConfig(c)
+						},
+					},
+					{
+						Name:  "validate",
+						Usage: "Check the configuration file for unknown settings, bad values, URLs and languages, and how to fix them",
+						Action: func(c *cli.Context) error {
+							return runConfigValidate(c)
+						},
+					},
+					{
+						Name:  "doctor",
+						Usage: "Show each effective setting and where it came from: flag, env, pair, project, user config or default",
+						Action: func(c *cli.Context) error {
+							return runConfigDoctor(c)
+						},
+					},
+					{
+						Name:  "export",
+						Usage: "Print the configuration as JSON to copy it to another machine or share it",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "out",
+								Usage: "Write to a file instead of stdout",
+							},
+							&cli.BoolFlag{
+								Name:  "no-secrets",
+								Usage: "Leave out tokens, the session and headers",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return exportConfig(c)
+						},
+					},
+					{
+						Name:      "import",
+						Usage:     "Merge the settings of an exported JSON or YAML file into the configuration",
+						ArgsUsage: "FILE",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "replace",
+								Usage: "Replace the whole configuration instead of merging into it",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return importConfig(c)
+						},
+					},
+				},
+			},
+			{
+				Name:  "setup",
+				Usage: "Interactive setup for DeepLX CLI",
+				Action: func(c *cli.Context) error {
+					fmt.Println("🚀 DeepLX CLI Setup")
+					fmt.Println("==================")
+					fmt.Println()
+					
+					// Check if DeepLX is running locally
+					fmt.Print("Checking for local DeepLX server... ")
+					localURL := "http://localhost:1188"
+					if err := checkServerConnection(localURL, 5*time.Second); err == nil {
+						fmt.Println("✓ Found!")
+						
+						// Test if it requires authentication
+						_, err := translate(localURL, "test", "AUTO", "EN", "", AuthBearer, 5*time.Second, false)
+						if err != nil && strings.Contains(err.Error(), "authentication") {
+							fmt.Println("\n⚠️  Server requires authentication")
+							token := askSecret("Enter your token (or press Enter to skip): ", c.String("token"))
+							
+							if token != "" {
+								// Test with token
+								_, err = translate(localURL, "test", "AUTO", "EN", token, AuthBearer, 5*time.Second, false)
+								if err == nil {
+									// Save configuration, keeping the other settings
+									err := updateConfig(c.Context, func(config *Config) error {
+										config.DefaultURL = localURL
+										config.DefaultToken = token
+										return nil
+									})
+									if err == nil {
+										fmt.Println("\n✓ Configuration saved!")
+										fmt.Println("\nYou're all set! Try:")
+										fmt.Println(`  translate "Hello world"`)
+										return nil
+									}
 								} else {
 									fmt.Println("⚠️  Token verification failed:", err)
 								}
 							}
 						} else if err == nil {
 							// No authentication needed
-							config := Config{
-								DefaultURL: localURL,
-							}
-							if err := saveConfig(config); err == nil {
+							err := updateConfig(c.Context, func(config *Config) error {
+								config.DefaultURL = localURL
+								config.DefaultToken = ""
+								return nil
+							})
+							if err == nil {
 								fmt.Println("\n✓ Configuration saved!")
 								fmt.Println("\nYou're all set! Try:")
 								fmt.Println(`  translate "Hello world"`)
@@ -197,25 +891,64 @@ func main() {
 					
 					// Offer to start DeepLX with Docker
 					fmt.Println("\n📦 No local DeepLX server found.")
+					hasDocker := dockerAvailable()
 					fmt.Println("\nWould you like to:")
-					fmt.Println("1. Start DeepLX with Docker (recommended)")
+					if hasDocker {
+						fmt.Println("1. Start DeepLX with Docker now (recommended)")
+					} else {
+						fmt.Println("1. Start DeepLX with Docker (recommended)")
+					}
 					fmt.Println("2. Use a remote DeepLX server")
 					fmt.Println("3. Exit and set up manually")
-					fmt.Print("\nChoice (1-3): ")
-					
-					var choice string
-					fmt.Scanln(&choice)
+					// Non-interactively, set up the server given with --url or leave it to the user
+					defaultChoice := "3"
+					if c.IsSet("url") {
+						defaultChoice = "2"
+					}
+					choice := ask("\nChoice (1-3): ", defaultChoice)
 					
 					switch choice {
 					case "1":
-						fmt.Println("\nTo start DeepLX with Docker, run:")
-						fmt.Println("\n  docker run -d -p 1188:1188 ghcr.io/owo-network/deeplx:latest")
-						fmt.Println("\nThen run 'translate setup' again.")
+						if !hasDocker {
+							fmt.Println("\nDocker was not found (or its daemon isn't running). Once it is, run:")
+							fmt.Println("\n  docker run -d -p 127.0.0.1:1188:1188 ghcr.io/owo-network/deeplx:latest")
+							fmt.Println("\nThen run 'translate setup' again.")
+							return nil
+						}
+
+						fmt.Print("\nStarting DeepLX container... ")
+						if err := startDockerServer(localURL, 60*time.Second); err != nil {
+							fmt.Println("✗ Failed")
+							fmt.Println("Error:", err)
+							return nil
+						}
+						fmt.Println("✓ Running")
+
+						fmt.Print("Testing translation... ")
+						result, err := translate(localURL, "Hello", "AUTO", "EN", "", AuthBearer, 10*time.Second, false)
+						if err != nil {
+							fmt.Println("✗ Failed")
+							fmt.Println("Error:", err)
+							return nil
+						}
+						fmt.Printf("✓ Success! Got: %s\n", result.Data)
+
+						err = updateConfig(c.Context, func(config *Config) error {
+							config.DefaultURL = localURL
+							config.DefaultToken = ""
+							return nil
+						})
+						if err != nil {
+							fmt.Println("\n⚠️  Failed to save config:", err)
+							return nil
+						}
+
+						fmt.Println("\n✓ Configuration saved!")
+						fmt.Println("\nYou're all set! Try:")
+						fmt.Println(`  translate "Hello world"`)
 						
 					case "2":
-						fmt.Print("\nEnter the DeepLX server URL: ")
-						var serverURL string
-						fmt.Scanln(&serverURL)
+						serverURL := ask("\nEnter the DeepLX server URL: ", c.String("url"))
 						
 						if serverURL != "" {
 							// Test connection
@@ -228,19 +961,20 @@ func main() {
 							fmt.Println("✓ Connected")
 							
 							// Check if authentication is needed
-							fmt.Print("\nDoes this server require authentication? (y/N): ")
-							var needsAuth string
-							fmt.Scanln(&needsAuth)
+							defaultNeedsAuth := "n"
+							if c.String("token") != "" {
+								defaultNeedsAuth = "y"
+							}
+							needsAuth := ask("\nDoes this server require authentication? (y/N): ", defaultNeedsAuth)
 							
 							var token string
 							if strings.ToLower(needsAuth) == "y" {
-								fmt.Print("Enter your token: ")
-								fmt.Scanln(&token)
+								token = askSecret("Enter your token: ", c.String("token"))
 							}
 							
 							// Test translation
 							fmt.Print("\nTesting translation... ")
-							result, err := translate(serverURL, "Hello", "AUTO", "EN", token, 10*time.Second, false)
+							result, err := translate(serverURL, "Hello", "AUTO", "EN", token, AuthBearer, 10*time.Second, false)
 							if err != nil {
 								fmt.Println("✗ Failed")
 								fmt.Println("Error:", err)
@@ -248,12 +982,13 @@ func main() {
 							}
 							fmt.Printf("✓ Success! Got: %s\n", result.Data)
 							
-							// Save configuration
-							config := Config{
-								DefaultURL:   serverURL,
-								DefaultToken: token,
-							}
-							if err := saveConfig(config); err != nil {
+							// Save configuration, keeping the other settings
+							err = updateConfig(c.Context, func(config *Config) error {
+								config.DefaultURL = serverURL
+								config.DefaultToken = token
+								return nil
+							})
+							if err != nil {
 								fmt.Println("\n⚠️  Failed to save config:", err)
 								return nil
 							}
@@ -277,92 +1012,779 @@ func main() {
 				Name:  "doctor",
 				Usage: "Diagnose configuration and connection issues",
 				Action: func(c *cli.Context) error {
-					fmt.Println("🔍 DeepLX CLI Diagnostic")
-					fmt.Println("=======================")
-					fmt.Println()
-					
-					// Check configuration
-					config := loadConfig()
-					fmt.Println("Configuration:")
-					if config.DefaultURL != "" {
-						fmt.Printf("  ✓ Default URL: %s\n", config.DefaultURL)
-					} else {
-						fmt.Printf("  ✗ Default URL: not set (using http://localhost:1188)\n")
-					}
-					
-					if config.DefaultToken != "" {
-						fmt.Printf("  ✓ Default Token: configured\n")
-					} else {
-						fmt.Printf("  ℹ Default Token: not set\n")
-					}
-					
-					// Check environment variables
-					fmt.Println("\nEnvironment:")
-					if token := os.Getenv("TOKEN"); token != "" {
-						fmt.Printf("  ✓ TOKEN: set\n")
-					} else if token := os.Getenv("DEEPLX_TOKEN"); token != "" {
-						fmt.Printf("  ✓ DEEPLX_TOKEN: set\n")
-					} else {
-						fmt.Printf("  ℹ No token in environment\n")
-					}
-					
-					if url := os.Getenv("DEEPLX_URL"); url != "" {
-						fmt.Printf("  ✓ DEEPLX_URL: %s\n", url)
-					}
-					
-					// Test connection
-					serverURL := c.String("url")
-					if serverURL == "" {
-						serverURL = config.DefaultURL
-						if serverURL == "" {
-							serverURL = "http://localhost:1188"
-						}
-					}
-					
-					fmt.Printf("\nTesting connection to %s:\n", serverURL)
-					
-					// Check if reachable
-					fmt.Print("  Checking connectivity... ")
-					if err := checkServerConnection(serverURL, 5*time.Second); err != nil {
-						fmt.Println("✗ Failed")
-						fmt.Printf("  Error: %v\n", err)
-						return nil
-					}
-					fmt.Println("✓ OK")
-					
-					// Try a test translation
-					token := c.String("token")
-					if token == "" {
-						token = config.DefaultToken
-					}
-					
-					fmt.Print("  Testing translation... ")
-					result, err := translate(serverURL, "Hello", "AUTO", "EN", token, 5*time.Second, false)
-					if err != nil {
-						fmt.Println("✗ Failed")
-						fmt.Printf("  Error: %v\n", err)
-						
-						if strings.Contains(err.Error(), "authentication") {
-							fmt.Println("\n💡 Tip: This server requires authentication.")
-							fmt.Println("   Set a token with: translate config set --token <your-token>")
-						}
-					} else {
-						fmt.Printf("✓ OK (got: %s)\n", result.Data)
-						fmt.Printf("  Method: %s\n", result.Method)
-						fmt.Printf("  Source: %s\n", result.SourceLang)
-					}
-					
-					return nil
+					fmt.Println("🔍 DeepLX CLI Diagnostic")
+					fmt.Println("=======================")
+					fmt.Println()
+					
+					// Check configuration
+					config := configFor(c.Context)
+					fmt.Println("Configuration:")
+					if config.DefaultURL != "" {
+						fmt.Printf("  ✓ Default URL: %s\n", redactSecrets(config.DefaultURL))
+					} else {
+						fmt.Printf("  ✗ Default URL: not set (using http://localhost:1188)\n")
+					}
+					
+					if config.DefaultToken != "" {
+						fmt.Printf("  ✓ Default Token: configured\n")
+					} else {
+						fmt.Printf("  ℹ Default Token: not set\n")
+					}
+					
+					// Check environment variables
+					fmt.Println("\nEnvironment:")
+					if token := os.Getenv("TOKEN"); token != "" {
+						fmt.Printf("  ✓ TOKEN: set\n")
+					} else if token := os.Getenv("DEEPLX_TOKEN"); token != "" {
+						fmt.Printf("  ✓ DEEPLX_TOKEN: set\n")
+					} else {
+						fmt.Printf("  ℹ No token in environment\n")
+					}
+					
+					if url := os.Getenv("DEEPLX_URL"); url != "" {
+						fmt.Printf("  ✓ DEEPLX_URL: %s\n", redactSecrets(url))
+					}
+					
+					// Test connection
+					serverURL := c.String("url")
+					if serverURL == "" {
+						serverURL = config.DefaultURL
+						if serverURL == "" {
+							serverURL = "http://localhost:1188"
+						}
+					}
+					
+					fmt.Printf("\nTesting connection to %s:\n", redactSecrets(serverURL))
+					
+					// Check if reachable
+					fmt.Print("  Checking connectivity... ")
+					if err := checkServerConnection(serverURL, 5*time.Second); err != nil {
+						fmt.Println("✗ Failed")
+						fmt.Printf("  Error: %s\n", redactSecrets(err.Error()))
+						return nil
+					}
+					fmt.Println("✓ OK")
+					
+					// Try a test translation
+					token := c.String("token")
+					if token == "" {
+						token = config.DefaultToken
+					}
+					
+					fmt.Print("  Testing translation... ")
+					result, err := translate(serverURL, "Hello", "AUTO", "EN", token, c.String("auth-style"), 5*time.Second, false)
+					if err != nil {
+						fmt.Println("✗ Failed")
+						fmt.Printf("  Error: %s\n", redactSecrets(err.Error()))
+						
+						if strings.Contains(err.Error(), "authentication") && !quiet {
+							fmt.Println("\n💡 Tip: This server requires authentication.")
+							fmt.Println("   Set a token with: translate config set --token <your-token>")
+						}
+					} else {
+						fmt.Printf("✓ OK (got: %s)\n", result.Data)
+						// Calls failing fast on a remembered failure can go through again
+						NewFailureCache(c.Duration("failure-ttl")).Clear(serverURL)
+						fmt.Printf("  Method: %s\n", result.Method)
+						fmt.Printf("  Source: %s\n", result.SourceLang)
+					}
+
+					if info := lookupTokenInfo(serverURL, token, c.String("auth-style"), 5*time.Second); info != nil {
+						printTokenInfo(info, time.Now())
+					} else if token != "" {
+						fmt.Println("\nToken:")
+						fmt.Println("  ℹ The server exposes no token metadata")
+					}
+					
+					return nil
+				},
+			},	
+			{
+				Name:  "serve",
+				Usage: "Run a local caching proxy exposing the DeepLX /translate and DeepL /v2/translate APIs",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: "localhost:8089",
+						Usage: "Address to listen on (e.g., :8089)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "upstream",
+						Usage: "Upstream DeepLX server, tried in order on failure (repeatable; defaults to --url)",
+					},
+					&cli.IntFlag{
+						Name:  "retries",
+						Value: 2,
+						Usage: "Retries per upstream for transient failures",
+					},
+					&cli.Float64Flag{
+						Name:  "rate",
+						Value: 0,
+						Usage: "Maximum upstream requests per second (0 for unlimited)",
+					},
+					&cli.IntFlag{
+						Name:  "cache-size",
+						Value: 10000,
+						Usage: "Maximum number of cached translations (0 disables caching)",
+					},
+					&cli.DurationFlag{
+						Name:  "cache-ttl",
+						Value: 24 * time.Hour,
+						Usage: "How long cached translations stay valid (0 for no expiry)",
+					},
+					&cli.StringFlag{
+						Name:    "auth-token",
+						Usage:   "Require clients to send this access token",
+						EnvVars: []string{"TRANSLATE_SERVE_TOKEN"},
+					},
+					&cli.StringFlag{
+						Name:  "grpc-listen",
+						Usage: "Also serve the gRPC API (see proto/translate.proto) on this address (e.g., :8090)",
+					},
+					&cli.StringFlag{
+						Name:    "grpc-cert",
+						Aliases: []string{"cert"},
+						Usage:   "TLS certificate file for gRPC (a self-signed one is generated if omitted)",
+					},
+					&cli.StringFlag{
+						Name:    "grpc-key",
+						Aliases: []string{"key"},
+						Usage:   "TLS private key file for gRPC",
+					},
+					&cli.BoolFlag{
+						Name:  "grpc-plaintext",
+						Usage: "Serve gRPC without TLS, as cleartext HTTP/2 (h2c)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runServe(c)
+				},
+			},
+			{
+				Name:      "xml",
+				Usage:     "Translate the text or attributes of XML nodes selected by an XPath expression",
+				ArgsUsage: "FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "xpath",
+						Usage: "Nodes to translate, e.g. '//description/text()' or '/catalog/item/@title'",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Write the translated document to this file instead of stdout",
+					},
+					&cli.BoolFlag{
+						Name:  "in-place",
+						Usage: "Overwrite the input file",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runXML(c)
+				},
+			},
+			{
+				Name:      "fixture",
+				Usage:     "Translate selected columns of SQL INSERT dumps or CSV/TSV fixtures",
+				ArgsUsage: "FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "columns",
+						Usage: "Comma-separated column names to translate",
+					},
+					&cli.StringFlag{
+						Name:  "table",
+						Usage: "Only translate INSERT statements for this table (SQL only)",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Input format: sql, csv or tsv (default: from the file extension)",
+					},
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Write the translated file here instead of stdout",
+					},
+					&cli.BoolFlag{
+						Name:  "in-place",
+						Usage: "Overwrite the input file",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runFixture(c)
+				},
+			},
+			{
+				Name:  "daemon",
+				Usage: "Manage a background daemon that keeps connections and a cache warm between invocations",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "start",
+						Usage: "Start the daemon in the background",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "idle-timeout",
+								Value: 30 * time.Minute,
+								Usage: "Stop after this long without requests (0 to run until stopped)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return startDaemon(c)
+						},
+					},
+					{
+						Name:  "stop",
+						Usage: "Stop the running daemon",
+						Action: func(c *cli.Context) error {
+							return stopDaemon(c)
+						},
+					},
+					{
+						Name:  "status",
+						Usage: "Show whether the daemon is running",
+						Action: func(c *cli.Context) error {
+							return showDaemonStatus(c)
+						},
+					},
+					{
+						Name:  "run",
+						Usage: "Run the daemon in the foreground",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "idle-timeout",
+								Value: 0,
+								Usage: "Stop after this long without requests (0 to run until stopped)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return runDaemon(c)
+						},
+					},
+				},
+			},
+			{
+				Name:  "mcp",
+				Usage: "Run a Model Context Protocol server on stdio for AI assistants",
+				Action: func(c *cli.Context) error {
+					return runMCP(c)
+				},
+			},
+			{
+				Name:      "batch",
+				Usage:     "Translate the \"text\" of each item of a JSON Lines file or JSON manifest, passing other fields through",
+				ArgsUsage: "[FILE]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Write the translated items to this file instead of stdout",
+					},
+					&cli.StringFlag{
+						Name:  "report",
+						Usage: "Write a JSON report of each item's outcome and metadata to this file",
+					},
+					&cli.StringFlag{
+						Name:  "output-format",
+						Value: BatchJSON,
+						Usage: "Write the items as json, a table of text and translation, tsv for spreadsheets, or plain translated lines",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runBatch(c)
+				},
+			},
+			{
+				Name:      "compare",
+				Usage:     "Translate text with several providers side by side",
+				ArgsUsage: "TEXT",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "providers",
+						Usage: "Providers to compare, e.g. deeplx,deepl (default: the selected one and every configured one)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runCompare(c)
+				},
+			},
+			{
+				Name:  "providers",
+				Usage: "List the translation providers, including translate-provider-* plugins on PATH",
+				Action: func(c *cli.Context) error {
+					return runProviders(c)
+				},
+			},
+			{
+				Name:  "languages",
+				Usage: "List the target languages the provider supports",
+				Action: func(c *cli.Context) error {
+					return runLanguages(c)
+				},
+			},
+			{
+				Name:      "doc",
+				Usage:     "Translate a document (.docx, .pptx, .pdf, ...) with the official DeepL API (--provider deepl)",
+				ArgsUsage: "FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Where to save the translated document (default: FILE with the target language before its extension)",
+					},
+					&cli.DurationFlag{
+						Name:  "poll-interval",
+						Value: 2 * time.Second,
+						Usage: "How often to check whether the translation is done",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runDoc(c)
+				},
+			},
+			{
+				Name:      "locale",
+				Usage:     "Translate PO, YAML or JSON locale files, keeping their comments and passing translator notes as context",
+				ArgsUsage: "FILE...",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Where to save the translation, - for stdout (default: next to FILE, named after the target language)",
+					},
+					&cli.IntFlag{
+						Name:  "jobs",
+						Value: 4,
+						Usage: "How many files to translate at a time",
+					},
+					&cli.BoolFlag{
+						Name:  "merge",
+						Usage: "Keep the translations already in the target file, translating only the missing and untranslated segments",
+					},
+					&cli.StringFlag{
+						Name:  "merge-annotation",
+						Usage: "Comment marking the segments --merge translated, none for no comment (default: merge_annotation setting, or \"machine translated\")",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runLocale(c)
+				},
+			},
+			{
+				Name:  "i18n",
+				Usage: "Keep the locale files of an app in step with its source language",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "sync",
+						Usage: "Translate and add the messages of a JSON or ARB source file missing from a target file, keeping its translations",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "source",
+								Usage: "Locale file in the source language, e.g. en.json",
+							},
+							&cli.StringFlag{
+								Name:  "target",
+								Usage: "Locale file to update, created if missing, e.g. de.json",
+							},
+							&cli.StringFlag{
+								Name:  "lang",
+								Usage: "Language of the target file (default: from its name)",
+							},
+							&cli.BoolFlag{
+								Name:  "prune",
+								Usage: "Remove the messages no longer in the source file",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return runI18nSync(c)
+						},
+					},
+					{
+						Name:      "lint",
+						Usage:     "Report missing, empty and untranslated messages and placeholder mismatches in JSON or ARB locale files, exiting 1 if any",
+						ArgsUsage: "FILE...",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "source",
+								Usage: "Locale file in the source language the others are checked against",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return runI18nLint(c)
+						},
+					},
+				},
+			},
+			{
+				Name:      "dir",
+				Usage:     "Translate the files of a directory tree into a mirrored tree: Markdown and text by paragraph, HTML and XML as markup, locale files by message",
+				ArgsUsage: "DIR",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Directory to mirror the tree into; {lang} stands for the target language, needed with several",
+					},
+					&cli.StringSliceFlag{
+						Name:  "include",
+						Usage: "Translate the files matching this glob, e.g. '*.md' or 'guide/*.txt' (repeatable; default: Markdown, text and HTML)",
+					},
+					&cli.StringSliceFlag{
+						Name:  "exclude",
+						Usage: "Leave out the files and directories matching this glob, as well as those in DIR/.translateignore (repeatable)",
+					},
+					&cli.IntFlag{
+						Name:  "jobs",
+						Value: 4,
+						Usage: "How many files to translate at a time",
+					},
+					&cli.BoolFlag{
+						Name:  "merge",
+						Usage: "Keep the translations already in the target file, translating only the missing and untranslated segments",
+					},
+					&cli.StringFlag{
+						Name:  "merge-annotation",
+						Usage: "Comment marking the segments --merge translated, none for no comment (default: merge_annotation setting, or \"machine translated\")",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runDir(c)
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Update a translation for a new revision of a document, translating only the paragraphs that changed",
+				ArgsUsage: "OLD NEW TRANSLATED_OLD",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "out",
+						Usage: "Write the updated translation to this file instead of stdout",
+					},
+					&cli.BoolFlag{
+						Name:  "changed-only",
+						Usage: "Take the old revision from git: translate -t LANG diff --changed-only FILE TRANSLATED",
+					},
+					&cli.StringFlag{
+						Name:  "rev",
+						Value: "HEAD",
+						Usage: "With --changed-only, the git revision the translation was made from",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runDiff(c)
+				},
+			},
+			{
+				Name:      "git-msg",
+				Usage:     "Translate a commit message from FILE or stdin, keeping its trailers, comments and diff; a file is rewritten in place",
+				ArgsUsage: "[FILE]",
+				Action: func(c *cli.Context) error {
+					return runGitMsg(c)
+				},
+			},
+			{
+				Name:      "fmt-check",
+				Usage:     "Check that a file passes through its format handler unchanged when nothing is translated, showing what would change",
+				ArgsUsage: "FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Format of the file: po, yaml, json, xml, sql, csv or tsv (default: from the extension)",
+					},
+					&cli.StringFlag{
+						Name:  "xpath",
+						Value: "//*",
+						Usage: "For XML, the nodes to pass through, as for the xml command",
+					},
+					&cli.StringFlag{
+						Name:  "columns",
+						Usage: "For SQL, CSV and TSV, the columns to pass through, as for the fixture command (default for CSV and TSV: all)",
+					},
+					&cli.StringFlag{
+						Name:  "table",
+						Usage: "For SQL, only check INSERTs into this table",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runFmtCheck(c)
+				},
+			},
+			{
+				Name:  "usage",
+				Usage: "Show the character quota and consumption the server reports, and what this CLI sent this month",
+				Action: func(c *cli.Context) error {
+					return runUsage(c)
+				},
+			},
+			{
+				Name:  "alias",
+				Usage: "Manage shortcuts such as `translate ja2en TEXT` that stand for a set of flags",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "add",
+						Usage:     "Add or replace an alias",
+						ArgsUsage: "NAME [--] FLAGS...",
+						Action: func(c *cli.Context) error {
+							return runAliasAdd(c)
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List the aliases",
+						Action: func(c *cli.Context) error {
+							return runAliasList(c)
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     "Remove an alias",
+						ArgsUsage: "NAME",
+						Action: func(c *cli.Context) error {
+							return runAliasRemove(c)
+						},
+					},
+				},
+			},
+			{
+				Name:  "preset",
+				Usage: "Manage presets, sets of flags saved under a name and used as `translate @NAME ...`",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "save",
+						Usage:     "Save or replace a preset",
+						ArgsUsage: "NAME [--] FLAGS...",
+						Action: func(c *cli.Context) error {
+							return runPresetSave(c)
+						},
+					},
+					{
+						Name:  "list",
+						Usage: "List the presets",
+						Action: func(c *cli.Context) error {
+							return runPresetList(c)
+						},
+					},
+					{
+						Name:      "remove",
+						Usage:     "Remove a preset",
+						ArgsUsage: "NAME",
+						Action: func(c *cli.Context) error {
+							return runPresetRemove(c)
+						},
+					},
+				},
+			},
+			{
+				Name:      "completion",
+				Usage:     "Print a shell completion script completing commands, flags, language codes and alias names",
+				ArgsUsage: "bash|zsh|fish|powershell",
+				Action: func(c *cli.Context) error {
+					return runCompletion(c)
+				},
+			},
+			{
+				Name:  "service",
+				Usage: "Integrate with macOS Services",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "install",
+						Usage:     "Install a Quick Action translating the selected text in any app, passing on the flags given (e.g., service install -- -t de)",
+						ArgsUsage: "[--] [FLAGS...]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "name",
+								Value: "Translate",
+								Usage: "Name of the Quick Action in the Services menu",
+							},
+							&cli.BoolFlag{
+								Name:  "show",
+								Usage: "Show the translation in a dialog instead of replacing the selected text",
+							},
+							&cli.StringFlag{
+								Name:  "dir",
+								Usage: "Where to write the workflow (default: ~/Library/Services)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return runServiceInstall(c)
+						},
+					},
+				},
+			},
+			{
+				Name:  "man",
+				Usage: "Print the man page, covering every flag, command, configuration key and environment variable (e.g., translate man > translate.1)",
+				Action: func(c *cli.Context) error {
+					return runMan(c)
+				},
+			},
+			{
+				Name:  "queue",
+				Usage: "Work with the translations --queue put aside while the server was unreachable",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "List the queued translations",
+						Action: func(c *cli.Context) error {
+							return runQueueList(c)
+						},
+					},
+					{
+						Name:  "flush",
+						Usage: "Send the queued translations, printing them and keeping those that still fail",
+						Action: func(c *cli.Context) error {
+							return runQueueFlush(c)
+						},
+					},
+				},
+			},
+			{
+				Name:  "history",
+				Usage: "Work with the history of translations made on the command line",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "export",
+						Usage: "Export the history as CSV, JSON or a TMX translation memory",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "format",
+								Value: HistoryCSV,
+								Usage: "Export format: csv, json or tmx",
+							},
+							&cli.StringFlag{
+								Name:  "out",
+								Usage: "Write the export here instead of stdout",
+							},
+							&cli.StringFlag{
+								Name:  "since",
+								Usage: "Only export translations made on or after this day (YYYY-MM-DD)",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return runHistoryExport(c)
+						},
+					},
+				},
+			},
+			{
+				Name:  "stats",
+				Usage: "Show statistics kept locally: the history by language pair, server and day, or a subcommand",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "days",
+						Value: 30,
+						Usage: "Summarize the last N days",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runStats(c)
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:  "usage",
+						Usage: "Show the characters sent per day or month, by provider and server",
+						Flags: []cli.Flag{
+							&cli.IntFlag{
+								Name:  "days",
+								Value: 30,
+								Usage: "Show the last N days",
+							},
+							&cli.StringFlag{
+								Name:  "by",
+								Value: BudgetDay,
+								Usage: "Group by day or month",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							return runStatsUsage(c)
+						},
+					},
+				},
+			},
+			{
+				Name:      "detect",
+				Usage:     "Detect the language of text (read from stdin if not given), offline if the server can't be reached",
+				ArgsUsage: "TEXT",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: "Use only the built-in detector, without contacting the server",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runDetect(c)
+				},
+			},
+			{
+				Name:    "repl",
+				Aliases: []string{"i"},
+				Usage:   "Translate lines interactively; Ctrl-C cancels the current request",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "no-history",
+						Usage: "Don't read or save the REPL history file",
+					},
+					&cli.StringFlag{
+						Name:  "transcript",
+						Usage: "Write the session to this file as a Markdown transcript, updated after each line",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runREPL(c)
+				},
+			},
+			{
+				Name:  "chat",
+				Usage: "Translate a face-to-face conversation: each line is translated into the other language of --pair, detected per line",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "pair",
+						Usage:    "The two languages spoken, e.g. en:ja",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "speakers",
+						Usage: "Names to label the two sides with, in --pair order, e.g. Anna,Kenji (default: the languages)",
+					},
+					&cli.BoolFlag{
+						Name:  "no-history",
+						Usage: "Don't read or save the REPL history file",
+					},
+					&cli.StringFlag{
+						Name:  "transcript",
+						Usage: "Write the conversation to this file as a Markdown transcript, updated after each line",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return runChat(c)
 				},
-			},	
+			},
 			
 		},
 		// Replace the Action function in main() with this enhanced version
 		Action: func(c *cli.Context) error {
-			if c.NArg() == 0 {
+			if c.Bool("service") {
+				return runService(c)
+			}
+			if field := c.String("json-field"); field != "" {
+				return runJSONField(c, field)
+			}
+			if c.Bool("null") {
+				return runNullDelimited(c)
+			}
+
+			config := configFor(c.Context)
+			args := c.Args().Slice()
+			if c.Bool("multiline") {
+				if len(args) > 0 {
+					return cli.Exit("Translation error: --multiline reads the text from stdin; don't give it as arguments too", ExitUsage)
+				}
+				text, err := readMultiline(os.Stdin)
+				if err != nil {
+					return cli.Exit(fmt.Sprintf("Input error: %s", err), 1)
+				}
+				if strings.TrimSpace(text) == "" {
+					return cli.Exit("Translation error: no text given", ExitUsage)
+				}
+				args = []string{text}
+			}
+
+			if len(args) == 0 {
 				// Check if this might be a first run
-				config := loadConfig()
-				if config.DefaultURL == "" && config.DefaultToken == "" {
+				if config.DefaultURL == "" && config.DefaultToken == "" && !quiet {
 					// No configuration found, suggest setup
 					fmt.Println("👋 Welcome to DeepLX CLI!")
 					fmt.Println("\nIt looks like this is your first time using the tool.")
@@ -375,71 +1797,221 @@ func main() {
 				return cli.ShowAppHelp(c)
 			}
 
-			text := strings.Join(c.Args().Slice(), " ")
-			sourceLang := strings.ToUpper(c.String("source"))
-			targetLang := strings.ToUpper(c.String("target"))
+			text := strings.Join(args, " ")
+			sourceLang := toDeepLCode(c.String("source"), true)
+			targetLangs := splitLangList(c.String("target"))
 			serverURL := c.String("url")
 			token := c.String("token")
 			showAlternatives := c.Bool("alternatives")
-			timeout := time.Duration(c.Int("timeout")) * time.Second
 			debug := c.Bool("debug")
+			outputFormat := c.String("output")
+			if c.Bool("pretty") {
+				outputFormat = OutputPretty
+			}
+			wrapWidth, reflow := wrapFromFlags(c)
+			langSort := c.String("sort-langs")
+			chooseVariant := c.Bool("choose-variant")
 
-			if debug {
-				fmt.Fprintf(os.Stderr, "Debug: URL=%s, Source=%s, Target=%s, HasToken=%t\n", 
-					serverURL, sourceLang, targetLang, token != "")
+			if len(targetLangs) == 0 {
+				return cli.Exit("Translation error: no target language given", ExitUsage)
+			}
+			pick := c.Int("pick")
+			if pick < 0 {
+				return cli.Exit("Translation error: --pick must be 1 or more", ExitUsage)
+			}
+			switch langSort {
+			case LangSortInput, LangSortAlpha, LangSortConfig:
+			default:
+				return cli.Exit(fmt.Sprintf("Translation error: unknown language sort %q (use input, alpha or config)", langSort), 1)
 			}
 
-			result, err := translate(serverURL, text, sourceLang, targetLang, token, timeout, debug)
-			if err != nil {
-				// Check if it's a connection error and provide helpful guidance
-				if strings.Contains(err.Error(), "cannot connect to DeepLX server") {
-					fmt.Fprintln(os.Stderr, err)
-					fmt.Fprintln(os.Stderr, "\n💡 First time? Run: translate setup")
-					return cli.Exit("", 1)
+			client := sharedClient(c)
+			if c.Bool("dry-run") {
+				resolved := make([]string, len(targetLangs))
+				for i, target := range targetLangs {
+					resolved[i] = resolveTargetVariant(toDeepLCode(target, false), config.VariantPreferences, false)
+				}
+				return runDryRun(c, client, text, sourceLang, resolved)
+			}
+
+			alternativesEndpoints := c.StringSlice("alternatives-endpoint")
+			if len(alternativesEndpoints) == 0 {
+				alternativesEndpoints = config.AlternativesEndpoints
+			}
+			if len(alternativesEndpoints) == 0 {
+				alternativesEndpoints = []string{"/v1/translate"}
+			}
+
+			// The variant prompt would be garbled by a spinner
+			var spinner *Spinner
+			if !chooseVariant {
+				spinner = startSpinner(spinnerLabel(targetLangs), debug)
+				defer spinner.Stop()
+				client.OnAttempt = spinner.SetServer
+			}
+
+			output := &TranslationOutput{}
+			for _, target := range targetLangs {
+				targetLang := resolveTargetVariant(toDeepLCode(target, false), config.VariantPreferences, chooseVariant)
+
+				if debug {
+					debugf("URL=%s, Source=%s, Target=%s, HasToken=%t\n", 
+						serverURL, sourceLang, targetLang, token != "")
+				}
+
+				result, _, err := client.Translate(c.Context, text, sourceLang, targetLang)
+				if err != nil && c.Bool("queue") && exitCodeFor(err) == ExitConnection {
+					spinner.Stop()
+					queued := QueuedTranslation{Time: time.Now(), Text: text, SourceLang: sourceLang, Options: translateOptions(c.Context)}
+					for _, target := range targetLangs {
+						queued.TargetLangs = append(queued.TargetLangs, resolveTargetVariant(toDeepLCode(target, false), config.VariantPreferences, false))
+					}
+					if err := enqueue(queued); err != nil {
+						return cli.Exit(fmt.Sprintf("Queue error: %s", err), 1)
+					}
+					hint("Server unreachable, queued the translation; send it with: translate queue flush\n")
+					return nil
+				}
+				if err != nil {
+					// Check if it's a connection error and provide helpful guidance
+					if strings.Contains(err.Error(), "cannot connect to DeepLX server") {
+						fmt.Fprintln(os.Stderr, redactSecrets(errorAdvice(err)))
+						hint("\n💡 First time? Run: translate setup\n")
+						return cli.Exit("", ExitConnection)
+					}
+					return translationExit(err)
+				}
+
+				// Print metadata in debug mode
+				if debug {
+					debugf("Method=%s, SourceLang=%s, ID=%d\n", 
+						result.Method, result.SourceLang, result.ID)
+				}
+
+				// Some DeepLX builds only return alternatives from specific endpoints
+				if (showAlternatives || pick > 0) && len(result.Alternatives) == 0 {
+					result.Alternatives = client.FetchAlternatives(c.Context, text, sourceLang, targetLang, alternativesEndpoints)
+				}
+				if pick > 0 {
+					if len(result.Alternatives) < pick {
+						return cli.Exit(fmt.Sprintf("Translation error: no alternative %d into %s (got %d)", pick, toBCP47(targetLang), len(result.Alternatives)), ExitFailure)
+					}
+					picked := *result
+					picked.Data, picked.Alternatives = result.Alternatives[pick-1], nil
+					result = &picked
+				}
+
+				if output.SourceLang == "" {
+					output.SourceLang = toDeepLCode(result.SourceLang, true)
+					output.SourceTag = toBCP47(output.SourceLang)
+				}
+				targetResult := newTargetResult(targetLang, result)
+				if c.Bool("stats") {
+					targetResult.Stats = newTextStats(text, result.Data)
 				}
-				return cli.Exit(fmt.Sprintf("Translation error: %s", err), 1)
+				output.Translations = append(output.Translations, targetResult)
 			}
 
-			// Print the translation
-			fmt.Println(result.Data)
+			spinner.Stop()
+			sortTargetResults(output.Translations, langSort, config.LanguageOrder)
 
-			// Print alternatives if requested
-			if showAlternatives && len(result.Alternatives) > 0 {
-				fmt.Println("\nAlternatives:")
-				for i, alt := range result.Alternatives {
-					fmt.Printf("%d. %s\n", i+1, alt)
+			var rendered bytes.Buffer
+			err := writeOutput(&rendered, output, OutputOptions{
+				Format:           outputFormat,
+				ShowAlternatives: showAlternatives,
+				WrapWidth:        wrapWidth,
+				Reflow:           reflow,
+				Terminal:         isTerminal(os.Stdout),
+				Color:            colorEnabled(os.Stdout),
+			})
+			if err != nil {
+				return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+			}
+			if err := writePaged(rendered.Bytes(), c.Bool("no-pager")); err != nil {
+				return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+			}
+			if outputFormat != OutputJSON {
+				// JSON output has the stats; the others keep stdout to the translation
+				for _, result := range output.Translations {
+					if result.Stats != nil {
+						fmt.Fprintf(os.Stderr, "Stats [%s]: %s\n", result.Tag, result.Stats)
+					}
 				}
 			}
 
-			// Print metadata in debug mode
-			if debug {
-				fmt.Fprintf(os.Stderr, "Debug: Method=%s, SourceLang=%s, ID=%d\n", 
-					result.Method, result.SourceLang, result.ID)
+			if c.Bool("copy") {
+				texts := make([]string, len(output.Translations))
+				for i, result := range output.Translations {
+					texts[i] = result.Text
+				}
+				if err := copyToClipboard(strings.Join(texts, "\n\n")); err != nil {
+					warnf("could not copy to the clipboard: %s", err)
+				}
+			}
+			if c.Bool("speak") {
+				for _, result := range output.Translations {
+					if err := speak(config, result.Text, result.TargetLang); err != nil {
+						warnf("could not read the translation aloud: %s", err)
+						break
+					}
+				}
 			}
 
 			return nil
 		},
 	}
 
-	err := app.Run(os.Args)
+	cli.VersionPrinter = printVersion
+
+	if len(os.Args) > 1 && os.Args[1] == completeCommand {
+		runComplete(app, os.Args[2:], config)
+		return
+	}
+
+	args, err := expandPreset(app, os.Args, config.Presets)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
-		os.Exit(1)
+		os.Exit(ExitUsage)
+	}
+	err = app.Run(expandAlias(app, args, config.Aliases))
+	if err != nil {
+		// Errors that aren't exits are the command line failing to parse
+		fmt.Fprintf(os.Stderr, "Error: %s\n", redactSecrets(err.Error()))
+		os.Exit(ExitUsage)
 	}
 }
 
 // translate sends a translation request to the DeepLX server
-func translate(serverURL, text, sourceLang, targetLang, token string, timeout time.Duration, debug bool) (*TranslationResponse, error) {
+func translate(serverURL, text, sourceLang, targetLang, token, authStyle string, timeout time.Duration, debug bool) (*TranslationResponse, error) {
 	// First, check if the server is reachable
 	if err := checkServerConnection(serverURL, timeout); err != nil {
 		return nil, err
 	}
 
+	conn := ProviderConn{
+		HTTPClient: &http.Client{Timeout: timeout},
+		Server:     serverURL,
+		Token:      token,
+		AuthStyle:  authStyle,
+		Debug:      debug,
+	}
+	return deepLXProvider{}.Translate(context.Background(), conn, "", text, sourceLang, targetLang)
+}
+
+// sendTranslation posts a translation request to an endpoint path of the DeepLX server
+func sendTranslation(ctx context.Context, client *http.Client, serverURL, endpoint, text, sourceLang, targetLang, token, authStyle string, debug bool) (*TranslationResponse, error) {
 	// Create request body
+	opts := translateOptions(ctx)
 	reqBody := TranslationRequest{
-		Text:       text,
-		SourceLang: sourceLang,
-		TargetLang: targetLang,
+		Text:               text,
+		SourceLang:         sourceLang,
+		TargetLang:         targetLang,
+		Formality:          opts.Formality,
+		TagHandling:        opts.TagHandling,
+		SplitSentences:     opts.SplitSentences,
+		PreserveFormatting: opts.PreserveFormatting,
+		Context:            opts.Context,
+		GlossaryID:         opts.GlossaryID,
 	}
 
 	// Convert request body to JSON
@@ -449,11 +2021,11 @@ func translate(serverURL, text, sourceLang, targetLang, token string, timeout ti
 	}
 
 	if debug {
-		fmt.Fprintf(os.Stderr, "Debug: Request body: %s\n", string(jsonData))
+		debugf("Request body: %s\n", string(jsonData))
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/translate", serverURL), bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", serverURL+endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -461,20 +2033,43 @@ func translate(serverURL, text, sourceLang, targetLang, token string, timeout ti
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, AppVersion))
+	setRequestID(ctx, req)
+	if debug && requestID(ctx) != "" {
+		debugf("Request ID: %s\n", requestID(ctx))
+	}
 	
+	// Credentials in the URL are for a reverse proxy's basic auth, which takes the
+	// Authorization header, so the token moves to the query string DeepLX also accepts
+	basicAuth := req.URL.User != nil
+	if basicAuth {
+		password, _ := req.URL.User.Password()
+		req.SetBasicAuth(req.URL.User.Username(), password)
+		req.URL.User = nil
+		if debug {
+			debugf("Using basic auth from the server URL\n")
+		}
+	}
+
 	// Add authentication if token is provided
-	if token != "" {
+	if token != "" && (authStyle == AuthQuery || basicAuth) {
+		query := req.URL.Query()
+		query.Set("token", token)
+		req.URL.RawQuery = query.Encode()
+		if debug {
+			debugf("Using token authentication (query parameter)\n")
+		}
+	} else if token != "" && authStyle == AuthDLHeader {
+		req.Header.Set("Authorization", fmt.Sprintf("DeepL-Auth-Key %s", token))
+		if debug {
+			debugf("Using token authentication (DeepL-Auth-Key header)\n")
+		}
+	} else if token != "" {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 		if debug {
-			fmt.Fprintf(os.Stderr, "Debug: Using token authentication\n")
+			debugf("Using token authentication\n")
 		}
 	} else if debug {
-		fmt.Fprintf(os.Stderr, "Debug: No token provided\n")
-	}
-
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: timeout,
+		debugf("No token provided\n")
 	}
 
 	// Send request
@@ -487,7 +2082,7 @@ func translate(serverURL, text, sourceLang, targetLang, token string, timeout ti
 It looks like DeepLX is not running. To fix this:
 
 1. Start DeepLX with Docker:
-   docker run -d -p 1188:1188 ghcr.io/owo-network/deeplx:latest
+   docker run -d -p 127.0.0.1:1188:1188 ghcr.io/owo-network/deeplx:latest
 
 2. Or use a different server:
    translate --url https://your-server.com "Hello world"
@@ -508,21 +2103,21 @@ For more info: https://github.com/OwO-Network/DeepLX`, serverURL)
 	}
 
 	if debug {
-		fmt.Fprintf(os.Stderr, "Debug: Response status: %d\n", resp.StatusCode)
-		fmt.Fprintf(os.Stderr, "Debug: Response body: %s\n", string(body))
+		debugf("Response status: %d\n", resp.StatusCode)
+		debugf("Response body: %s\n", string(body))
 	}
 
 	// Check status code and provide helpful error messages
 	if resp.StatusCode != http.StatusOK {
 		switch resp.StatusCode {
 		case http.StatusUnauthorized:
-			return nil, fmt.Errorf("authentication failed - check your token")
+			return nil, &StatusError{resp.StatusCode, "authentication failed - check your token"}
 		case http.StatusTooManyRequests:
-			return nil, fmt.Errorf("rate limit exceeded - please wait and try again")
+			return nil, &StatusError{resp.StatusCode, "rate limit exceeded - please wait and try again"}
 		case http.StatusNotFound:
-			return nil, fmt.Errorf("server endpoint not found - check your URL: %s", serverURL)
+			return nil, &StatusError{resp.StatusCode, fmt.Sprintf("server endpoint not found - check your URL: %s", serverURL)}
 		default:
-			return nil, fmt.Errorf("server returned status %d: %s", resp.StatusCode, string(body))
+			return nil, &StatusError{resp.StatusCode, fmt.Sprintf("server returned status %d: %s", resp.StatusCode, string(body))}
 		}
 	}
 
@@ -542,10 +2137,11 @@ For more info: https://github.com/OwO-Network/DeepLX`, serverURL)
 
 // checkServerConnection checks if the DeepLX server is reachable
 func checkServerConnection(serverURL string, timeout time.Duration) error {
-	client := &http.Client{
-		Timeout: timeout,
-	}
-	
+	return pingServer(&http.Client{Timeout: timeout}, serverURL)
+}
+
+// pingServer checks that the server answers on its root endpoint
+func pingServer(client *http.Client, serverURL string) error {
 	// Try to reach the root endpoint
 	resp, err := client.Get(serverURL)
 	if err != nil {
@@ -554,7 +2150,7 @@ func checkServerConnection(serverURL string, timeout time.Duration) error {
 
 No DeepLX server found. To start one:
 
-  docker run -d -p 1188:1188 ghcr.io/owo-network/deeplx:latest
+  docker run -d -p 127.0.0.1:1188:1188 ghcr.io/owo-network/deeplx:latest
 
 Or specify a different server:
 
@@ -566,76 +2162,430 @@ Or specify a different server:
 	
 	return nil
 }
-// loadConfig loads configuration from ~/.config/translate/config.json
+// loadConfig loads configuration from ~/.config/translate/config.json, or --config
 func loadConfig() Config {
 	var config Config
 	
-	configDir, err := os.UserConfigDir()
+	configPath, err := configFilePath()
 	if err != nil {
 		return config
 	}
 	
-	configPath := filepath.Join(configDir, "translate", "config.json")
-	
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return config
 	}
 	
 	json.Unmarshal(data, &config)
-	return config
+	decrypted, err := decryptConfig(config)
+	configSecretErr = err
+	if err != nil {
+		return config
+	}
+	return decrypted
 }
 
-// saveConfig saves configuration to ~/.config/translate/config.json
+// saveConfig saves configuration to ~/.config/translate/config.json, or --config
 func saveConfig(config Config) error {
-	configDir, err := os.UserConfigDir()
+	configPath, err := configFilePath()
 	if err != nil {
 		return err
 	}
 	
-	translateConfigDir := filepath.Join(configDir, "translate")
-	if err := os.MkdirAll(translateConfigDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return err
 	}
 	
-	configPath := filepath.Join(translateConfigDir, "config.json")
-	
+	config, err = encryptConfig(config)
+	if err != nil {
+		return err
+	}
 	data, err := json.MarshalIndent(config, "", "  ")
 	if err != nil {
 		return err
 	}
 	
-	return os.WriteFile(configPath, data, 0644)
+	// Written to a temporary file first so a reader never sees half of it
+	tmp := configPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, configPath)
 }
 
 // setConfig handles the config set command
 func setConfig(c *cli.Context) error {
-	config := loadConfig()
+	return updateConfig(c.Context, func(config *Config) error {
+		return setConfigFlags(c, config)
+	})
+}
+
+// setConfigFlags sets the values given to config set
+func setConfigFlags(c *cli.Context, config *Config) error {
 	
 	if url := c.String("url"); url != "" {
 		config.DefaultURL = url
-		fmt.Printf("Set default URL to: %s\n", url)
+		fmt.Printf("Set default URL to: %s\n", redactSecrets(url))
 	}
 	
 	if token := c.String("token"); token != "" {
 		config.DefaultToken = token
 		fmt.Printf("Set default token\n")
 	}
+
+	if order := c.String("language-order"); order != "" {
+		config.LanguageOrder = nil
+		for _, lang := range splitLangList(order) {
+			config.LanguageOrder = append(config.LanguageOrder, toBCP47(toDeepLCode(lang, false)))
+		}
+		fmt.Printf("Set language order to: %s\n", strings.Join(config.LanguageOrder, ", "))
+	}
+
+	if style := c.String("auth-style"); style != "" {
+		if err := checkAuthStyle(style); err != nil {
+			return err
+		}
+		config.AuthStyle = style
+		fmt.Printf("Set auth style to: %s\n", style)
+	}
+
+	if mode := c.String("language-sort"); mode != "" {
+		switch mode {
+		case LangSortInput, LangSortAlpha, LangSortConfig:
+		default:
+			return fmt.Errorf("unknown language sort %q (use input, alpha or config)", mode)
+		}
+		config.LanguageSort = mode
+		fmt.Printf("Set language sort to: %s\n", mode)
+	}
+
+	if endpoints := c.String("alternatives-endpoints"); endpoints != "" {
+		config.AlternativesEndpoints = nil
+		for _, endpoint := range strings.Split(endpoints, ",") {
+			if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+				config.AlternativesEndpoints = append(config.AlternativesEndpoints, endpoint)
+			}
+		}
+		fmt.Printf("Set alternatives endpoints to: %s\n", strings.Join(config.AlternativesEndpoints, ", "))
+	}
+
+	if variants := c.String("variants"); variants != "" {
+		if config.VariantPreferences == nil {
+			config.VariantPreferences = make(map[string]string)
+		}
+		for _, variant := range splitLangList(variants) {
+			code := toDeepLCode(variant, false)
+			base := strings.SplitN(code, "-", 2)[0]
+			if !ambiguousTargets[base] || code == base {
+				return fmt.Errorf("%s is not a regional variant of an ambiguous target (e.g., en-GB, en-US, pt-BR, pt-PT)", variant)
+			}
+			config.VariantPreferences[base] = code
+			fmt.Printf("Set preferred variant for %s to: %s\n", base, code)
+		}
+	}
+
+	for _, header := range c.StringSlice("header") {
+		name, value, err := parseHeader(header)
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			delete(config.Headers, name)
+			fmt.Printf("Removed header %s\n", name)
+			continue
+		}
+		if config.Headers == nil {
+			config.Headers = make(map[string]string)
+		}
+		config.Headers[name] = value
+		fmt.Printf("Set header %s\n", name)
+	}
+
+	if provider := c.String("provider"); provider != "" {
+		if _, err := lookupProvider(provider); err != nil {
+			return err
+		}
+		config.Provider = provider
+		fmt.Printf("Set provider to: %s\n", provider)
+	}
+
+	for _, flag := range []string{"provider-url", "provider-token"} {
+		for _, setting := range c.StringSlice(flag) {
+			name, value, ok := strings.Cut(setting, "=")
+			if !ok {
+				return fmt.Errorf("invalid %s %q (use NAME=VALUE)", flag, setting)
+			}
+			if _, err := lookupProvider(name); err != nil {
+				return err
+			}
+			if config.Providers == nil {
+				config.Providers = make(map[string]ProviderSettings)
+			}
+			settings := config.Providers[name]
+			if flag == "provider-url" {
+				settings.URL = value
+				fmt.Printf("Set %s URL to: %s\n", name, redactSecrets(value))
+			} else {
+				settings.Token = value
+				fmt.Printf("Set %s token\n", name)
+			}
+			config.Providers[name] = settings
+		}
+	}
+
+	if tokens := c.String("tokens"); tokens != "" {
+		config.Tokens = nil
+		for _, token := range strings.Split(tokens, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				config.Tokens = append(config.Tokens, token)
+			}
+		}
+		fmt.Printf("Set %d tokens\n", len(config.Tokens))
+	}
+	if rotation := c.String("token-rotation"); rotation != "" {
+		if err := checkTokenRotation(rotation); err != nil {
+			return err
+		}
+		config.TokenRotation = rotation
+		fmt.Printf("Set token rotation to: %s\n", rotation)
+	}
+	if budget := c.String("budget"); budget != "" {
+		if _, _, err := parseBudget(budget); err != nil {
+			return err
+		}
+		config.Budget = budget
+		fmt.Printf("Set budget to: %s\n", budget)
+	}
+	if action := c.String("budget-action"); action != "" {
+		if err := checkBudgetAction(action); err != nil {
+			return err
+		}
+		config.BudgetAction = action
+		fmt.Printf("Set budget action to: %s\n", action)
+	}
+	if setting := c.String("update-check"); setting != "" {
+		if err := checkUpdateCheck(setting); err != nil {
+			return err
+		}
+		config.UpdateCheck = setting
+		fmt.Printf("Set update check to: %s\n", setting)
+	}
+	if setting := c.String("history"); setting != "" {
+		if err := checkHistory(setting); err != nil {
+			return err
+		}
+		config.History = setting
+		fmt.Printf("Set history to: %s\n", setting)
+	}
+	if mode := c.String("encrypt"); mode != "" {
+		if err := setEncryption(config, mode); err != nil {
+			return err
+		}
+	}
+
+	if session := c.String("dl-session"); session != "" {
+		config.DLSession = parseSessionValue(session)
+		fmt.Printf("Set dl_session\n")
+	}
+	if command := c.String("session-refresh-command"); command != "" {
+		config.SessionRefreshCommand = command
+		fmt.Printf("Set session refresh command to: %s\n", command)
+	}
+	if annotation := c.String("merge-annotation"); annotation != "" {
+		if err := checkMergeAnnotation(annotation); err != nil {
+			return err
+		}
+		config.MergeAnnotation = annotation
+		fmt.Printf("Set merge annotation to: %s\n", annotation)
+	}
+	if command := c.String("speak-command"); command != "" {
+		config.SpeakCommand = command
+		fmt.Printf("Set speak command to: %s\n", command)
+	}
+	for _, hook := range []struct {
+		flag, name string
+		setting    *string
+	}{
+		{"pre-translate", "pre_translate", &config.PreTranslate},
+		{"post-translate", "post_translate", &config.PostTranslate},
+	} {
+		switch command := c.String(hook.flag); command {
+		case "":
+		case "none":
+			*hook.setting = ""
+			fmt.Printf("Removed the %s hook\n", hook.name)
+		default:
+			*hook.setting = command
+			fmt.Printf("Set %s hook to: %s\n", hook.name, command)
+		}
+	}
+	for _, setting := range c.StringSlice("voice") {
+		lang, voice, ok := strings.Cut(setting, "=")
+		if !ok || strings.TrimSpace(lang) == "" {
+			return fmt.Errorf("invalid voice %q (use LANG=VOICE, e.g. de=Anna)", setting)
+		}
+		code := toDeepLCode(strings.TrimSpace(lang), false)
+		voice = strings.TrimSpace(voice)
+		if voice == "" {
+			delete(config.Voices, code)
+			fmt.Printf("Removed voice for %s\n", code)
+			continue
+		}
+		if config.Voices == nil {
+			config.Voices = make(map[string]string)
+		}
+		config.Voices[code] = voice
+		fmt.Printf("Set voice for %s to: %s\n", code, voice)
+	}
 	
-	return saveConfig(config)
+	return nil
 }
 
 // showConfig handles the config show command
 func showConfig() error {
 	config := loadConfig()
+	if project != nil {
+		fmt.Printf("Project configuration (%s):\n", project.Path)
+		for _, setting := range [][2]string{{"Target", project.Target}, {"Source", project.Source}, {"Glossary", project.Glossary}, {"Ignore", strings.Join(project.Ignore, ", ")}} {
+			if setting[1] != "" {
+				fmt.Printf("  %s: %s\n", setting[0], setting[1])
+			}
+		}
+		if keys := project.settingKeys(); len(keys) > 0 {
+			fmt.Printf("  Overrides: %s\n", strings.Join(keys, ", "))
+		}
+		fmt.Println()
+	}
 	
 	fmt.Printf("Current configuration:\n")
-	fmt.Printf("  Default URL: %s\n", config.DefaultURL)
+	fmt.Printf("  Default URL: %s\n", redactSecrets(config.DefaultURL))
 	if config.DefaultToken != "" {
 		fmt.Printf("  Default Token: [configured]\n")
 	} else {
 		fmt.Printf("  Default Token: [not set]\n")
 	}
+	if len(config.LanguageOrder) > 0 {
+		fmt.Printf("  Language Order: %s\n", strings.Join(config.LanguageOrder, ", "))
+	}
+	if config.AuthStyle != "" {
+		fmt.Printf("  Auth Style: %s\n", config.AuthStyle)
+	}
+	if config.LanguageSort != "" {
+		fmt.Printf("  Language Sort: %s\n", config.LanguageSort)
+	}
+	if len(config.AlternativesEndpoints) > 0 {
+		fmt.Printf("  Alternatives Endpoints: %s\n", strings.Join(config.AlternativesEndpoints, ", "))
+	}
+	bases := make([]string, 0, len(config.VariantPreferences))
+	for base := range config.VariantPreferences {
+		bases = append(bases, base)
+	}
+	sort.Strings(bases)
+	for _, base := range bases {
+		fmt.Printf("  Preferred Variant: %s → %s\n", base, config.VariantPreferences[base])
+	}
+	names := make([]string, 0, len(config.Headers))
+	for name := range config.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  Header: %s [configured]\n", name)
+	}
+	if config.Provider != "" {
+		fmt.Printf("  Provider: %s\n", config.Provider)
+	}
+	for _, name := range providerNames() {
+		settings, ok := config.Providers[name]
+		if !ok {
+			continue
+		}
+		line := fmt.Sprintf("  Provider %s:", name)
+		if settings.URL != "" {
+			line += " " + redactSecrets(settings.URL)
+		}
+		if settings.Token != "" {
+			line += " [token configured]"
+		}
+		fmt.Println(line)
+	}
+	pairs := make([]string, 0, len(config.Pairs))
+	for pair := range config.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Strings(pairs)
+	for _, pair := range pairs {
+		settings := config.Pairs[pair]
+		line := fmt.Sprintf("  Pair %s:", pair)
+		for _, setting := range [][2]string{{"provider", settings.Provider}, {"server", redactSecrets(settings.Server)}, {"formality", settings.Formality}, {"glossary", settings.Glossary}} {
+			if setting[1] != "" {
+				line += fmt.Sprintf(" %s=%s", setting[0], setting[1])
+			}
+		}
+		if settings.Token != "" {
+			line += " [token configured]"
+		}
+		fmt.Println(line)
+	}
+	if len(config.Tokens) > 0 {
+		rotation := config.TokenRotation
+		if rotation == "" {
+			rotation = RotateOnError
+		}
+		fmt.Printf("  Tokens: %d configured (rotation: %s)\n", len(config.Tokens), rotation)
+	}
+	if config.Budget != "" {
+		action := config.BudgetAction
+		if action == "" {
+			action = BudgetStop
+		}
+		fmt.Printf("  Budget: %s (%s)\n", config.Budget, action)
+	}
+	if config.UpdateCheck != "" {
+		fmt.Printf("  Update Check: %s\n", config.UpdateCheck)
+	}
+	if config.History != "" {
+		fmt.Printf("  History: %s\n", config.History)
+	}
+	if config.Encryption != "" {
+		fmt.Printf("  Encryption: %s\n", config.Encryption)
+	}
+	if config.MergeAnnotation != "" {
+		fmt.Printf("  Merge Annotation: %s\n", config.MergeAnnotation)
+	}
+	for _, name := range glossaryNames(config) {
+		terms := 0
+		targets := make([]string, 0, len(config.Glossaries[name]))
+		for target, entries := range config.Glossaries[name] {
+			terms += len(entries)
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		fmt.Printf("  Glossary %s: %d terms (%s)\n", name, terms, strings.Join(targets, ", "))
+	}
+	if config.DLSession != "" {
+		fmt.Printf("  DL Session: [configured]\n")
+	}
+	if config.SessionRefreshCommand != "" {
+		fmt.Printf("  Session Refresh Command: %s\n", config.SessionRefreshCommand)
+	}
+	if config.SpeakCommand != "" {
+		fmt.Printf("  Speak Command: %s\n", config.SpeakCommand)
+	}
+	if config.PreTranslate != "" {
+		fmt.Printf("  Pre-translate Hook: %s\n", config.PreTranslate)
+	}
+	if config.PostTranslate != "" {
+		fmt.Printf("  Post-translate Hook: %s\n", config.PostTranslate)
+	}
+	voiceLangs := make([]string, 0, len(config.Voices))
+	for lang := range config.Voices {
+		voiceLangs = append(voiceLangs, lang)
+	}
+	sort.Strings(voiceLangs)
+	for _, lang := range voiceLangs {
+		fmt.Printf("  Voice: %s → %s\n", lang, config.Voices[lang])
+	}
 	
 	return nil
 }
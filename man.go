@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// configKeyUsage describes the keys of the configuration file for the man page
+var configKeyUsage = map[string]string{
+	"default_url":             "Server used unless --url is given",
+	"default_token":           "Token used unless --token is given",
+	"language_order":          "Preferred order of languages in multi-target output",
+	"language_sort":           "Default ordering of multi-target output: input, alpha or config",
+	"alternatives_endpoints":  "Endpoints tried in order when --alternatives gets none from /translate",
+	"variant_preferences":     "Regional variant to use for an ambiguous base language, e.g. EN: EN-GB",
+	"headers":                 "Headers sent with every request",
+	"auth_style":              "How the token is sent: bearer, query or dl-header",
+	"provider":                "Default translation engine",
+	"providers":               "Server (url) and credentials (token) of each provider",
+	"dl_session":              "DeepL Pro session for DeepLX's pro endpoint",
+	"session_refresh_command": "Command printing a new dl_session when the server reports it expired",
+	"tokens":                  "Tokens rotated over for the default server",
+	"token_rotation":          "How tokens are rotated: on-error or round-robin",
+	"budget":                  "Character budget per day or month, e.g. 50k/day or 2M/month",
+	"budget_action":           "What happens when the budget would be exceeded: warn or stop",
+	"pairs":                   "Defaults per language pair such as \"ja>en\" or \"*>de\": server, token, provider, formality and glossary",
+	"aliases":                 "Shortcut names and the arguments they stand for",
+	"presets":                 "Named sets of arguments used as @NAME, saved with preset save",
+	"update_check":            "Daily check for a newer release: on (default) or off",
+	"glossaries":              "Named sets of terms per target language (or * for any) and their translations, selected with --glossary",
+	"pre_translate":           "Shell command each text is passed through, on stdin, before it is sent; what it prints is sent instead",
+	"trusted_servers":         "Servers named by project files that the token and headers may be sent to, added when you allow one",
+	"post_translate":          "Shell command each translation is passed through, on stdin; what it prints, if anything, is output instead",
+	"speak_command":           "Shell command reading the text on stdin aloud for --speak, with $TRANSLATE_VOICE and $TRANSLATE_LANG set",
+	"voices":                  "Voice --speak uses per target language, e.g. DE: Anna",
+	"history":                 "Keeping the translations made in history.jsonl: on (default) or off",
+	"encryption":              "How the tokens and session are encrypted at rest: passphrase or machine",
+	"merge_annotation":        "Comment marking the segments --merge translated (default: machine translated), none for no comment",
+}
+
+// manEnvironment lists the environment variables read other than those of flags
+var manEnvironment = [][2]string{
+	{"DEEPLX_URL, DEEPLX_TOKEN", "Checked by doctor"},
+	{"NO_COLOR", "Disables colored output with --color auto"},
+	{"COLUMNS", "Width to wrap output at when it isn't a terminal"},
+	{"OTEL_SERVICE_NAME, OTEL_EXPORTER_OTLP_HEADERS", "Service name and headers of exported traces and OTLP metrics"},
+	{"TRACEPARENT", "Trace the spans of this invocation belong to"},
+	{"TRANSLATE_PASSPHRASE", "Passphrase of tokens encrypted with config set --encrypt passphrase"},
+	{"TRANSLATE_NO_UPDATE_CHECK", "Turns off the check for a newer release"},
+	{"XDG_CONFIG_HOME", "Where the configuration directory is, on Linux and BSD"},
+}
+
+// manFiles lists the files kept in the configuration directory
+var manFiles = [][2]string{
+	{"config.json", "Configuration, written by config set, config apply and setup (another file with --config)"},
+	{"failures.json", "Servers recently found unreachable or refusing their token"},
+	{"usage.json", "Characters sent per day, provider and server, shown by stats usage"},
+	{"update.json", "Latest release found by the update check"},
+	{"queue.jsonl", "Translations --queue put aside while the server was unreachable"},
+	{"history.jsonl", "Translations made on the command line, exported by history export"},
+	{"history.jsonl.1", "Older translations, moved aside when history.jsonl reached 10 MB"},
+	{"repl_history", "History of the repl command"},
+	{"daemon.sock", "Socket of the daemon"},
+}
+
+// roffEscape escapes text for use in a man page
+func roffEscape(text string) string {
+	text = strings.ReplaceAll(text, `\`, `\e`)
+	text = strings.ReplaceAll(text, "-", `\-`)
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = `\&` + text
+	}
+	return text
+}
+
+// roffItem writes a tagged paragraph to a man page
+func roffItem(b *strings.Builder, tag, text string) {
+	fmt.Fprintf(b, ".TP\n\\fB%s\\fP\n%s\n", roffEscape(tag), roffEscape(text))
+}
+
+// configKeyType describes the type of a configuration value
+func configKeyType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice:
+		return "list"
+	case reflect.Map:
+		return "map"
+	}
+	return t.Kind().String()
+}
+
+// flagEnvVars returns the environment variables of the flags of the app and its
+// commands, mapped to the flags they set
+func flagEnvVars(app *cli.App) map[string]string {
+	vars := make(map[string]string)
+	add := func(prefix string, flags []cli.Flag) {
+		for _, flag := range flags {
+			if docFlag, ok := flag.(cli.DocGenerationFlag); ok {
+				for _, name := range docFlag.GetEnvVars() {
+					vars[name] = prefix + "--" + flag.Names()[0]
+				}
+			}
+		}
+	}
+	add("", app.Flags)
+	var walk func(prefix string, commands []*cli.Command)
+	walk = func(prefix string, commands []*cli.Command) {
+		for _, command := range commands {
+			add(prefix+command.Name+" ", command.Flags)
+			walk(prefix+command.Name+" ", command.Subcommands)
+		}
+	}
+	walk("", app.Commands)
+	return vars
+}
+
+// manPage renders the man page of the app: the flags and commands from their definitions,
+// then the configuration keys, environment variables, exit statuses and files
+func manPage(app *cli.App) (string, error) {
+	page, err := app.ToManWithSection(1)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString(page)
+
+	b.WriteString(".SH CONFIGURATION\n")
+	fmt.Fprintf(&b, "Settings are kept as JSON in config.json (see \\fBFILES\\fP) and changed with \\fB%s config set\\fP or \\fB%s config apply\\fP. Command line flags take precedence.\n", app.Name, app.Name)
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		key := strings.Split(field.Tag.Get("json"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		usage := configKeyUsage[key]
+		if usage == "" {
+			usage = field.Name
+		}
+		roffItem(&b, key, fmt.Sprintf("%s (%s)", usage, configKeyType(field.Type)))
+	}
+
+	b.WriteString(".SH ENVIRONMENT\n")
+	vars := flagEnvVars(app)
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		roffItem(&b, name, "Sets "+vars[name])
+	}
+	for _, item := range manEnvironment {
+		roffItem(&b, item[0], item[1])
+	}
+
+	b.WriteString(".SH \"EXIT STATUS\"\n")
+	for _, item := range exitCodes {
+		roffItem(&b, item[0], item[1])
+	}
+
+	b.WriteString(".SH FILES\n")
+	b.WriteString("Files are kept in the translate directory of the user configuration directory: ~/.config/translate on Linux, ~/Library/Application Support/translate on macOS and %AppData%\\etranslate on Windows. In portable mode (\\fB\\-\\-portable\\fP, or a translate.portable file beside the executable) they are kept in translate\\-data beside the executable instead.\n")
+	for _, item := range manFiles {
+		roffItem(&b, item[0], item[1])
+	}
+	return b.String(), nil
+}
+
+// runMan handles the man command, printing the man page
+func runMan(c *cli.Context) error {
+	page, err := manPage(c.App)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Man error: %s", err), 1)
+	}
+	fmt.Print(page)
+	return nil
+}
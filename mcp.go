@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// MCPProtocolVersion is the Model Context Protocol revision implemented by the mcp command
+const MCPProtocolVersion = "2024-11-05"
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+// rpcRequest is an incoming JSON-RPC 2.0 request or notification
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is an outgoing JSON-RPC 2.0 response
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC 2.0 error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// mcpTool describes a tool offered to MCP clients
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// mcpContent is a single content block of a tool result
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpToolResult is the result of a tools/call request
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+// mcpTools lists the tools exposed by the mcp command
+var mcpTools = []mcpTool{
+	{
+		Name:        "translate_text",
+		Description: "Translate text with the configured DeepLX server. Language codes may be DeepL codes (DE, EN-GB) or BCP-47 tags (de, en-GB, pt-BR).",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"text":        map[string]string{"type": "string", "description": "Text to translate"},
+				"target_lang": map[string]string{"type": "string", "description": "Target language, e.g. EN, DE, pt-BR"},
+				"source_lang": map[string]string{"type": "string", "description": "Source language, or omit for automatic detection"},
+			},
+			"required": []string{"text", "target_lang"},
+		},
+	},
+	{
+		Name:        "detect_language",
+		Description: "Detect the language of a piece of text using the configured DeepLX server.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"text": map[string]string{"type": "string", "description": "Text whose language should be detected"},
+			},
+			"required": []string{"text"},
+		},
+	},
+}
+
+// mcpServer answers MCP requests over a line-delimited JSON-RPC stream
+type mcpServer struct {
+	client *Client
+	out    *json.Encoder
+}
+
+// runMCP handles the mcp command, serving the Model Context Protocol on stdin/stdout
+func runMCP(c *cli.Context) error {
+	client, err := newClientWith(c, clientOverrides{Retries: 1, Cache: NewCache(1000, 0)})
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("MCP error: %s", err), 1)
+	}
+	server := &mcpServer{client: client, out: json.NewEncoder(os.Stdout)}
+	return server.serve(os.Stdin)
+}
+
+// serve reads requests until EOF
+func (s *mcpServer) serve(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			s.reply(json.RawMessage("null"), nil, &rpcError{rpcParseError, fmt.Sprintf("parse error: %v", err)})
+			continue
+		}
+
+		result, rpcErr := s.handle(&req)
+
+		// Notifications carry no id and get no response
+		if len(req.ID) == 0 {
+			continue
+		}
+		s.reply(req.ID, result, rpcErr)
+	}
+	return scanner.Err()
+}
+
+// handle dispatches a single request
+func (s *mcpServer) handle(req *rpcRequest) (interface{}, *rpcError) {
+	if req.JSONRPC != "2.0" {
+		return nil, &rpcError{rpcInvalidRequest, "invalid JSON-RPC version"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": MCPProtocolVersion,
+			"capabilities": map[string]interface{}{
+				"tools": map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{
+				"name":    AppName,
+				"version": AppVersion,
+			},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": mcpTools}, nil
+	case "tools/call":
+		return s.callTool(req.Params)
+	default:
+		if strings.HasPrefix(req.Method, "notifications/") {
+			return nil, nil
+		}
+		return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+// callTool runs one of the tools in mcpTools
+func (s *mcpServer) callTool(params json.RawMessage) (interface{}, *rpcError) {
+	var call struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			Text       string `json:"text"`
+			TargetLang string `json:"target_lang"`
+			SourceLang string `json:"source_lang"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("invalid params: %v", err)}
+	}
+
+	args := call.Arguments
+	if args.Text == "" {
+		return nil, &rpcError{rpcInvalidParams, "text is required"}
+	}
+
+	sourceLang := toDeepLCode(args.SourceLang, true)
+	if sourceLang == "" {
+		sourceLang = "AUTO"
+	}
+
+	switch call.Name {
+	case "translate_text":
+		if args.TargetLang == "" {
+			return nil, &rpcError{rpcInvalidParams, "target_lang is required"}
+		}
+		resp, _, err := s.client.Translate(context.Background(), args.Text, sourceLang, toDeepLCode(args.TargetLang, false))
+		if err != nil {
+			return toolError(err), nil
+		}
+		return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: resp.Data}}}, nil
+	case "detect_language":
+		detected, offline, err := detectSource(context.Background(), s.client, args.Text, false)
+		if err != nil {
+			return toolError(err), nil
+		}
+		text := fmt.Sprintf("%s (%s)", detected, toBCP47(detected))
+		if offline {
+			text += " [offline]"
+		}
+		return &mcpToolResult{Content: []mcpContent{{Type: "text", Text: text}}}, nil
+	default:
+		return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("unknown tool: %s", call.Name)}
+	}
+}
+
+// toolError reports a failed tool call as a result, so the model can see what went wrong,
+// without the tokens and credentials the error may quote
+func toolError(err error) *mcpToolResult {
+	return &mcpToolResult{
+		Content: []mcpContent{{Type: "text", Text: redactSecrets(err.Error())}},
+		IsError: true,
+	}
+}
+
+// reply writes a response
+func (s *mcpServer) reply(id json.RawMessage, result interface{}, rpcErr *rpcError) {
+	resp := rpcResponse{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		resp.Result = result
+	}
+	s.out.Encode(resp)
+}
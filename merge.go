@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// defaultMergeAnnotation marks the segments --merge translated, for reviewers to find
+const defaultMergeAnnotation = "machine translated"
+
+// mergeMode is how a translation is merged into the target file it is written to
+type mergeMode struct {
+	// enabled keeps the translations already in the target file, translating only the gaps
+	enabled bool
+	// annotation is the comment marking the segments translated, empty for none
+	annotation string
+}
+
+// mergeModeFor returns the merge mode of the --merge and --merge-annotation flags. The
+// annotation defaults to the merge_annotation setting; none turns it off.
+func mergeModeFor(c *cli.Context) mergeMode {
+	mode := mergeMode{enabled: c.Bool("merge"), annotation: configFor(c.Context).MergeAnnotation}
+	if c.IsSet("merge-annotation") {
+		mode.annotation = c.String("merge-annotation")
+	}
+	switch mode.annotation {
+	case "":
+		if !c.IsSet("merge-annotation") {
+			mode.annotation = defaultMergeAnnotation
+		}
+	case "none":
+		mode.annotation = ""
+	}
+	return mode
+}
+
+// checkMergeAnnotation checks that an annotation fits on the comment line it is written to
+func checkMergeAnnotation(annotation string) error {
+	if strings.ContainsAny(annotation, "\r\n") || strings.Contains(annotation, "-->") {
+		return fmt.Errorf("merge annotation %q must be a single line without -->", annotation)
+	}
+	return nil
+}
+
+// existingTranslation is the translation of a segment already in the target file
+type existingTranslation struct {
+	texts []string
+	// annotated is set when the segment still has the annotation of a merge
+	annotated bool
+}
+
+// keeps reports whether the existing translation of texts is kept: one that is complete
+// and differs from the source. Empty or untranslated segments are gaps to fill.
+func (t existingTranslation) keeps(texts []string) bool {
+	if len(t.texts) != len(texts) {
+		return false
+	}
+	same := true
+	for i, text := range t.texts {
+		if text == "" {
+			return false
+		}
+		if text != texts[i] {
+			same = false
+		}
+	}
+	return !same
+}
+
+// readTarget reads the target file of a merge, returning false if there is none yet
+func readTarget(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	text, _ := splitLayout(data)
+	return text, err == nil, err
+}
+
+// canMergeLocale reports whether --merge supports a locale file: JSON and PO files, whose
+// messages have keys to find their translations by
+func canMergeLocale(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".arb", ".po", ".pot":
+		return true
+	}
+	return false
+}
+
+// existingLocaleTranslations returns the translations of a JSON or PO target file by the
+// key of their message
+func existingLocaleTranslations(path, data, annotation string) (map[string]existingTranslation, error) {
+	existing := make(map[string]existingTranslation)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".arb":
+		scanner := &jsonLocaleScanner{data: data}
+		if err := scanner.value(nil); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		for _, str := range scanner.strings {
+			existing[strings.Join(str.path, "\x00")] = existingTranslation{texts: []string{str.value}}
+		}
+	default:
+		for _, lines := range splitPOMessages(data) {
+			fields := make(map[string]string)
+			var field string
+			annotated := false
+			for _, line := range lines {
+				trimmed := strings.TrimSpace(line)
+				switch {
+				case strings.HasPrefix(trimmed, "#"):
+					if annotation != "" && trimmed == "# "+annotation {
+						annotated = true
+					}
+				case strings.HasPrefix(trimmed, `"`):
+					fields[field] += poUnquote(trimmed)
+				case trimmed != "":
+					keyword, value, _ := strings.Cut(trimmed, " ")
+					field = keyword
+					fields[field] = poUnquote(value)
+				}
+			}
+			id, ok := fields["msgid"]
+			if !ok || id == "" {
+				continue
+			}
+			translation := existingTranslation{annotated: annotated}
+			if str, ok := fields["msgstr"]; ok {
+				translation.texts = []string{str}
+			} else {
+				// The source's singular and plural take msgstr[0] and msgstr[1]
+				translation.texts = []string{fields["msgstr[0]"], fields["msgstr[1]"]}
+			}
+			existing[poKey(fields["msgctxt"], id)] = translation
+		}
+	}
+	return existing, nil
+}
+
+// mergeLocale keeps the translations of the existing target file out, returning them and
+// the entries left to translate, which get the annotation of mode
+func mergeLocale(file *localeFile, path, out string, mode mergeMode) (map[*localeEntry][]string, []*localeEntry, error) {
+	if !canMergeLocale(path) {
+		return nil, nil, fmt.Errorf("--merge supports Markdown, text, JSON and PO files")
+	}
+	translations := make(map[*localeEntry][]string)
+	data, found, err := readTarget(out)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing := make(map[string]existingTranslation)
+	if found {
+		if existing, err = existingLocaleTranslations(out, data, mode.annotation); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var todo []*localeEntry
+	for _, entry := range file.entries {
+		translation, ok := existing[entry.Key]
+		if ok && entry.Key != "" && translation.keeps(entry.Texts) {
+			translations[entry] = translation.texts
+			if translation.annotated {
+				entry.Annotation = mode.annotation
+			}
+			continue
+		}
+		entry.Annotation = mode.annotation
+		todo = append(todo, entry)
+	}
+	return translations, todo, nil
+}
+
+// markdownAnnotation returns the HTML comment annotating a Markdown paragraph
+func markdownAnnotation(annotation string) string {
+	return "<!-- " + annotation + " -->\n"
+}
+
+// mergeParagraphs pairs the paragraphs of a document with those of its existing
+// translation in order, returning the translation kept for each, or nil for those left to
+// translate. Annotations are taken off the kept ones, and whether they had one returned.
+func mergeParagraphs(segments []string, existing string, markdown bool, mode mergeMode) ([]*existingTranslation, error) {
+	var translated []string
+	if existing != "" {
+		translated = translatableSegments(splitParagraphs(existing, markdown))
+	}
+	if len(translated) > len(segments) {
+		return nil, fmt.Errorf("the translation has %d paragraphs but the source has %d; use diff to match them up", len(translated), len(segments))
+	}
+	kept := make([]*existingTranslation, len(segments))
+	for i, text := range translated {
+		translation := existingTranslation{texts: []string{text}}
+		if markdown && mode.annotation != "" {
+			if rest, ok := strings.CutPrefix(text, markdownAnnotation(mode.annotation)); ok {
+				translation = existingTranslation{texts: []string{rest}, annotated: true}
+			}
+		}
+		if translation.keeps([]string{segments[i]}) {
+			kept[i] = &translation
+		}
+	}
+	return kept, nil
+}
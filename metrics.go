@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics recorded for translation requests
+const (
+	metricRequests   = "translate.requests"
+	metricCharacters = "translate.characters"
+	metricRetries    = "translate.retries"
+	metricDuration   = "translate.duration"
+)
+
+// How often metrics are sent while running, e.g. for serve, and how much of them fits in
+// a StatsD datagram
+const (
+	metricsFlushInterval = 10 * time.Second
+	statsdMaxDatagram    = 1432
+)
+
+// metricBounds are the upper bounds in milliseconds of the request duration histogram buckets
+var metricBounds = []float64{50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+
+// metricSeries is the value of a metric for one set of tags since the last flush: a sum
+// for counters, the samples for durations
+type metricSeries struct {
+	name    string
+	tags    map[string]string
+	sum     float64
+	samples []float64
+}
+
+// Metrics collects request metrics and sends them to StatsD or an OTLP/HTTP collector,
+// every few seconds and when shut down. Counts are sent as deltas since the last flush.
+type Metrics struct {
+	endpoint string
+	statsd   bool
+	headers  map[string]string
+	service  string
+	debug    bool
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+	since  time.Time
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type metricsContextKey struct{}
+
+// NewMetrics creates a collector sending to endpoint: statsd://HOST:PORT, or the base URL
+// of an OTLP/HTTP collector. It returns nil if endpoint is empty.
+func NewMetrics(endpoint string, debug bool) (*Metrics, error) {
+	if endpoint == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metrics endpoint %q: %v", endpoint, err)
+	}
+	m := &Metrics{
+		headers: make(map[string]string),
+		service: AppName,
+		debug:   debug,
+		series:  make(map[string]*metricSeries),
+		since:   time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	switch u.Scheme {
+	case "statsd":
+		if u.Port() == "" {
+			u.Host = net.JoinHostPort(u.Hostname(), "8125")
+		}
+		m.endpoint, m.statsd = u.Host, true
+	case "http", "https":
+		m.endpoint = strings.TrimSuffix(endpoint, "/")
+		if !strings.HasSuffix(m.endpoint, "/v1/metrics") {
+			m.endpoint += "/v1/metrics"
+		}
+		if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+			m.service = name
+		}
+		for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+			if key, value, ok := strings.Cut(pair, "="); ok {
+				m.headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid metrics endpoint %q (use statsd://HOST:PORT or an OTLP/HTTP URL)", endpoint)
+	}
+	return m, nil
+}
+
+// Start begins sending metrics periodically and returns a context carrying the collector
+func (m *Metrics) Start(ctx context.Context) context.Context {
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(metricsFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.flush()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+	return context.WithValue(ctx, metricsContextKey{}, m)
+}
+
+// metricsFrom returns the collector in ctx, or nil
+func metricsFrom(ctx context.Context) *Metrics {
+	m, _ := ctx.Value(metricsContextKey{}).(*Metrics)
+	return m
+}
+
+// shutdownMetrics sends what the collector in ctx, if any, has left
+func shutdownMetrics(ctx context.Context) {
+	metricsFrom(ctx).Shutdown()
+}
+
+// Shutdown stops the periodic sending and sends the remaining metrics; later calls do nothing
+func (m *Metrics) Shutdown() {
+	if m == nil {
+		return
+	}
+	m.once.Do(func() {
+		close(m.stop)
+		<-m.done
+		m.flush()
+	})
+}
+
+// seriesFor returns the series of a metric with tags, creating it. m.mu must be held.
+func (m *Metrics) seriesFor(name string, tags map[string]string) *metricSeries {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	id := name
+	for _, key := range keys {
+		id += "\x00" + key + "=" + tags[key]
+	}
+	series, ok := m.series[id]
+	if !ok {
+		series = &metricSeries{name: name, tags: tags}
+		m.series[id] = series
+	}
+	return series
+}
+
+// Count adds value to a counter
+func (m *Metrics) Count(name string, value float64, tags map[string]string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seriesFor(name, tags).sum += value
+}
+
+// Observe records a sample of a distribution, such as a duration in milliseconds
+func (m *Metrics) Observe(name string, value float64, tags map[string]string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series := m.seriesFor(name, tags)
+	series.samples = append(series.samples, value)
+}
+
+// recordRequest records the outcome of translating a text: whether it came from the
+// cache, the characters sent, the retries it took and how long it took
+func (m *Metrics) recordRequest(provider, server string, chars, retries int, took time.Duration, cached bool, err error) {
+	if m == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	cache := "miss"
+	if cached {
+		cache = "hit"
+	}
+	m.Count(metricRequests, 1, map[string]string{"provider": provider, "server": server, "status": status, "cache": cache})
+	if cached {
+		return
+	}
+	tags := map[string]string{"provider": provider, "server": server}
+	if err == nil {
+		m.Count(metricCharacters, float64(chars), tags)
+	}
+	if retries > 0 {
+		m.Count(metricRetries, float64(retries), tags)
+	}
+	m.Observe(metricDuration, float64(took.Microseconds())/1000, tags)
+}
+
+// flush sends the metrics collected since the last flush
+func (m *Metrics) flush() {
+	m.mu.Lock()
+	series := m.series
+	since := m.since
+	m.series = make(map[string]*metricSeries)
+	m.since = time.Now()
+	m.mu.Unlock()
+	if len(series) == 0 {
+		return
+	}
+
+	var err error
+	if m.statsd {
+		err = m.sendStatsD(series)
+	} else {
+		err = m.sendOTLP(series, since)
+	}
+	if err != nil {
+		warnf("%s", redactSecrets(fmt.Sprintf("failed to send metrics to %s: %v", m.endpoint, err)))
+	} else if m.debug {
+		debugf("Sent %d metric series to %s\n", len(series), m.endpoint)
+	}
+}
+
+// sendStatsD sends the series as StatsD lines with DogStatsD tags, several to a datagram
+func (m *Metrics) sendStatsD(series map[string]*metricSeries) error {
+	conn, err := net.Dial("udp", m.endpoint)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var datagram bytes.Buffer
+	send := func() error {
+		if datagram.Len() == 0 {
+			return nil
+		}
+		_, err := conn.Write(datagram.Bytes())
+		datagram.Reset()
+		return err
+	}
+	add := func(line string) error {
+		if datagram.Len() > 0 && datagram.Len()+1+len(line) > statsdMaxDatagram {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		if datagram.Len() > 0 {
+			datagram.WriteByte('\n')
+		}
+		datagram.WriteString(line)
+		return nil
+	}
+
+	for _, s := range series {
+		var tags []string
+		for key, value := range s.tags {
+			tags = append(tags, strings.ReplaceAll(statsdEscape(key), ":", "_")+":"+statsdEscape(value))
+		}
+		sort.Strings(tags)
+		suffix := ""
+		if len(tags) > 0 {
+			suffix = "|#" + strings.Join(tags, ",")
+		}
+		if s.samples == nil {
+			if err := add(fmt.Sprintf("%s:%s|c%s", s.name, strconv.FormatFloat(s.sum, 'f', -1, 64), suffix)); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, sample := range s.samples {
+			if err := add(fmt.Sprintf("%s:%s|ms%s", s.name, strconv.FormatFloat(sample, 'f', 3, 64), suffix)); err != nil {
+				return err
+			}
+		}
+	}
+	return send()
+}
+
+// statsdEscape replaces the characters separating tags and fields in StatsD lines; a
+// colon only separates a tag's name from its value
+func statsdEscape(text string) string {
+	return strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_").Replace(redactSecrets(text))
+}
+
+// sendOTLP posts the series as OTLP/HTTP JSON: counters as delta sums, durations as histograms
+func (m *Metrics) sendOTLP(series map[string]*metricSeries, since time.Time) error {
+	start := strconv.FormatInt(since.UnixNano(), 10)
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	points := make(map[string][]map[string]interface{})
+	histograms := make(map[string]bool)
+	for _, s := range series {
+		attrs := make(map[string]interface{}, len(s.tags))
+		for key, value := range s.tags {
+			attrs[key] = value
+		}
+		point := map[string]interface{}{
+			"attributes":        otlpAttributes(attrs),
+			"startTimeUnixNano": start,
+			"timeUnixNano":      now,
+		}
+		if s.samples == nil {
+			point["asDouble"] = s.sum
+		} else {
+			histograms[s.name] = true
+			buckets := make([]int, len(metricBounds)+1)
+			sum := 0.0
+			for _, sample := range s.samples {
+				sum += sample
+				i := sort.SearchFloat64s(metricBounds, sample)
+				buckets[i]++
+			}
+			counts := make([]string, len(buckets))
+			for i, n := range buckets {
+				counts[i] = strconv.Itoa(n)
+			}
+			point["count"] = strconv.Itoa(len(s.samples))
+			point["sum"] = sum
+			point["bucketCounts"] = counts
+			point["explicitBounds"] = metricBounds
+		}
+		points[s.name] = append(points[s.name], point)
+	}
+
+	names := make([]string, 0, len(points))
+	for name := range points {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var metrics []map[string]interface{}
+	for _, name := range names {
+		metric := map[string]interface{}{"name": name}
+		// Delta temporality: each flush reports what happened since the previous one
+		if histograms[name] {
+			metric["unit"] = "ms"
+			metric["histogram"] = map[string]interface{}{"aggregationTemporality": 1, "dataPoints": points[name]}
+		} else {
+			metric["unit"] = "1"
+			metric["sum"] = map[string]interface{}{"aggregationTemporality": 1, "isMonotonic": true, "dataPoints": points[name]}
+		}
+		metrics = append(metrics, metric)
+	}
+
+	payload := map[string]interface{}{
+		"resourceMetrics": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{
+					"service.name":    m.service,
+					"service.version": AppVersion,
+				}),
+			},
+			"scopeMetrics": []interface{}{map[string]interface{}{
+				"scope":   map[string]string{"name": "github.com/juan-de-costa-rica/deeplx-cli", "version": AppVersion},
+				"metrics": metrics,
+			}},
+		}},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", m.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range m.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
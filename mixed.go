@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageRun is a passage of the input in one language
+type languageRun struct {
+	textChunk
+	// Lang is the detected base DeepL code, or "" if it couldn't be detected
+	Lang string
+}
+
+// splitLanguageRuns splits text into sentences, detects the language of each and merges
+// neighbouring sentences in the same language. Sentences too short to detect join the
+// run before them.
+func splitLanguageRuns(text string) []languageRun {
+	type run struct {
+		text string
+		lang string
+	}
+	var runs []run
+	for _, sentence := range mixedSentences(text) {
+		lang := detectLanguage(sentence)
+		if n := len(runs); n > 0 && (lang == "" || runs[n-1].lang == "" || lang == runs[n-1].lang) {
+			runs[n-1].text += sentence
+			if runs[n-1].lang == "" {
+				runs[n-1].lang = lang
+			}
+			continue
+		}
+		runs = append(runs, run{text: sentence, lang: lang})
+	}
+
+	result := make([]languageRun, len(runs))
+	for i, r := range runs {
+		trimmed := strings.TrimRightFunc(r.text, unicode.IsSpace)
+		result[i] = languageRun{textChunk: textChunk{Text: trimmed, Sep: r.text[len(trimmed):]}, Lang: r.lang}
+	}
+	return result
+}
+
+// mixedSentences splits text into sentences in any script
+func mixedSentences(text string) []string {
+	var sentences []string
+	for _, sentence := range defaultSegmenter.Segment(text) {
+		sentences = append(sentences, cjkSegmenter.Segment(sentence)...)
+	}
+	return sentences
+}
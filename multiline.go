@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// multilineTerminator is the line ending text entered with --multiline before EOF
+const multilineTerminator = "."
+
+// readMultiline reads the text of --multiline: the lines of r up to a line holding only
+// a dot, or EOF, translated as one text with their newlines
+func readMultiline(r io.Reader) (string, error) {
+	if isTerminal(os.Stdin) {
+		hint("Enter the text; end it with a line holding only %s, or Ctrl-D\n", multilineTerminator)
+	}
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == multilineTerminator {
+			break
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read the text: %v", err)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n"), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Unicode normalization forms for --normalize
+const (
+	// NormalizeNone leaves text as it is (default)
+	NormalizeNone = "none"
+	// NormalizeNFC composes characters, e.g. e and a combining acute accent into é, as
+	// in the decomposed names macOS gives files
+	NormalizeNFC = "nfc"
+	// NormalizeNFKC also replaces compatibility characters such as the ﬁ ligature and
+	// full-width letters, as OCR output often has
+	NormalizeNFKC = "nfkc"
+)
+
+// checkNormalization checks a normalization form
+func checkNormalization(form string) error {
+	switch form {
+	case "", NormalizeNone, NormalizeNFC, NormalizeNFKC:
+		return nil
+	}
+	return fmt.Errorf("unknown normalization %q (use nfc, nfkc or none)", form)
+}
+
+// normalizeText returns text in a normalization form
+func normalizeText(text, form string) string {
+	switch form {
+	case NormalizeNFC:
+		return norm.NFC.String(text)
+	case NormalizeNFKC:
+		return norm.NFKC.String(text)
+	}
+	return text
+}
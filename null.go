@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// readNullDelimited returns the NUL-separated segments of r; a NUL ending the last one,
+// as find -print0 writes, doesn't start another
+func readNullDelimited(r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\x00"), "\x00"), nil
+}
+
+// runNullDelimited handles -0: each segment, given as an argument (as xargs -0 passes
+// them) or separated by NUL bytes on stdin, is translated on its own, newlines and all,
+// and the translations are written each followed by a NUL byte, in order. With several
+// targets, each segment's translations follow each other in the order of the targets.
+func runNullDelimited(c *cli.Context) error {
+	segments := c.Args().Slice()
+	if len(segments) == 0 {
+		var err error
+		if segments, err = readNullDelimited(os.Stdin); err != nil {
+			return cli.Exit(fmt.Sprintf("Input error: %s", err), 1)
+		}
+	}
+	targets := splitLangList(c.String("target"))
+	if len(targets) == 0 {
+		return cli.Exit("Translation error: no target language given", ExitUsage)
+	}
+	config := configFor(c.Context)
+	for i, target := range targets {
+		targets[i] = resolveTargetVariant(toDeepLCode(target, false), config.VariantPreferences, false)
+	}
+	sourceLang := toDeepLCode(c.String("source"), true)
+
+	client := sharedClient(c)
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	for _, segment := range segments {
+		for _, targetLang := range targets {
+			translation := segment
+			if strings.TrimSpace(segment) != "" {
+				result, _, err := client.Translate(c.Context, segment, sourceLang, targetLang)
+				if err != nil {
+					out.Flush()
+					return translationExit(err)
+				}
+				translation = result.Data
+			}
+			out.WriteString(translation)
+			out.WriteByte(0)
+		}
+	}
+	return nil
+}
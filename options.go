@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Formality levels, as named by the DeepL API
+const (
+	FormalityDefault = "default"
+	FormalityMore    = "more"
+	FormalityLess    = "less"
+)
+
+// Tag handling modes, as named by the DeepL API
+const (
+	TagHandlingHTML = "html"
+	TagHandlingXML  = "xml"
+)
+
+// Sentence splitting modes, as named by the DeepL API
+const (
+	// SplitSentencesOff translates the text as a single sentence
+	SplitSentencesOff = "0"
+	// SplitSentencesOn splits on punctuation and newlines, the engine's default
+	SplitSentencesOn = "1"
+	// SplitSentencesNoNewlines splits on punctuation only
+	SplitSentencesNoNewlines = "nonewlines"
+)
+
+// TranslateOptions are request options providers forward to engines that support them;
+// the zero value leaves every choice to the engine
+type TranslateOptions struct {
+	// Formality is the register of the translation (FormalityMore, FormalityLess), or "" for the default
+	Formality string `json:"formality,omitempty"`
+	// TagHandling makes the engine parse the text as markup (TagHandlingHTML, TagHandlingXML)
+	// and translate only its text, or "" for plain text
+	TagHandling string `json:"tag_handling,omitempty"`
+	// SplitSentences is how the engine splits the text into sentences (SplitSentencesOff,
+	// SplitSentencesOn, SplitSentencesNoNewlines), or "" for the engine's default
+	SplitSentences string `json:"split_sentences,omitempty"`
+	// PreserveFormatting stops the engine from correcting punctuation and capitalization
+	PreserveFormatting bool `json:"preserve_formatting,omitempty"`
+	// Context describes where the text is used, e.g. a translator note for a short UI
+	// string; engines that support it take it into account without translating it
+	Context string `json:"context,omitempty"`
+	// GlossaryID is the glossary stored on the server to translate with, or "" for none
+	GlossaryID string `json:"glossary_id,omitempty"`
+	// Alternatives is how many alternatives to ask for, or 0 for the server's default.
+	// Engines without the option return their own number, cut down to it.
+	Alternatives int `json:"alternatives,omitempty"`
+}
+
+// key distinguishes cached translations made with different options; it is "" for the zero value
+func (o TranslateOptions) key() string {
+	if o == (TranslateOptions{}) {
+		return ""
+	}
+	key := fmt.Sprintf("formality=%s\x00tag_handling=%s\x00split_sentences=%s\x00preserve_formatting=%t\x00context=%s\x00glossary_id=%s",
+		o.Formality, o.TagHandling, o.SplitSentences, o.PreserveFormatting, o.Context, o.GlossaryID)
+	// Added later, so only part of the key when set to keep earlier keys valid
+	if o.Alternatives > 0 {
+		key += fmt.Sprintf("\x00alternatives=%d", o.Alternatives)
+	}
+	return key
+}
+
+// limitAlternatives cuts alternatives down to the number asked for
+func (o TranslateOptions) limitAlternatives(alternatives []string) []string {
+	if o.Alternatives > 0 && len(alternatives) > o.Alternatives {
+		return alternatives[:o.Alternatives]
+	}
+	return alternatives
+}
+
+// translateOptionsContextKey is the context key holding the TranslateOptions
+type translateOptionsContextKey struct{}
+
+// withTranslateOptions returns a context whose translation requests use opts
+func withTranslateOptions(ctx context.Context, opts TranslateOptions) context.Context {
+	return context.WithValue(ctx, translateOptionsContextKey{}, opts)
+}
+
+// translateOptions returns the options in ctx, or the zero value
+func translateOptions(ctx context.Context) TranslateOptions {
+	opts, _ := ctx.Value(translateOptionsContextKey{}).(TranslateOptions)
+	return opts
+}
+
+// parseFormality checks a formality level, returning "" for the default
+func parseFormality(formality string) (string, error) {
+	switch formality = strings.ToLower(strings.TrimSpace(formality)); formality {
+	case "", FormalityDefault:
+		return "", nil
+	case FormalityMore, FormalityLess:
+		return formality, nil
+	case "prefer_" + FormalityMore, "prefer_" + FormalityLess:
+		// The DeepL API's soft variants, accepted for compatibility
+		return strings.TrimPrefix(formality, "prefer_"), nil
+	}
+	return "", fmt.Errorf("unknown formality %q (use more, less or default)", formality)
+}
+
+// parseTagHandling checks a tag handling mode, returning "" for plain text
+func parseTagHandling(mode string) (string, error) {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "", TagHandlingHTML, TagHandlingXML:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown tag handling %q (use html or xml)", mode)
+}
+
+// parseSplitSentences checks a sentence splitting mode, returning "" for the engine's default
+func parseSplitSentences(mode string) (string, error) {
+	switch mode = strings.ToLower(strings.TrimSpace(mode)); mode {
+	case "":
+		return "", nil
+	case SplitSentencesOff, "off", "none", "false":
+		return SplitSentencesOff, nil
+	case SplitSentencesOn, "on", "all", "true":
+		return SplitSentencesOn, nil
+	case SplitSentencesNoNewlines:
+		return SplitSentencesNoNewlines, nil
+	}
+	return "", fmt.Errorf("unknown sentence splitting %q (use 0, 1 or nonewlines)", mode)
+}
+
+// optionsFromFlags builds the TranslateOptions given on the command line
+func optionsFromFlags(c *cli.Context) (TranslateOptions, error) {
+	formality, err := parseFormality(c.String("formality"))
+	if err != nil {
+		return TranslateOptions{}, err
+	}
+	tagHandling, err := parseTagHandling(c.String("tag-handling"))
+	if err != nil {
+		return TranslateOptions{}, err
+	}
+	splitSentences, err := parseSplitSentences(c.String("split-sentences"))
+	if err != nil {
+		return TranslateOptions{}, err
+	}
+	if c.Int("alternatives-count") < 0 {
+		return TranslateOptions{}, fmt.Errorf("--alternatives-count must be 0 or more")
+	}
+	return TranslateOptions{
+		Formality:          formality,
+		TagHandling:        tagHandling,
+		SplitSentences:     splitSentences,
+		PreserveFormatting: c.Bool("preserve-formatting"),
+		Context:            c.String("context"),
+		GlossaryID:         c.String("glossary-id"),
+		Alternatives:       c.Int("alternatives-count"),
+	}, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Output formats
+const (
+	OutputText   = "text"
+	OutputJSON   = "json"
+	OutputPretty = "pretty"
+	// Launcher formats list the translations and their alternatives as items to pick
+	OutputRaycast = "raycast"
+	OutputAlfred  = "alfred"
+)
+
+// SchemaVersion is the version of the JSON output of every command, reported in its
+// "schema" field. Within a version fields are only ever added, so consumers should ignore
+// fields they don't know; renaming, removing or changing the meaning of a field bumps it.
+const SchemaVersion = 1
+
+// OutputOptions controls how writeOutput renders results
+type OutputOptions struct {
+	Format           string
+	ShowAlternatives bool
+	// WrapWidth wraps text output to this many terminal columns; 0 disables wrapping
+	WrapWidth int
+	// Reflow joins the lines of each paragraph before wrapping, as for --wrap N
+	Reflow bool
+	// Terminal selects indented JSON for people; otherwise JSON is compact, one line per result
+	Terminal bool
+	// Color adds ANSI colors where the format supports them
+	Color bool
+}
+
+// TargetResult holds the translation into a single target language
+type TargetResult struct {
+	TargetLang   string   `json:"target_lang"`
+	Tag          string   `json:"tag"`
+	Text         string   `json:"text"`
+	Alternatives []string `json:"alternatives,omitempty"`
+	Method       string   `json:"method,omitempty"`
+	// Stats are the lengths of the text and translation, with --stats
+	Stats *textStats `json:"stats,omitempty"`
+}
+
+// TranslationOutput is the result of translating one input into one or more target languages
+type TranslationOutput struct {
+	Schema       int            `json:"schema"`
+	SourceLang   string         `json:"source_lang"`
+	SourceTag    string         `json:"source_tag"`
+	Translations []TargetResult `json:"translations"`
+}
+
+// newTargetResult builds a TargetResult from a server response
+func newTargetResult(targetLang string, resp *TranslationResponse) TargetResult {
+	if resp.TargetLang != "" {
+		targetLang = resp.TargetLang
+	}
+	return TargetResult{
+		TargetLang:   toDeepLCode(targetLang, false),
+		Tag:          toBCP47(targetLang),
+		Text:         resp.Data,
+		Alternatives: resp.Alternatives,
+		Method:       resp.Method,
+	}
+}
+
+// writeOutput renders translation results in the requested format
+func writeOutput(w io.Writer, out *TranslationOutput, opts OutputOptions) error {
+	showAlternatives, wrapWidth := opts.ShowAlternatives, opts.WrapWidth
+	if opts.Reflow && (opts.Format == OutputText || opts.Format == "" || opts.Format == OutputPretty) {
+		// Only the formats that wrap are reflowed; the results are copied, not changed
+		reflowed := *out
+		reflowed.Translations = make([]TargetResult, len(out.Translations))
+		for i, result := range out.Translations {
+			result.Text = reflowText(result.Text)
+			alternatives := make([]string, len(result.Alternatives))
+			for j, alternative := range result.Alternatives {
+				alternatives[j] = reflowText(alternative)
+			}
+			result.Alternatives = alternatives
+			reflowed.Translations[i] = result
+		}
+		out = &reflowed
+	}
+	switch opts.Format {
+	case OutputJSON:
+		out.Schema = SchemaVersion
+		if !showAlternatives {
+			for i := range out.Translations {
+				out.Translations[i].Alternatives = nil
+			}
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		if opts.Terminal {
+			enc.SetIndent("", "  ")
+		}
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+		data := buf.Bytes()
+		if opts.Color {
+			data = colorizeJSON(data)
+		}
+		_, err := w.Write(data)
+		return err
+	case OutputText, "":
+		multi := len(out.Translations) > 1
+		for i, result := range out.Translations {
+			if multi {
+				if i > 0 {
+					fmt.Fprintln(w)
+				}
+				fmt.Fprintln(w, paint(opts.Color, ansiCyan, fmt.Sprintf("[%s]", result.Tag)))
+			}
+			fmt.Fprintln(w, wrapText(result.Text, wrapWidth))
+
+			if showAlternatives && len(result.Alternatives) > 0 {
+				fmt.Fprintln(w, "\n"+paint(opts.Color, ansiBold, "Alternatives:"))
+				for j, alt := range result.Alternatives {
+					fmt.Fprintln(w, paint(opts.Color, ansiDim, wrapNumbered(j+1, alt, wrapWidth)))
+				}
+			}
+		}
+		return nil
+	case OutputPretty:
+		writePretty(w, out, showAlternatives, wrapWidth, opts.Color)
+		return nil
+	case OutputRaycast, OutputAlfred:
+		return writeLauncher(w, out, opts)
+	default:
+		return fmt.Errorf("unknown output format %q (use text, json, pretty, raycast or alfred)", opts.Format)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// writePaged writes output to stdout, piping it through $PAGER when stdout is a terminal
+// and the output doesn't fit on one screen, like git does
+func writePaged(output []byte, noPager bool) error {
+	if noPager || !isTerminal(os.Stdout) {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+
+	width, height := terminalSize(os.Stdout)
+	if height <= 0 || screenRows(output, width) < height {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+
+	pager, ok := os.LookupEnv("PAGER")
+	if !ok {
+		pager = "less"
+		if runtime.GOOS == "windows" {
+			pager = "more"
+		}
+	}
+	args := strings.Fields(pager)
+	if len(args) == 0 || args[0] == "cat" {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(output)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// Same defaults as git: quit if one screen, keep colors, don't clear the screen
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	if err := cmd.Run(); err != nil {
+		if _, isExit := err.(*exec.ExitError); isExit {
+			return nil
+		}
+		// The pager couldn't be started; show the output directly
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+	return nil
+}
+
+// screenRows returns how many terminal rows output takes up at the given width
+func screenRows(output []byte, width int) int {
+	rows := 0
+	for _, line := range strings.Split(strings.TrimSuffix(string(output), "\n"), "\n") {
+		rows++
+		if w := displayWidth(line); width > 0 && w > width {
+			rows += (w - 1) / width
+		}
+	}
+	return rows
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// pairWildcard in a pair stands for any language, e.g. "*>en" for everything into English
+const pairWildcard = "*"
+
+// PairSettings are the defaults for translating from one language into another, used
+// where the command line doesn't say otherwise
+type PairSettings struct {
+	Server    string `json:"server,omitempty"`
+	Token     string `json:"token,omitempty"`
+	Provider  string `json:"provider,omitempty"`
+	Formality string `json:"formality,omitempty"`
+	// Glossary is the ID of a glossary stored on the server
+	Glossary string `json:"glossary,omitempty"`
+}
+
+// parsePair splits a pair such as "ja>en" or "*>pt-BR" into its DeepL source and target
+// codes, keeping wildcards as they are
+func parsePair(pair string) (string, string, error) {
+	source, target, ok := strings.Cut(pair, ">")
+	source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+	if !ok || source == "" || target == "" {
+		return "", "", fmt.Errorf("invalid language pair %q (e.g., ja>en, *>de)", pair)
+	}
+	if source != pairWildcard {
+		source = toDeepLCode(source, true)
+	}
+	if target != pairWildcard {
+		target = toDeepLCode(target, false)
+	}
+	return source, target, nil
+}
+
+// checkPairs validates the configured pairs and their settings
+func checkPairs(pairs map[string]PairSettings) error {
+	for pair, settings := range pairs {
+		if _, _, err := parsePair(pair); err != nil {
+			return err
+		}
+		if _, err := parseFormality(settings.Formality); err != nil {
+			return fmt.Errorf("pair %s: %v", pair, err)
+		}
+		if settings.Provider != "" {
+			if _, err := lookupProvider(settings.Provider); err != nil {
+				return fmt.Errorf("pair %s: %v", pair, err)
+			}
+		}
+	}
+	return nil
+}
+
+// pairSettingsFor merges the settings of the pairs matching a translation, more specific
+// pairs taking precedence: "ja>*", then "*>en", then "ja>en". A target in a pair also
+// matches its regional variants ("*>en" matches EN-GB).
+func pairSettingsFor(pairs map[string]PairSettings, sourceLang, targetLang string) (PairSettings, []string) {
+	specificity := func(source, target string) int {
+		matches := func(want, have string) bool {
+			return want == pairWildcard || want == have || want == baseLanguage(have)
+		}
+		if !matches(source, sourceLang) || !matches(target, targetLang) {
+			return -1
+		}
+		n := 0
+		if target != pairWildcard {
+			n += 2
+		}
+		if source != pairWildcard {
+			n++
+		}
+		return n
+	}
+
+	var merged PairSettings
+	var applied []string
+	for level := 0; level <= 3; level++ {
+		for pair, settings := range pairs {
+			source, target, err := parsePair(pair)
+			if err != nil || specificity(source, target) != level {
+				continue
+			}
+			if settings.Server != "" {
+				merged.Server = settings.Server
+			}
+			if settings.Token != "" {
+				merged.Token = settings.Token
+			}
+			if settings.Provider != "" {
+				merged.Provider = settings.Provider
+			}
+			if settings.Formality != "" {
+				merged.Formality = settings.Formality
+			}
+			if settings.Glossary != "" {
+				merged.Glossary = settings.Glossary
+			}
+			applied = append(applied, pair)
+		}
+	}
+	return merged, applied
+}
+
+// pairFlags are the flags applyPairSettings set, and the pairs whose settings they came from
+var pairFlags = make(map[string]string)
+
+// applyPairSettings fills in the flags not given on the command line from the settings
+// of the language pair being translated. It only applies to a single target language.
+func applyPairSettings(c *cli.Context) error {
+	pairs := configFor(c.Context).Pairs
+	if err := checkPairs(pairs); err != nil {
+		return err
+	}
+	targets := splitLangList(c.String("target"))
+	if len(pairs) == 0 || len(targets) != 1 {
+		return nil
+	}
+	sourceLang := toDeepLCode(c.String("source"), true)
+	targetLang := toDeepLCode(targets[0], false)
+	settings, applied := pairSettingsFor(pairs, sourceLang, targetLang)
+	if len(applied) == 0 {
+		return nil
+	}
+	if c.Bool("debug") {
+		debugf("Using the settings of %s\n", strings.Join(applied, ", "))
+	}
+
+	for flag, value := range map[string]string{
+		"url":         settings.Server,
+		"token":       settings.Token,
+		"provider":    settings.Provider,
+		"formality":   settings.Formality,
+		"glossary-id": settings.Glossary,
+	} {
+		if value == "" || c.IsSet(flag) {
+			continue
+		}
+		if err := c.Set(flag, value); err != nil {
+			return err
+		}
+		pairFlags[flag] = strings.Join(applied, ", ")
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// placeholderPattern matches the placeholders of common message formats: {name} and ICU
+// {count, plural, ...} arguments, {{name}} of Mustache and i18next, ${name} of template
+// literals, and printf verbs such as %s, %1$d or %.2f
+var placeholderPattern = regexp.MustCompile(`\{\{\s*[\w.]+\s*\}\}|\$\{[\w.]+\}|\{[\w.]+\s*[,}]|%(\d+\$)?[-+#0]*\d*(\.\d+)?[sdifuxXeEgGcpq@]`)
+
+// placeholders returns the placeholders of text, in order. ICU arguments are given as
+// {name}, whatever follows their name. The messages of ICU plural and select arguments,
+// as {file} in {count, plural, one {file} other {files}}, are text to translate.
+func placeholders(text string) []string {
+	var found []string
+	messages := icuMessageStarts(text)
+	for _, loc := range placeholderPattern.FindAllStringIndex(text, -1) {
+		p := text[loc[0]:loc[1]]
+		if messages[loc[0]] {
+			continue
+		}
+		if p[0] == '{' && p[len(p)-1] == ',' {
+			p = strings.TrimRight(p[:len(p)-1], " \t") + "}"
+		}
+		found = append(found, p)
+	}
+	return found
+}
+
+// icuMessageStarts returns the offsets of the braces of text that open the message of an
+// ICU argument rather than an argument: those directly inside an argument. Arguments
+// open at the top level and inside messages.
+func icuMessageStarts(text string) map[int]bool {
+	starts := make(map[int]bool)
+	var inArgument []bool
+	for i, r := range text {
+		switch r {
+		case '{':
+			message := len(inArgument) > 0 && inArgument[len(inArgument)-1]
+			if message {
+				starts[i] = true
+			}
+			inArgument = append(inArgument, !message)
+		case '}':
+			if len(inArgument) > 0 {
+				inArgument = inArgument[:len(inArgument)-1]
+			}
+		}
+	}
+	return starts
+}
+
+// placeholderMismatch compares the placeholders of a source text and its translation,
+// returning those missing from the translation and those it has that the source hasn't
+func placeholderMismatch(source, translation string) (missing, extra []string) {
+	return tokenMismatch(placeholders(source), placeholders(translation))
+}
+
+// tokenMismatch returns the tokens of source missing from translation, and those of
+// translation source hasn't, each as many times as they are missing or extra
+func tokenMismatch(source, translation []string) (missing, extra []string) {
+	count := make(map[string]int)
+	for _, p := range source {
+		count[p]++
+	}
+	for _, p := range translation {
+		count[p]--
+	}
+	for p, n := range count {
+		for ; n > 0; n-- {
+			missing = append(missing, p)
+		}
+		for ; n < 0; n++ {
+			extra = append(extra, p)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// tagPattern matches the HTML and XML tags of a text, capturing whether they close and
+// their name; attributes, whose values may be translated, are left out
+var tagPattern = regexp.MustCompile(`<(/?)([a-zA-Z][\w:.-]*)[^<>]*?(/?)>`)
+
+// tags returns the tags of text as <name>, </name> or <name/>, in order
+func tags(text string) []string {
+	var found []string
+	for _, m := range tagPattern.FindAllStringSubmatch(text, -1) {
+		found = append(found, "<"+m[1]+strings.ToLower(m[2])+m[3]+">")
+	}
+	return found
+}
+
+// bracketPairs are the brackets whose pairs a translation must keep balanced
+var bracketPairs = [][2]rune{{'(', ')'}, {'[', ']'}, {'{', '}'}}
+
+// balanced reports whether the brackets of a pair open and close in order in text
+func balanced(text string, pair [2]rune) bool {
+	depth := 0
+	for _, r := range text {
+		switch r {
+		case pair[0]:
+			depth++
+		case pair[1]:
+			if depth--; depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// translationProblems returns what a translation lost or broke of the placeholders, tags
+// and bracket pairs of its source text
+func translationProblems(source, translation string) []string {
+	var problems []string
+	missing, extra := placeholderMismatch(source, translation)
+	missingTags, extraTags := tokenMismatch(tags(source), tags(translation))
+	missing, extra = append(missing, missingTags...), append(extra, extraTags...)
+	if len(missing) > 0 {
+		problems = append(problems, "lost "+strings.Join(missing, " "))
+	}
+	if len(extra) > 0 {
+		problems = append(problems, "added "+strings.Join(extra, " "))
+	}
+	for _, pair := range bracketPairs {
+		if balanced(source, pair) && !balanced(translation, pair) {
+			problems = append(problems, fmt.Sprintf("unbalanced %c%c", pair[0], pair[1]))
+		}
+	}
+	return problems
+}
+
+// PlaceholderError is a translation that lost or broke placeholders, tags or brackets of
+// its text, with --strict-placeholders
+type PlaceholderError struct {
+	Text     string
+	Problems []string
+}
+
+func (e *PlaceholderError) Error() string {
+	text := []rune(e.Text)
+	if len(text) > 40 {
+		text = append(text[:40], '…')
+	}
+	return fmt.Sprintf("translation of %q %s", string(text), strings.Join(e.Problems, ", "))
+}
+
+// freshContextKey marks a context whose translation must not come from the cache
+type freshContextKey struct{}
+
+// withFresh returns a context whose translation is requested again, bypassing the cache,
+// as when retrying one that broke placeholders
+func withFresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshContextKey{}, true)
+}
+
+// isFresh reports whether the translation of ctx must not come from the cache
+func isFresh(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshContextKey{}).(bool)
+	return fresh
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello {name}, you have {count} messages", []string{"{name}", "{count}"}},
+		{"{{ user.name }} and {{count}}", []string{"{{ user.name }}", "{{count}}"}},
+		{"Total: ${price.total}", []string{"${price.total}"}},
+		{"%s has %d items (%.2f%%), %1$s again, %-5s and %@", []string{"%s", "%d", "%.2f", "%1$s", "%-5s", "%@"}},
+		{"{count, plural, one {# file} other {# files}}", []string{"{count}"}},
+		{"{count , plural, one {file} other {{count} files}}", []string{"{count}", "{count}"}},
+		{"{gender, select, male {He} female {She} other {They}} said {message}", []string{"{gender}", "{message}"}},
+		{"50% off, { spaced }, {} and 100 % d", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := placeholders(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("placeholders(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTokenMismatch(t *testing.T) {
+	tests := []struct {
+		name               string
+		source, translated []string
+		missing, extra     []string
+	}{
+		{"same", []string{"{a}", "%s"}, []string{"%s", "{a}"}, nil, nil},
+		{"lost", []string{"{a}", "{b}"}, []string{"{b}"}, []string{"{a}"}, nil},
+		{"added", []string{"{a}"}, []string{"{a}", "{c}"}, nil, []string{"{c}"}},
+		{"counted", []string{"%s", "%s", "%s"}, []string{"%s", "{x}", "{x}"}, []string{"%s", "%s"}, []string{"{x}", "{x}"}},
+		{"sorted", []string{"{z}", "{a}", "{m}"}, nil, []string{"{a}", "{m}", "{z}"}, nil},
+	}
+	for _, tt := range tests {
+		missing, extra := tokenMismatch(tt.source, tt.translated)
+		if !reflect.DeepEqual(missing, tt.missing) || !reflect.DeepEqual(extra, tt.extra) {
+			t.Errorf("%s: got missing %q, extra %q; want %q, %q", tt.name, missing, extra, tt.missing, tt.extra)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{`<p class="x">Hi <B>there</B><br/></p>`, []string{"<p>", "<b>", "</b>", "<br/>", "</p>"}},
+		{`<xliff:g id="n">%d</xliff:g>`, []string{"<xliff:g>", "</xliff:g>"}},
+		{"1 < 2 and 3 > 2, <3", nil},
+	}
+	for _, tt := range tests {
+		if got := tags(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tags(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestTranslationProblems(t *testing.T) {
+	tests := []struct {
+		name                string
+		source, translation string
+		want                []string
+	}{
+		{"kept", "Hello {name} (<b>%s</b>)", "Hallo {name} (<b>%s</b>)", nil},
+		{"reordered", "{a} then {b}", "{b} dann {a}", nil},
+		{"lost and added", "Hi {name}, <b>bold</b>", "Hallo {Name}, fett", []string{"lost {name} </b> <b>", "added {Name}"}},
+		{"unbalanced", "Save (now) [x]", "Speichern (jetzt [x]", []string{"unbalanced ()"}},
+		{"unbalanced source", "a) b", "a) b", nil},
+		{"translated plural", "{n, plural, one {file} other {# files}}", "{n, plural, one {Datei} other {# Dateien}}", nil},
+		{"broken plural", "{n, plural, one {# file} other {# files}}", "{n, plural, one {# Datei} other {# Dateien}", []string{"unbalanced {}"}},
+	}
+	for _, tt := range tests {
+		if got := translationProblems(tt.source, tt.translation); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPlaceholderError(t *testing.T) {
+	err := &PlaceholderError{Text: "ééééééééééééééééééééééééééééééééééééééééé {x}", Problems: []string{"lost {x}", "unbalanced ()"}}
+	want := `translation of "éééééééééééééééééééééééééééééééééééééééé…" lost {x}, unbalanced ()`
+	if err.Error() != want {
+		t.Errorf("got %s, want %s", err, want)
+	}
+
+	if isFresh(context.Background()) || !isFresh(withFresh(context.Background())) {
+		t.Error("withFresh not reported by isFresh")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// pluginPrefix starts the name of provider plugin executables; the rest is the provider name
+const pluginPrefix = "translate-provider-"
+
+// pluginRequest is written to a plugin's stdin as a single JSON object. Method is
+// "translate", "detect" or "languages"; languages are DeepL codes, with AUTO for detection.
+type pluginRequest struct {
+	Method             string `json:"method"`
+	Text               string `json:"text,omitempty"`
+	SourceLang         string `json:"source_lang,omitempty"`
+	TargetLang         string `json:"target_lang,omitempty"`
+	Formality          string `json:"formality,omitempty"`
+	TagHandling        string `json:"tag_handling,omitempty"`
+	SplitSentences     string `json:"split_sentences,omitempty"`
+	PreserveFormatting bool   `json:"preserve_formatting,omitempty"`
+	Context            string `json:"context,omitempty"`
+	GlossaryID         string `json:"glossary_id,omitempty"`
+	Alternatives       int    `json:"alternatives,omitempty"`
+	Server             string `json:"server,omitempty"`
+	Token              string `json:"token,omitempty"`
+}
+
+// pluginResponse is read from a plugin's stdout. A non-empty Error fails the request.
+type pluginResponse struct {
+	Text         string   `json:"text"`
+	Alternatives []string `json:"alternatives,omitempty"`
+	SourceLang   string   `json:"source_lang,omitempty"`
+	Languages    []string `json:"languages,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// pluginProvider runs an external executable once per request
+type pluginProvider struct {
+	path string
+}
+
+var pluginsOnce sync.Once
+
+// discoverPlugins registers the translate-provider-* executables on PATH, without
+// replacing built-in providers or plugins found earlier on PATH
+func discoverPlugins() {
+	pluginsOnce.Do(func() {
+		for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+			matches, _ := filepath.Glob(filepath.Join(dir, pluginPrefix+"*"))
+			for _, path := range matches {
+				name := strings.TrimPrefix(filepath.Base(path), pluginPrefix)
+				if runtime.GOOS == "windows" {
+					if !strings.EqualFold(filepath.Ext(name), ".exe") {
+						continue
+					}
+					name = strings.TrimSuffix(name, filepath.Ext(name))
+				}
+				info, err := os.Stat(path)
+				if err != nil || info.IsDir() || runtime.GOOS != "windows" && info.Mode()&0111 == 0 {
+					continue
+				}
+				if _, exists := providers[name]; name != "" && !exists {
+					registerProvider(name, &pluginProvider{path: path})
+				}
+			}
+		}
+	})
+}
+
+// call runs the plugin with one request and decodes its response. The token goes
+// through stdin so it doesn't show up in the process list.
+func (p *pluginProvider) call(ctx context.Context, conn ProviderConn, req pluginRequest) (*pluginResponse, error) {
+	req.Server = conn.Server
+	req.Token = conn.Token
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	if conn.HTTPClient != nil && conn.HTTPClient.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, conn.HTTPClient.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, p.path)
+	cmd.Stdin = bytes.NewReader(data)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if conn.Debug {
+		debugf("Running provider plugin %s (%s)\n", p.path, req.Method)
+	}
+	start := time.Now()
+	err = cmd.Run()
+	if conn.Debug {
+		debugf("Provider plugin finished in %s: %s\n", time.Since(start).Round(time.Millisecond), strings.TrimSpace(stdout.String()))
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("provider plugin %s failed: %s", filepath.Base(p.path), message)
+	}
+
+	var resp pluginResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response of provider plugin %s: %v", filepath.Base(p.path), err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("translation failed: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+// Translate implements Provider; plugins have a single translation method, so endpoint is ignored
+func (p *pluginProvider) Translate(ctx context.Context, conn ProviderConn, endpoint, text, sourceLang, targetLang string) (*TranslationResponse, error) {
+	opts := translateOptions(ctx)
+	resp, err := p.call(ctx, conn, pluginRequest{
+		Method:             "translate",
+		Text:               text,
+		SourceLang:         sourceLang,
+		TargetLang:         targetLang,
+		Formality:          opts.Formality,
+		TagHandling:        opts.TagHandling,
+		SplitSentences:     opts.SplitSentences,
+		PreserveFormatting: opts.PreserveFormatting,
+		Context:            opts.Context,
+		GlossaryID:         opts.GlossaryID,
+		Alternatives:       opts.Alternatives,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TranslationResponse{
+		Code:         200,
+		Data:         resp.Text,
+		Alternatives: resp.Alternatives,
+		SourceLang:   resp.SourceLang,
+		TargetLang:   targetLang,
+	}, nil
+}
+
+// Detect implements Provider
+func (p *pluginProvider) Detect(ctx context.Context, conn ProviderConn, text string) (string, error) {
+	resp, err := p.call(ctx, conn, pluginRequest{Method: "detect", Text: text})
+	if err != nil {
+		return "", err
+	}
+	if resp.SourceLang == "" {
+		return "", fmt.Errorf("detection failed: provider plugin returned no language")
+	}
+	return toDeepLCode(resp.SourceLang, true), nil
+}
+
+// Languages implements Provider
+func (p *pluginProvider) Languages(ctx context.Context, conn ProviderConn) ([]string, error) {
+	resp, err := p.call(ctx, conn, pluginRequest{Method: "languages"})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Languages, nil
+}
+
+// runProviders handles the providers command, listing built-in providers and plugins
+func runProviders(c *cli.Context) error {
+	selected := c.String("provider")
+	for _, name := range providerNames() {
+		line := name
+		if plugin, ok := providers[name].(*pluginProvider); ok {
+			line += " (plugin: " + plugin.path + ")"
+		}
+		if name == selected {
+			line += " [selected]"
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
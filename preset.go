@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// presetPrefix marks an argument naming a preset, as in `translate @docs-de README.md`
+const presetPrefix = "@"
+
+// presetNamePattern matches the names presets can have
+var presetNamePattern = regexp.MustCompile(`^[\w.-]+$`)
+
+// expandPreset replaces an @NAME argument after the global flags with the arguments of
+// the preset it names, as expandAlias does for aliases: the preset's flags go first, so
+// flags given on the command line override them, and it may end in a command.
+func expandPreset(app *cli.App, args []string, presets map[string][]string) ([]string, error) {
+	if len(args) < 2 {
+		return args, nil
+	}
+	i := 1 + firstPositional(app, args[1:])
+	if i == len(args) {
+		return args, nil
+	}
+	name, ok := strings.CutPrefix(args[i], presetPrefix)
+	if !ok || !presetNamePattern.MatchString(name) {
+		// Text such as "@john, hi" is translated as it is
+		return args, nil
+	}
+	preset, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("no preset named %q (see translate preset list)", name)
+	}
+	j := firstPositional(app, preset)
+	expanded := append([]string{args[0]}, preset[:j]...)
+	expanded = append(expanded, args[1:i]...)
+	expanded = append(expanded, preset[j:]...)
+	return append(expanded, args[i+1:]...), nil
+}
+
+// runPresetSave handles the preset save command
+func runPresetSave(c *cli.Context) error {
+	args := c.Args().Slice()
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1], args[2:]...)
+	}
+	if len(args) < 2 {
+		return cli.Exit("Usage: translate preset save NAME [--] FLAGS... (e.g., preset save docs-de -- -t de --glossary docs)", ExitUsage)
+	}
+	name := args[0]
+	if !presetNamePattern.MatchString(name) {
+		return cli.Exit(fmt.Sprintf("Preset error: invalid preset name %q (use letters, digits, ., - and _)", name), ExitUsage)
+	}
+
+	err := updateConfig(c.Context, func(config *Config) error {
+		if config.Presets == nil {
+			config.Presets = make(map[string][]string)
+		}
+		config.Presets[name] = args[1:]
+		return nil
+	})
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Preset error: %s", err), 1)
+	}
+	fmt.Printf("Saved preset %s%s: %s\n", presetPrefix, name, quoteArgs(args[1:]))
+	return nil
+}
+
+// runPresetList handles the preset list command
+func runPresetList(c *cli.Context) error {
+	presets := configFor(c.Context).Presets
+	if len(presets) == 0 {
+		fmt.Println("No presets saved (save one with: translate preset save docs-de -- -t de --glossary docs)")
+		return nil
+	}
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s%s\t%s\n", presetPrefix, name, quoteArgs(presets[name]))
+	}
+	return nil
+}
+
+// runPresetRemove handles the preset remove command
+func runPresetRemove(c *cli.Context) error {
+	name := strings.TrimPrefix(c.Args().First(), presetPrefix)
+	err := updateConfig(c.Context, func(config *Config) error {
+		if _, ok := config.Presets[name]; !ok {
+			return fmt.Errorf("no preset named %q", name)
+		}
+		delete(config.Presets, name)
+		return nil
+	})
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Preset error: %s", err), 1)
+	}
+	fmt.Printf("Removed preset %s%s\n", presetPrefix, name)
+	return nil
+}
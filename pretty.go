@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// writePretty renders translation results in a bordered box with language labels,
+// for sharing as screenshots. The box fits in wrapWidth columns unless it is 0. With
+// color on the languages and alternatives are colored; widths are measured without it.
+func writePretty(w io.Writer, out *TranslationOutput, showAlternatives bool, wrapWidth int, color bool) {
+	// Leave room for the borders and padding
+	contentWidth := 0
+	if wrapWidth > 0 {
+		contentWidth = max(wrapWidth-4, 10)
+	}
+
+	source := out.SourceTag
+	if source == "" {
+		source = "auto"
+	}
+
+	type section struct {
+		label   string
+		painted string
+		lines   []string
+		// alternatives is the index of the blank line before the alternatives
+		alternatives int
+	}
+	var sections []section
+	for _, result := range out.Translations {
+		s := section{
+			label:   fmt.Sprintf("%s → %s", source, result.Tag),
+			painted: fmt.Sprintf("%s → %s", paint(color, ansiGreen, source), paint(color, ansiCyan, result.Tag)),
+		}
+		s.lines = append(s.lines, strings.Split(wrapText(result.Text, contentWidth), "\n")...)
+		s.alternatives = len(s.lines)
+		if showAlternatives && len(result.Alternatives) > 0 {
+			s.lines = append(s.lines, "", "Alternatives:")
+			for i, alt := range result.Alternatives {
+				s.lines = append(s.lines, strings.Split(wrapNumbered(i+1, alt, contentWidth), "\n")...)
+			}
+		}
+		sections = append(sections, s)
+	}
+
+	// The box is as wide as its widest line or label
+	width := 0
+	for _, s := range sections {
+		width = max(width, displayWidth(s.label)+2)
+		for _, line := range s.lines {
+			width = max(width, displayWidth(line))
+		}
+	}
+
+	for i, s := range sections {
+		left, right := "╭", "╮"
+		if i > 0 {
+			left, right = "├", "┤"
+		}
+		fmt.Fprintf(w, "%s─ %s %s%s\n", left, s.painted, strings.Repeat("─", width-displayWidth(s.label)-1), right)
+		for j, line := range s.lines {
+			padding := strings.Repeat(" ", width-displayWidth(line))
+			switch {
+			case j == s.alternatives+1:
+				line = paint(color, ansiBold, line)
+			case j > s.alternatives+1:
+				line = paint(color, ansiDim, line)
+			}
+			fmt.Fprintf(w, "│ %s%s │\n", line, padding)
+		}
+	}
+	fmt.Fprintf(w, "╰%s╯\n", strings.Repeat("─", width+2))
+}
+
+// displayWidth returns the number of terminal columns s occupies, counting
+// East Asian wide characters as two columns and combining marks as none
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// runeWidth returns the number of terminal columns r occupies
+func runeWidth(r rune) int {
+	switch {
+	case r == '\t':
+		return 4
+	case r < 0x20 || r == 0x7f:
+		return 0
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || r == 0x200b || r == 0x200d || r == 0xfe0f:
+		return 0
+	case isWideRune(r):
+		return 2
+	}
+	return 1
+}
+
+// isWideRune reports whether r is an East Asian wide or fullwidth character (or an emoji)
+func isWideRune(r rune) bool {
+	return r >= 0x1100 && r <= 0x115f || // Hangul Jamo
+		r >= 0x2e80 && r <= 0x303e || // CJK radicals, punctuation
+		r >= 0x3041 && r <= 0x33ff || // Hiragana, Katakana, CJK compatibility
+		r >= 0x3400 && r <= 0x4dbf || // CJK extension A
+		r >= 0x4e00 && r <= 0x9fff || // CJK unified ideographs
+		r >= 0xa000 && r <= 0xa4cf || // Yi
+		r >= 0xac00 && r <= 0xd7a3 || // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff || // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f || // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60 || // Fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6 ||
+		r >= 0x1f300 && r <= 0x1f64f || // Emoji
+		r >= 0x1f900 && r <= 0x1f9ff ||
+		r >= 0x20000 && r <= 0x3fffd // CJK extensions B and later
+}
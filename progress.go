@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressBarWidth is the width of the bar of a progress line
+const progressBarWidth = 24
+
+// Progress shows how far a run over many texts has got on stderr: a bar with the texts
+// done and failed, the throughput and the time left. Runs of unknown length show the
+// count instead of the bar and the time left.
+type Progress struct {
+	w       io.Writer
+	label   string
+	total   int
+	started time.Time
+
+	mu     sync.Mutex
+	done   int
+	failed int
+	stop   chan struct{}
+	exited chan struct{}
+}
+
+// startProgress starts a progress line for total texts (0 if unknown) on stderr if it is a
+// terminal, debug output isn't interleaved with it and not running quietly; otherwise it
+// returns nil, whose methods do nothing. Like the spinner it stays hidden for runs that
+// finish quickly.
+func startProgress(label string, total int, debug bool) *Progress {
+	if debug || quiet || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	p := &Progress{
+		w:       os.Stderr,
+		label:   label,
+		total:   total,
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		exited:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Step records a text as done, or failed with err
+func (p *Progress) Step(err error) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.done++
+	if err != nil {
+		p.failed++
+	}
+	p.mu.Unlock()
+}
+
+// Stop removes the progress line
+func (p *Progress) Stop() {
+	if p == nil {
+		return
+	}
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	<-p.exited
+}
+
+// run redraws the progress line until stopped
+func (p *Progress) run() {
+	defer close(p.exited)
+
+	timer := time.NewTimer(spinnerDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-p.stop:
+		return
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		fmt.Fprintf(p.w, "\r\x1b[K%s", p.line())
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			fmt.Fprint(p.w, "\r\x1b[K")
+			return
+		}
+	}
+}
+
+// line describes the progress so far
+func (p *Progress) line() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	elapsed := time.Since(p.started)
+	line := fmt.Sprintf("%s %d done", p.label, p.done)
+	if p.total > 0 {
+		line = fmt.Sprintf("%s %s %d/%d", p.label, progressBar(p.done, p.total, progressBarWidth), p.done, p.total)
+	}
+	if p.failed > 0 {
+		line += fmt.Sprintf(" · %d failed", p.failed)
+	}
+	line += " · " + throughput(p.done, elapsed)
+	if eta := progressETA(p.done, p.total, elapsed); eta != "" {
+		line += " · ETA " + eta
+	}
+	return line
+}
+
+// throughput describes the rate of done texts in elapsed time
+func throughput(done int, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "0.0/s"
+	}
+	return fmt.Sprintf("%.1f/s", float64(done)/elapsed.Seconds())
+}
+
+// progressETA estimates the time left from the rate so far, empty while there is nothing
+// to estimate from or the total is unknown
+func progressETA(done, total int, elapsed time.Duration) string {
+	if done == 0 || total <= done {
+		return ""
+	}
+	left := time.Duration(float64(elapsed) / float64(done) * float64(total-done))
+	return left.Round(time.Second).String()
+}
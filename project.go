@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// projectConfigNames are the names of a project's configuration file, looked for in the
+// working directory and each directory above it
+var projectConfigNames = []string{".translaterc", ".translaterc.json", ".translaterc.yaml", ".translaterc.yml"}
+
+// projectSettingKeys are the configuration settings a project file can make. A cloned
+// repository shouldn't run commands (hooks, or aliases and presets standing for flags that
+// do) or send the user's token and headers to a server it picked, so the rest can only be
+// set in the user configuration.
+var projectSettingKeys = []string{"glossaries", "language_order", "language_sort"}
+
+// projectKeys are the project's own keys, besides projectSettingKeys
+var projectKeys = []string{"target", "source", "glossary", "ignore", "server"}
+
+// ProjectConfig is a repository's .translaterc: settings merged over the user's
+// configuration for everyone working in it, and the defaults of some flags
+type ProjectConfig struct {
+	// Path is where the file was found
+	Path string `json:"-"`
+	// Target and Source are the default languages (--target, --source)
+	Target string `json:"target,omitempty"`
+	Source string `json:"source,omitempty"`
+	// Glossary names the glossaries applied by default (--glossary)
+	Glossary string `json:"glossary,omitempty"`
+	// Ignore are patterns of files dir leaves out, as in .translateignore
+	Ignore []string `json:"ignore,omitempty"`
+	// Server is the project's server, used with the user's token once they allow it
+	Server *ProjectServer `json:"server,omitempty"`
+
+	// settings are the configuration keys of the file
+	settings map[string]interface{}
+}
+
+// ProjectServer is a server a project file names for its translations
+type ProjectServer struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+}
+
+// project is the project configuration found at startup, or nil
+var project *ProjectConfig
+
+// findProjectConfig looks for a project file from dir up to the root, returning nil if
+// there is none
+func findProjectConfig(dir string) (*ProjectConfig, error) {
+	for {
+		for _, name := range projectConfigNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return readProjectConfig(path)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// readProjectConfig reads a project file, in JSON or YAML, separating the project's own
+// keys from the configuration settings
+func readProjectConfig(path string) (*ProjectConfig, error) {
+	settings, err := readDesiredConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	project := &ProjectConfig{Path: path, settings: make(map[string]interface{})}
+	own := make(map[string]interface{})
+	for key, value := range settings {
+		switch {
+		case slices.Contains(projectKeys, key):
+			own[key] = value
+		case slices.Contains(projectSettingKeys, key):
+			project.settings[key] = value
+		default:
+			return nil, fmt.Errorf("%s: %s can only be set in the user configuration (a project file can set %s)", path, key, strings.Join(append(append([]string(nil), projectKeys...), projectSettingKeys...), ", "))
+		}
+	}
+	data, err := json.Marshal(own)
+	if err == nil {
+		err = json.Unmarshal(data, project)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	if project.Server != nil {
+		if problem := checkConfigURL("server.url", project.Server.URL); problem != nil || project.Server.URL == "" {
+			return nil, fmt.Errorf("%s: server needs a url, a full http or https URL", path)
+		}
+		if u, _ := url.Parse(project.Server.URL); u.User != nil {
+			return nil, fmt.Errorf("%s: the server url can't hold credentials", path)
+		}
+	}
+	// Checked on their own so mistakes are reported against the project file
+	if _, err := project.apply(Config{}); err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// apply merges the project's settings over config. A setting replaces the user's, except
+// for mappings such as glossaries, pairs or headers, whose entries are added to the user's.
+func (p *ProjectConfig) apply(config Config) (Config, error) {
+	if p == nil || len(p.settings) == 0 {
+		return config, nil
+	}
+	result, err := decodeSettings(mergeSettings(configAsMap(config), p.settings))
+	if err != nil {
+		return config, fmt.Errorf("invalid %s: %v", p.Path, err)
+	}
+	return result, nil
+}
+
+// settingKeys returns the configuration keys the project sets, in order
+func (p *ProjectConfig) settingKeys() []string {
+	keys := make([]string, 0, len(p.settings))
+	for key := range p.settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// loadEffectiveConfig reads the user's configuration with the project's merged over it
+func loadEffectiveConfig() Config {
+	config := loadConfig()
+	if merged, err := project.apply(config); err == nil {
+		config = merged
+	}
+	return config
+}
+
+// hasCredentials reports whether anything secret would go to the server of --url: a
+// token, session, basic auth (applied to whatever server is used), headers, or the
+// tokens of providers and pairs
+func hasCredentials(c *cli.Context, config Config) bool {
+	if c.String("token") != "" || c.String("tokens") != "" || c.String("dl-session") != "" || c.String("basic-auth") != "" || len(config.Headers) > 0 {
+		return true
+	}
+	for _, settings := range config.Providers {
+		if settings.Token != "" {
+			return true
+		}
+	}
+	for _, settings := range config.Pairs {
+		if settings.Token != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyProjectServer points --url at the project's server, unless it was given. The user's
+// credentials only go to a server they allowed, asked once and remembered in
+// trusted_servers; without their answer the user's own server is kept.
+func applyProjectServer(c *cli.Context) error {
+	if project == nil || project.Server == nil || c.IsSet("url") {
+		return nil
+	}
+	server := project.Server
+	config := configFor(c.Context)
+	ownURL, _ := splitUserinfo(config.DefaultURL)
+	if hasCredentials(c, config) && server.URL != ownURL && !slices.Contains(config.TrustedServers, server.URL) {
+		name := server.URL
+		if server.Name != "" {
+			name = server.Name + " (" + server.URL + ")"
+		}
+		if !canPrompt() {
+			warnf("%s asks for server %s; not sending your credentials there without your confirmation, run translate interactively to allow it", project.Path, name)
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "%s asks for server %s. Send your credentials (token, basic auth, headers) there? [y/N] ", project.Path, name)
+		var answer string
+		fmt.Scanln(&answer)
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			hint("Keeping your own server\n")
+			return nil
+		}
+		err := updateConfig(c.Context, func(config *Config) error {
+			config.TrustedServers = append(config.TrustedServers, server.URL)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return c.Set("url", server.URL)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// nonInteractive is set by --non-interactive: nothing waits for an answer on the terminal,
+// and every question takes its safe default
+var nonInteractive bool
+
+// quiet is set by --quiet: tips, welcome text, notices and progress are left out so the
+// output is only the translation and its errors
+var quiet bool
+
+// hint prints a tip or notice for the user on stderr, unless running quietly
+func hint(format string, args ...interface{}) {
+	if !quiet {
+		fmt.Fprintf(os.Stderr, format, args...)
+	}
+}
+
+// errorAdvice returns the message of err, without the advice following its first line when
+// running quietly
+func errorAdvice(err error) string {
+	if quiet {
+		return strings.SplitN(err.Error(), "\n", 2)[0]
+	}
+	return err.Error()
+}
+
+// nonInteractiveFromArgs reports whether --non-interactive (or --yes, or --service) is
+// among the global flags or TRANSLATE_NON_INTERACTIVE is set, for what runs before the
+// flags are parsed, such as decrypting the configuration the flags' defaults come from
+func nonInteractiveFromArgs(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "non-interactive" && name != "yes" && name != "service" {
+			continue
+		}
+		if on, err := strconv.ParseBool(value); !hasValue || err == nil && on {
+			return true
+		}
+	}
+	on, _ := strconv.ParseBool(os.Getenv("TRANSLATE_NON_INTERACTIVE"))
+	return on
+}
+
+// canPrompt reports whether the user can be asked something on the terminal
+func canPrompt() bool {
+	return !nonInteractive && isTerminal(os.Stdin)
+}
+
+// ask prints a question and reads a one-word answer. Running non-interactively the
+// default answer is printed and taken instead.
+func ask(question, defaultAnswer string) string {
+	fmt.Print(question)
+	if nonInteractive {
+		fmt.Println(defaultAnswer)
+		return defaultAnswer
+	}
+	var answer string
+	fmt.Scanln(&answer)
+	return answer
+}
+
+// askSecret is ask for a secret such as a token: on a terminal the answer isn't echoed,
+// and running non-interactively the default answer is taken without being printed
+func askSecret(question, defaultAnswer string) string {
+	if nonInteractive {
+		fmt.Print(question)
+		if defaultAnswer != "" {
+			fmt.Println("[given]")
+		} else {
+			fmt.Println()
+		}
+		return defaultAnswer
+	}
+	if isTerminal(os.Stdin) {
+		fmt.Print(question)
+		answer, _ := readPassphrase("")
+		return answer
+	}
+	var answer string
+	fmt.Print(question)
+	fmt.Scanln(&answer)
+	return answer
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestNonInteractiveFromArgs(t *testing.T) {
+	t.Setenv("TRANSLATE_NON_INTERACTIVE", "")
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"-t", "de", "hello"}, false},
+		{[]string{"--yes", "--version"}, true},
+		{[]string{"-yes", "hello"}, true},
+		{[]string{"--non-interactive", "setup"}, true},
+		{[]string{"--non-interactive=true"}, true},
+		{[]string{"--non-interactive=false"}, false},
+		{[]string{"--service"}, true},
+		{[]string{"-t", "de", "--", "--yes"}, false},
+		{[]string{"yes"}, false},
+	}
+	for _, test := range tests {
+		if got := nonInteractiveFromArgs(test.args); got != test.want {
+			t.Errorf("nonInteractiveFromArgs(%q) = %t, want %t", test.args, got, test.want)
+		}
+	}
+
+	t.Setenv("TRANSLATE_NON_INTERACTIVE", "1")
+	if !nonInteractiveFromArgs(nil) {
+		t.Error("TRANSLATE_NON_INTERACTIVE=1 is ignored")
+	}
+}
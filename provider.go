@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Built-in provider names
+const (
+	ProviderDeepLX         = "deeplx"
+	ProviderDeepL          = "deepl"
+	ProviderLibreTranslate = "libretranslate"
+	// ProviderPseudo pseudo-localizes instead of translating, without a server
+	ProviderPseudo = "pseudo"
+)
+
+// Provider is a translation engine. Each call makes one request to one server; the
+// Client adds caching, retries and failover on top.
+type Provider interface {
+	// Translate translates text; endpoint is the path to post to, or "" for the default
+	Translate(ctx context.Context, conn ProviderConn, endpoint, text, sourceLang, targetLang string) (*TranslationResponse, error)
+	// Detect returns the DeepL code of the language of text
+	Detect(ctx context.Context, conn ProviderConn, text string) (string, error)
+	// Languages returns the DeepL codes of the target languages the server supports
+	Languages(ctx context.Context, conn ProviderConn) ([]string, error)
+}
+
+// ProviderConn is how a provider reaches its server
+type ProviderConn struct {
+	HTTPClient *http.Client
+	Server     string
+	Token      string
+	AuthStyle  string
+	Debug      bool
+	// Session is the DeepL Pro session DeepLX's pro endpoint translates with, if any
+	Session *Session
+}
+
+// providers holds the available providers by name
+var providers = map[string]Provider{
+	ProviderDeepLX:         deepLXProvider{},
+	ProviderDeepL:          deepLProvider{},
+	ProviderLibreTranslate: libreTranslateProvider{},
+	ProviderPseudo:         pseudoProvider{},
+}
+
+// registerProvider makes a provider selectable by name
+func registerProvider(name string, provider Provider) {
+	providers[name] = provider
+}
+
+// providerNames returns the names of the available providers, sorted
+func providerNames() []string {
+	discoverPlugins()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupProvider returns the provider registered under name
+func lookupProvider(name string) (Provider, error) {
+	discoverPlugins()
+	if provider, ok := providers[name]; ok {
+		return provider, nil
+	}
+	return nil, fmt.Errorf("unknown provider %q (available: %s)", name, strings.Join(providerNames(), ", "))
+}
+
+// ProviderSettings are the server and credentials configured for one provider
+type ProviderSettings struct {
+	URL   string `json:"url,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+// providerURL returns the server to use for a provider without a configured URL; plugins
+// need none unless they say so
+func providerURL(name, token string) string {
+	switch name {
+	case ProviderDeepL:
+		// Keys for the free API end in ":fx"
+		if strings.HasSuffix(token, ":fx") {
+			return "https://api-free.deepl.com"
+		}
+		return "https://api.deepl.com"
+	case ProviderLibreTranslate:
+		return "http://localhost:5000"
+	case ProviderDeepLX:
+		return "http://localhost:1188"
+	}
+	return ""
+}
+
+// applyProvider checks the selected provider and, unless --url or --token were given,
+// points them at the server and credentials configured for it. Other providers never
+// get the DeepLX token, which would leak it to a third party.
+func applyProvider(c *cli.Context) error {
+	name := c.String("provider")
+	if _, err := lookupProvider(name); err != nil {
+		return err
+	}
+	settings, configured := configFor(c.Context).Providers[name]
+	if name == ProviderDeepLX && !configured {
+		return nil
+	}
+
+	if !c.IsSet("token") {
+		if err := c.Set("token", settings.Token); err != nil {
+			return err
+		}
+	}
+	if !c.IsSet("url") {
+		serverURL := settings.URL
+		if serverURL == "" {
+			serverURL = providerURL(name, c.String("token"))
+		}
+		if err := c.Set("url", serverURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deepLXProvider talks to DeepLX servers
+type deepLXProvider struct{}
+
+// Translate implements Provider
+func (deepLXProvider) Translate(ctx context.Context, conn ProviderConn, endpoint, text, sourceLang, targetLang string) (*TranslationResponse, error) {
+	if conn.Session != nil {
+		return translateWithSession(ctx, conn, endpoint, text, sourceLang, targetLang)
+	}
+	if endpoint == "" {
+		endpoint = "/translate"
+	}
+	return sendTranslation(ctx, conn.HTTPClient, conn.Server, endpoint, text, sourceLang, targetLang, conn.Token, conn.AuthStyle, conn.Debug)
+}
+
+// Detect implements Provider; DeepLX has no detection endpoint, so it translates to English
+func (p deepLXProvider) Detect(ctx context.Context, conn ProviderConn, text string) (string, error) {
+	resp, err := p.Translate(ctx, conn, "", text, "AUTO", "EN")
+	if err != nil {
+		return "", err
+	}
+	return toDeepLCode(resp.SourceLang, true), nil
+}
+
+// Languages implements Provider; DeepLX can't list them, so these are DeepL's
+func (deepLXProvider) Languages(ctx context.Context, conn ProviderConn) ([]string, error) {
+	var langs []string
+	for _, code := range deepLLanguages {
+		if variants, ok := deepLVariants[code]; ok {
+			langs = append(langs, variants...)
+		}
+		langs = append(langs, code)
+	}
+	sort.Strings(langs)
+	return langs, nil
+}
+
+// deepLProvider talks to the official DeepL API
+type deepLProvider struct{}
+
+// authorize sets the DeepL API key, which always goes in the DeepL-Auth-Key header
+func (deepLProvider) authorize(req *http.Request, conn ProviderConn) {
+	if conn.Token != "" {
+		req.Header.Set("Authorization", "DeepL-Auth-Key "+conn.Token)
+	}
+}
+
+// Translate implements Provider
+func (p deepLProvider) Translate(ctx context.Context, conn ProviderConn, endpoint, text, sourceLang, targetLang string) (*TranslationResponse, error) {
+	if endpoint == "" {
+		endpoint = "/v2/translate"
+	}
+	opts := translateOptions(ctx)
+	body := deepLTranslateRequest{
+		Text:               []string{text},
+		TargetLang:         targetLang,
+		Formality:          opts.Formality,
+		TagHandling:        opts.TagHandling,
+		SplitSentences:     opts.SplitSentences,
+		PreserveFormatting: opts.PreserveFormatting,
+		Context:            opts.Context,
+		GlossaryID:         opts.GlossaryID,
+	}
+	if !strings.EqualFold(sourceLang, "auto") {
+		body.SourceLang = baseLanguage(sourceLang)
+	}
+
+	var result deepLTranslateResponse
+	if err := providerRequest(ctx, conn, http.MethodPost, endpoint, body, p.authorize, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Translations) == 0 {
+		return nil, fmt.Errorf("translation failed: no translations in response")
+	}
+	return &TranslationResponse{
+		Code:       http.StatusOK,
+		Data:       result.Translations[0].Text,
+		SourceLang: result.Translations[0].DetectedSourceLanguage,
+		TargetLang: targetLang,
+	}, nil
+}
+
+// Detect implements Provider; the DeepL API detects the source language while translating
+func (p deepLProvider) Detect(ctx context.Context, conn ProviderConn, text string) (string, error) {
+	resp, err := p.Translate(ctx, conn, "", text, "AUTO", "EN-US")
+	if err != nil {
+		return "", err
+	}
+	return toDeepLCode(resp.SourceLang, true), nil
+}
+
+// Languages implements Provider
+func (p deepLProvider) Languages(ctx context.Context, conn ProviderConn) ([]string, error) {
+	var result []struct {
+		Language string `json:"language"`
+	}
+	if err := providerRequest(ctx, conn, http.MethodGet, "/v2/languages?type=target", nil, p.authorize, &result); err != nil {
+		return nil, err
+	}
+	langs := make([]string, len(result))
+	for i, lang := range result {
+		langs[i] = strings.ToUpper(lang.Language)
+	}
+	sort.Strings(langs)
+	return langs, nil
+}
+
+// libreTranslateProvider talks to LibreTranslate servers, which use lower-case ISO codes
+// and take the API key in the request body
+type libreTranslateProvider struct{}
+
+// libreLanguage converts a DeepL code to a LibreTranslate one; regional variants are dropped
+func libreLanguage(code string) string {
+	return strings.ToLower(baseLanguage(code))
+}
+
+// Translate implements Provider
+func (libreTranslateProvider) Translate(ctx context.Context, conn ProviderConn, endpoint, text, sourceLang, targetLang string) (*TranslationResponse, error) {
+	if endpoint == "" {
+		endpoint = "/translate"
+	}
+	// LibreTranslate handles markup as HTML, which covers XML well enough
+	format := "text"
+	if translateOptions(ctx).TagHandling != "" {
+		format = "html"
+	}
+	body := map[string]string{
+		"q":      text,
+		"source": libreLanguage(sourceLang),
+		"target": libreLanguage(targetLang),
+		"format": format,
+	}
+	if conn.Token != "" {
+		body["api_key"] = conn.Token
+	}
+	if n := translateOptions(ctx).Alternatives; n > 0 {
+		body["alternatives"] = strconv.Itoa(n)
+	}
+	if opts := translateOptions(ctx); conn.Debug {
+		if opts.Formality != "" {
+			debugf("LibreTranslate has no formality option, ignoring it\n")
+		}
+		if opts.SplitSentences != "" || opts.PreserveFormatting {
+			debugf("LibreTranslate has no sentence splitting or formatting options, ignoring them\n")
+		}
+		if opts.Context != "" {
+			debugf("LibreTranslate has no context option, ignoring it\n")
+		}
+		if opts.GlossaryID != "" {
+			debugf("LibreTranslate has no glossaries, ignoring the glossary ID\n")
+		}
+	}
+
+	var result struct {
+		TranslatedText   string   `json:"translatedText"`
+		Alternatives     []string `json:"alternatives"`
+		DetectedLanguage struct {
+			Language string `json:"language"`
+		} `json:"detectedLanguage"`
+	}
+	if err := providerRequest(ctx, conn, http.MethodPost, endpoint, body, nil, &result); err != nil {
+		return nil, err
+	}
+	detected := strings.ToUpper(result.DetectedLanguage.Language)
+	if detected == "" && !strings.EqualFold(sourceLang, "auto") {
+		detected = baseLanguage(sourceLang)
+	}
+	return &TranslationResponse{
+		Code:         http.StatusOK,
+		Data:         result.TranslatedText,
+		Alternatives: result.Alternatives,
+		SourceLang:   detected,
+		TargetLang:   targetLang,
+	}, nil
+}
+
+// Detect implements Provider
+func (libreTranslateProvider) Detect(ctx context.Context, conn ProviderConn, text string) (string, error) {
+	body := map[string]string{"q": text}
+	if conn.Token != "" {
+		body["api_key"] = conn.Token
+	}
+	var result []struct {
+		Language   string  `json:"language"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := providerRequest(ctx, conn, http.MethodPost, "/detect", body, nil, &result); err != nil {
+		return "", err
+	}
+	if len(result) == 0 {
+		return "", fmt.Errorf("detection failed: no languages in response")
+	}
+	return toDeepLCode(result[0].Language, true), nil
+}
+
+// Languages implements Provider
+func (libreTranslateProvider) Languages(ctx context.Context, conn ProviderConn) ([]string, error) {
+	var result []struct {
+		Code string `json:"code"`
+	}
+	if err := providerRequest(ctx, conn, http.MethodGet, "/languages", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	langs := make([]string, len(result))
+	for i, lang := range result {
+		langs[i] = strings.ToUpper(lang.Code)
+	}
+	sort.Strings(langs)
+	return langs, nil
+}
+
+// providerRequest sends a JSON request to a path of the provider's server and decodes
+// the JSON response into out, turning error statuses into StatusErrors
+func providerRequest(ctx context.Context, conn ProviderConn, method, path string, body interface{}, authorize func(*http.Request, ProviderConn), out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %v", err)
+		}
+		if conn.Debug {
+			debugf("Request body: %s\n", string(data))
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	target, err := url.JoinPath(conn.Server, strings.SplitN(path, "?", 2)[0])
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	if _, query, ok := strings.Cut(path, "?"); ok {
+		target += "?" + query
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	data, err := providerSend(conn, req, authorize)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
+
+// providerSend sends a request built by a provider and returns the body of a successful
+// response; other statuses become a StatusError
+func providerSend(conn ProviderConn, req *http.Request, authorize func(*http.Request, ProviderConn)) ([]byte, error) {
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, AppVersion))
+	setRequestID(req.Context(), req)
+	if authorize != nil {
+		authorize(req, conn)
+	}
+
+	resp, err := conn.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	if conn.Debug {
+		debugf("Response status: %d\n", resp.StatusCode)
+		// Documents and other binary bodies would only garble the terminal
+		if contentType := resp.Header.Get("Content-Type"); contentType == "" || strings.Contains(contentType, "json") || strings.HasPrefix(contentType, "text/") {
+			debugf("Response body: %s\n", string(data))
+		} else {
+			debugf("Response body: %d bytes of %s\n", len(data), contentType)
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, &StatusError{resp.StatusCode, "authentication failed - check your token"}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return nil, &StatusError{resp.StatusCode, "rate limit exceeded - please wait and try again"}
+	case resp.StatusCode == 456:
+		return nil, &StatusError{resp.StatusCode, "quota exceeded - the character limit of your plan has been reached"}
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &StatusError{resp.StatusCode, fmt.Sprintf("server endpoint not found - check your URL: %s", conn.Server)}
+	default:
+		return nil, &StatusError{resp.StatusCode, fmt.Sprintf("server returned status %d: %s", resp.StatusCode, string(data))}
+	}
+	return data, nil
+}
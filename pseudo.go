@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// pseudoAccents are the accented letters standing in for plain ones
+var pseudoAccents = map[rune]rune{
+	'a': 'á', 'b': 'ƀ', 'c': 'ç', 'd': 'ð', 'e': 'é', 'f': 'ƒ', 'g': 'ĝ', 'h': 'ĥ', 'i': 'í',
+	'j': 'ĵ', 'k': 'ķ', 'l': 'ļ', 'm': 'ɱ', 'n': 'ñ', 'o': 'ö', 'p': 'þ', 'q': 'ǫ', 'r': 'ŕ',
+	's': 'š', 't': 'ţ', 'u': 'ü', 'v': 'ṽ', 'w': 'ŵ', 'x': 'ẋ', 'y': 'ý', 'z': 'ž',
+	'A': 'Å', 'B': 'Ɓ', 'C': 'Ç', 'D': 'Ð', 'E': 'É', 'F': 'Ƒ', 'G': 'Ĝ', 'H': 'Ĥ', 'I': 'Î',
+	'J': 'Ĵ', 'K': 'Ķ', 'L': 'Ļ', 'M': 'Ṁ', 'N': 'Ñ', 'O': 'Ö', 'P': 'Þ', 'Q': 'Ǫ', 'R': 'Ŕ',
+	'S': 'Š', 'T': 'Ţ', 'U': 'Û', 'V': 'Ṽ', 'W': 'Ŵ', 'X': 'Ẋ', 'Y': 'Ý', 'Z': 'Ž',
+}
+
+// pseudoExpansion is how much longer pseudo-localized text gets, in percent, as
+// translations from English often are
+const pseudoExpansion = 30
+
+// markupPattern matches the tags, comments and entities left as they are in markup
+var markupPattern = regexp.MustCompile(`<!--[\s\S]*?-->|<[^>]*>|&(#\d+|#x[0-9a-fA-F]+|\w+);`)
+
+// pseudoKeptPattern matches what pseudoText keeps as it is: placeholders, and tags and
+// entities even in text not handled as markup, whose --pseudo output has them kept too
+var pseudoKeptPattern = regexp.MustCompile(markupPattern.String() + "|" + placeholderPattern.String())
+
+// pseudoText pseudo-localizes a text: its letters are accented, placeholders and tags
+// kept, and it is padded and put in brackets, so that hard-coded, truncated and
+// concatenated strings stand out. Surrounding whitespace stays outside the brackets.
+func pseudoText(text string) string {
+	core := strings.TrimSpace(text)
+	if core == "" {
+		return text
+	}
+	lead := text[:strings.Index(text, core)]
+	trail := text[len(lead)+len(core):]
+
+	var b strings.Builder
+	letters, pos := 0, 0
+	accent := func(s string) {
+		for _, r := range s {
+			if unicode.IsLetter(r) {
+				letters++
+			}
+			if accented, ok := pseudoAccents[r]; ok {
+				r = accented
+			}
+			b.WriteRune(r)
+		}
+	}
+	for _, span := range pseudoKeptPattern.FindAllStringIndex(core, -1) {
+		accent(core[pos:span[0]])
+		b.WriteString(core[span[0]:span[1]])
+		pos = span[1]
+	}
+	accent(core[pos:])
+
+	padding := (letters*pseudoExpansion + 99) / 100
+	return lead + "[" + b.String() + " " + strings.Repeat("~", max(padding, 1)) + "]" + trail
+}
+
+// pseudoLocalize pseudo-localizes text; in markup, each run of text between tags is
+// pseudo-localized on its own, leaving the tags, comments and entities as they are
+func pseudoLocalize(text string, markup bool) string {
+	if !markup {
+		return pseudoText(text)
+	}
+	var b strings.Builder
+	pos := 0
+	for _, span := range markupPattern.FindAllStringIndex(text, -1) {
+		b.WriteString(pseudoText(text[pos:span[0]]))
+		b.WriteString(text[span[0]:span[1]])
+		pos = span[1]
+	}
+	b.WriteString(pseudoText(text[pos:]))
+	return b.String()
+}
+
+// pseudoProvider pseudo-localizes texts for --pseudo, so that the i18n readiness of an
+// app can be tested through the same pipelines as a real translation, without a server
+type pseudoProvider struct{}
+
+// Translate implements Provider
+func (pseudoProvider) Translate(ctx context.Context, conn ProviderConn, endpoint, text, sourceLang, targetLang string) (*TranslationResponse, error) {
+	source := sourceLang
+	if source == "" || source == "AUTO" {
+		source = "EN"
+	}
+	return &TranslationResponse{
+		Code:       200,
+		Data:       pseudoLocalize(text, translateOptions(ctx).TagHandling != ""),
+		SourceLang: source,
+		TargetLang: targetLang,
+	}, nil
+}
+
+// Detect implements Provider with the offline detector
+func (pseudoProvider) Detect(ctx context.Context, conn ProviderConn, text string) (string, error) {
+	if lang := detectLanguage(text); lang != "" {
+		return lang, nil
+	}
+	return "", fmt.Errorf("can't tell the language of the text offline")
+}
+
+// Languages implements Provider; any language can be pseudo-localized into
+func (pseudoProvider) Languages(ctx context.Context, conn ProviderConn) ([]string, error) {
+	langs := append([]string(nil), deepLLanguages...)
+	sort.Strings(langs)
+	return langs, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestPseudoLocalize(t *testing.T) {
+	tests := []struct {
+		text   string
+		markup bool
+		want   string
+	}{
+		{"Hello", false, "[Ĥéļļö ~~]"},
+		{"  Hello\n", false, "  [Ĥéļļö ~~]\n"},
+		{"", false, ""},
+		{"Hi {name}, you have %d new", false, "[Ĥí {name}, ýöü ĥáṽé %d ñéŵ ~~~~]"},
+		{"Hello <b>click</b>", false, "[Ĥéļļö <b>çļíçķ</b> ~~~]"},
+		{"Tom &amp; Jerry", false, "[Ţöɱ &amp; Ĵéŕŕý ~~~]"},
+		{"Hello <b>click</b>", true, "[Ĥéļļö ~~] <b>[çļíçķ ~~]</b>"},
+		{"<!-- note --><p>Hi</p>", true, "<!-- note --><p>[Ĥí ~]</p>"},
+	}
+	for _, test := range tests {
+		if got := pseudoLocalize(test.text, test.markup); got != test.want {
+			t.Errorf("pseudoLocalize(%q, %t) = %q, want %q", test.text, test.markup, got, test.want)
+		}
+	}
+}
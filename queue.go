@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// QueuedTranslation is a translation --queue put aside while the server was unreachable
+type QueuedTranslation struct {
+	Time        time.Time        `json:"time"`
+	Text        string           `json:"text"`
+	SourceLang  string           `json:"source_lang"`
+	TargetLangs []string         `json:"target_langs"`
+	Options     TranslateOptions `json:"options"`
+}
+
+// queuePath returns the path of the queue file
+func queuePath() (string, error) {
+	dir, err := appDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "queue.jsonl"), nil
+}
+
+// enqueue adds a translation to the queue file
+func enqueue(item QueuedTranslation) error {
+	path, err := queuePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return appendLine(path, data)
+}
+
+// loadQueue reads the queued translations, oldest first
+func loadQueue() ([]QueuedTranslation, error) {
+	path, err := queuePath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []QueuedTranslation
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var item QueuedTranslation
+		if err := json.Unmarshal(scanner.Bytes(), &item); err == nil {
+			items = append(items, item)
+		}
+	}
+	return items, scanner.Err()
+}
+
+// saveQueue replaces the queue file with items, removing it when there are none
+func saveQueue(items []QueuedTranslation) error {
+	path, err := queuePath()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	var b strings.Builder
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		b.Write(data)
+		b.WriteByte('\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runQueueList handles the queue list command
+func runQueueList(c *cli.Context) error {
+	items, err := loadQueue()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Queue error: %s", err), 1)
+	}
+	if len(items) == 0 {
+		fmt.Println("Nothing queued")
+		return nil
+	}
+	for _, item := range items {
+		text := strings.Join(strings.Fields(item.Text), " ")
+		if len([]rune(text)) > 60 {
+			text = string([]rune(text)[:59]) + "…"
+		}
+		fmt.Printf("%s  %s → %s  %s\n", item.Time.Local().Format("2006-01-02 15:04"), item.SourceLang, strings.Join(item.TargetLangs, ","), text)
+	}
+	return nil
+}
+
+// runQueueFlush handles the queue flush command, translating the queued texts in order.
+// Translations that still fail stay queued; while the server can't be reached, the rest
+// isn't tried. The translations are kept in the history like any other.
+func runQueueFlush(c *cli.Context) error {
+	items, err := loadQueue()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Queue error: %s", err), 1)
+	}
+	if len(items) == 0 {
+		hint("Nothing queued\n")
+		return nil
+	}
+
+	client := sharedClient(c)
+	var remaining []QueuedTranslation
+	var lastErr error
+	sent := 0
+	for i, item := range items {
+		if lastErr != nil && exitCodeFor(lastErr) == ExitConnection {
+			remaining = append(remaining, items[i:]...)
+			break
+		}
+
+		ctx := withTranslateOptions(c.Context, item.Options)
+		var failed []string
+		var translations []string
+		for _, targetLang := range item.TargetLangs {
+			result, _, err := client.Translate(ctx, item.Text, item.SourceLang, targetLang)
+			if err != nil {
+				lastErr = err
+				failed = append(failed, targetLang)
+				continue
+			}
+			translations = append(translations, fmt.Sprintf("[%s] %s", toBCP47(targetLang), result.Data))
+		}
+		if len(translations) > 0 {
+			sent++
+			fmt.Println(item.Text)
+			for _, translation := range translations {
+				fmt.Println(translation)
+			}
+			fmt.Println()
+		}
+		if len(failed) > 0 {
+			item.TargetLangs = failed
+			remaining = append(remaining, item)
+		}
+	}
+	if err := saveQueue(remaining); err != nil {
+		return cli.Exit(fmt.Sprintf("Queue error: %s", err), 1)
+	}
+
+	if lastErr == nil {
+		return nil
+	}
+	message := fmt.Sprintf("%d still queued: %s", len(remaining), errorAdvice(lastErr))
+	if sent == 0 {
+		return cli.Exit(fmt.Sprintf("Queue error: %s", message), exitCodeFor(lastErr))
+	}
+	return cli.Exit(fmt.Sprintf("Queue error: %s", message), ExitPartial)
+}
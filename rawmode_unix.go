@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw puts the terminal f is attached to into raw mode, so keys arrive one at a
+// time without echo, and returns a function that restores the previous mode
+func makeRaw(f *os.File) (func(), error) {
+	var saved syscall.Termios
+	if err := termiosIoctl(f, ioctlGetTermios, &saved); err != nil {
+		return nil, err
+	}
+
+	raw := saved
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := termiosIoctl(f, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { termiosIoctl(f, ioctlSetTermios, &saved) }, nil
+}
+
+// termiosIoctl gets or sets the terminal attributes of f
+func termiosIoctl(f *os.File, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
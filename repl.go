@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// runREPL handles the repl command, translating each line read from stdin. On a terminal,
+// lines are edited with history (persisted across sessions), Ctrl-R search and Tab completion.
+// Ctrl-C cancels the request in flight and returns to the prompt; at the prompt it exits.
+func runREPL(c *cli.Context) error {
+	config := configFor(c.Context)
+	targets, err := replTargets(c, config, c.String("target"))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Translation error: %s", err), ExitUsage)
+	}
+	state := &replState{
+		config:         config,
+		source:         toDeepLCode(c.String("source"), true),
+		targets:        targets,
+		alternatives:   c.Bool("alternatives"),
+		transcript:     NewTranscript(),
+		transcriptPath: c.String("transcript"),
+	}
+
+	client := sharedClient(c)
+	client.Cache = NewCache(1000, 0)
+
+	wrapWidth, reflow := wrapFromFlags(c)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	input := newREPLInput(c, interrupts)
+	if isTerminal(os.Stdin) {
+		hint("Type text to translate, :to LANGS to change the target, :save FILE to save a transcript, :help for more. Ctrl-C cancels a request, Ctrl-D or Ctrl-C at the prompt exits.\n")
+	}
+
+	for {
+		line, err := input.ReadLine(strings.ToLower(strings.Join(state.targets, ",")) + "> ")
+		if err == io.EOF || errors.Is(err, errInterrupted) {
+			return nil
+		}
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Input error: %s", err), 1)
+		}
+
+		text := strings.TrimSpace(line)
+		if text == "" {
+			continue
+		}
+		input.AddHistory(text)
+
+		if strings.HasPrefix(text, ":") {
+			if err := state.command(c, text); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			}
+			continue
+		}
+		if c.Bool("multiline") {
+			if text, err = readEntry(input, text); errors.Is(err, errInterrupted) {
+				continue
+			} else if err != nil {
+				return cli.Exit(fmt.Sprintf("Input error: %s", err), 1)
+			}
+		}
+
+		output, err := translateCancellable(c, client, interrupts, text, state.source, state.targets)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				fmt.Fprintln(os.Stderr, "Cancelled")
+			} else {
+				fmt.Fprintf(os.Stderr, "Translation error: %s\n", redactSecrets(strings.SplitN(err.Error(), "\n", 2)[0]))
+				if id := sentRequestID(c.Context); id != "" {
+					fmt.Fprintf(os.Stderr, "Request ID: %s\n", id)
+				}
+			}
+			continue
+		}
+
+		err = writeOutput(os.Stdout, output, OutputOptions{
+			Format:           OutputText,
+			ShowAlternatives: state.alternatives,
+			WrapWidth:        wrapWidth,
+			Reflow:           reflow,
+		})
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+
+		state.last = output
+		state.transcript.Add(text, output)
+		// Keep the transcript file current so the record survives a crash or closed terminal
+		if state.transcriptPath != "" {
+			if err := state.transcript.Save(state.transcriptPath); err != nil {
+				return cli.Exit(fmt.Sprintf("Transcript error: %s", err), 1)
+			}
+		}
+	}
+}
+
+// readEntry reads the rest of an entry with --multiline, whose first line is given: the
+// lines up to one holding only a dot, or EOF. Ctrl-C abandons the entry.
+func readEntry(input replInput, first string) (string, error) {
+	lines := []string{first}
+	for {
+		line, err := input.ReadLine("... ")
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) == multilineTerminator {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n"), nil
+}
+
+// replState is what REPL commands can change during a session
+type replState struct {
+	config Config
+	// source is the source language, AUTO or "" to detect it
+	source  string
+	targets []string
+	// alternatives shows the alternatives of each translation
+	alternatives bool
+	// last is the output of the last line translated
+	last       *TranslationOutput
+	transcript *Transcript
+	// transcriptPath is rewritten after each translation when --transcript is given
+	transcriptPath string
+}
+
+// replCommands are the REPL commands, with their arguments, as :help lists them
+var replCommands = []string{
+	":to LANGS",
+	":set target LANGS",
+	":set source LANG",
+	":set alternatives on|off",
+	":alts",
+	":copy",
+	":history [N]",
+	":save FILE",
+	":help",
+}
+
+// command runs a REPL command line such as ":to fr,ja" or ":save session.md"
+func (s *replState) command(c *cli.Context, line string) error {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":to":
+		targets, err := replTargets(c, s.config, arg)
+		if err != nil {
+			return err
+		}
+		s.targets = targets
+	case ":set":
+		return s.set(c, arg)
+	case ":alts":
+		if s.last == nil {
+			return errors.New("nothing translated yet")
+		}
+		found := false
+		for _, result := range s.last.Translations {
+			for i, alternative := range result.Alternatives {
+				fmt.Printf("%s %d: %s\n", result.Tag, i+1, alternative)
+				found = true
+			}
+		}
+		if !found {
+			fmt.Fprintln(os.Stderr, "The last translation has no alternatives")
+		}
+	case ":copy":
+		if s.last == nil {
+			return errors.New("nothing translated yet")
+		}
+		texts := make([]string, len(s.last.Translations))
+		for i, result := range s.last.Translations {
+			texts[i] = result.Text
+		}
+		if err := copyToClipboard(strings.Join(texts, "\n")); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Copied the last translation")
+	case ":history":
+		count := 20
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 1 {
+				return errors.New("usage: :history [N]")
+			}
+			count = n
+		}
+		entries := s.transcript.Entries
+		start := max(len(entries)-count, 0)
+		for i, entry := range entries[start:] {
+			fmt.Printf("%4d  %s\n", start+i+1, entry.Text)
+			for _, result := range entry.Output.Translations {
+				fmt.Printf("      %s: %s\n", result.Tag, result.Text)
+			}
+		}
+	case ":help":
+		for _, command := range replCommands {
+			fmt.Println(command)
+		}
+	case ":save":
+		path := arg
+		if path == "" {
+			path = s.transcriptPath
+		}
+		if path == "" {
+			return errors.New("usage: :save FILE")
+		}
+		if err := s.transcript.Save(path); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Saved %d entries to %s\n", len(s.transcript.Entries), path)
+	default:
+		return fmt.Errorf("unknown command %s (see :help)", name)
+	}
+	return nil
+}
+
+// set runs a :set command, such as "target fr,ja" or "alternatives on"; without a setting
+// it shows them all
+func (s *replState) set(c *cli.Context, arg string) error {
+	setting, value, _ := strings.Cut(arg, " ")
+	value = strings.TrimSpace(value)
+	switch setting {
+	case "":
+		source, alternatives := s.source, "off"
+		if source == "" {
+			source = "AUTO"
+		}
+		if s.alternatives {
+			alternatives = "on"
+		}
+		fmt.Printf("target %s\nsource %s\nalternatives %s\n", strings.Join(s.targets, ","), source, alternatives)
+	case "target":
+		targets, err := replTargets(c, s.config, value)
+		if err != nil {
+			return err
+		}
+		s.targets = targets
+	case "source":
+		if value == "" {
+			return errors.New("usage: :set source LANG (auto to detect it)")
+		}
+		s.source = toDeepLCode(value, true)
+	case "alternatives":
+		switch value {
+		case "on":
+			s.alternatives = true
+		case "off":
+			s.alternatives = false
+		default:
+			return errors.New("usage: :set alternatives on|off")
+		}
+	default:
+		return fmt.Errorf("unknown setting %s (target, source or alternatives)", setting)
+	}
+	return nil
+}
+
+// replTargets resolves a comma-separated list of target languages for the REPL
+func replTargets(c *cli.Context, config Config, langs string) ([]string, error) {
+	targets := splitLangList(langs)
+	if len(targets) == 0 {
+		return nil, errors.New("no target language given")
+	}
+	for i, target := range targets {
+		targets[i] = resolveTargetVariant(toDeepLCode(target, false), config.VariantPreferences, c.Bool("choose-variant"))
+	}
+	return targets, nil
+}
+
+// replInput reads REPL lines
+type replInput interface {
+	// ReadLine shows prompt and returns the next line, io.EOF at the end of input or
+	// errInterrupted on Ctrl-C
+	ReadLine(prompt string) (string, error)
+	// AddHistory records a line entered
+	AddHistory(line string)
+}
+
+// newREPLInput returns a line editor when stdin and stdout are a terminal that supports
+// raw mode, and plain line reading otherwise
+func newREPLInput(c *cli.Context, interrupts <-chan os.Signal) replInput {
+	if isTerminal(os.Stdin) && isTerminal(os.Stdout) {
+		if restore, err := makeRaw(os.Stdin); err == nil {
+			restore()
+
+			historyPath := ""
+			if !c.Bool("no-history") {
+				historyPath, _ = replHistoryPath()
+			}
+			editor := newLineEditor(os.Stdin, os.Stdout, historyPath)
+			editor.complete = replCompletions(editor)
+			return editor
+		}
+	}
+
+	// Read lines in the background so Ctrl-C can be noticed at the prompt
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	return &scannerInput{lines: lines, interrupts: interrupts, interactive: isTerminal(os.Stdin)}
+}
+
+// scannerInput reads lines without editing, for piped input and terminals without raw mode
+type scannerInput struct {
+	lines       <-chan string
+	interrupts  <-chan os.Signal
+	interactive bool
+}
+
+// ReadLine implements replInput
+func (s *scannerInput) ReadLine(prompt string) (string, error) {
+	if s.interactive {
+		fmt.Print(prompt)
+	}
+	select {
+	case line, ok := <-s.lines:
+		if !ok {
+			if s.interactive {
+				fmt.Println()
+			}
+			return "", io.EOF
+		}
+		return line, nil
+	case <-s.interrupts:
+		fmt.Println()
+		return "", errInterrupted
+	}
+}
+
+// AddHistory implements replInput; piped input has no history
+func (s *scannerInput) AddHistory(line string) {}
+
+// translateCancellable translates text into each target, showing a spinner and
+// aborting the requests if an interrupt arrives
+func translateCancellable(c *cli.Context, client *Client, interrupts <-chan os.Signal, text, sourceLang string, targets []string) (*TranslationOutput, error) {
+	// Ignore a Ctrl-C pressed while no request was running
+	select {
+	case <-interrupts:
+	default:
+	}
+
+	ctx, cancel := context.WithCancel(c.Context)
+	defer cancel()
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-finished:
+		}
+	}()
+
+	spinner := startSpinner(spinnerLabel(targets), c.Bool("debug"))
+	defer spinner.Stop()
+	client.OnAttempt = spinner.SetServer
+
+	output := &TranslationOutput{}
+	for _, targetLang := range targets {
+		result, _, err := client.Translate(ctx, text, sourceLang, targetLang)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if output.SourceLang == "" {
+			output.SourceLang = toDeepLCode(result.SourceLang, true)
+			output.SourceTag = toBCP47(output.SourceLang)
+		}
+		output.Translations = append(output.Translations, newTargetResult(targetLang, result))
+	}
+	return output, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// requestIDHeader carries the correlation ID of a request to the server
+const requestIDHeader = "X-Request-ID"
+
+// requestInfo is the correlation ID of an invocation and whether any request used it
+type requestInfo struct {
+	id   string
+	sent atomic.Bool
+}
+
+// requestIDContextKey is the context key holding the requestInfo
+type requestIDContextKey struct{}
+
+// withRequestID returns a context carrying the correlation ID id, or a new one if id is empty
+func withRequestID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		id = newRequestID()
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, &requestInfo{id: id})
+}
+
+// newRequestID returns a random UUIDv4
+func newRequestID() string {
+	b := []byte(randomHex(16))
+	// Version 4, variant 10
+	b[12] = '4'
+	b[16] = "89ab"[b[16]%4]
+	return string(b[0:8]) + "-" + string(b[8:12]) + "-" + string(b[12:16]) + "-" + string(b[16:20]) + "-" + string(b[20:32])
+}
+
+// requestID returns the correlation ID in ctx, or ""
+func requestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestIDContextKey{}).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// sentRequestID returns the correlation ID in ctx if a request was sent with it, or ""
+func sentRequestID(ctx context.Context) string {
+	if info, ok := ctx.Value(requestIDContextKey{}).(*requestInfo); ok && info.sent.Load() {
+		return info.id
+	}
+	return ""
+}
+
+// setRequestID adds the correlation ID in ctx to an outgoing request
+func setRequestID(ctx context.Context, req *http.Request) {
+	if info, ok := ctx.Value(requestIDContextKey{}).(*requestInfo); ok {
+		req.Header.Set(requestIDHeader, info.id)
+		info.sent.Store(true)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// matchSegments pairs the segments of a new revision with the unchanged segments of the
+// old one, along their longest common subsequence. It returns, for each new segment, the
+// index of the old segment it is, or -1 if it is new or changed.
+func matchSegments(old, new []string) []int {
+	// lcs[i][j] is the length of the longest common subsequence of old[i:] and new[j:]
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	matches := make([]int, len(new))
+	for j := range matches {
+		matches[j] = -1
+	}
+	for i, j := 0, 0; i < len(old) && j < len(new); {
+		switch {
+		case old[i] == new[j]:
+			matches[j] = i
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return matches
+}
+
+// translatableSegments returns the texts of the parts to translate
+func translatableSegments(parts []dirPart) []string {
+	var segments []string
+	for _, part := range parts {
+		if part.translate {
+			segments = append(segments, part.text)
+		}
+	}
+	return segments
+}
+
+// gitRevision returns the contents of path at a git revision
+func gitRevision(rev, path string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "show", rev+":./"+filepath.ToSlash(filepath.Base(path)))
+	cmd.Dir = filepath.Dir(path)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git show %s:%s: %s", rev, path, message)
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// runDiff handles the diff command: the paragraphs of a document that are unchanged since
+// the revision its translation was made from keep their translation, and only the new and
+// changed ones are translated, spliced in where they belong
+func runDiff(c *cli.Context) error {
+	var oldText, newPath, translatedPath string
+	if c.Bool("changed-only") {
+		if c.NArg() != 2 {
+			return cli.Exit("Usage: translate -t LANG diff --changed-only [--rev REV] FILE TRANSLATED", ExitUsage)
+		}
+		newPath, translatedPath = c.Args().Get(0), c.Args().Get(1)
+		old, err := gitRevision(c.String("rev"), newPath)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Diff error: %s", err), 1)
+		}
+		oldText = old
+	} else {
+		if c.NArg() != 3 {
+			return cli.Exit("Usage: translate -t LANG diff OLD NEW TRANSLATED_OLD", ExitUsage)
+		}
+		data, err := os.ReadFile(c.Args().Get(0))
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+		}
+		oldText, _ = splitLayout(data)
+		newPath, translatedPath = c.Args().Get(1), c.Args().Get(2)
+	}
+	newData, err := os.ReadFile(newPath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+	translatedData, err := os.ReadFile(translatedPath)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+
+	targets := splitLangList(c.String("target"))
+	if len(targets) != 1 {
+		return cli.Exit("Diff error: the translation is in one language; give a single --target", ExitUsage)
+	}
+	config := configFor(c.Context)
+	targetLang := resolveTargetVariant(toDeepLCode(targets[0], false), config.VariantPreferences, false)
+	sourceLang := toDeepLCode(c.String("source"), true)
+
+	// The translation is written laid out as the new revision is
+	newText, layout := splitLayout(newData)
+	translatedText, _ := splitLayout(translatedData)
+	oldText, _ = splitLayout([]byte(oldText))
+	ext := strings.ToLower(filepath.Ext(newPath))
+	markdown := ext == ".md" || ext == ".markdown"
+	oldSegments := translatableSegments(splitParagraphs(oldText, markdown))
+	translatedSegments := translatableSegments(splitParagraphs(translatedText, markdown))
+	if len(oldSegments) != len(translatedSegments) {
+		return cli.Exit(fmt.Sprintf("Diff error: %s has %d paragraphs but the old revision has %d, so they can't be matched up", translatedPath, len(translatedSegments), len(oldSegments)), 1)
+	}
+
+	newParts := splitParagraphs(newText, markdown)
+	matches := matchSegments(oldSegments, translatableSegments(newParts))
+	changed := 0
+	for _, match := range matches {
+		if match < 0 {
+			changed++
+		}
+	}
+
+	client := sharedClient(c)
+	var progress *Progress
+	if c.String("out") != "" || !isTerminal(os.Stdout) {
+		progress = startProgress("Translating changed paragraphs", changed, c.Bool("debug"))
+	}
+	var b strings.Builder
+	segment := 0
+	for _, part := range newParts {
+		if !part.translate {
+			b.WriteString(part.text)
+			continue
+		}
+		if match := matches[segment]; match >= 0 {
+			b.WriteString(translatedSegments[match])
+		} else {
+			resp, _, err := client.Translate(c.Context, part.text, sourceLang, targetLang)
+			progress.Step(err)
+			if err != nil {
+				progress.Stop()
+				return translationExit(err)
+			}
+			b.WriteString(resp.Data)
+		}
+		segment++
+	}
+	progress.Stop()
+
+	output := layout.restore(b.String())
+	if out := c.String("out"); out != "" {
+		if err := os.WriteFile(out, []byte(output), 0644); err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+	} else {
+		fmt.Print(output)
+	}
+	hint("Translated %d changed of %d paragraphs, kept %d translations\n", changed, len(matches), len(matches)-changed)
+	return nil
+}
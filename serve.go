@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// maxProxyBody is the largest request body the proxy reads, well above the 128 KiB the
+// DeepL API accepts
+const maxProxyBody = 1 << 20
+
+// proxyServer exposes the DeepLX /translate API backed by a Client
+type proxyServer struct {
+	client    *Client
+	authToken string
+	debug     bool
+}
+
+// runServe handles the serve command
+func runServe(c *cli.Context) error {
+	upstreams := c.StringSlice("upstream")
+	if len(upstreams) == 0 {
+		upstreams = []string{c.String("url")}
+	}
+	for i, upstream := range upstreams {
+		upstreams[i] = strings.TrimRight(upstream, "/")
+	}
+
+	redactor.addSecrets(c.String("auth-token"))
+	client, err := newClientWith(c, clientOverrides{
+		Servers:   upstreams,
+		Retries:   c.Int("retries"),
+		Cache:     NewCache(c.Int("cache-size"), c.Duration("cache-ttl")),
+		Limiter:   NewRateLimiter(c.Float64("rate")),
+		KeepAlive: true,
+	})
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Serve error: %s", err), 1)
+	}
+	proxy := &proxyServer{
+		client:    client,
+		authToken: c.String("auth-token"),
+		debug:     c.Bool("debug"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", proxy.handleRoot)
+	mux.HandleFunc("/translate", proxy.handleTranslate)
+	mux.HandleFunc("/v2/translate", proxy.handleDeepLTranslate)
+	mux.HandleFunc("/v2/usage", proxy.handleDeepLUsage)
+
+	listen := c.String("listen")
+	fmt.Fprintf(os.Stderr, "Serving DeepLX proxy on %s\n", listen)
+	fmt.Fprintf(os.Stderr, "Upstream servers: %s\n", redactSecrets(strings.Join(upstreams, ", ")))
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	if grpcListen := c.String("grpc-listen"); grpcListen != "" {
+		go func() {
+			errs <- proxy.serveGRPC(grpcListen, c.String("grpc-cert"), c.String("grpc-key"), c.Bool("grpc-plaintext"))
+		}()
+	}
+
+	if err := <-errs; err != nil {
+		return cli.Exit(fmt.Sprintf("Serve error: %s", err), 1)
+	}
+	return nil
+}
+
+// handleRoot answers health checks the same way a DeepLX server does
+func (p *proxyServer) handleRoot(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	size, hits, misses := p.client.Cache.Stats()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"code":    http.StatusOK,
+		"message": fmt.Sprintf("%s %s proxy", AppName, AppVersion),
+		"cache": map[string]interface{}{
+			"entries": size,
+			"hits":    hits,
+			"misses":  misses,
+		},
+	})
+}
+
+// handleTranslate serves the DeepLX-compatible POST /translate endpoint
+func (p *proxyServer) handleTranslate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeProxyError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !p.authorized(r) {
+		writeProxyError(w, http.StatusUnauthorized, "invalid access token")
+		return
+	}
+
+	var req TranslationRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxProxyBody)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProxyError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	if req.Text == "" {
+		writeProxyError(w, http.StatusBadRequest, "no text to translate")
+		return
+	}
+
+	sourceLang := toDeepLCode(req.SourceLang, true)
+	if sourceLang == "" {
+		sourceLang = "AUTO"
+	}
+	targetLang := toDeepLCode(req.TargetLang, false)
+	if targetLang == "" {
+		targetLang = "EN"
+	}
+
+	formality, err := parseFormality(req.Formality)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	tagHandling, err := parseTagHandling(req.TagHandling)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	splitSentences, err := parseSplitSentences(req.SplitSentences)
+	if err != nil {
+		writeProxyError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Pass the caller's correlation ID on to the upstream server
+	ctx := withRequestID(r.Context(), r.Header.Get(requestIDHeader))
+	ctx = withTranslateOptions(ctx, TranslateOptions{
+		Formality:          formality,
+		TagHandling:        tagHandling,
+		SplitSentences:     splitSentences,
+		PreserveFormatting: req.PreserveFormatting,
+		Context:            req.Context,
+		GlossaryID:         req.GlossaryID,
+	})
+	w.Header().Set(requestIDHeader, requestID(ctx))
+
+	start := time.Now()
+	resp, cached, err := p.client.Translate(ctx, req.Text, sourceLang, targetLang)
+	if p.debug {
+		debugf("[%s] %s→%s %d chars cached=%t in %s err=%v\n",
+			requestID(ctx), sourceLang, targetLang, len(req.Text), cached, time.Since(start).Round(time.Millisecond), err)
+	}
+	if err != nil {
+		status := http.StatusBadGateway
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			status = statusErr.StatusCode
+		}
+		writeProxyError(w, status, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// authorized checks the client's access token when the proxy requires one
+func (p *proxyServer) authorized(r *http.Request) bool {
+	if p.authToken == "" {
+		return true
+	}
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && p.tokenMatches(bearer) {
+		return true
+	}
+	if p.tokenMatches(deepLAuthKey(r)) {
+		return true
+	}
+	return p.tokenMatches(r.URL.Query().Get("token"))
+}
+
+// tokenMatches compares a token given by a client with the access token in constant time,
+// so how long the comparison takes tells nothing about the token
+func (p *proxyServer) tokenMatches(token string) bool {
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(p.authToken)) == 1
+}
+
+// writeProxyError writes an error in the DeepLX response shape, without the upstream
+// tokens and other secrets it may quote
+func writeProxyError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"code":    status,
+		"message": redactSecrets(message),
+	})
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// deepLTranslateRequest is the official DeepL API /v2/translate request body
+type deepLTranslateRequest struct {
+	Text               []string `json:"text"`
+	SourceLang         string   `json:"source_lang,omitempty"`
+	TargetLang         string   `json:"target_lang"`
+	Formality          string   `json:"formality,omitempty"`
+	TagHandling        string   `json:"tag_handling,omitempty"`
+	SplitSentences     string   `json:"split_sentences,omitempty"`
+	PreserveFormatting bool     `json:"preserve_formatting,omitempty"`
+	Context            string   `json:"context,omitempty"`
+	GlossaryID         string   `json:"glossary_id,omitempty"`
+}
+
+// deepLTranslation is a single entry of the official DeepL API response
+type deepLTranslation struct {
+	DetectedSourceLanguage string `json:"detected_source_language"`
+	Text                   string `json:"text"`
+}
+
+// deepLTranslateResponse is the official DeepL API /v2/translate response body
+type deepLTranslateResponse struct {
+	Translations []deepLTranslation `json:"translations"`
+}
+
+// handleDeepLTranslate serves POST /v2/translate in the official DeepL API shape,
+// accepting both JSON and form-encoded bodies
+func (p *proxyServer) handleDeepLTranslate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeDeepLError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	req, err := parseDeepLRequest(w, r)
+	if err != nil {
+		writeDeepLError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !p.authorized(r) {
+		writeDeepLError(w, http.StatusForbidden, "Authorization failed. Please supply a valid auth_key parameter.")
+		return
+	}
+	if len(req.Text) == 0 {
+		writeDeepLError(w, http.StatusBadRequest, "Parameter 'text' not specified.")
+		return
+	}
+	if req.TargetLang == "" {
+		writeDeepLError(w, http.StatusBadRequest, "Value for 'target_lang' not supported.")
+		return
+	}
+
+	sourceLang := toDeepLCode(req.SourceLang, true)
+	if sourceLang == "" {
+		sourceLang = "AUTO"
+	}
+	targetLang := toDeepLCode(req.TargetLang, false)
+	formality, err := parseFormality(req.Formality)
+	if err != nil {
+		writeDeepLError(w, http.StatusBadRequest, "Value for 'formality' not supported.")
+		return
+	}
+	tagHandling, err := parseTagHandling(req.TagHandling)
+	if err != nil {
+		writeDeepLError(w, http.StatusBadRequest, "Value for 'tag_handling' not supported.")
+		return
+	}
+	splitSentences, err := parseSplitSentences(req.SplitSentences)
+	if err != nil {
+		writeDeepLError(w, http.StatusBadRequest, "Value for 'split_sentences' not supported.")
+		return
+	}
+	ctx := withTranslateOptions(r.Context(), TranslateOptions{
+		Formality:          formality,
+		TagHandling:        tagHandling,
+		SplitSentences:     splitSentences,
+		PreserveFormatting: req.PreserveFormatting,
+		Context:            req.Context,
+		GlossaryID:         req.GlossaryID,
+	})
+
+	resp := deepLTranslateResponse{Translations: make([]deepLTranslation, 0, len(req.Text))}
+	for _, text := range req.Text {
+		result, _, err := p.client.Translate(ctx, text, sourceLang, targetLang)
+		if err != nil {
+			status := http.StatusBadGateway
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) {
+				status = statusErr.StatusCode
+			}
+			writeDeepLError(w, status, redactSecrets(err.Error()))
+			return
+		}
+
+		detected := toDeepLCode(result.SourceLang, true)
+		if detected == "" {
+			detected = sourceLang
+		}
+		resp.Translations = append(resp.Translations, deepLTranslation{
+			DetectedSourceLanguage: detected,
+			Text:                   result.Data,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDeepLUsage serves GET/POST /v2/usage, which many DeepL clients call to validate their key
+func (p *proxyServer) handleDeepLUsage(w http.ResponseWriter, r *http.Request) {
+	if !p.authorized(r) {
+		writeDeepLError(w, http.StatusForbidden, "Authorization failed. Please supply a valid auth_key parameter.")
+		return
+	}
+	// DeepLX has no quota of its own; the character budget is the only limit there is to report
+	budget := p.client.Budget
+	if budget == nil {
+		writeDeepLError(w, http.StatusNotImplemented, "No character limit to report: the proxy has no quota unless started with --budget.")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{
+		"character_count": budget.Used(),
+		"character_limit": budget.Limit,
+	})
+}
+
+// parseDeepLRequest decodes a /v2/translate request from a JSON or form-encoded body
+func parseDeepLRequest(w http.ResponseWriter, r *http.Request) (*deepLTranslateRequest, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxProxyBody)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		var req deepLTranslateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, fmt.Errorf("invalid request body: %v", err)
+		}
+		return &req, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("invalid request body: %v", err)
+	}
+	return &deepLTranslateRequest{
+		Text:        r.Form["text"],
+		SourceLang:  r.Form.Get("source_lang"),
+		TargetLang:  r.Form.Get("target_lang"),
+		Formality:   r.Form.Get("formality"),
+		TagHandling: r.Form.Get("tag_handling"),
+		// Form bodies send booleans as "0" and "1"
+		SplitSentences:     r.Form.Get("split_sentences"),
+		PreserveFormatting: r.Form.Get("preserve_formatting") == "1",
+		Context:            r.Form.Get("context"),
+		GlossaryID:         r.Form.Get("glossary_id"),
+	}, nil
+}
+
+// deepLAuthKey extracts the key from a DeepL-style "DeepL-Auth-Key" header or legacy auth_key parameter
+func deepLAuthKey(r *http.Request) string {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "DeepL-Auth-Key "); ok {
+		return strings.TrimSpace(key)
+	}
+	// Only look at an already parsed form, so JSON bodies are left for the handler to decode
+	if r.Form != nil {
+		return r.Form.Get("auth_key")
+	}
+	return r.URL.Query().Get("auth_key")
+}
+
+// writeDeepLError writes an error in the official DeepL API shape
+func writeDeepLError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
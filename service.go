@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Exit statuses of --service, for the automations calling it
+const (
+	ServiceExitOK      = ExitOK
+	ServiceExitFailed  = ExitFailure // The translation failed
+	ServiceExitNoInput = ExitUsage   // There was nothing to translate on stdin
+)
+
+// serviceInfoPlist is the Info.plist of a Quick Action taking and returning text; %[1]s is
+// its name and %[2]s the return types, empty when the result is only shown
+const serviceInfoPlist = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>NSServices</key>
+	<array>
+		<dict>
+			<key>NSMenuItem</key>
+			<dict>
+				<key>default</key>
+				<string>%[1]s</string>
+			</dict>
+			<key>NSMessage</key>
+			<string>runWorkflowAsService</string>
+			<key>NSRequiredContext</key>
+			<dict/>
+			<key>NSSendTypes</key>
+			<array>
+				<string>public.utf8-plain-text</string>
+			</array>%[2]s
+		</dict>
+	</array>
+</dict>
+</plist>
+`
+
+// serviceReturnTypes makes a Quick Action replace the selected text with its output
+const serviceReturnTypes = `
+			<key>NSReturnTypes</key>
+			<array>
+				<string>public.utf8-plain-text</string>
+			</array>`
+
+// serviceWorkflow is the document.wflow of a Quick Action running a shell script on the
+// selected text; %[1]s is the script, %[2]s, %[3]s and %[4]s the UUIDs of the action, its
+// input and its output, and %[5]s the output type
+const serviceWorkflow = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>AMApplicationBuild</key>
+	<string>523</string>
+	<key>AMApplicationVersion</key>
+	<string>2.10</string>
+	<key>AMDocumentVersion</key>
+	<string>2</string>
+	<key>actions</key>
+	<array>
+		<dict>
+			<key>action</key>
+			<dict>
+				<key>AMAccepts</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Optional</key>
+					<true/>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>AMActionVersion</key>
+				<string>2.0.3</string>
+				<key>AMApplication</key>
+				<array>
+					<string>Automator</string>
+				</array>
+				<key>AMParameterProperties</key>
+				<dict>
+					<key>COMMAND_STRING</key>
+					<dict/>
+					<key>CheckedForUserDefaultShell</key>
+					<dict/>
+					<key>inputMethod</key>
+					<dict/>
+					<key>shell</key>
+					<dict/>
+					<key>source</key>
+					<dict/>
+				</dict>
+				<key>AMProvides</key>
+				<dict>
+					<key>Container</key>
+					<string>List</string>
+					<key>Types</key>
+					<array>
+						<string>com.apple.cocoa.string</string>
+					</array>
+				</dict>
+				<key>ActionBundlePath</key>
+				<string>/System/Library/Automator/Run Shell Script.action</string>
+				<key>ActionName</key>
+				<string>Run Shell Script</string>
+				<key>ActionParameters</key>
+				<dict>
+					<key>COMMAND_STRING</key>
+					<string>%[1]s</string>
+					<key>CheckedForUserDefaultShell</key>
+					<true/>
+					<key>inputMethod</key>
+					<integer>0</integer>
+					<key>shell</key>
+					<string>/bin/zsh</string>
+					<key>source</key>
+					<string></string>
+				</dict>
+				<key>BundleIdentifier</key>
+				<string>com.apple.RunShellScript</string>
+				<key>CFBundleVersion</key>
+				<string>2.0.3</string>
+				<key>CanShowSelectedItemsWhenRun</key>
+				<false/>
+				<key>CanShowWhenRun</key>
+				<true/>
+				<key>Category</key>
+				<array>
+					<string>AMCategoryUtilities</string>
+				</array>
+				<key>Class Name</key>
+				<string>RunShellScriptAction</string>
+				<key>InputUUID</key>
+				<string>%[3]s</string>
+				<key>OutputUUID</key>
+				<string>%[4]s</string>
+				<key>UUID</key>
+				<string>%[2]s</string>
+				<key>UnlocalizedApplications</key>
+				<array>
+					<string>Automator</string>
+				</array>
+				<key>isViewVisible</key>
+				<integer>1</integer>
+			</dict>
+			<key>isViewVisible</key>
+			<integer>1</integer>
+		</dict>
+	</array>
+	<key>connectors</key>
+	<dict/>
+	<key>workflowMetaData</key>
+	<dict>
+		<key>applicationBundleIDsByPath</key>
+		<dict/>
+		<key>applicationPaths</key>
+		<array/>
+		<key>inputTypeIdentifier</key>
+		<string>com.apple.Automator.text</string>
+		<key>outputTypeIdentifier</key>
+		<string>%[5]s</string>
+		<key>presentationMode</key>
+		<integer>11</integer>
+		<key>processesInput</key>
+		<integer>0</integer>
+		<key>serviceInputTypeIdentifier</key>
+		<string>com.apple.Automator.text</string>
+		<key>serviceOutputTypeIdentifier</key>
+		<string>%[5]s</string>
+		<key>serviceProcessesInput</key>
+		<integer>0</integer>
+		<key>useAutomaticInputType</key>
+		<integer>0</integer>
+		<key>workflowTypeIdentifier</key>
+		<string>com.apple.Automator.servicesMenu</string>
+	</dict>
+</dict>
+</plist>
+`
+
+// serviceDialogScript shows the translation in a dialog instead of replacing the selection
+const serviceDialogScript = `osascript -e 'on run argv' -e 'display dialog (item 1 of argv) with title "Translation" buttons {"OK"} default button 1' -e 'end run' "$(%s)"`
+
+// runService handles --service: the text on stdin is translated with the configured
+// defaults and only the translation is printed, keeping the whitespace around the text,
+// so it can replace a selection. Several targets are separated by a blank line.
+func runService(c *cli.Context) error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Service error: %s", err), ServiceExitFailed)
+	}
+	input := string(data)
+	text := strings.TrimSpace(input)
+	if text == "" {
+		return cli.Exit("Service error: no text on stdin", ServiceExitNoInput)
+	}
+	leading := input[:strings.Index(input, text)]
+	trailing := input[len(leading)+len(text):]
+
+	targets := splitLangList(c.String("target"))
+	if len(targets) == 0 {
+		return cli.Exit("Service error: no target language given", ServiceExitFailed)
+	}
+	config := configFor(c.Context)
+	client := sharedClient(c)
+	sourceLang := toDeepLCode(c.String("source"), true)
+	var translations []string
+	for _, target := range targets {
+		targetLang := resolveTargetVariant(toDeepLCode(target, false), config.VariantPreferences, false)
+		result, _, err := client.Translate(c.Context, text, sourceLang, targetLang)
+		if err != nil {
+			// Only the error itself, without the advice for the terminal (--service is quiet)
+			return cli.Exit(fmt.Sprintf("Translation error: %s", errorAdvice(err)), ServiceExitFailed)
+		}
+		translations = append(translations, result.Data)
+	}
+	fmt.Print(leading + strings.Join(translations, "\n\n") + trailing)
+	return nil
+}
+
+// shellQuote quotes an argument for a POSIX shell
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=,:@") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// plistEscape escapes text for a plist string
+func plistEscape(text string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// runServiceInstall handles the service install command, writing a macOS Quick Action that
+// translates the selected text with --service
+func runServiceInstall(c *cli.Context) error {
+	dir := c.String("dir")
+	if dir == "" {
+		if runtime.GOOS != "darwin" {
+			return cli.Exit("Service error: Quick Actions are only available on macOS (use --dir to write one elsewhere)", 1)
+		}
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Service error: %s", err), 1)
+		}
+		dir = filepath.Join(home, "Library", "Services")
+	}
+	name := c.String("name")
+	if name == "" || strings.ContainsAny(name, "/:") {
+		return cli.Exit(fmt.Sprintf("Service error: invalid name %q", name), 1)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Service error: %s", err), 1)
+	}
+
+	// Flags after the name, e.g. -t de, are passed on; they go before --service
+	args := c.Args().Slice()
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	command := shellQuote(executable)
+	for _, arg := range args {
+		command += " " + shellQuote(arg)
+	}
+	command += " --service"
+
+	returnTypes, outputType := serviceReturnTypes, "com.apple.Automator.text"
+	if c.Bool("show") {
+		command = fmt.Sprintf(serviceDialogScript, command)
+		returnTypes, outputType = "", "com.apple.Automator.nothing"
+	}
+
+	contents := filepath.Join(dir, name+".workflow", "Contents")
+	if err := os.MkdirAll(contents, 0755); err != nil {
+		return cli.Exit(fmt.Sprintf("Service error: %s", err), 1)
+	}
+	files := map[string]string{
+		"Info.plist": fmt.Sprintf(serviceInfoPlist, plistEscape(name), returnTypes),
+		"document.wflow": fmt.Sprintf(serviceWorkflow, plistEscape(command),
+			strings.ToUpper(newRequestID()), strings.ToUpper(newRequestID()), strings.ToUpper(newRequestID()), outputType),
+	}
+	for file, content := range files {
+		if err := os.WriteFile(filepath.Join(contents, file), []byte(content), 0644); err != nil {
+			return cli.Exit(fmt.Sprintf("Service error: %s", err), 1)
+		}
+	}
+
+	fmt.Printf("Installed the Quick Action %q in %s\n", name, filepath.Dir(contents))
+	fmt.Println("Select text in any app and choose it from the right-click menu or the app menu under Services;")
+	fmt.Println("a keyboard shortcut can be set in System Settings → Keyboard → Keyboard Shortcuts → Services.")
+	return nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+// dlSessionCookie is the cookie DeepLX's pro endpoint reads the DeepL Pro session from
+const dlSessionCookie = "dl_session"
+
+// dlSessionEndpoint is the DeepLX endpoint that translates with a DeepL Pro session
+const dlSessionEndpoint = "/v1/translate"
+
+// Session is a DeepL Pro dl_session shared by all requests of a client. When the server
+// reports it expired, the first request to notice obtains a new one and the others wait
+// for it, so a batch carries on instead of failing.
+type Session struct {
+	mu         sync.Mutex
+	value      string
+	generation int
+	// RefreshCommand is run through the shell to print a new session; if empty, the user
+	// is asked for one on the terminal
+	RefreshCommand string
+	// Persist saves refreshed sessions to the configuration file
+	Persist bool
+}
+
+// sessionFromFlags returns the session given on the command line or configured, or nil
+// if there is none or the provider isn't DeepLX
+func sessionFromFlags(c *cli.Context) *Session {
+	value := parseSessionValue(c.String("dl-session"))
+	if value == "" || c.String("provider") != ProviderDeepLX {
+		return nil
+	}
+	return &Session{
+		value:          value,
+		RefreshCommand: c.String("session-refresh-command"),
+		Persist:        !c.IsSet("dl-session"),
+	}
+}
+
+// current returns the session and how many times it has been refreshed
+func (s *Session) current() (string, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.value, s.generation
+}
+
+// refresh replaces the session a request saw at generation. If another request has
+// replaced it in the meantime, the new one is used without asking again.
+func (s *Session) refresh(ctx context.Context, generation int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation != generation {
+		return nil
+	}
+
+	var value string
+	var err error
+	if s.RefreshCommand != "" {
+		value, err = runSessionRefresh(ctx, s.RefreshCommand)
+	} else {
+		value, err = promptSession()
+	}
+	if err != nil {
+		return err
+	}
+	if value == "" || value == s.value {
+		return fmt.Errorf("no new session")
+	}
+	redactor.addSecrets(value)
+	s.value = value
+	s.generation++
+
+	if s.Persist {
+		err := updateConfig(ctx, func(config *Config) error {
+			config.DLSession = value
+			return nil
+		})
+		if err != nil {
+			warnf("failed to save the new session: %v", err)
+		}
+	}
+	return nil
+}
+
+// parseSessionValue reads a session given bare or as a "dl_session=VALUE; ..." cookie
+func parseSessionValue(text string) string {
+	text = strings.TrimSpace(text)
+	text = strings.TrimPrefix(text, dlSessionCookie+"=")
+	if i := strings.IndexByte(text, ';'); i >= 0 {
+		text = text[:i]
+	}
+	return strings.TrimSpace(text)
+}
+
+// runSessionRefresh runs the refresh hook, which prints the new session on stdout
+func runSessionRefresh(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("session refresh command failed: %s", message)
+	}
+	return parseSessionValue(string(out)), nil
+}
+
+// promptSession asks for a new session on the terminal, which works even while stdin
+// carries the texts of a batch
+func promptSession() (string, error) {
+	if nonInteractive {
+		return "", fmt.Errorf("no session refresh command configured, and --non-interactive forbids asking for a new session")
+	}
+	name := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		name = "CONIN$"
+	}
+	tty, err := os.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("no session refresh command configured and no terminal to ask for a new session")
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, "The dl_session has expired. Paste a new one (the dl_session cookie of deepl.com): ")
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read the new session: %v", err)
+	}
+	return parseSessionValue(line), nil
+}
+
+// isSessionExpired reports whether an error from the pro endpoint means the session was refused
+func isSessionExpired(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden
+	}
+	msg := err.Error()
+	return strings.Contains(msg, dlSessionCookie) ||
+		strings.Contains(msg, "translation failed with code 401") ||
+		strings.Contains(msg, "translation failed with code 403")
+}
+
+// translateWithSession posts to the pro endpoint with the session cookie, refreshing the
+// session and retrying once if it has expired
+func translateWithSession(ctx context.Context, conn ProviderConn, endpoint, text, sourceLang, targetLang string) (*TranslationResponse, error) {
+	if endpoint == "" {
+		endpoint = dlSessionEndpoint
+	}
+	for refreshed := false; ; refreshed = true {
+		value, generation := conn.Session.current()
+		client := withHeaders(conn.HTTPClient, http.Header{"Cookie": {dlSessionCookie + "=" + value}})
+		resp, err := sendTranslation(ctx, client, conn.Server, endpoint, text, sourceLang, targetLang, conn.Token, conn.AuthStyle, conn.Debug)
+		if err == nil || refreshed || !isSessionExpired(err) {
+			return resp, err
+		}
+
+		if conn.Debug {
+			debugf("Session refused (%s), refreshing it\n", strings.SplitN(err.Error(), "\n", 2)[0])
+		}
+		if refreshErr := conn.Session.refresh(ctx, generation); refreshErr != nil {
+			return nil, fmt.Errorf("%v (refreshing the dl_session failed: %v)", err, refreshErr)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// defaultSpeakCommands returns the text-to-speech commands reading the text on stdin
+// tried in order when no speak_command is configured, for a voice (empty for the default
+// voice of the language) and a target language
+func defaultSpeakCommands(voice, targetLang string) [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		if voice == "" {
+			return [][]string{{"say"}}
+		}
+		return [][]string{{"say", "-v", voice}}
+	case "windows":
+		return [][]string{{"powershell", "-NoProfile", "-Command", "[Console]::InputEncoding = [Text.Encoding]::UTF8; Add-Type -AssemblyName System.Speech; $s = New-Object System.Speech.Synthesis.SpeechSynthesizer; if ($env:TRANSLATE_VOICE) { $s.SelectVoice($env:TRANSLATE_VOICE) }; $s.Speak([Console]::In.ReadToEnd())"}}
+	}
+	// espeak names its voices after the language, e.g. de, en-gb or pt-br
+	if voice == "" {
+		voice = strings.ToLower(toBCP47(targetLang))
+	}
+	return [][]string{
+		{"espeak-ng", "--stdin", "-v", voice},
+		{"espeak", "--stdin", "-v", voice},
+	}
+}
+
+// speakVoice returns the voice configured for a target language, trying the exact variant
+// before the base language; empty if there is none
+func speakVoice(voices map[string]string, targetLang string) string {
+	base := ""
+	for lang, voice := range voices {
+		switch toDeepLCode(lang, false) {
+		case targetLang:
+			return voice
+		case baseLanguage(targetLang):
+			base = voice
+		}
+	}
+	return base
+}
+
+// speak reads text aloud in targetLang, a DeepL code. A configured speak_command is run
+// by the shell with the text on stdin and the voice and language in $TRANSLATE_VOICE and
+// $TRANSLATE_LANG, so any engine can be used, e.g. piper piping to aplay.
+func speak(config Config, text, targetLang string) error {
+	voice := speakVoice(config.Voices, targetLang)
+	commands := defaultSpeakCommands(voice, targetLang)
+	if config.SpeakCommand != "" {
+		if runtime.GOOS == "windows" {
+			commands = [][]string{{"cmd", "/C", config.SpeakCommand}}
+		} else {
+			commands = [][]string{{"sh", "-c", config.SpeakCommand}}
+		}
+	}
+
+	for _, args := range commands {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		cmd.Env = append(os.Environ(), "TRANSLATE_VOICE="+voice, "TRANSLATE_LANG="+toBCP47(targetLang))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return fmt.Errorf("no speech command found (install espeak-ng or set speak_command)")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spinnerDelay keeps the spinner hidden for requests that finish quickly
+const spinnerDelay = 300 * time.Millisecond
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Spinner shows an animated progress line with the elapsed time and active server on stderr
+type Spinner struct {
+	w       io.Writer
+	label   string
+	started time.Time
+
+	mu     sync.Mutex
+	server string
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// startSpinner starts a spinner on stderr if it is a terminal, debug output isn't
+// interleaved with it and not running quietly; otherwise it returns nil, whose methods do
+// nothing
+func startSpinner(label string, debug bool) *Spinner {
+	if debug || quiet || !isTerminal(os.Stderr) {
+		return nil
+	}
+
+	s := &Spinner{
+		w:       os.Stderr,
+		label:   label,
+		started: time.Now(),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// SetServer updates the server shown next to the spinner
+func (s *Spinner) SetServer(server string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.server = server
+	s.mu.Unlock()
+}
+
+// Stop removes the spinner line
+func (s *Spinner) Stop() {
+	if s == nil {
+		return
+	}
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+	<-s.done
+}
+
+// run animates the spinner until stopped
+func (s *Spinner) run() {
+	defer close(s.done)
+
+	timer := time.NewTimer(spinnerDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-s.stop:
+		return
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for frame := 0; ; frame++ {
+		s.mu.Lock()
+		line := fmt.Sprintf("%s %s… %.1fs", spinnerFrames[frame%len(spinnerFrames)], s.label, time.Since(s.started).Seconds())
+		if s.server != "" {
+			line += " (" + redactSecrets(s.server) + ")"
+		}
+		s.mu.Unlock()
+		fmt.Fprintf(s.w, "\r\x1b[K%s", line)
+
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			fmt.Fprint(s.w, "\r\x1b[K")
+			return
+		}
+	}
+}
+
+// spinnerLabel describes a request for the spinner
+func spinnerLabel(targets []string) string {
+	return "Translating to " + strings.Join(targets, ", ")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// statsGroup sums the history entries sharing a language pair, server or day
+type statsGroup struct {
+	Key          string  `json:"key"`
+	Segments     int     `json:"segments"`
+	Characters   int     `json:"characters"`
+	CacheHits    int     `json:"cache_hits"`
+	CacheHitRate float64 `json:"cache_hit_rate"`
+	// AvgLatencyMS is the mean duration of the translations not served from the cache
+	AvgLatencyMS float64 `json:"avg_latency_ms"`
+
+	requests  int
+	latencyMS int64
+}
+
+// add counts an entry in the group
+func (g *statsGroup) add(entry HistoryEntry) {
+	g.Segments++
+	g.Characters += entry.Characters
+	if entry.Cached {
+		g.CacheHits++
+	} else {
+		g.requests++
+		g.latencyMS += entry.DurationMS
+	}
+}
+
+// finish computes the rates of the group
+func (g *statsGroup) finish() {
+	if g.Segments > 0 {
+		g.CacheHitRate = float64(g.CacheHits) / float64(g.Segments)
+	}
+	if g.requests > 0 {
+		g.AvgLatencyMS = float64(g.latencyMS) / float64(g.requests)
+	}
+}
+
+// statsOutput is the JSON output of stats
+type statsOutput struct {
+	Schema  int          `json:"schema"`
+	Days    int          `json:"days"`
+	Pairs   []statsGroup `json:"pairs"`
+	Servers []statsGroup `json:"servers"`
+	ByDay   []statsGroup `json:"by_day"`
+	Total   statsGroup   `json:"total"`
+}
+
+// groupHistory sums the entries by the key each one is given, sorted by key
+func groupHistory(entries []HistoryEntry, key func(HistoryEntry) string) []statsGroup {
+	groups := make(map[string]*statsGroup)
+	for _, entry := range entries {
+		k := key(entry)
+		if groups[k] == nil {
+			groups[k] = &statsGroup{Key: k}
+		}
+		groups[k].add(entry)
+	}
+	sorted := make([]statsGroup, 0, len(groups))
+	for _, group := range groups {
+		group.finish()
+		sorted = append(sorted, *group)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	return sorted
+}
+
+// runStats handles the stats command, summarizing the history of the last days by
+// language pair, server and day
+func runStats(c *cli.Context) error {
+	days := c.Int("days")
+	entries, err := loadTranslationHistory()
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Stats error: %s", err), 1)
+	}
+	entries, _ = historySince(entries, time.Now().AddDate(0, 0, -days+1).Format(ledgerDay))
+
+	output := statsOutput{
+		Schema: SchemaVersion,
+		Days:   days,
+		Pairs: groupHistory(entries, func(entry HistoryEntry) string {
+			return toBCP47(entry.SourceLang) + ">" + toBCP47(entry.TargetLang)
+		}),
+		Servers: groupHistory(entries, func(entry HistoryEntry) string {
+			if entry.Server == "" {
+				return entry.Provider
+			}
+			return entry.Provider + " " + redactSecrets(entry.Server)
+		}),
+		ByDay: groupHistory(entries, func(entry HistoryEntry) string {
+			return entry.Time.Local().Format(ledgerDay)
+		}),
+	}
+	for _, entry := range entries {
+		output.Total.add(entry)
+	}
+	output.Total.Key = "Total"
+	output.Total.finish()
+
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(output)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No translations in the history in the last %d days\n", days)
+		return nil
+	}
+	for _, section := range []struct {
+		title  string
+		groups []statsGroup
+	}{
+		{"Language pair", output.Pairs},
+		{"Server", output.Servers},
+		{"Day", output.ByDay},
+	} {
+		fmt.Printf("%-44s  %8s  %10s  %9s  %11s\n", section.title, "Segments", "Characters", "Cache hit", "Avg latency")
+		for _, group := range section.groups {
+			printStatsGroup(group)
+		}
+		fmt.Println()
+	}
+	printStatsGroup(output.Total)
+	return nil
+}
+
+// printStatsGroup prints a row of the stats table
+func printStatsGroup(group statsGroup) {
+	latency := "-"
+	if group.requests > 0 {
+		latency = fmt.Sprintf("%.0fms", group.AvgLatencyMS)
+	}
+	fmt.Printf("%-44s  %8d  %10d  %8.0f%%  %11s\n", group.Key, group.Segments, group.Characters, group.CacheHitRate*100, latency)
+}
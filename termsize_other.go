@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package main
+
+import "os"
+
+// terminalSize is not supported on this platform
+func terminalSize(f *os.File) (int, int) {
+	return 0, 0
+}
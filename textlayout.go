@@ -0,0 +1,41 @@
+package main
+
+import "strings"
+
+// utf8BOM is the byte order mark some tools, notably on Windows, start UTF-8 files with
+const utf8BOM = "\ufeff"
+
+// textLayout is what the bytes of a text file hold besides its text: a byte order mark
+// and CRLF line endings, kept so that translated files differ only in their text
+type textLayout struct {
+	bom  bool
+	crlf bool
+}
+
+// splitLayout returns the text of a file without its byte order mark and with LF line
+// endings, as the format handlers expect, and the layout to restore. Line endings are
+// CRLF if most lines end so.
+func splitLayout(data []byte) (string, textLayout) {
+	text := string(data)
+	var layout textLayout
+	if strings.HasPrefix(text, utf8BOM) {
+		layout.bom = true
+		text = text[len(utf8BOM):]
+	}
+	if crlf := strings.Count(text, "\r\n"); crlf > 0 && crlf*2 >= strings.Count(text, "\n") {
+		layout.crlf = true
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+	return text, layout
+}
+
+// restore returns text laid out as the file it came from
+func (l textLayout) restore(text string) string {
+	if l.crlf {
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+	}
+	if l.bom && !strings.HasPrefix(text, utf8BOM) {
+		text = utf8BOM + text
+	}
+	return text
+}
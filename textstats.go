@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Length ratios outside these bounds suggest a truncated or runaway translation
+const (
+	minLengthRatio = 0.5
+	maxLengthRatio = 2.0
+)
+
+// textStats are the lengths of a text and its translation, for --stats
+type textStats struct {
+	SourceChars int `json:"source_chars"`
+	SourceWords int `json:"source_words"`
+	TargetChars int `json:"target_chars"`
+	TargetWords int `json:"target_words"`
+	// Ratio is the length of the translation in characters over that of the text
+	Ratio float64 `json:"ratio"`
+}
+
+// countWords counts the words of text: runs of letters and digits, and each wide (CJK)
+// character, since those languages don't put spaces between words
+func countWords(text string) int {
+	words, inWord := 0, false
+	for _, r := range text {
+		switch {
+		case isWideRune(r) && unicode.IsLetter(r):
+			words++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		case r == '\'' || r == '’' || r == '-':
+			// Keep contractions and hyphenated words whole
+		default:
+			inWord = false
+		}
+	}
+	return words
+}
+
+// newTextStats measures a text and its translation
+func newTextStats(text, translation string) *textStats {
+	stats := &textStats{
+		SourceChars: utf8.RuneCountInString(text),
+		SourceWords: countWords(text),
+		TargetChars: utf8.RuneCountInString(translation),
+		TargetWords: countWords(translation),
+	}
+	if stats.SourceChars > 0 {
+		stats.Ratio = math.Round(float64(stats.TargetChars)/float64(stats.SourceChars)*100) / 100
+	}
+	return stats
+}
+
+// unusual reports whether the translation is much shorter or longer than the text
+func (s *textStats) unusual() bool {
+	return s.SourceChars > 0 && (s.Ratio < minLengthRatio || s.Ratio > maxLengthRatio)
+}
+
+// String describes the stats on one line
+func (s *textStats) String() string {
+	line := fmt.Sprintf("%d → %d characters, %d → %d words, ratio %.2f", s.SourceChars, s.TargetChars, s.SourceWords, s.TargetWords, s.Ratio)
+	if s.unusual() {
+		line += " (unusual; truncated or runaway?)"
+	}
+	return line
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenInfoPath is where gateways that expose token metadata serve it
+const tokenInfoPath = "/v1/token"
+
+// tokenExpiryWarning is how long before a token expires doctor starts warning
+const tokenExpiryWarning = 7 * 24 * time.Hour
+
+// tokenInfo is what is known about a token's permissions and lifetime
+type tokenInfo struct {
+	Scopes    []string
+	Role      string
+	ExpiresAt time.Time
+	// Source is where the information came from: the token's own claims or the server
+	Source string
+}
+
+// canTranslate reports whether the scopes, if known, allow translating
+func (t *tokenInfo) canTranslate() bool {
+	if len(t.Scopes) == 0 {
+		return true
+	}
+	for _, scope := range t.Scopes {
+		if strings.Contains(strings.ToLower(scope), "translate") || scope == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTokenClaims reads the scopes, role and expiry from JWT claims or a gateway's token
+// metadata, accepting the usual spellings of each
+func parseTokenClaims(claims map[string]interface{}) *tokenInfo {
+	info := &tokenInfo{}
+	for _, key := range []string{"scope", "scopes", "scp", "permissions"} {
+		switch v := claims[key].(type) {
+		case string:
+			info.Scopes = append(info.Scopes, strings.Fields(v)...)
+		case []interface{}:
+			for _, scope := range v {
+				if s, ok := scope.(string); ok {
+					info.Scopes = append(info.Scopes, s)
+				}
+			}
+		}
+	}
+	sort.Strings(info.Scopes)
+
+	for _, key := range []string{"role", "roles"} {
+		switch v := claims[key].(type) {
+		case string:
+			info.Role = v
+		case []interface{}:
+			var roles []string
+			for _, role := range v {
+				if s, ok := role.(string); ok {
+					roles = append(roles, s)
+				}
+			}
+			info.Role = strings.Join(roles, ", ")
+		}
+		if info.Role != "" {
+			break
+		}
+	}
+
+	for _, key := range []string{"exp", "expires_at", "expiry", "expires"} {
+		switch v := claims[key].(type) {
+		case float64:
+			info.ExpiresAt = time.Unix(int64(v), 0)
+		case string:
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				info.ExpiresAt = t
+			} else if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				info.ExpiresAt = time.Unix(n, 0)
+			}
+		}
+		if !info.ExpiresAt.IsZero() {
+			break
+		}
+	}
+	return info
+}
+
+// decodeTokenClaims reads the claims of a JWT without verifying it; other tokens are opaque
+func decodeTokenClaims(token string) (*tokenInfo, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, false
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, false
+	}
+	info := parseTokenClaims(claims)
+	info.Source = "token"
+	return info, true
+}
+
+// fetchTokenInfo asks the server for the token's metadata. Servers without it answer 404,
+// reported as a nil tokenInfo without error.
+func fetchTokenInfo(client *http.Client, serverURL, token, authStyle string) (*tokenInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, serverURL+tokenInfoPath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, AppVersion))
+	setTokenAuth(req, token, authStyle)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned status %d", resp.StatusCode)
+	}
+
+	var claims map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
+		// DeepLX answers unknown paths with its own pages; that isn't token metadata
+		return nil, nil
+	}
+	info := parseTokenClaims(claims)
+	if len(info.Scopes) == 0 && info.Role == "" && info.ExpiresAt.IsZero() {
+		return nil, nil
+	}
+	info.Source = "server"
+	return info, nil
+}
+
+// lookupTokenInfo returns what the server, or failing that the token itself, says about
+// the token; nil if neither says anything
+func lookupTokenInfo(serverURL, token, authStyle string, timeout time.Duration) *tokenInfo {
+	if token == "" {
+		return nil
+	}
+	if info, err := fetchTokenInfo(&http.Client{Timeout: timeout}, serverURL, token, authStyle); err == nil && info != nil {
+		return info
+	}
+	if info, ok := decodeTokenClaims(token); ok {
+		return info
+	}
+	return nil
+}
+
+// describeExpiry says when a token expires relative to now, e.g. "in 3 days"
+func describeExpiry(expiresAt, now time.Time) string {
+	left := expiresAt.Sub(now)
+	ago := left < 0
+	if ago {
+		left = -left
+	}
+	var amount string
+	switch {
+	case left >= 48*time.Hour:
+		amount = fmt.Sprintf("%d days", int(left.Hours()/24))
+	case left >= 2*time.Hour:
+		amount = fmt.Sprintf("%d hours", int(left.Hours()))
+	case left >= 2*time.Minute:
+		amount = fmt.Sprintf("%d minutes", int(left.Minutes()))
+	default:
+		amount = "a minute"
+	}
+	if ago {
+		return amount + " ago"
+	}
+	return "in " + amount
+}
+
+// printTokenInfo prints the token section of doctor
+func printTokenInfo(info *tokenInfo, now time.Time) {
+	fmt.Printf("\nToken (from the %s):\n", info.Source)
+	if len(info.Scopes) > 0 {
+		fmt.Printf("  ✓ Scopes: %s\n", strings.Join(info.Scopes, ", "))
+	}
+	if info.Role != "" {
+		fmt.Printf("  ℹ Role: %s\n", info.Role)
+	}
+	if !info.canTranslate() {
+		fmt.Printf("  ⚠ None of the scopes allow translating; requests may be refused\n")
+	}
+	if info.ExpiresAt.IsZero() {
+		return
+	}
+	expires := info.ExpiresAt.Local().Format("2006-01-02 15:04 MST")
+	switch left := info.ExpiresAt.Sub(now); {
+	case left <= 0:
+		fmt.Printf("  ✗ Expired: %s (%s)\n", expires, describeExpiry(info.ExpiresAt, now))
+	case left < tokenExpiryWarning:
+		fmt.Printf("  ⚠ Expires: %s (%s) - renew it before long-running jobs\n", expires, describeExpiry(info.ExpiresAt, now))
+	default:
+		fmt.Printf("  ✓ Expires: %s (%s)\n", expires, describeExpiry(info.ExpiresAt, now))
+	}
+}
+
+// warnTokenExpiry warns on stderr when the token has expired or expires within window,
+// so a long job doesn't fail halfway through
+func warnTokenExpiry(token string, window time.Duration) {
+	info, ok := decodeTokenClaims(token)
+	if !ok || info.ExpiresAt.IsZero() {
+		return
+	}
+	now := time.Now()
+	if left := info.ExpiresAt.Sub(now); left <= 0 {
+		warnf("the token expired %s", describeExpiry(info.ExpiresAt, now))
+	} else if left < window {
+		warnf("the token expires %s", describeExpiry(info.ExpiresAt, now))
+	}
+}
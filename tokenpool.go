@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// How a token pool picks the token for each request
+const (
+	// RotateOnError keeps using a token until it is rate limited or out of quota
+	RotateOnError = "on-error"
+	// RotateRoundRobin uses the tokens in turn, spreading requests evenly
+	RotateRoundRobin = "round-robin"
+)
+
+// How long a token is left alone after the server refuses it
+const (
+	rateLimitRest = time.Minute
+	quotaRest     = 24 * time.Hour
+)
+
+// TokenPool spreads requests to a server over several tokens, moving on to the next
+// when one is rate limited or runs out of quota
+type TokenPool struct {
+	mu         sync.Mutex
+	tokens     []string
+	current    int
+	roundRobin bool
+	// resting holds when each refused token may be used again
+	resting map[int]time.Time
+}
+
+// checkTokenRotation validates a --token-rotation value
+func checkTokenRotation(mode string) error {
+	switch mode {
+	case RotateOnError, RotateRoundRobin:
+		return nil
+	}
+	return fmt.Errorf("unknown token rotation %q (use on-error or round-robin)", mode)
+}
+
+// NewTokenPool returns a pool of the given tokens, or nil if there are fewer than two
+func NewTokenPool(tokens []string, mode string) *TokenPool {
+	var pool []string
+	for _, token := range tokens {
+		if token = strings.TrimSpace(token); token != "" {
+			pool = append(pool, token)
+		}
+	}
+	if len(pool) < 2 {
+		return nil
+	}
+	return &TokenPool{tokens: pool, roundRobin: mode == RotateRoundRobin, resting: make(map[int]time.Time)}
+}
+
+// tokenPoolFromFlags builds the pool from --tokens or, for the default DeepLX server,
+// the configured tokens
+func tokenPoolFromFlags(c *cli.Context) *TokenPool {
+	if tokens := c.String("tokens"); tokens != "" {
+		return NewTokenPool(strings.Split(tokens, ","), c.String("token-rotation"))
+	}
+	if c.String("provider") != ProviderDeepLX || c.IsSet("token") {
+		return nil
+	}
+	return NewTokenPool(configFor(c.Context).Tokens, c.String("token-rotation"))
+}
+
+// First returns the token requests start with
+func (p *TokenPool) First() string {
+	return p.tokens[0]
+}
+
+// pick returns the token to send the next request with and its index
+func (p *TokenPool) pick() (string, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	start := p.current
+	if p.roundRobin {
+		p.current = (p.current + 1) % len(p.tokens)
+	}
+	// Skip resting tokens, or use the one resting longest ago if they all are
+	for i := 0; i < len(p.tokens); i++ {
+		index := (start + i) % len(p.tokens)
+		if until, ok := p.resting[index]; !ok || now.After(until) {
+			delete(p.resting, index)
+			return p.tokens[index], index
+		}
+	}
+	return p.tokens[start], start
+}
+
+// rest leaves a refused token alone for a while, reporting whether another one is available
+func (p *TokenPool) rest(index int, d time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resting[index] = time.Now().Add(d)
+	if index == p.current {
+		p.current = (p.current + 1) % len(p.tokens)
+	}
+	now := time.Now()
+	for i := range p.tokens {
+		if until, ok := p.resting[i]; !ok || now.After(until) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenRestTime returns how long to leave a token alone after err, or 0 if err isn't the
+// server refusing that token's rate or quota
+func tokenRestTime(err error) time.Duration {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		return 0
+	}
+	switch statusErr.StatusCode {
+	case http.StatusTooManyRequests:
+		return rateLimitRest
+	case 456:
+		return quotaRest
+	}
+	return 0
+}
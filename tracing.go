@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP span kinds and status codes
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+
+	spanStatusOK    = 1
+	spanStatusError = 2
+)
+
+// Tracer collects spans for one invocation and exports them as OTLP/HTTP JSON when shut down
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	debug    bool
+
+	mu    sync.Mutex
+	spans []*Span
+	root  *Span
+	once  sync.Once
+}
+
+// Span is a timed operation within a trace
+type Span struct {
+	tracer   *Tracer
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+
+	mu     sync.Mutex
+	end    time.Time
+	attrs  map[string]interface{}
+	events []spanEvent
+	status int
+	errMsg string
+}
+
+// spanEvent is a point-in-time annotation on a span, such as a failover
+type spanEvent struct {
+	name  string
+	time  time.Time
+	attrs map[string]interface{}
+}
+
+// spanContextKey is the context key holding the current span
+type spanContextKey struct{}
+
+// NewTracer creates a tracer exporting to an OTLP/HTTP endpoint (nil if endpoint is empty).
+// OTEL_EXPORTER_OTLP_HEADERS and OTEL_SERVICE_NAME are honoured, and a TRACEPARENT
+// environment variable makes the invocation part of the caller's trace.
+func NewTracer(endpoint string, debug bool) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+
+	t := &Tracer{
+		endpoint: endpoint,
+		headers:  make(map[string]string),
+		service:  AppName,
+		debug:    debug,
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		t.service = name
+	}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			t.headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return t
+}
+
+// Start begins the root span of the invocation and returns a context carrying it
+func (t *Tracer) Start(ctx context.Context, name string) context.Context {
+	traceID, parentID := randomHex(16), ""
+	// traceparent: version-traceid-parentid-flags
+	if parts := strings.Split(os.Getenv("TRACEPARENT"), "-"); len(parts) == 4 && len(parts[1]) == 32 && len(parts[2]) == 16 {
+		traceID, parentID = parts[1], parts[2]
+	}
+
+	t.root = t.newSpan(traceID, parentID, name, spanKindInternal)
+	if id := requestID(ctx); id != "" {
+		t.root.SetAttr("request.id", id)
+	}
+	return context.WithValue(ctx, spanContextKey{}, t.root)
+}
+
+// Shutdown ends the root span and exports every span; later calls do nothing
+func (t *Tracer) Shutdown() {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		if t.root != nil {
+			t.root.End()
+		}
+		if err := t.export(); err != nil {
+			warnf("%s", redactSecrets(fmt.Sprintf("failed to export traces to %s: %v", t.endpoint, err)))
+		} else if t.debug {
+			debugf("Exported %d spans to %s\n", len(t.spans), t.endpoint)
+		}
+	})
+}
+
+// shutdownTracer exports the traces of the tracer in ctx, if any
+func shutdownTracer(ctx context.Context) {
+	if span, ok := ctx.Value(spanContextKey{}).(*Span); ok {
+		span.tracer.Shutdown()
+	}
+}
+
+// newSpan creates and records a span
+func (t *Tracer) newSpan(traceID, parentID, name string, kind int) *Span {
+	span := &Span{
+		tracer:   t,
+		traceID:  traceID,
+		spanID:   randomHex(8),
+		parentID: parentID,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+		attrs:    make(map[string]interface{}),
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return span
+}
+
+// startSpan starts a child of the span in ctx. Without a tracer in ctx it returns a nil
+// span, whose methods do nothing, so callers don't need to check whether tracing is on.
+func startSpan(ctx context.Context, name string, kind int) (context.Context, *Span) {
+	parent, _ := ctx.Value(spanContextKey{}).(*Span)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := parent.tracer.newSpan(parent.traceID, parent.spanID, name, kind)
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// SetAttr records an attribute (string, bool, int or float64)
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// AddEvent records a named event at the current time
+func (s *Span) AddEvent(name string, attrs map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.events = append(s.events, spanEvent{name: name, time: time.Now(), attrs: attrs})
+	s.mu.Unlock()
+}
+
+// SetError marks the span as failed, or as successful if err is nil
+func (s *Span) SetError(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if err != nil {
+		s.status = spanStatusError
+		s.errMsg = strings.SplitN(err.Error(), "\n", 2)[0]
+	} else {
+		s.status = spanStatusOK
+	}
+	s.mu.Unlock()
+}
+
+// End finishes the span
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	s.mu.Unlock()
+}
+
+// traceparent returns the W3C trace context header value for the span
+func (s *Span) traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.traceID, s.spanID)
+}
+
+// tracedHTTPClient returns a copy of client that sends the span's traceparent header,
+// so servers that understand trace context can join the trace
+func tracedHTTPClient(client *http.Client, span *Span) *http.Client {
+	if span == nil {
+		return client
+	}
+	traced := *client
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	traced.Transport = &traceTransport{base: base, span: span}
+	return &traced
+}
+
+// traceTransport adds a traceparent header to outgoing requests
+type traceTransport struct {
+	base http.RoundTripper
+	span *Span
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("traceparent", t.span.traceparent())
+
+	t.span.SetAttr("http.request.method", req.Method)
+	t.span.SetAttr("url.full", req.URL.String())
+	t.span.SetAttr("server.address", req.URL.Hostname())
+
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.span.SetAttr("http.response.status_code", resp.StatusCode)
+	}
+	return resp, err
+}
+
+// export posts all spans in OTLP/HTTP JSON encoding
+func (t *Tracer) export() error {
+	t.mu.Lock()
+	spans := make([]map[string]interface{}, 0, len(t.spans))
+	for _, span := range t.spans {
+		spans = append(spans, span.otlp())
+	}
+	t.mu.Unlock()
+
+	payload := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{
+					"service.name":    t.service,
+					"service.version": AppVersion,
+				}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/juan-de-costa-rica/deeplx-cli", "version": AppVersion},
+				"spans": spans,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// otlp renders the span in OTLP JSON form
+func (s *Span) otlp() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	end := s.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	span := map[string]interface{}{
+		"traceId":           s.traceID,
+		"spanId":            s.spanID,
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.attrs),
+	}
+	if s.parentID != "" {
+		span["parentSpanId"] = s.parentID
+	}
+	if s.status != 0 {
+		span["status"] = map[string]interface{}{"code": s.status, "message": redactSecrets(s.errMsg)}
+	}
+
+	var events []map[string]interface{}
+	for _, event := range s.events {
+		events = append(events, map[string]interface{}{
+			"name":         event.name,
+			"timeUnixNano": strconv.FormatInt(event.time.UnixNano(), 10),
+			"attributes":   otlpAttributes(event.attrs),
+		})
+	}
+	if len(events) > 0 {
+		span["events"] = events
+	}
+	return span
+}
+
+// otlpAttributes converts attributes to OTLP key/value pairs
+func otlpAttributes(attrs map[string]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(attrs))
+	for key, value := range attrs {
+		var v map[string]interface{}
+		switch value := value.(type) {
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": redactSecrets(fmt.Sprint(value))}
+		}
+		result = append(result, map[string]interface{}{"key": key, "value": v})
+	}
+	return result
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// transcriptEntry is one translated line of a session
+type transcriptEntry struct {
+	Time   time.Time
+	Text   string
+	Output *TranslationOutput
+	// Speaker is who said the line in a chat, shown instead of its language
+	Speaker string
+}
+
+// Transcript records an interactive session so it can be saved as a bilingual Markdown document
+type Transcript struct {
+	Started time.Time
+	Entries []transcriptEntry
+}
+
+// NewTranscript starts an empty transcript
+func NewTranscript() *Transcript {
+	return &Transcript{Started: time.Now()}
+}
+
+// Add records a line and its translations
+func (t *Transcript) Add(text string, output *TranslationOutput) {
+	t.Entries = append(t.Entries, transcriptEntry{Time: time.Now(), Text: text, Output: output})
+}
+
+// AddSpoken records a line a speaker said in a chat and its translation
+func (t *Transcript) AddSpoken(speaker, text string, output *TranslationOutput) {
+	t.Entries = append(t.Entries, transcriptEntry{Time: time.Now(), Text: text, Output: output, Speaker: speaker})
+}
+
+// WriteMarkdown writes the transcript with each line followed by its translations
+func (t *Transcript) WriteMarkdown(w io.Writer) error {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Translation session\n\n")
+	fmt.Fprintf(&b, "Started %s · %d entries\n", t.Started.Format("2006-01-02 15:04:05 MST"), len(t.Entries))
+
+	for _, entry := range t.Entries {
+		targets := make([]string, len(entry.Output.Translations))
+		for i, result := range entry.Output.Translations {
+			targets[i] = result.Tag
+		}
+		fmt.Fprintf(&b, "\n## %s · %s → %s\n\n", entry.Time.Format("15:04:05"), entry.Output.SourceTag, strings.Join(targets, ", "))
+		label := entry.Output.SourceTag
+		if entry.Speaker != "" {
+			label = entry.Speaker
+		}
+		fmt.Fprintf(&b, "**%s:** %s\n", label, entry.Text)
+		for _, result := range entry.Output.Translations {
+			fmt.Fprintf(&b, "\n**%s:** %s\n", result.Tag, result.Text)
+			if len(result.Alternatives) > 0 {
+				fmt.Fprintf(&b, "\n_Alternatives:_ %s\n", strings.Join(result.Alternatives, "; "))
+			}
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// Save writes the transcript to path as Markdown
+func (t *Transcript) Save(path string) error {
+	var b bytes.Buffer
+	if err := t.WriteMarkdown(&b); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(), 0644)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Update checks ask GitHub for the latest release at most once a day, and the notice of a
+// newer one is shown at most once a day too
+const (
+	updateRepo          = "juan-de-costa-rica/deeplx-cli"
+	updateCheckInterval = 24 * time.Hour
+	updateCheckTimeout  = 3 * time.Second
+
+	UpdateCheckOn  = "on"
+	UpdateCheckOff = "off"
+)
+
+// updateState is what the update checks remember between invocations
+type updateState struct {
+	Latest     string    `json:"latest,omitempty"`
+	CheckedAt  time.Time `json:"checked_at"`
+	NotifiedAt time.Time `json:"notified_at"`
+}
+
+// checkUpdateCheck validates an update check setting
+func checkUpdateCheck(setting string) error {
+	switch setting {
+	case UpdateCheckOn, UpdateCheckOff:
+		return nil
+	}
+	return fmt.Errorf("unknown update check setting %q (use on or off)", setting)
+}
+
+// updatePath returns where the update check state is kept
+func updatePath() (string, error) {
+	dir, err := appDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "update.json"), nil
+}
+
+// loadUpdateState reads the update check state, empty if there is none
+func loadUpdateState() updateState {
+	var state updateState
+	path, err := updatePath()
+	if err != nil {
+		return state
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+// saveUpdateState writes the update check state
+func saveUpdateState(state updateState) {
+	path, err := updatePath()
+	if err != nil {
+		return
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, path)
+}
+
+// parseVersion splits a version such as "v1.2.3" into its numbers, reporting false for
+// anything else, e.g. development builds
+func parseVersion(version string) ([3]int, bool) {
+	var numbers [3]int
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	if len(parts) != 3 {
+		return numbers, false
+	}
+	for i, part := range parts {
+		// Pre-releases count as their release
+		part, _, _ = strings.Cut(part, "-")
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return numbers, false
+		}
+		numbers[i] = n
+	}
+	return numbers, true
+}
+
+// newerVersion reports whether latest is a later release than current
+func newerVersion(latest, current string) bool {
+	l, ok := parseVersion(latest)
+	c, ok2 := parseVersion(current)
+	if !ok || !ok2 {
+		return false
+	}
+	for i := range l {
+		if l[i] != c[i] {
+			return l[i] > c[i]
+		}
+	}
+	return false
+}
+
+// fetchLatestVersion asks GitHub for the tag of the latest release
+func fetchLatestVersion(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, updateCheckTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/repos/"+updateRepo+"/releases/latest", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/%s", AppName, AppVersion))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", err
+	}
+	return release.TagName, nil
+}
+
+// updateNotice returns the notice of a newer release
+func updateNotice(latest string) string {
+	return fmt.Sprintf("A newer version of %s is available: %s (this is %s)\nhttps://github.com/%s/releases/latest\nTurn these notices off with: %s config set --update-check off",
+		AppName, latest, AppVersion, updateRepo, AppName)
+}
+
+// updateChecksEnabled reports whether update checks are wanted: they are on unless turned
+// off, and there is nothing to compare for development builds
+func updateChecksEnabled(config Config) bool {
+	if _, ok := parseVersion(AppVersion); !ok {
+		return false
+	}
+	return config.UpdateCheck != UpdateCheckOff && os.Getenv("TRANSLATE_NO_UPDATE_CHECK") == ""
+}
+
+// startUpdateCheck refreshes the latest release in the background when the last check is
+// over a day old, for interactive use only. It isn't waited for: a check cut short by the
+// program ending is made again next time.
+func startUpdateCheck(config Config) {
+	if !updateChecksEnabled(config) || !isTerminal(os.Stderr) || time.Since(loadUpdateState().CheckedAt) < updateCheckInterval {
+		return
+	}
+	go func() {
+		latest, err := fetchLatestVersion(context.Background())
+		if err != nil {
+			return
+		}
+		state := loadUpdateState()
+		state.Latest = latest
+		state.CheckedAt = time.Now()
+		saveUpdateState(state)
+	}()
+}
+
+// notifyUpdate tells the user on stderr about a newer release found by an earlier check,
+// once a day and only on a terminal, so scripts and editors never see it
+func notifyUpdate(config Config) {
+	if quiet || !updateChecksEnabled(config) || !isTerminal(os.Stderr) {
+		return
+	}
+	state := loadUpdateState()
+	if !newerVersion(state.Latest, AppVersion) || time.Since(state.NotifiedAt) < updateCheckInterval {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\n%s\n", updateNotice(state.Latest))
+	state.NotifiedAt = time.Now()
+	saveUpdateState(state)
+}
+
+// printVersion prints the version line on stdout, for scripts to parse. A newer release
+// found by an earlier background check is mentioned on stderr, without a check of its own
+// that would hold up the output.
+func printVersion(c *cli.Context) {
+	fmt.Printf("%s version %s\n", c.App.Name, c.App.Version)
+	config := configFor(c.Context)
+	if quiet || !updateChecksEnabled(config) || !isTerminal(os.Stderr) {
+		return
+	}
+	if state := loadUpdateState(); newerVersion(state.Latest, AppVersion) {
+		fmt.Fprintln(os.Stderr, updateNotice(state.Latest))
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// unlimitedCharacters and above is how DeepLX proxies report that there is no quota
+const unlimitedCharacters = 1000000000000
+
+// deepLXUsagePaths are where DeepLX forks report usage, tried in order
+var deepLXUsagePaths = []string{"/v2/usage", "/v1/usage", "/usage"}
+
+// errUsageUnsupported is returned for providers whose servers don't report usage
+var errUsageUnsupported = errors.New("the server doesn't report usage")
+
+// ServerUsage is the character consumption and quota a server reports
+type ServerUsage struct {
+	Characters int64 `json:"character_count"`
+	// Limit is the quota of the billing period, or 0 if there is none
+	Limit int64 `json:"character_limit,omitempty"`
+}
+
+// usageProvider is implemented by providers whose servers can report usage
+type usageProvider interface {
+	Usage(ctx context.Context, conn ProviderConn) (*ServerUsage, error)
+}
+
+// parseServerUsage reads the usage from a DeepL-style response, or the field names some
+// DeepLX forks use instead
+func parseServerUsage(fields map[string]interface{}) (*ServerUsage, bool) {
+	number := func(keys ...string) (int64, bool) {
+		for _, key := range keys {
+			if n, ok := fields[key].(float64); ok {
+				return int64(n), true
+			}
+		}
+		return 0, false
+	}
+	characters, ok := number("character_count", "characters", "total_characters")
+	if !ok {
+		return nil, false
+	}
+	limit, _ := number("character_limit", "limit")
+	if limit >= unlimitedCharacters {
+		limit = 0
+	}
+	return &ServerUsage{Characters: characters, Limit: limit}, true
+}
+
+// Usage implements usageProvider
+func (p deepLProvider) Usage(ctx context.Context, conn ProviderConn) (*ServerUsage, error) {
+	var fields map[string]interface{}
+	if err := providerRequest(ctx, conn, http.MethodGet, "/v2/usage", nil, p.authorize, &fields); err != nil {
+		return nil, err
+	}
+	usage, ok := parseServerUsage(fields)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse response: no character_count")
+	}
+	return usage, nil
+}
+
+// Usage implements usageProvider; stock DeepLX has no usage endpoint, but some forks do
+func (deepLXProvider) Usage(ctx context.Context, conn ProviderConn) (*ServerUsage, error) {
+	authorize := func(req *http.Request, conn ProviderConn) {
+		setTokenAuth(req, conn.Token, conn.AuthStyle)
+	}
+	for _, path := range deepLXUsagePaths {
+		var fields map[string]interface{}
+		if err := providerRequest(ctx, conn, http.MethodGet, path, nil, authorize, &fields); err != nil {
+			var statusErr *StatusError
+			if errors.As(err, &statusErr) && statusErr.StatusCode != http.StatusUnauthorized && statusErr.StatusCode != http.StatusForbidden {
+				continue
+			}
+			if strings.HasPrefix(err.Error(), "failed to parse response") {
+				continue
+			}
+			return nil, err
+		}
+		if usage, ok := parseServerUsage(fields); ok {
+			return usage, nil
+		}
+	}
+	return nil, errUsageUnsupported
+}
+
+// Usage returns the usage reported by the first server that reports it
+func (cl *Client) Usage(ctx context.Context) (*ServerUsage, error) {
+	p, ok := cl.provider().(usageProvider)
+	if !ok {
+		return nil, errUsageUnsupported
+	}
+	err := fmt.Errorf("no server configured")
+	for _, server := range cl.Servers {
+		var conn ProviderConn
+		if conn, err = cl.conn(server, nil); err != nil {
+			continue
+		}
+		var usage *ServerUsage
+		if usage, err = p.Usage(ctx, conn); err == nil {
+			return usage, nil
+		}
+	}
+	return nil, err
+}
+
+// usageOutput is the JSON output of the usage command
+type usageOutput struct {
+	Schema   int    `json:"schema"`
+	Provider string `json:"provider"`
+	Server   string `json:"server"`
+	// Remote is the usage the server reports, or nil if it reports none
+	Remote *ServerUsage `json:"remote"`
+	// Local is what the CLI sent to the server this month
+	Local usageCount `json:"local"`
+	Month string     `json:"month"`
+}
+
+// runUsage handles the usage command, showing the quota the server reports and the
+// characters the CLI counted itself
+func runUsage(c *cli.Context) error {
+	server := c.String("url")
+	output := usageOutput{
+		Schema:   SchemaVersion,
+		Provider: c.String("provider"),
+		Server:   server,
+		Month:    time.Now().Format(ledgerMonth),
+	}
+	output.Local = loadLedger().total(output.Month, output.Provider, server)
+
+	// The daemon would answer for itself rather than for the server
+	c.Set("no-daemon", "true")
+	usage, err := sharedClient(c).Usage(c.Context)
+	if err != nil && !errors.Is(err, errUsageUnsupported) {
+		// Local counts are still worth showing when the server can't be asked
+		warnf("failed to get usage from the server: %s", redactSecrets(err.Error()))
+	}
+	output.Remote = usage
+
+	if c.String("output") == OutputJSON {
+		data, err := json.Marshal(output)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Output error: %s", err), 1)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Printf("Provider: %s (%s)\n", output.Provider, redactSecrets(server))
+	switch {
+	case usage == nil:
+		fmt.Println("Server usage: not reported")
+	case usage.Limit > 0:
+		fmt.Printf("Server usage: %d of %d characters (%.1f%%)\n", usage.Characters, usage.Limit, float64(usage.Characters)*100/float64(usage.Limit))
+	default:
+		fmt.Printf("Server usage: %d characters (no limit)\n", usage.Characters)
+	}
+	fmt.Printf("Sent by this CLI in %s: %d characters in %d requests\n", output.Month, output.Local.Characters, output.Local.Requests)
+
+	return nil
+}
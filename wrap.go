@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v2"
+)
+
+// defaultWrapWidth is used when wrapping is requested but the terminal width is unknown
+const defaultWrapWidth = 80
+
+// outputWidth returns the width to wrap stdout at: $COLUMNS if set, else the terminal width
+func outputWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if width, _ := terminalSize(os.Stdout); width > 0 {
+		return width
+	}
+	return defaultWrapWidth
+}
+
+// wrapFromFlags returns the width to wrap text output at, 0 for none, and whether to
+// reflow it first: --wrap N reflows it to N columns, and output to a terminal is wrapped
+// at its width, unless --no-wrap is given
+func wrapFromFlags(c *cli.Context) (int, bool) {
+	switch {
+	case c.Bool("no-wrap"):
+		return 0, false
+	case c.Int("wrap") > 0:
+		return c.Int("wrap"), true
+	case isTerminal(os.Stdout):
+		return outputWidth(), false
+	}
+	return 0, false
+}
+
+// blockStartPattern matches the lines that start a block of their own: indented lines,
+// list items and Markdown headings and quotes
+var blockStartPattern = regexp.MustCompile(`^([ \t]|[-*+•] |\d+[.)] |#|>)`)
+
+// reflowText joins the lines of each paragraph of text, so that wrapping fills lines up
+// to the width. Blank lines, and the lines that start a block such as a list item, keep
+// their line breaks. Lines ending or starting with a wide (CJK) character are joined
+// without a space.
+func reflowText(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		n := len(lines)
+		if n == 0 || strings.TrimSpace(lines[n-1]) == "" || strings.TrimSpace(line) == "" || blockStartPattern.MatchString(line) {
+			lines = append(lines, line)
+			continue
+		}
+		prev := strings.TrimRight(lines[n-1], " \t")
+		last, _ := utf8.DecodeLastRuneInString(prev)
+		first, _ := utf8.DecodeRuneInString(line)
+		separator := " "
+		if isWideRune(last) || isWideRune(first) {
+			separator = ""
+		}
+		lines[n-1] = prev + separator + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapText wraps text to width terminal columns, breaking at spaces where possible and
+// between wide (CJK) characters, which don't use spaces between words. Existing line
+// breaks are kept and words longer than a line are split.
+func wrapText(text string, width int) string {
+	if width <= 0 {
+		return text
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = wrapLine(line, width)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapNumbered renders "n. text" wrapped to width, indenting continuation lines under the text
+func wrapNumbered(n int, text string, width int) string {
+	prefix := strconv.Itoa(n) + ". "
+	if width <= 0 {
+		return prefix + text
+	}
+	indent := strings.Repeat(" ", len(prefix))
+	lines := strings.Split(wrapText(text, max(width-len(prefix), 10)), "\n")
+	for i := range lines {
+		if i == 0 {
+			lines[i] = prefix + lines[i]
+		} else {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wrapLine wraps a single line of text
+func wrapLine(line string, width int) string {
+	if displayWidth(line) <= width {
+		return line
+	}
+
+	var out strings.Builder
+	var current strings.Builder
+	currentWidth := 0
+	pendingSpace := ""
+
+	flush := func() {
+		out.WriteString(strings.TrimRight(current.String(), " "))
+		out.WriteByte('\n')
+		current.Reset()
+		currentWidth = 0
+	}
+
+	for _, token := range wrapTokens(line) {
+		if strings.TrimSpace(token) == "" {
+			pendingSpace = token
+			continue
+		}
+
+		tokenWidth := displayWidth(token)
+		spaceWidth := displayWidth(pendingSpace)
+		if currentWidth > 0 && currentWidth+spaceWidth+tokenWidth > width {
+			flush()
+			pendingSpace = ""
+			spaceWidth = 0
+		}
+		// Keep indentation at the start of the line, drop spaces carried over a break
+		if current.Len() > 0 || out.Len() == 0 {
+			current.WriteString(pendingSpace)
+			currentWidth += spaceWidth
+		}
+		pendingSpace = ""
+
+		// Split words that don't fit on a line of their own
+		for _, r := range token {
+			w := runeWidth(r)
+			if currentWidth > 0 && currentWidth+w > width {
+				flush()
+			}
+			current.WriteRune(r)
+			currentWidth += w
+		}
+	}
+
+	out.WriteString(current.String())
+	return out.String()
+}
+
+// wrapTokens splits a line into words, runs of spaces and single wide characters,
+// each of which may be moved to the next line as a unit
+func wrapTokens(line string) []string {
+	var tokens []string
+	start := 0
+	inSpace := false
+	for i, r := range line {
+		switch {
+		case isWideRune(r) && unicode.IsPunct(r) && i == start && len(tokens) > 0 && !inSpace:
+			// Keep CJK punctuation such as 。 and 、 with the character before it
+			tokens[len(tokens)-1] += string(r)
+			start = i + len(string(r))
+			continue
+		case isWideRune(r) && !unicode.IsPunct(r):
+			if i > start {
+				tokens = append(tokens, line[start:i])
+			}
+			tokens = append(tokens, string(r))
+			start = i + len(string(r))
+			inSpace = false
+			continue
+		case r == ' ' || r == '\t':
+			if !inSpace && i > start {
+				tokens = append(tokens, line[start:i])
+				start = i
+			}
+			inSpace = true
+		default:
+			if inSpace && i > start {
+				tokens = append(tokens, line[start:i])
+				start = i
+			}
+			inSpace = false
+		}
+	}
+	if start < len(line) {
+		tokens = append(tokens, line[start:])
+	}
+	return tokens
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// xpathStep is one location step of the supported XPath subset
+type xpathStep struct {
+	descendant bool   // reached via "//" rather than "/"
+	name       string // element name, or "*"
+	attr       string // predicate [@attr] or [@attr='value']
+	attrValue  string
+	hasValue   bool
+}
+
+// xpathExpr is a compiled XPath expression selecting text nodes or attributes of elements
+type xpathExpr struct {
+	steps []xpathStep
+	// attribute to select (from a final @name step); empty selects the element's text
+	attribute string
+}
+
+// compileXPath parses the XPath subset used by the xml command: absolute paths made of
+// element names or *, "/" and "//" separators, [@attr] / [@attr='value'] predicates,
+// and an optional final text() or @attr step.
+func compileXPath(expr string) (*xpathExpr, error) {
+	expr = strings.TrimSpace(expr)
+	if !strings.HasPrefix(expr, "/") {
+		return nil, fmt.Errorf("xpath must be absolute (start with / or //): %s", expr)
+	}
+
+	compiled := &xpathExpr{}
+	rest := expr
+	for rest != "" {
+		step := xpathStep{}
+		if strings.HasPrefix(rest, "//") {
+			step.descendant = true
+			rest = rest[2:]
+		} else if strings.HasPrefix(rest, "/") {
+			rest = rest[1:]
+		} else {
+			return nil, fmt.Errorf("unexpected %q in xpath", rest)
+		}
+
+		// Find the end of this step, skipping over slashes inside predicates
+		end, depth := len(rest), 0
+		for i, r := range rest {
+			if r == '[' {
+				depth++
+			} else if r == ']' {
+				depth--
+			} else if r == '/' && depth == 0 {
+				end = i
+				break
+			}
+		}
+		token := rest[:end]
+		rest = rest[end:]
+
+		switch {
+		case token == "text()":
+			if rest != "" || step.descendant {
+				return nil, fmt.Errorf("text() must be the last step: %s", expr)
+			}
+			return compiled, compiled.validate(expr)
+		case strings.HasPrefix(token, "@"):
+			if rest != "" || step.descendant {
+				return nil, fmt.Errorf("@attribute must be the last step: %s", expr)
+			}
+			compiled.attribute = token[1:]
+			return compiled, compiled.validate(expr)
+		}
+
+		name, predicate, hasPredicate := strings.Cut(token, "[")
+		step.name = name
+		if step.name == "" {
+			return nil, fmt.Errorf("empty step in xpath: %s", expr)
+		}
+		if hasPredicate {
+			if !strings.HasSuffix(predicate, "]") || !strings.HasPrefix(predicate, "@") {
+				return nil, fmt.Errorf("only [@attr] and [@attr='value'] predicates are supported: %s", expr)
+			}
+			predicate = strings.TrimSuffix(predicate[1:], "]")
+			if attr, value, ok := strings.Cut(predicate, "="); ok {
+				value = strings.TrimSpace(value)
+				if len(value) < 2 || (value[0] != '\'' && value[0] != '"') || value[len(value)-1] != value[0] {
+					return nil, fmt.Errorf("predicate value must be quoted: %s", expr)
+				}
+				step.attr = strings.TrimSpace(attr)
+				step.attrValue = value[1 : len(value)-1]
+				step.hasValue = true
+			} else {
+				step.attr = strings.TrimSpace(predicate)
+			}
+		}
+		compiled.steps = append(compiled.steps, step)
+	}
+	return compiled, compiled.validate(expr)
+}
+
+// validate checks that the expression selects at least one element
+func (x *xpathExpr) validate(expr string) error {
+	if len(x.steps) == 0 {
+		return fmt.Errorf("xpath selects no elements: %s", expr)
+	}
+	return nil
+}
+
+// xmlElement is an open element during scanning
+type xmlElement struct {
+	name  string
+	attrs []xml.Attr
+}
+
+// matches reports whether the open element stack is selected by the expression
+func (x *xpathExpr) matches(stack []xmlElement) bool {
+	return matchSteps(x.steps, stack)
+}
+
+// matchSteps matches steps against the stack from the root down
+func matchSteps(steps []xpathStep, stack []xmlElement) bool {
+	if len(steps) == 0 {
+		return len(stack) == 0
+	}
+	if len(stack) == 0 {
+		return false
+	}
+
+	step := steps[0]
+	if step.descendant {
+		// "//" may skip any number of ancestors
+		for skip := 0; skip < len(stack); skip++ {
+			if step.matchesElement(stack[skip]) && matchSteps(steps[1:], stack[skip+1:]) {
+				return true
+			}
+		}
+		return false
+	}
+	return step.matchesElement(stack[0]) && matchSteps(steps[1:], stack[1:])
+}
+
+// matchesElement checks the step's name test and predicate against one element
+func (s xpathStep) matchesElement(el xmlElement) bool {
+	if s.name != "*" && s.name != el.name {
+		// Allow unprefixed names to match prefixed elements
+		if _, local, ok := strings.Cut(el.name, ":"); !ok || s.name != local {
+			return false
+		}
+	}
+	if s.attr == "" {
+		return true
+	}
+	for _, attr := range el.attrs {
+		if xmlName(attr.Name) == s.attr {
+			return !s.hasValue || attr.Value == s.attrValue
+		}
+	}
+	return false
+}
+
+// xmlName renders a raw token name with its prefix
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// xmlEdit replaces a byte range of the original document
+type xmlEdit struct {
+	start, end int64
+	text       string // text to translate
+	attr       string // attribute being replaced, empty for text nodes
+	cdata      bool
+}
+
+// findXMLEdits scans a document and returns the text nodes or attributes selected by expr
+func findXMLEdits(data []byte, expr *xpathExpr) ([]xmlEdit, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = true
+
+	var edits []xmlEdit
+	var stack []xmlElement
+	for {
+		start := dec.InputOffset()
+		token, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+		end := dec.InputOffset()
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			stack = append(stack, xmlElement{name: xmlName(t.Name), attrs: t.Attr})
+			if expr.attribute != "" && expr.matches(stack) {
+				for _, attr := range t.Attr {
+					if xmlName(attr.Name) == expr.attribute && strings.TrimSpace(attr.Value) != "" {
+						edits = append(edits, xmlEdit{start: start, end: end, text: attr.Value, attr: expr.attribute})
+					}
+				}
+			}
+			// Self-closing elements produce their end token without consuming input
+			if bytes.HasSuffix(bytes.TrimRight(data[start:end], " \t\r\n"), []byte("/>")) {
+				stack = stack[:len(stack)-1]
+				dec.RawToken()
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if expr.attribute == "" && expr.matches(stack) && strings.TrimSpace(string(t)) != "" {
+				edits = append(edits, xmlEdit{
+					start: start,
+					end:   end,
+					text:  string(t),
+					cdata: bytes.HasPrefix(data[start:end], []byte("<![CDATA[")),
+				})
+			}
+		}
+	}
+	return edits, nil
+}
+
+// applyXMLEdits splices translations into the original document
+func applyXMLEdits(data []byte, edits []xmlEdit, translations []string) ([]byte, error) {
+	var out bytes.Buffer
+	var pos int64
+	for i, edit := range edits {
+		out.Write(data[pos:edit.start])
+		raw := data[edit.start:edit.end]
+
+		switch {
+		case edit.attr != "":
+			replaced, err := replaceXMLAttr(raw, edit.attr, translations[i])
+			if err != nil {
+				return nil, err
+			}
+			out.Write(replaced)
+		case edit.cdata:
+			out.WriteString("<![CDATA[")
+			out.WriteString(strings.ReplaceAll(translations[i], "]]>", "]]]]><![CDATA[>"))
+			out.WriteString("]]>")
+		default:
+			xml.EscapeText(&out, []byte(translations[i]))
+		}
+		pos = edit.end
+	}
+	out.Write(data[pos:])
+	return out.Bytes(), nil
+}
+
+// replaceXMLAttr rewrites the value of one attribute inside a raw start tag
+func replaceXMLAttr(tag []byte, name, value string) ([]byte, error) {
+	s := string(tag)
+	for i := 0; i < len(s); {
+		idx := strings.Index(s[i:], name)
+		if idx < 0 {
+			break
+		}
+		idx += i
+		after := strings.TrimLeft(s[idx+len(name):], " \t\r\n")
+		// Must be a whole attribute name followed by =
+		before := s[idx-1]
+		if (before == ' ' || before == '\t' || before == '\n' || before == '\r') && strings.HasPrefix(after, "=") {
+			valueStart := len(s) - len(strings.TrimLeft(after[1:], " \t\r\n"))
+			quote := s[valueStart]
+			valueEnd := strings.IndexByte(s[valueStart+1:], quote)
+			if valueEnd < 0 {
+				break
+			}
+			valueEnd += valueStart + 1
+
+			var escaped bytes.Buffer
+			xml.EscapeText(&escaped, []byte(value))
+			return []byte(s[:valueStart+1] + escaped.String() + s[valueEnd:]), nil
+		}
+		i = idx + len(name)
+	}
+	return nil, fmt.Errorf("attribute %s not found in %s", name, s)
+}
+
+// runXML handles the xml command
+func runXML(c *cli.Context) error {
+	args, err := parseTrailingFlags(c)
+	if err != nil {
+		return cli.Exit(err.Error(), ExitUsage)
+	}
+	if len(args) != 1 || c.String("xpath") == "" {
+		return cli.Exit("Usage: translate xml FILE --xpath EXPR", ExitUsage)
+	}
+	path := args[0]
+
+	expr, err := compileXPath(c.String("xpath"))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("XPath error: %s", err), 1)
+	}
+
+	targets := splitLangList(c.String("target"))
+	if len(targets) != 1 {
+		return cli.Exit("Translation error: xml needs exactly one target language", ExitUsage)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Read error: %s", err), 1)
+	}
+
+	edits, err := findXMLEdits(data, expr)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("%s: %s", path, err), 1)
+	}
+	if c.Bool("debug") {
+		debugf("%d nodes matched %s\n", len(edits), c.String("xpath"))
+	}
+
+	config := configFor(c.Context)
+	client := sharedClient(c)
+	client.Cache = NewCache(len(edits), 0)
+	sourceLang := toDeepLCode(c.String("source"), true)
+	targetLang := resolveTargetVariant(toDeepLCode(targets[0], false), config.VariantPreferences, false)
+
+	progress := startProgress("Translating nodes", len(edits), c.Bool("debug"))
+	translations := make([]string, len(edits))
+	for i, edit := range edits {
+		// Translate the trimmed text so surrounding indentation survives
+		text := strings.TrimSpace(edit.text)
+		leading := edit.text[:strings.Index(edit.text, text)]
+		trailing := edit.text[len(leading)+len(text):]
+
+		resp, _, err := client.Translate(c.Context, text, sourceLang, targetLang)
+		progress.Step(err)
+		if err != nil {
+			progress.Stop()
+			return translationExit(err)
+		}
+		translations[i] = leading + resp.Data + trailing
+	}
+	progress.Stop()
+	reportSkipped(client, targetLang)
+
+	result, err := applyXMLEdits(data, edits, translations)
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("XML error: %s", err), 1)
+	}
+
+	// Refuse to write anything that no longer parses
+	check := xml.NewDecoder(bytes.NewReader(result))
+	for {
+		if _, err := check.RawToken(); err == io.EOF {
+			break
+		} else if err != nil {
+			return cli.Exit(fmt.Sprintf("XML error: translated document is not valid XML: %s", err), 1)
+		}
+	}
+
+	switch {
+	case c.Bool("in-place"):
+		info, err := os.Stat(path)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+		err = os.WriteFile(path, result, info.Mode().Perm())
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+	case c.String("out") != "":
+		if err := os.WriteFile(c.String("out"), result, 0644); err != nil {
+			return cli.Exit(fmt.Sprintf("Write error: %s", err), 1)
+		}
+	default:
+		os.Stdout.Write(result)
+	}
+	return nil
+}
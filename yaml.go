@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// yamlLine is a significant line of a YAML document: its indentation and its text without
+// comments
+type yamlLine struct {
+	indent int
+	text   string
+	number int
+}
+
+// parseYAML parses the YAML subset used for configuration files: mappings and sequences
+// nested by indentation, one-line flow sequences and mappings, quoted and plain scalars
+// and comments. Anchors, tags and multi-line scalars aren't supported.
+func parseYAML(data string) (interface{}, error) {
+	var lines []yamlLine
+	for i, line := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		if strings.Contains(line, "\t") && strings.TrimLeft(line, " \t") != strings.TrimLeft(line, " ") {
+			return nil, fmt.Errorf("line %d: tabs aren't allowed for indentation", i+1)
+		}
+		text := strings.TrimRight(stripYAMLComment(line), " ")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{indent: len(text) - len(trimmed), text: trimmed, number: i + 1})
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	value, next, err := parseYAMLBlock(lines, 0, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if next < len(lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", lines[next].number)
+	}
+	return value, nil
+}
+
+// stripYAMLComment removes a # comment that starts outside quotes
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			i, quote = yamlQuoted(line, i, quote)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlQuoted steps over text[i] inside a quoted scalar opened by quote, returning the
+// index of the last byte stepped over and the quote still open, or 0 if it closed there.
+// Double quotes close at an unescaped quote.
+func yamlQuoted(text string, i int, quote byte) (int, byte) {
+	switch {
+	case quote == '"' && text[i] == '\\' && i+1 < len(text):
+		return i + 1, quote
+	case text[i] == quote:
+		return i, 0
+	}
+	return i, quote
+}
+
+// isYAMLSequenceItem reports whether a line starts a sequence item
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseYAMLBlock parses the mapping or sequence starting at lines[i] with the given
+// indentation, returning it and the index of the first line after it
+func parseYAMLBlock(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	if isYAMLSequenceItem(lines[i].text) {
+		return parseYAMLSequence(lines, i, indent)
+	}
+	return parseYAMLMapping(lines, i, indent)
+}
+
+// parseYAMLSequence parses "- item" lines
+func parseYAMLSequence(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	items := []interface{}{}
+	for i < len(lines) && lines[i].indent == indent && isYAMLSequenceItem(lines[i].text) {
+		line := lines[i]
+		rest := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		switch {
+		case isYAMLSequenceItem(rest):
+			// A sequence starting on the item's line continues at the indentation of its first item
+			lines[i] = yamlLine{indent: indent + len(line.text) - len(rest), text: rest, number: line.number}
+			value, next, err := parseYAMLSequence(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, value)
+			i = next
+		case rest == "":
+			// The item is the block on the following, more indented lines
+			if i+1 >= len(lines) || lines[i+1].indent <= indent {
+				items = append(items, nil)
+				i++
+				continue
+			}
+			value, next, err := parseYAMLBlock(lines, i+1, lines[i+1].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, value)
+			i = next
+		case yamlKeyEnd(rest) >= 0:
+			// A mapping starting on the item's line continues at the indentation of its first key
+			lines[i] = yamlLine{indent: indent + len(line.text) - len(rest), text: rest, number: line.number}
+			value, next, err := parseYAMLMapping(lines, i, lines[i].indent)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, value)
+			i = next
+		default:
+			value, err := parseYAMLValue(rest)
+			if err != nil {
+				return nil, 0, fmt.Errorf("line %d: %v", line.number, err)
+			}
+			items = append(items, value)
+			i++
+		}
+	}
+	return items, i, nil
+}
+
+// parseYAMLMapping parses "key: value" lines
+func parseYAMLMapping(lines []yamlLine, i, indent int) (interface{}, int, error) {
+	mapping := map[string]interface{}{}
+	for i < len(lines) && lines[i].indent == indent && !isYAMLSequenceItem(lines[i].text) {
+		line := lines[i]
+		end := yamlKeyEnd(line.text)
+		if end < 0 {
+			return nil, 0, fmt.Errorf("line %d: expected \"key: value\"", line.number)
+		}
+		key, err := parseYAMLScalar(strings.TrimSpace(line.text[:end]))
+		if err != nil {
+			return nil, 0, fmt.Errorf("line %d: %v", line.number, err)
+		}
+		name := fmt.Sprint(key)
+		if _, exists := mapping[name]; exists {
+			return nil, 0, fmt.Errorf("line %d: duplicate key %q", line.number, name)
+		}
+
+		rest := strings.TrimSpace(line.text[end+1:])
+		i++
+		switch {
+		case rest != "":
+			if mapping[name], err = parseYAMLValue(rest); err != nil {
+				return nil, 0, fmt.Errorf("line %d: %v", line.number, err)
+			}
+		case i < len(lines) && (lines[i].indent > indent || lines[i].indent == indent && isYAMLSequenceItem(lines[i].text)):
+			// A nested block, or a sequence at the key's own indentation
+			if mapping[name], i, err = parseYAMLBlock(lines, i, lines[i].indent); err != nil {
+				return nil, 0, err
+			}
+		default:
+			mapping[name] = nil
+		}
+	}
+	if i < len(lines) && lines[i].indent > indent {
+		return nil, 0, fmt.Errorf("line %d: unexpected indentation", lines[i].number)
+	}
+	return mapping, i, nil
+}
+
+// yamlKeyEnd returns the index of the colon ending a mapping key outside quotes and
+// brackets, or -1 if text isn't a "key: value" pair
+func yamlKeyEnd(text string) int {
+	var quote byte
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			i, quote = yamlQuoted(text, i, quote)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ':' && depth == 0 && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+// parseYAMLValue parses a scalar or a flow sequence or mapping
+func parseYAMLValue(text string) (interface{}, error) {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		value, rest, err := parseYAMLFlow(text)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after %s", rest, text[:len(text)-len(rest)])
+		}
+		return value, nil
+	}
+	return parseYAMLScalar(text)
+}
+
+// parseYAMLFlow parses a flow collection at the start of text, returning the rest
+func parseYAMLFlow(text string) (interface{}, string, error) {
+	open := text[0]
+	closer := byte(']')
+	if open == '{' {
+		closer = '}'
+	}
+	rest := strings.TrimSpace(text[1:])
+	var items []interface{}
+	mapping := map[string]interface{}{}
+	for {
+		if rest == "" {
+			return nil, "", fmt.Errorf("unterminated %c", open)
+		}
+		if rest[0] == closer {
+			rest = rest[1:]
+			break
+		}
+
+		var value interface{}
+		var err error
+		if rest[0] == '[' || rest[0] == '{' {
+			value, rest, err = parseYAMLFlow(rest)
+		} else {
+			end := yamlFlowEnd(rest, open == '{')
+			value, err = parseYAMLScalar(strings.TrimSpace(rest[:end]))
+			rest = rest[end:]
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		rest = strings.TrimSpace(rest)
+
+		if open == '{' {
+			if !strings.HasPrefix(rest, ":") {
+				return nil, "", fmt.Errorf("expected ':' after key %v", value)
+			}
+			rest = strings.TrimSpace(rest[1:])
+			var item interface{}
+			if rest != "" && (rest[0] == '[' || rest[0] == '{') {
+				item, rest, err = parseYAMLFlow(rest)
+			} else {
+				end := yamlFlowEnd(rest, false)
+				item, err = parseYAMLScalar(strings.TrimSpace(rest[:end]))
+				rest = rest[end:]
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			mapping[fmt.Sprint(value)] = item
+			rest = strings.TrimSpace(rest)
+		} else {
+			items = append(items, value)
+		}
+
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimSpace(rest[1:])
+		} else if rest != "" && rest[0] != closer {
+			return nil, "", fmt.Errorf("expected ',' or '%c'", closer)
+		}
+	}
+	if open == '{' {
+		return mapping, rest, nil
+	}
+	if items == nil {
+		items = []interface{}{}
+	}
+	return items, rest, nil
+}
+
+// yamlFlowEnd returns the end of a scalar inside a flow collection, at a comma, a closing
+// bracket or, for keys, a colon outside quotes
+func yamlFlowEnd(text string, key bool) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			i, quote = yamlQuoted(text, i, quote)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',' || c == ']' || c == '}' || key && c == ':':
+			return i
+		}
+	}
+	return len(text)
+}
+
+// parseYAMLScalar parses a quoted or plain scalar; plain scalars may be null, booleans or numbers
+func parseYAMLScalar(text string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", text)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("invalid quoted string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	// Words like inf and NaN that Go reads as numbers are plain strings in YAML
+	if strings.IndexFunc(text, unicode.IsLetter) == strings.IndexAny(text, "eE") {
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f, nil
+		}
+	}
+	return text, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	type m = map[string]interface{}
+	type s = []interface{}
+	tests := []struct {
+		name string
+		in   string
+		want interface{}
+	}{
+		{"empty", "", nil},
+		{"only comments", "# settings\n---\n  # none\n", nil},
+		{"scalars", "a: 1\nb: 2.5\nc: true\nd: ~\ne: plain text\nf:\n",
+			m{"a": int64(1), "b": 2.5, "c": true, "d": nil, "e": "plain text", "f": nil}},
+		{"words that parse as floats", "a: inf\nb: NaN\nc: Infinity\nd: 1e3\ne: -0.5",
+			m{"a": "inf", "b": "NaN", "c": "Infinity", "d": 1000.0, "e": -0.5}},
+		{"quoted", `a: "x: y # z"` + "\n" + `b: 'it''s'` + "\n" + `c: "tab\there"` + "\n" + `d: "1"`,
+			m{"a": "x: y # z", "b": "it's", "c": "tab\there", "d": "1"}},
+		{"escaped quotes", `a: "say \"hi\" # not a comment" # comment` + "\n" + `b: "1\" # c" # d` + "\n" + `c: ["x\", y", z]`,
+			m{"a": `say "hi" # not a comment`, "b": `1" # c`, "c": s{`x", y`, "z"}}},
+		{"comments", "a: b # note\nc: d#e\n# whole line\n", m{"a": "b", "c": "d#e"}},
+		{"urls", "url: http://localhost:1188/translate\nkey:value: x", m{"url": "http://localhost:1188/translate", "key:value": "x"}},
+		{"nested", "a:\n  b:\n    c: 1\n  d: 2\ne: 3",
+			m{"a": m{"b": m{"c": int64(1)}, "d": int64(2)}, "e": int64(3)}},
+		{"sequence", "- a\n- 2\n-\n- - x\n  - y\n- b", s{"a", int64(2), nil, s{"x", "y"}, "b"}},
+		{"sequence at key indentation", "targets:\n- de\n- fr\nsource: en",
+			m{"targets": s{"de", "fr"}, "source": "en"}},
+		{"mappings in sequence", "pairs:\n  - from: en\n    to: de\n  - from: fr\n    to: es",
+			m{"pairs": s{m{"from": "en", "to": "de"}, m{"from": "fr", "to": "es"}}}},
+		{"flow", "a: [de, 'fr', \"es\"]\nb: {x: 1, y: [2, 3], z: {}}\nc: []",
+			m{"a": s{"de", "fr", "es"}, "b": m{"x": int64(1), "y": s{int64(2), int64(3)}, "z": m{}}, "c": s{}}},
+		{"flow url value", "server: {url: http://localhost:1188, token: 'a,b'}",
+			m{"server": m{"url": "http://localhost:1188", "token": "a,b"}}},
+		{"windows line endings", "a: 1\r\nb: 2\r\n", m{"a": int64(1), "b": int64(2)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"tab indentation", "a:\n\tb: 1", "line 2: tabs aren't allowed"},
+		{"duplicate key", "a: 1\na: 2", `line 2: duplicate key "a"`},
+		{"not a mapping", "a: 1\nb", `line 2: expected "key: value"`},
+		{"over-indented", "a: 1\n  b: 2", "line 2: unexpected indentation"},
+		{"dedented", "  a: 1\nb: 2", "line 2: unexpected indentation"},
+		{"unterminated flow", "a: [1, 2", "line 1: unterminated ["},
+		{"missing comma", "a: [1 2] x", "line 1: unexpected"},
+		{"flow key without value", "a: {x}", "line 1: expected ':' after key x"},
+		{"bad quotes", `a: "open`, "line 1: invalid quoted string"},
+		{"bad single quotes", "a: 'open", "line 1: invalid quoted string"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML(tt.in)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}